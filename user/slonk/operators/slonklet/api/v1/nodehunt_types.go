@@ -0,0 +1,165 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeHuntSpec defines a campaign running a diagnostic on a set of physical nodes, e.g. to
+// find hosts with silent data corruption.
+type NodeHuntSpec struct {
+	// Physical nodes in the namespace of the hunt to diagnose, by label. Empty selects all
+	// of them. The selection is made once, when the hunt starts.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Diagnostic run on each selected physical node.
+	Diagnostic NodeHuntDiagnostic `json:"diagnostic"`
+
+	// Physical nodes diagnosed at the same time. Defaults to 1. Diagnostics also count
+	// against the disruption budgets of remediations, and wait while those are exhausted.
+	// +kubebuilder:validation:Minimum=0
+	Concurrency int `json:"concurrency,omitempty"`
+	// At most this many physical nodes are selected, in name order. 0 selects up to 1000 of
+	// them, the most a hunt can track in its status.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000
+	MaxNodes int `json:"maxNodes,omitempty"`
+	// The hunt is aborted once this many physical nodes failed, e.g. because the diagnostic
+	// itself is broken. Running diagnostics finish, the remaining nodes are skipped. 0 never
+	// aborts.
+	// +kubebuilder:validation:Minimum=0
+	MaxFailures int `json:"maxFailures,omitempty"`
+
+	// When a physical node passes or fails.
+	Criteria NodeHuntCriteria `json:"criteria,omitempty"`
+
+	// Label set to passed or failed on each diagnosed physical node. Defaults to
+	// slonk.your-org.com/hunt-<name>.
+	ResultLabel string `json:"resultLabel,omitempty"`
+
+	// No new diagnostics are started while suspended, running ones finish.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// NodeHuntDiagnostic is what runs on each physical node. Exactly one must be set.
+type NodeHuntDiagnostic struct {
+	// Slurm batch job submitted on the slurm node of the physical node.
+	SlurmJob *NodeHuntSlurmJob `json:"slurmJob,omitempty"`
+	// Shell command run by the slonklet agent on the k8s node of the physical node.
+	AgentCommand string `json:"agentCommand,omitempty"`
+}
+
+type NodeHuntSlurmJob struct {
+	// Batch script, starting with a #! line.
+	Script string `json:"script"`
+	// Partition to submit to. Defaults to the slurm default partition.
+	Partition string `json:"partition,omitempty"`
+	// Time limit of the job in minutes. 0 uses the partition default.
+	// +kubebuilder:validation:Minimum=0
+	TimeLimitMinutes int `json:"timeLimitMinutes,omitempty"`
+}
+
+type NodeHuntCriteria struct {
+	// Final slurm job states passing the physical node. Defaults to COMPLETED. Agent
+	// commands pass when they exit 0.
+	PassStates []string `json:"passStates,omitempty"`
+	// A diagnostic not finished this long after it started running fails. A diagnostic
+	// still queued this long after it was submitted is cancelled, and the physical node
+	// is skipped instead. Defaults to 1h.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Failed diagnostics are retried this many times before the physical node fails.
+	// +kubebuilder:validation:Minimum=0
+	Retries int `json:"retries,omitempty"`
+}
+
+// NodeHuntStatus is the progress of the hunt.
+type NodeHuntStatus struct {
+	// Running, Suspended, Completed, Aborted, or Invalid if the spec can't be run.
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	StartTimestamp      *metav1.Time `json:"startTimestamp,omitempty"`
+	CompletionTimestamp *metav1.Time `json:"completionTimestamp,omitempty"`
+
+	// Physical nodes per node phase.
+	Total   int `json:"total,omitempty"`
+	Pending int `json:"pending,omitempty"`
+	Running int `json:"running,omitempty"`
+	Passed  int `json:"passed,omitempty"`
+	Failed  int `json:"failed,omitempty"`
+	Skipped int `json:"skipped,omitempty"`
+
+	// Per physical node results, in name order.
+	// +optional
+	// +listType=map
+	// +listMapKey=physicalNode
+	Nodes []NodeHuntNodeStatus `json:"nodes,omitempty"`
+}
+
+type NodeHuntNodeStatus struct {
+	PhysicalNode string `json:"physicalNode"`
+	// Pending, Running, Passed, Failed or Skipped.
+	Phase string `json:"phase"`
+	// Diagnostics started on the physical node, retries included.
+	Attempts int `json:"attempts,omitempty"`
+
+	SlurmNodeName string `json:"slurmNodeName,omitempty"`
+	K8sNodeName   string `json:"k8sNodeName,omitempty"`
+	// Slurm job of the latest attempt.
+	JobID int `json:"jobID,omitempty"`
+	// Agent task of the latest attempt.
+	TaskID string `json:"taskID,omitempty"`
+
+	// When the latest attempt was submitted.
+	StartTimestamp *metav1.Time `json:"startTimestamp,omitempty"`
+	// When the latest attempt was first seen running, after it left the queue.
+	RunningTimestamp    *metav1.Time `json:"runningTimestamp,omitempty"`
+	CompletionTimestamp *metav1.Time `json:"completionTimestamp,omitempty"`
+	Message             string       `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.total`
+//+kubebuilder:printcolumn:name="Running",type=integer,JSONPath=`.status.running`
+//+kubebuilder:printcolumn:name="Passed",type=integer,JSONPath=`.status.passed`
+//+kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// NodeHunt is the Schema for the nodehunts API
+type NodeHunt struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeHuntSpec   `json:"spec,omitempty"`
+	Status NodeHuntStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NodeHuntList contains a list of NodeHunt
+type NodeHuntList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeHunt `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeHunt{}, &NodeHuntList{})
+}
@@ -32,16 +32,70 @@ type PhysicalNodeSpec struct {
 	SlurmNodeSpec SlurmNodeSpec `json:"slurmNodeSpec"`
 	K8sNodeSpec   K8sNodeSpec   `json:"k8sNodeSpec"`
 	Manual        bool          `json:"manual,omitempty"`
+
+	// Who manually manages the physical node, why and until when. Only meaningful while
+	// Manual is set.
+	ManualOverride *ManualOverride `json:"manualOverride,omitempty"`
+}
+
+// ManualOverride describes a manual takeover of a physical node from the controller.
+type ManualOverride struct {
+	// Person or team responsible for the override.
+	Owner string `json:"owner,omitempty"`
+	// Ticket tracking the override, e.g. a bug or incident link.
+	Ticket string `json:"ticket,omitempty"`
+	Notes  string `json:"notes,omitempty"`
+
+	StartTimestamp metav1.Time `json:"startTimestamp,omitempty"`
+	// When the override expires, never if unset.
+	ExpirationTimestamp *metav1.Time `json:"expirationTimestamp,omitempty"`
+	// What happens once the override expires. Revert returns the physical node to
+	// automatic management, Alert keeps the override and emits warning events. Defaults to
+	// Alert.
+	// +kubebuilder:validation:Enum=Revert;Alert
+	OnExpiry string `json:"onExpiry,omitempty"`
 }
 
 // PhysicalNodeStatus defines the observed state of PhysicalNode
 type PhysicalNodeStatus struct {
 	// Observed state of cluster.
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Latest observations of the physical node, see CONDITION_* in the controller.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
 	SlurmNodeStatus        SlurmNodeStatus   `json:"slurmNodeStatus,omitempty"`
 	SlurmNodeStatusHistory []SlurmNodeStatus `json:"slurmNodeStatusHistory,omitempty"`
 	K8sNodeStatus          K8sNodeStatus     `json:"k8sNodeStatus,omitempty"`
 	K8sNodeStatusHistory   []K8sNodeStatus   `json:"k8sNodeStatusHistory,omitempty"`
+
+	// Where the host sits in the cluster, last seen on its k8s node.
+	Topology *Topology `json:"topology,omitempty"`
+
+	// Hardware of the host, last reported by the node-local slonklet agent.
+	Inventory *HardwareInventory `json:"inventory,omitempty"`
+
+	// Progress of draining the slurm node before its pod is removed or its host rebooted.
+	SlurmDrain *SlurmDrainStatus `json:"slurmDrain,omitempty"`
+
+	// Progress of the latest reboot of the host.
+	Reboot *RebootStatus `json:"reboot,omitempty"`
+
+	// Set while a running slurm pod on the host has no slurm node registered with slurmctld.
+	UnregisteredSlurmPod *UnregisteredSlurmPodStatus `json:"unregisteredSlurmPod,omitempty"`
+
+	// Set while the controller fails to write the physical node during sync.
+	SyncFailure *SyncFailureStatus `json:"syncFailure,omitempty"`
+
+	// Most recent GCP maintenance episodes of the host, newest first.
+	MaintenanceEpisodes []MaintenanceEpisode `json:"maintenanceEpisodes,omitempty"`
+	// Total number of GCP maintenance episodes seen on the host.
+	MaintenanceCount int `json:"maintenanceCount,omitempty"`
 }
 
 type SlurmNodeSpec struct {
@@ -49,6 +103,8 @@ type SlurmNodeSpec struct {
 
 	Reason    string      `json:"reason,omitempty"`
 	Timestamp metav1.Time `json:"timestamp,omitempty"`
+	// User who last changed the goal state or reason, stamped by the mutating webhook.
+	Actor string `json:"actor,omitempty"`
 }
 
 func (s *SlurmNodeSpec) IsEqual(s2 SlurmNodeSpec) bool {
@@ -109,6 +165,8 @@ type K8sNodeSpec struct {
 
 	Reason    string      `json:"reason,omitempty"`
 	Timestamp metav1.Time `json:"timestamp,omitempty"`
+	// User who last changed the goal state or reason, stamped by the mutating webhook.
+	Actor string `json:"actor,omitempty"`
 }
 
 func (s *K8sNodeSpec) IsEqual(s2 K8sNodeSpec) bool {
@@ -153,6 +211,149 @@ func (s *K8sNodeStatus) IsEqual(s2 K8sNodeStatus) bool {
 	return true
 }
 
+// SlurmDrainStatus is the progress of draining a slurm node and waiting for its running
+// jobs before the slurm pod is removed.
+type SlurmDrainStatus struct {
+	Phase         string `json:"phase"`
+	SlurmNodeName string `json:"slurmNodeName,omitempty"`
+	// Lifecycle taint that caused the drain.
+	Reason string `json:"reason,omitempty"`
+
+	// Jobs still running on the slurm node.
+	RunningJobs []int `json:"runningJobs,omitempty"`
+	// Jobs requeued after the drain deadline passed.
+	RequeuedJobs []int  `json:"requeuedJobs,omitempty"`
+	Message      string `json:"message,omitempty"`
+
+	StartTimestamp metav1.Time `json:"startTimestamp"`
+	// Latest deadline of the running jobs, based on their partitions.
+	Deadline  *metav1.Time `json:"deadline,omitempty"`
+	Timestamp metav1.Time  `json:"timestamp,omitempty"`
+}
+
+// RebootStatus tracks a reboot of the host requested for a reboot taint. The reboot is
+// complete once the slurm node reports a new boot time and is healthy again.
+type RebootStatus struct {
+	Phase string `json:"phase"`
+	// How the reboot was requested, "scontrol" or "agent".
+	Method        string `json:"method,omitempty"`
+	SlurmNodeName string `json:"slurmNodeName,omitempty"`
+	// Task ID returned by the node-local slonklet agent.
+	AgentTaskID string `json:"agentTaskID,omitempty"`
+
+	// Boot times reported by slurm, in seconds since epoch.
+	PreviousBootTime int64 `json:"previousBootTime,omitempty"`
+	BootTime         int64 `json:"bootTime,omitempty"`
+
+	// Number of reboots requested for the current taint.
+	Attempts int    `json:"attempts,omitempty"`
+	Message  string `json:"message,omitempty"`
+
+	RequestTimestamp    metav1.Time  `json:"requestTimestamp"`
+	CompletionTimestamp *metav1.Time `json:"completionTimestamp,omitempty"`
+}
+
+// UnregisteredSlurmPodStatus tracks a running slurm pod whose slurmd never registered with
+// slurmctld.
+type UnregisteredSlurmPodStatus struct {
+	PodName     string `json:"podName"`
+	PodUID      string `json:"podUID,omitempty"`
+	K8sNodeName string `json:"k8sNodeName,omitempty"`
+
+	// When the current pod was first seen running without a slurm node.
+	SinceTimestamp metav1.Time `json:"sinceTimestamp"`
+	// Number of times slonklet restarted the pod because it didn't register.
+	Restarts             int          `json:"restarts,omitempty"`
+	LastRestartTimestamp *metav1.Time `json:"lastRestartTimestamp,omitempty"`
+	// Whether the k8s node was tainted to be drained after the restarts didn't help.
+	Escalated bool `json:"escalated,omitempty"`
+}
+
+// Topology locates a host in the cluster, so that correlated failures can be reasoned about.
+// Each level is read from k8s node labels or annotations, see the topology config.
+type Topology struct {
+	Zone            string `json:"zone,omitempty"`
+	Nodepool        string `json:"nodepool,omitempty"`
+	Rack            string `json:"rack,omitempty"`
+	PlacementPolicy string `json:"placementPolicy,omitempty"`
+	NVLinkDomain    string `json:"nvlinkDomain,omitempty"`
+	// Leaf switch of the slurm node in the slurm topology.conf.
+	Switch string `json:"switch,omitempty"`
+}
+
+// HardwareInventory describes the hardware of a host, collected by the node-local slonklet
+// agent from nvidia-smi and /proc.
+type HardwareInventory struct {
+	DriverVersion string         `json:"driverVersion,omitempty"`
+	CUDAVersion   string         `json:"cudaVersion,omitempty"`
+	GPUs          []GPUInventory `json:"gpus,omitempty"`
+
+	CPUModel      string `json:"cpuModel,omitempty"`
+	CPUCount      int    `json:"cpuCount,omitempty"`
+	MemoryBytes   int64  `json:"memoryBytes,omitempty"`
+	KernelVersion string `json:"kernelVersion,omitempty"`
+
+	// When the agent collected the inventory. The status only follows changes of the
+	// hardware, so this is when the current hardware was first reported.
+	Timestamp metav1.Time `json:"timestamp,omitempty"`
+}
+
+// IsEqual returns whether both inventories describe the same hardware, whenever collected.
+func (h *HardwareInventory) IsEqual(h2 *HardwareInventory) bool {
+	if h == nil || h2 == nil {
+		return h == h2
+	}
+	if h.DriverVersion != h2.DriverVersion || h.CUDAVersion != h2.CUDAVersion ||
+		h.CPUModel != h2.CPUModel || h.CPUCount != h2.CPUCount ||
+		h.MemoryBytes != h2.MemoryBytes || h.KernelVersion != h2.KernelVersion ||
+		len(h.GPUs) != len(h2.GPUs) {
+		return false
+	}
+	for i := range h.GPUs {
+		if h.GPUs[i] != h2.GPUs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type GPUInventory struct {
+	// Minor number of the device, i.e. N in /dev/nvidiaN.
+	Index        int    `json:"index"`
+	PCIBusID     string `json:"pciBusID,omitempty"`
+	ProductName  string `json:"productName,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+	VBIOSVersion string `json:"vbiosVersion,omitempty"`
+	MemoryMiB    int    `json:"memoryMiB,omitempty"`
+}
+
+// SyncFailureStatus counts the consecutive failures to write an object during sync. It is
+// cleared by the next successful write.
+type SyncFailureStatus struct {
+	Count   int    `json:"count"`
+	Message string `json:"message,omitempty"`
+
+	FirstTimestamp metav1.Time `json:"firstTimestamp"`
+	LastTimestamp  metav1.Time `json:"lastTimestamp"`
+}
+
+// MaintenanceEpisode is a period during which the k8s node of the host carried a GCP
+// maintenance taint.
+type MaintenanceEpisode struct {
+	Taint         string `json:"taint"`
+	K8sNodeName   string `json:"k8sNodeName,omitempty"`
+	SlurmNodeName string `json:"slurmNodeName,omitempty"`
+
+	// Whether the slurm node was drained for the maintenance.
+	Drained bool `json:"drained,omitempty"`
+	// Jobs that were signaled to checkpoint.
+	SignaledJobs []int `json:"signaledJobs,omitempty"`
+
+	StartTimestamp metav1.Time  `json:"startTimestamp"`
+	EndTimestamp   *metav1.Time `json:"endTimestamp,omitempty"`
+}
+
 // EventRecord is a record of an event that's processed or emitted by the controller.
 type EventRecord struct {
 	Event corev1.Event `json:"event,omitempty"`
@@ -167,6 +368,13 @@ func (e *EventRecord) IsFromEvent(event v1.Event) bool {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Slurm Goal",type=string,JSONPath=`.spec.slurmNodeSpec.goalState`
+//+kubebuilder:printcolumn:name="K8s Goal",type=string,JSONPath=`.spec.k8sNodeSpec.goalState`
+//+kubebuilder:printcolumn:name="Slurm State",type=string,JSONPath=`.status.slurmNodeStatus.state`
+//+kubebuilder:printcolumn:name="Slurm Node",type=string,JSONPath=`.status.slurmNodeStatus.name`,priority=1
+//+kubebuilder:printcolumn:name="K8s Node",type=string,JSONPath=`.status.k8sNodeStatus.name`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // PhysicalNode is the Schema for the physicalnodes API
 type PhysicalNode struct {
@@ -176,6 +384,8 @@ type PhysicalNode struct {
 	Spec   PhysicalNodeSpec   `json:"spec,omitempty"`
 	Status PhysicalNodeStatus `json:"status,omitempty"`
 
+	// Deprecated: events are emitted through the event recorder and no longer recorded
+	// here.
 	EventRecords []EventRecord `json:"eventRecords,omitempty"`
 }
 
@@ -0,0 +1,219 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Goal states understood by the controller, see GoalState* in the controller.
+var validGoalStates = []string{"init", "up", "drain", "down"}
+
+// Goal states that take the node out of service and need a reason.
+var goalStatesRequiringReason = []string{"drain", "down"}
+
+// SetupWebhookWithManager registers the PhysicalNode webhooks with the manager. The
+// conversion webhook is served at /convert once another version implements conversion.
+func (r *PhysicalNode) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&physicalNodeDefaulter{}).
+		WithValidator(&physicalNodeValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-slonk-your-org-com-v1-physicalnode,mutating=true,failurePolicy=fail,sideEffects=None,groups=slonk.your-org.com,resources=physicalnodes,verbs=create;update,versions=v1,name=mphysicalnode.kb.io,admissionReviewVersions=v1
+
+// physicalNodeDefaulter stamps the timestamp and actor of goal state changes, marks the
+// physical node as manually managed when a human changes a goal state, and fills in the
+// start and owner of manual overrides.
+type physicalNodeDefaulter struct{}
+
+var _ admission.CustomDefaulter = &physicalNodeDefaulter{}
+
+func (d *physicalNodeDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	physicalNode, ok := obj.(*PhysicalNode)
+	if !ok {
+		return fmt.Errorf("expected a PhysicalNode but got a %T", obj)
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get admission request: %w", err)
+	}
+
+	oldPhysicalNode := &PhysicalNode{}
+	if len(req.OldObject.Raw) > 0 {
+		if err := json.Unmarshal(req.OldObject.Raw, oldPhysicalNode); err != nil {
+			return fmt.Errorf("decode old physical node: %w", err)
+		}
+	}
+
+	actor := req.UserInfo.Username
+	now := metav1.Now()
+	slurmChanged := defaultGoalState(&physicalNode.Spec.SlurmNodeSpec.GoalState, &physicalNode.Spec.SlurmNodeSpec.Reason,
+		&physicalNode.Spec.SlurmNodeSpec.Timestamp, &physicalNode.Spec.SlurmNodeSpec.Actor,
+		oldPhysicalNode.Spec.SlurmNodeSpec.GoalState, oldPhysicalNode.Spec.SlurmNodeSpec.Reason,
+		oldPhysicalNode.Spec.SlurmNodeSpec.Timestamp, oldPhysicalNode.Spec.SlurmNodeSpec.Actor, actor, now)
+	k8sChanged := defaultGoalState(&physicalNode.Spec.K8sNodeSpec.GoalState, &physicalNode.Spec.K8sNodeSpec.Reason,
+		&physicalNode.Spec.K8sNodeSpec.Timestamp, &physicalNode.Spec.K8sNodeSpec.Actor,
+		oldPhysicalNode.Spec.K8sNodeSpec.GoalState, oldPhysicalNode.Spec.K8sNodeSpec.Reason,
+		oldPhysicalNode.Spec.K8sNodeSpec.Timestamp, oldPhysicalNode.Spec.K8sNodeSpec.Actor, actor, now)
+
+	// A human changing a goal state takes over the node from the controller, unless the
+	// same edit sets Manual explicitly. Returning the slurm node to up, e.g. an undrain,
+	// leaves the node to the controller.
+	slurmTakenOver := slurmChanged && physicalNode.Spec.SlurmNodeSpec.GoalState != "up"
+	if (slurmTakenOver || k8sChanged) && isHumanUser(actor) && physicalNode.Spec.Manual == oldPhysicalNode.Spec.Manual {
+		physicalNode.Spec.Manual = true
+	}
+
+	// The override starts when Manual is set and belongs to whoever set it, unless given.
+	if !physicalNode.Spec.Manual {
+		physicalNode.Spec.ManualOverride = nil
+	} else {
+		if physicalNode.Spec.ManualOverride == nil {
+			physicalNode.Spec.ManualOverride = &ManualOverride{}
+		}
+		override := physicalNode.Spec.ManualOverride
+		if !oldPhysicalNode.Spec.Manual {
+			override.StartTimestamp = now
+		} else if override.StartTimestamp.IsZero() && oldPhysicalNode.Spec.ManualOverride != nil {
+			override.StartTimestamp = oldPhysicalNode.Spec.ManualOverride.StartTimestamp
+		}
+		if override.Owner == "" && isHumanUser(actor) {
+			override.Owner = actor
+		}
+	}
+	return nil
+}
+
+// defaultGoalState stamps the timestamp and actor of a changed goal state, and carries over
+// the old ones otherwise. Returns whether the goal state or reason changed.
+func defaultGoalState(
+	goalState *string, reason *string, timestamp *metav1.Time, actor *string,
+	oldGoalState string, oldReason string, oldTimestamp metav1.Time, oldActor string,
+	requestActor string, now metav1.Time,
+) bool {
+	if *goalState == oldGoalState && *reason == oldReason {
+		if timestamp.IsZero() {
+			*timestamp = oldTimestamp
+		}
+		if *actor == "" {
+			*actor = oldActor
+		}
+		return false
+	}
+	*timestamp = now
+	*actor = requestActor
+	return true
+}
+
+// isHumanUser returns whether the user is a person rather than a service account, node or
+// other system component.
+func isHumanUser(username string) bool {
+	return username != "" && !strings.HasPrefix(username, "system:")
+}
+
+//+kubebuilder:webhook:path=/validate-slonk-your-org-com-v1-physicalnode,mutating=false,failurePolicy=fail,sideEffects=None,groups=slonk.your-org.com,resources=physicalnodes,verbs=create;update,versions=v1,name=vphysicalnode.kb.io,admissionReviewVersions=v1
+
+// physicalNodeValidator rejects goal states the controller doesn't understand, and
+// out-of-service goal states without a reason.
+type physicalNodeValidator struct{}
+
+var _ admission.CustomValidator = &physicalNodeValidator{}
+
+func (v *physicalNodeValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	physicalNode, ok := obj.(*PhysicalNode)
+	if !ok {
+		return nil, fmt.Errorf("expected a PhysicalNode but got a %T", obj)
+	}
+	return nil, validatePhysicalNode(physicalNode, nil)
+}
+
+func (v *physicalNodeValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldPhysicalNode, ok := oldObj.(*PhysicalNode)
+	if !ok {
+		return nil, fmt.Errorf("expected a PhysicalNode but got a %T", oldObj)
+	}
+	physicalNode, ok := newObj.(*PhysicalNode)
+	if !ok {
+		return nil, fmt.Errorf("expected a PhysicalNode but got a %T", newObj)
+	}
+	return nil, validatePhysicalNode(physicalNode, oldPhysicalNode)
+}
+
+func (v *physicalNodeValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validatePhysicalNode validates the goal states that changed from the old physical node,
+// so that existing objects with legacy values can still be updated otherwise.
+func validatePhysicalNode(physicalNode *PhysicalNode, oldPhysicalNode *PhysicalNode) error {
+	if oldPhysicalNode == nil {
+		oldPhysicalNode = &PhysicalNode{}
+	}
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+	if physicalNode.Spec.SlurmNodeSpec.GoalState != oldPhysicalNode.Spec.SlurmNodeSpec.GoalState ||
+		physicalNode.Spec.SlurmNodeSpec.Reason != oldPhysicalNode.Spec.SlurmNodeSpec.Reason {
+		allErrs = append(allErrs, validateGoalState(specPath.Child("slurmNodeSpec"),
+			physicalNode.Spec.SlurmNodeSpec.GoalState, physicalNode.Spec.SlurmNodeSpec.Reason)...)
+	}
+	if physicalNode.Spec.K8sNodeSpec.GoalState != oldPhysicalNode.Spec.K8sNodeSpec.GoalState ||
+		physicalNode.Spec.K8sNodeSpec.Reason != oldPhysicalNode.Spec.K8sNodeSpec.Reason {
+		allErrs = append(allErrs, validateGoalState(specPath.Child("k8sNodeSpec"),
+			physicalNode.Spec.K8sNodeSpec.GoalState, physicalNode.Spec.K8sNodeSpec.Reason)...)
+	}
+	if override := physicalNode.Spec.ManualOverride; override != nil && override.ExpirationTimestamp != nil &&
+		!override.StartTimestamp.IsZero() && !override.ExpirationTimestamp.After(override.StartTimestamp.Time) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("manualOverride", "expirationTimestamp"),
+			override.ExpirationTimestamp.String(), "must be after the start of the override"))
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("PhysicalNode").GroupKind(), physicalNode.Name, allErrs)
+}
+
+func validateGoalState(path *field.Path, goalState string, reason string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if !containsString(validGoalStates, goalState) {
+		allErrs = append(allErrs, field.NotSupported(path.Child("goalState"), goalState, validGoalStates))
+	} else if containsString(goalStatesRequiringReason, goalState) && strings.TrimSpace(reason) == "" {
+		allErrs = append(allErrs, field.Required(path.Child("reason"), fmt.Sprintf("a reason is required for goal state %q", goalState)))
+	}
+	return allErrs
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestPhysicalNodeDefaulter(t *testing.T) {
+	oldTimestamp := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	oldPhysicalNode := &PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: "slurm"},
+		Spec: PhysicalNodeSpec{
+			SlurmNodeSpec: SlurmNodeSpec{GoalState: "up", Timestamp: oldTimestamp, Actor: "system:serviceaccount:slurm:default"},
+			K8sNodeSpec:   K8sNodeSpec{GoalState: "up", Timestamp: oldTimestamp},
+		},
+	}
+	oldRaw, err := json.Marshal(oldPhysicalNode)
+	assert.NoError(t, err)
+	defaultFor := func(username string, physicalNode *PhysicalNode) {
+		ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Update,
+				UserInfo:  authenticationv1.UserInfo{Username: username},
+				OldObject: runtime.RawExtension{Raw: oldRaw},
+			},
+		})
+		assert.NoError(t, (&physicalNodeDefaulter{}).Default(ctx, physicalNode))
+	}
+
+	// A human drain is stamped and taken over from the controller.
+	physicalNode := oldPhysicalNode.DeepCopy()
+	physicalNode.Spec.SlurmNodeSpec.GoalState = "drain"
+	physicalNode.Spec.SlurmNodeSpec.Reason = "bad gpu"
+	defaultFor("alice@example.com", physicalNode)
+	assert.Equal(t, "alice@example.com", physicalNode.Spec.SlurmNodeSpec.Actor)
+	assert.True(t, physicalNode.Spec.SlurmNodeSpec.Timestamp.After(oldTimestamp.Time))
+	assert.True(t, physicalNode.Spec.Manual)
+	assert.True(t, oldTimestamp.Equal(&physicalNode.Spec.K8sNodeSpec.Timestamp))
+	assert.Equal(t, "alice@example.com", physicalNode.Spec.ManualOverride.Owner)
+	assert.False(t, physicalNode.Spec.ManualOverride.StartTimestamp.IsZero())
+
+	// A human explicitly handing the node back to the controller keeps Manual off.
+	physicalNode = oldPhysicalNode.DeepCopy()
+	physicalNode.Spec.SlurmNodeSpec.Reason = "recovered"
+	physicalNode.Spec.Manual = false
+	oldPhysicalNode.Spec.Manual = true
+	oldRaw, err = json.Marshal(oldPhysicalNode)
+	assert.NoError(t, err)
+	defaultFor("alice@example.com", physicalNode)
+	assert.False(t, physicalNode.Spec.Manual)
+	assert.Nil(t, physicalNode.Spec.ManualOverride)
+	oldPhysicalNode.Spec.Manual = false
+	oldRaw, err = json.Marshal(oldPhysicalNode)
+	assert.NoError(t, err)
+
+	// A human undrain of a node drained by the controller doesn't take it over.
+	oldPhysicalNode.Spec.SlurmNodeSpec.GoalState = "drain"
+	oldPhysicalNode.Spec.SlurmNodeSpec.Reason = "slonklet: slonk.your-org.com/slurm-goal-state:down"
+	oldRaw, err = json.Marshal(oldPhysicalNode)
+	assert.NoError(t, err)
+	physicalNode = oldPhysicalNode.DeepCopy()
+	physicalNode.Spec.SlurmNodeSpec = SlurmNodeSpec{GoalState: "up", Timestamp: metav1.Now()}
+	defaultFor("alice@example.com", physicalNode)
+	assert.Equal(t, "alice@example.com", physicalNode.Spec.SlurmNodeSpec.Actor)
+	assert.False(t, physicalNode.Spec.Manual)
+	assert.Nil(t, physicalNode.Spec.ManualOverride)
+	oldPhysicalNode.Spec.SlurmNodeSpec = SlurmNodeSpec{GoalState: "up", Timestamp: oldTimestamp, Actor: "system:serviceaccount:slurm:default"}
+	oldRaw, err = json.Marshal(oldPhysicalNode)
+	assert.NoError(t, err)
+
+	// A controller change is stamped, but doesn't flip Manual.
+	physicalNode = oldPhysicalNode.DeepCopy()
+	physicalNode.Spec.SlurmNodeSpec.GoalState = "drain"
+	physicalNode.Spec.SlurmNodeSpec.Reason = "maintenance"
+	defaultFor("system:serviceaccount:slurm:slurm-sa", physicalNode)
+	assert.Equal(t, "system:serviceaccount:slurm:slurm-sa", physicalNode.Spec.SlurmNodeSpec.Actor)
+	assert.False(t, physicalNode.Spec.Manual)
+
+	// Unrelated edits keep the actor, even if the writer dropped it.
+	physicalNode = oldPhysicalNode.DeepCopy()
+	physicalNode.Spec.SlurmNodeSpec.Actor = ""
+	physicalNode.Labels = map[string]string{"foo": "bar"}
+	defaultFor("alice@example.com", physicalNode)
+	assert.Equal(t, "system:serviceaccount:slurm:default", physicalNode.Spec.SlurmNodeSpec.Actor)
+	assert.False(t, physicalNode.Spec.Manual)
+}
+
+func TestPhysicalNodeValidator(t *testing.T) {
+	validator := &physicalNodeValidator{}
+	oldPhysicalNode := &PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: "slurm"},
+		Spec: PhysicalNodeSpec{
+			SlurmNodeSpec: SlurmNodeSpec{GoalState: "up"},
+			K8sNodeSpec:   K8sNodeSpec{GoalState: "up"},
+		},
+	}
+
+	_, err := validator.ValidateCreate(context.Background(), oldPhysicalNode)
+	assert.NoError(t, err)
+
+	// Typo in the goal state.
+	physicalNode := oldPhysicalNode.DeepCopy()
+	physicalNode.Spec.SlurmNodeSpec.GoalState = "drained"
+	_, err = validator.ValidateUpdate(context.Background(), oldPhysicalNode, physicalNode)
+	assert.True(t, apierrors.IsInvalid(err))
+	assert.Contains(t, err.Error(), "spec.slurmNodeSpec.goalState")
+
+	// Drain without a reason.
+	physicalNode.Spec.SlurmNodeSpec.GoalState = "drain"
+	_, err = validator.ValidateUpdate(context.Background(), oldPhysicalNode, physicalNode)
+	assert.True(t, apierrors.IsInvalid(err))
+	assert.Contains(t, err.Error(), "spec.slurmNodeSpec.reason")
+
+	physicalNode.Spec.SlurmNodeSpec.Reason = "bad gpu"
+	_, err = validator.ValidateUpdate(context.Background(), oldPhysicalNode, physicalNode)
+	assert.NoError(t, err)
+
+	// Overrides can't expire before they start.
+	start := metav1.Now()
+	expiration := metav1.NewTime(start.Add(-time.Minute))
+	physicalNode.Spec.Manual = true
+	physicalNode.Spec.ManualOverride = &ManualOverride{StartTimestamp: start, ExpirationTimestamp: &expiration}
+	_, err = validator.ValidateUpdate(context.Background(), oldPhysicalNode, physicalNode)
+	assert.True(t, apierrors.IsInvalid(err))
+	assert.Contains(t, err.Error(), "spec.manualOverride.expirationTimestamp")
+
+	// Legacy values are only validated once they change.
+	oldPhysicalNode.Spec.K8sNodeSpec.GoalState = ""
+	physicalNode = oldPhysicalNode.DeepCopy()
+	physicalNode.Labels = map[string]string{"foo": "bar"}
+	_, err = validator.ValidateUpdate(context.Background(), oldPhysicalNode, physicalNode)
+	assert.NoError(t, err)
+}
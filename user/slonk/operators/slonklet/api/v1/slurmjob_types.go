@@ -38,8 +38,19 @@ type SlurmJobStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	RestartCount int `json:"restartCount,omitempty"`
 
+	// Latest observations of the job, see CONDITION_JOB_* in the controller.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
 	SlurmJobRunCurrentStatus SlurmJobRunStatus   `json:"slurmJobRunCurrentStatus,omitempty"`
 	SlurmJobRunStatusHistory []SlurmJobRunStatus `json:"slurmJobRunStatusHistory,omitempty"`
+
+	// Set while the controller fails to write the job during sync.
+	SyncFailure *SyncFailureStatus `json:"syncFailure,omitempty"`
 }
 
 type SlurmJobRunStatus struct {
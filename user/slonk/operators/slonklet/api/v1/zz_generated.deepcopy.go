@@ -22,6 +22,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -81,6 +82,285 @@ func (in *K8sNodeStatus) DeepCopy() *K8sNodeStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GPUInventory) DeepCopyInto(out *GPUInventory) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GPUInventory.
+func (in *GPUInventory) DeepCopy() *GPUInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(GPUInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HardwareInventory) DeepCopyInto(out *HardwareInventory) {
+	*out = *in
+	if in.GPUs != nil {
+		in, out := &in.GPUs, &out.GPUs
+		*out = make([]GPUInventory, len(*in))
+		copy(*out, *in)
+	}
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HardwareInventory.
+func (in *HardwareInventory) DeepCopy() *HardwareInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(HardwareInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceEpisode) DeepCopyInto(out *MaintenanceEpisode) {
+	*out = *in
+	if in.SignaledJobs != nil {
+		in, out := &in.SignaledJobs, &out.SignaledJobs
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	in.StartTimestamp.DeepCopyInto(&out.StartTimestamp)
+	if in.EndTimestamp != nil {
+		in, out := &in.EndTimestamp, &out.EndTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceEpisode.
+func (in *MaintenanceEpisode) DeepCopy() *MaintenanceEpisode {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceEpisode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManualOverride) DeepCopyInto(out *ManualOverride) {
+	*out = *in
+	in.StartTimestamp.DeepCopyInto(&out.StartTimestamp)
+	if in.ExpirationTimestamp != nil {
+		in, out := &in.ExpirationTimestamp, &out.ExpirationTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManualOverride.
+func (in *ManualOverride) DeepCopy() *ManualOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(ManualOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHunt) DeepCopyInto(out *NodeHunt) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHunt.
+func (in *NodeHunt) DeepCopy() *NodeHunt {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHunt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeHunt) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntCriteria) DeepCopyInto(out *NodeHuntCriteria) {
+	*out = *in
+	if in.PassStates != nil {
+		in, out := &in.PassStates, &out.PassStates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntCriteria.
+func (in *NodeHuntCriteria) DeepCopy() *NodeHuntCriteria {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntCriteria)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntDiagnostic) DeepCopyInto(out *NodeHuntDiagnostic) {
+	*out = *in
+	if in.SlurmJob != nil {
+		in, out := &in.SlurmJob, &out.SlurmJob
+		*out = new(NodeHuntSlurmJob)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntDiagnostic.
+func (in *NodeHuntDiagnostic) DeepCopy() *NodeHuntDiagnostic {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntDiagnostic)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntList) DeepCopyInto(out *NodeHuntList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NodeHunt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntList.
+func (in *NodeHuntList) DeepCopy() *NodeHuntList {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NodeHuntList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntNodeStatus) DeepCopyInto(out *NodeHuntNodeStatus) {
+	*out = *in
+	if in.StartTimestamp != nil {
+		in, out := &in.StartTimestamp, &out.StartTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.RunningTimestamp != nil {
+		in, out := &in.RunningTimestamp, &out.RunningTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTimestamp != nil {
+		in, out := &in.CompletionTimestamp, &out.CompletionTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntNodeStatus.
+func (in *NodeHuntNodeStatus) DeepCopy() *NodeHuntNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntSlurmJob) DeepCopyInto(out *NodeHuntSlurmJob) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntSlurmJob.
+func (in *NodeHuntSlurmJob) DeepCopy() *NodeHuntSlurmJob {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntSlurmJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntSpec) DeepCopyInto(out *NodeHuntSpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Diagnostic.DeepCopyInto(&out.Diagnostic)
+	in.Criteria.DeepCopyInto(&out.Criteria)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntSpec.
+func (in *NodeHuntSpec) DeepCopy() *NodeHuntSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeHuntStatus) DeepCopyInto(out *NodeHuntStatus) {
+	*out = *in
+	if in.StartTimestamp != nil {
+		in, out := &in.StartTimestamp, &out.StartTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTimestamp != nil {
+		in, out := &in.CompletionTimestamp, &out.CompletionTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeHuntNodeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeHuntStatus.
+func (in *NodeHuntStatus) DeepCopy() *NodeHuntStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeHuntStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PhysicalNode) DeepCopyInto(out *PhysicalNode) {
 	*out = *in
@@ -168,6 +448,11 @@ func (in *PhysicalNodeSpec) DeepCopyInto(out *PhysicalNodeSpec) {
 	*out = *in
 	in.SlurmNodeSpec.DeepCopyInto(&out.SlurmNodeSpec)
 	in.K8sNodeSpec.DeepCopyInto(&out.K8sNodeSpec)
+	if in.ManualOverride != nil {
+		in, out := &in.ManualOverride, &out.ManualOverride
+		*out = new(ManualOverride)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhysicalNodeSpec.
@@ -183,6 +468,13 @@ func (in *PhysicalNodeSpec) DeepCopy() *PhysicalNodeSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PhysicalNodeStatus) DeepCopyInto(out *PhysicalNodeStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	in.SlurmNodeStatus.DeepCopyInto(&out.SlurmNodeStatus)
 	if in.SlurmNodeStatusHistory != nil {
 		in, out := &in.SlurmNodeStatusHistory, &out.SlurmNodeStatusHistory
@@ -199,6 +491,43 @@ func (in *PhysicalNodeStatus) DeepCopyInto(out *PhysicalNodeStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Topology != nil {
+		in, out := &in.Topology, &out.Topology
+		*out = new(Topology)
+		**out = **in
+	}
+	if in.Inventory != nil {
+		in, out := &in.Inventory, &out.Inventory
+		*out = new(HardwareInventory)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SlurmDrain != nil {
+		in, out := &in.SlurmDrain, &out.SlurmDrain
+		*out = new(SlurmDrainStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Reboot != nil {
+		in, out := &in.Reboot, &out.Reboot
+		*out = new(RebootStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnregisteredSlurmPod != nil {
+		in, out := &in.UnregisteredSlurmPod, &out.UnregisteredSlurmPod
+		*out = new(UnregisteredSlurmPodStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SyncFailure != nil {
+		in, out := &in.SyncFailure, &out.SyncFailure
+		*out = new(SyncFailureStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaintenanceEpisodes != nil {
+		in, out := &in.MaintenanceEpisodes, &out.MaintenanceEpisodes
+		*out = make([]MaintenanceEpisode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhysicalNodeStatus.
@@ -211,6 +540,57 @@ func (in *PhysicalNodeStatus) DeepCopy() *PhysicalNodeStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RebootStatus) DeepCopyInto(out *RebootStatus) {
+	*out = *in
+	in.RequestTimestamp.DeepCopyInto(&out.RequestTimestamp)
+	if in.CompletionTimestamp != nil {
+		in, out := &in.CompletionTimestamp, &out.CompletionTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RebootStatus.
+func (in *RebootStatus) DeepCopy() *RebootStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RebootStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SlurmDrainStatus) DeepCopyInto(out *SlurmDrainStatus) {
+	*out = *in
+	if in.RunningJobs != nil {
+		in, out := &in.RunningJobs, &out.RunningJobs
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequeuedJobs != nil {
+		in, out := &in.RequeuedJobs, &out.RequeuedJobs
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	in.StartTimestamp.DeepCopyInto(&out.StartTimestamp)
+	if in.Deadline != nil {
+		in, out := &in.Deadline, &out.Deadline
+		*out = (*in).DeepCopy()
+	}
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SlurmDrainStatus.
+func (in *SlurmDrainStatus) DeepCopy() *SlurmDrainStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SlurmDrainStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SlurmJob) DeepCopyInto(out *SlurmJob) {
 	*out = *in
@@ -322,6 +702,13 @@ func (in *SlurmJobSpec) DeepCopy() *SlurmJobSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SlurmJobStatus) DeepCopyInto(out *SlurmJobStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	in.SlurmJobRunCurrentStatus.DeepCopyInto(&out.SlurmJobRunCurrentStatus)
 	if in.SlurmJobRunStatusHistory != nil {
 		in, out := &in.SlurmJobRunStatusHistory, &out.SlurmJobRunStatusHistory
@@ -330,6 +717,11 @@ func (in *SlurmJobStatus) DeepCopyInto(out *SlurmJobStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.SyncFailure != nil {
+		in, out := &in.SyncFailure, &out.SyncFailure
+		*out = new(SyncFailureStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SlurmJobStatus.
@@ -383,3 +775,55 @@ func (in *SlurmNodeStatus) DeepCopy() *SlurmNodeStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncFailureStatus) DeepCopyInto(out *SyncFailureStatus) {
+	*out = *in
+	in.FirstTimestamp.DeepCopyInto(&out.FirstTimestamp)
+	in.LastTimestamp.DeepCopyInto(&out.LastTimestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncFailureStatus.
+func (in *SyncFailureStatus) DeepCopy() *SyncFailureStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncFailureStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Topology) DeepCopyInto(out *Topology) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Topology.
+func (in *Topology) DeepCopy() *Topology {
+	if in == nil {
+		return nil
+	}
+	out := new(Topology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnregisteredSlurmPodStatus) DeepCopyInto(out *UnregisteredSlurmPodStatus) {
+	*out = *in
+	in.SinceTimestamp.DeepCopyInto(&out.SinceTimestamp)
+	if in.LastRestartTimestamp != nil {
+		in, out := &in.LastRestartTimestamp, &out.LastRestartTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnregisteredSlurmPodStatus.
+func (in *UnregisteredSlurmPodStatus) DeepCopy() *UnregisteredSlurmPodStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(UnregisteredSlurmPodStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+// ConvertTo converts this PhysicalNode to the hub version (v1).
+func (src *PhysicalNode) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*slonkv1.PhysicalNode)
+	if !ok {
+		return fmt.Errorf("unsupported hub type %T", dstRaw)
+	}
+	in := src.DeepCopy()
+
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = slonkv1.PhysicalNodeSpec{
+		SlurmNodeSpec:  in.Spec.SlurmNodeSpec,
+		K8sNodeSpec:    in.Spec.K8sNodeSpec,
+		Manual:         in.Spec.Manual,
+		ManualOverride: in.Spec.ManualOverride,
+	}
+	dst.Status = slonkv1.PhysicalNodeStatus{
+		Conditions:             in.Status.Conditions,
+		SlurmNodeStatus:        in.Status.SlurmNodeStatus,
+		SlurmNodeStatusHistory: in.Status.History.SlurmNodeStatuses,
+		K8sNodeStatus:          in.Status.K8sNodeStatus,
+		K8sNodeStatusHistory:   in.Status.History.K8sNodeStatuses,
+		Topology:               in.Status.Topology,
+		Inventory:              in.Status.Inventory,
+		SlurmDrain:             in.Status.SlurmDrain,
+		Reboot:                 in.Status.Reboot,
+		UnregisteredSlurmPod:   in.Status.UnregisteredSlurmPod,
+		SyncFailure:            in.Status.SyncFailure,
+		MaintenanceEpisodes:    in.Status.History.MaintenanceEpisodes,
+		MaintenanceCount:       in.Status.MaintenanceCount,
+	}
+	dst.EventRecords = in.Status.EventRecords
+	return nil
+}
+
+// ConvertFrom converts the hub version (v1) to this PhysicalNode.
+func (dst *PhysicalNode) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*slonkv1.PhysicalNode)
+	if !ok {
+		return fmt.Errorf("unsupported hub type %T", srcRaw)
+	}
+	in := src.DeepCopy()
+
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = PhysicalNodeSpec{
+		SlurmNodeSpec:  in.Spec.SlurmNodeSpec,
+		K8sNodeSpec:    in.Spec.K8sNodeSpec,
+		Manual:         in.Spec.Manual,
+		ManualOverride: in.Spec.ManualOverride,
+	}
+	dst.Status = PhysicalNodeStatus{
+		Conditions:           in.Status.Conditions,
+		SlurmNodeStatus:      in.Status.SlurmNodeStatus,
+		K8sNodeStatus:        in.Status.K8sNodeStatus,
+		Topology:             in.Status.Topology,
+		Inventory:            in.Status.Inventory,
+		SlurmDrain:           in.Status.SlurmDrain,
+		Reboot:               in.Status.Reboot,
+		UnregisteredSlurmPod: in.Status.UnregisteredSlurmPod,
+		SyncFailure:          in.Status.SyncFailure,
+		MaintenanceCount:     in.Status.MaintenanceCount,
+		EventRecords:         in.EventRecords,
+		History: PhysicalNodeHistory{
+			SlurmNodeStatuses:   in.Status.SlurmNodeStatusHistory,
+			K8sNodeStatuses:     in.Status.K8sNodeStatusHistory,
+			MaintenanceEpisodes: in.Status.MaintenanceEpisodes,
+		},
+	}
+	return nil
+}
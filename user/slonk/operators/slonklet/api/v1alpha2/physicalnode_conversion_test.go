@@ -0,0 +1,73 @@
+package v1alpha2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestPhysicalNodeConversionRoundTrip(t *testing.T) {
+	completion := metav1.Now()
+	hub := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: "slurm", ResourceVersion: "7"},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: "drain", Reason: "xid"},
+			K8sNodeSpec:   slonkv1.K8sNodeSpec{GoalState: "up"},
+			Manual:        true,
+			ManualOverride: &slonkv1.ManualOverride{
+				Owner:               "alice",
+				Ticket:              "INC-1",
+				StartTimestamp:      completion,
+				ExpirationTimestamp: &completion,
+				OnExpiry:            "Revert",
+			},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			Conditions:      []metav1.Condition{{Type: "SlurmRegistered", Status: metav1.ConditionTrue, Reason: "Registered"}},
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-node-1", State: []string{"IDLE", "DRAIN"}},
+			SlurmNodeStatusHistory: []slonkv1.SlurmNodeStatus{
+				{Name: "slurm-node-1", State: []string{"IDLE"}},
+			},
+			K8sNodeStatus: slonkv1.K8sNodeStatus{
+				Name:   "k8s-node-1",
+				Taints: []corev1.Taint{{Key: "a", Value: "b", Effect: corev1.TaintEffectNoSchedule}},
+			},
+			K8sNodeStatusHistory: []slonkv1.K8sNodeStatus{{Name: "k8s-node-0", Removed: true}},
+			Reboot:               &slonkv1.RebootStatus{Phase: "Completed", CompletionTimestamp: &completion},
+			MaintenanceEpisodes:  []slonkv1.MaintenanceEpisode{{Taint: "maintenance", Drained: true}},
+			MaintenanceCount:     3,
+		},
+		EventRecords: []slonkv1.EventRecord{{Event: corev1.Event{Reason: "SlonkletAutoReboot"}}},
+	}
+
+	spoke := &PhysicalNode{}
+	assert.NoError(t, spoke.ConvertFrom(hub))
+	assert.Equal(t, "abc", spoke.Name)
+	assert.Equal(t, "drain", spoke.Spec.SlurmNodeSpec.GoalState)
+	assert.Equal(t, hub.Status.SlurmNodeStatusHistory, spoke.Status.History.SlurmNodeStatuses)
+	assert.Equal(t, hub.Status.K8sNodeStatusHistory, spoke.Status.History.K8sNodeStatuses)
+	assert.Equal(t, hub.Status.MaintenanceEpisodes, spoke.Status.History.MaintenanceEpisodes)
+	assert.Equal(t, hub.EventRecords, spoke.Status.EventRecords)
+	assert.Equal(t, hub.Status.Conditions, spoke.Status.Conditions)
+
+	// Converting back is lossless.
+	converted := &slonkv1.PhysicalNode{}
+	assert.NoError(t, spoke.ConvertTo(converted))
+	assert.Equal(t, hub, converted)
+}
+
+func TestPhysicalNodeIsConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, slonkv1.AddToScheme(scheme))
+	assert.NoError(t, AddToScheme(scheme))
+
+	convertible, err := conversion.IsConvertible(scheme, &slonkv1.PhysicalNode{})
+	assert.NoError(t, err)
+	assert.True(t, convertible)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+// PhysicalNodeSpec defines the desired state of PhysicalNode
+type PhysicalNodeSpec struct {
+	SlurmNodeSpec slonkv1.SlurmNodeSpec `json:"slurmNodeSpec"`
+	K8sNodeSpec   slonkv1.K8sNodeSpec   `json:"k8sNodeSpec"`
+	Manual        bool                  `json:"manual,omitempty"`
+
+	ManualOverride *slonkv1.ManualOverride `json:"manualOverride,omitempty"`
+}
+
+// PhysicalNodeStatus defines the observed state of PhysicalNode. Unlike v1 it only holds
+// the current state, past states are grouped under History.
+type PhysicalNodeStatus struct {
+	// Latest observations of the physical node.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	SlurmNodeStatus slonkv1.SlurmNodeStatus `json:"slurmNodeStatus,omitempty"`
+	K8sNodeStatus   slonkv1.K8sNodeStatus   `json:"k8sNodeStatus,omitempty"`
+
+	// Where the host sits in the cluster, last seen on its k8s node.
+	Topology *slonkv1.Topology `json:"topology,omitempty"`
+
+	// Hardware of the host, last reported by the node-local slonklet agent.
+	Inventory *slonkv1.HardwareInventory `json:"inventory,omitempty"`
+
+	// Progress of draining the slurm node before its pod is removed or its host rebooted.
+	SlurmDrain *slonkv1.SlurmDrainStatus `json:"slurmDrain,omitempty"`
+
+	// Progress of the latest reboot of the host.
+	Reboot *slonkv1.RebootStatus `json:"reboot,omitempty"`
+
+	// Set while a running slurm pod on the host has no slurm node registered with slurmctld.
+	UnregisteredSlurmPod *slonkv1.UnregisteredSlurmPodStatus `json:"unregisteredSlurmPod,omitempty"`
+
+	// Set while the controller fails to write the physical node during sync.
+	SyncFailure *slonkv1.SyncFailureStatus `json:"syncFailure,omitempty"`
+
+	// Total number of GCP maintenance episodes seen on the host.
+	MaintenanceCount int `json:"maintenanceCount,omitempty"`
+
+	// Deprecated: events are emitted through the event recorder and no longer recorded
+	// here.
+	EventRecords []slonkv1.EventRecord `json:"eventRecords,omitempty"`
+
+	History PhysicalNodeHistory `json:"history,omitempty"`
+}
+
+// PhysicalNodeHistory holds the most recent past states of the physical node, newest
+// first. The full history is archived by the controller outside the object.
+type PhysicalNodeHistory struct {
+	SlurmNodeStatuses   []slonkv1.SlurmNodeStatus    `json:"slurmNodeStatuses,omitempty"`
+	K8sNodeStatuses     []slonkv1.K8sNodeStatus      `json:"k8sNodeStatuses,omitempty"`
+	MaintenanceEpisodes []slonkv1.MaintenanceEpisode `json:"maintenanceEpisodes,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Slurm Goal",type=string,JSONPath=`.spec.slurmNodeSpec.goalState`
+//+kubebuilder:printcolumn:name="K8s Goal",type=string,JSONPath=`.spec.k8sNodeSpec.goalState`
+//+kubebuilder:printcolumn:name="Slurm State",type=string,JSONPath=`.status.slurmNodeStatus.state`
+//+kubebuilder:printcolumn:name="Slurm Node",type=string,JSONPath=`.status.slurmNodeStatus.name`,priority=1
+//+kubebuilder:printcolumn:name="K8s Node",type=string,JSONPath=`.status.k8sNodeStatus.name`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PhysicalNode is the Schema for the physicalnodes API
+type PhysicalNode struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PhysicalNodeSpec   `json:"spec,omitempty"`
+	Status PhysicalNodeStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PhysicalNodeList contains a list of PhysicalNode
+type PhysicalNodeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PhysicalNode `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PhysicalNode{}, &PhysicalNodeList{})
+}
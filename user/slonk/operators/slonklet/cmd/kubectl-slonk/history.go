@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/controller"
+	"your-org.com/slonklet/internal/history"
+)
+
+const INFO_REQUEST_TIMEOUT = 30 * time.Second
+
+func runHistory(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk history", flag.ContinueOnError)
+	o.addFlags(fs)
+	since := fs.Duration("since", 30*24*time.Hour, "How far back to go, only with --info-url.")
+	limit := fs.Int("limit", 100, "Show at most this many of the most recent records.")
+	kinds := fs.String("kinds", "", "Comma separated record kinds to show, e.g. SlurmGoalState,Event. Empty shows all.")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+
+	physicalNode, err := o.resolvePhysicalNode(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	records, err := o.history(ctx, physicalNode, *since)
+	if err != nil {
+		return err
+	}
+	if *kinds != "" {
+		kindSet := map[string]bool{}
+		for _, kind := range strings.Split(*kinds, ",") {
+			kindSet[strings.TrimSpace(kind)] = true
+		}
+		filtered := []history.Record{}
+		for _, record := range records {
+			if kindSet[record.Kind] {
+				filtered = append(filtered, record)
+			}
+		}
+		records = filtered
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+
+	if o.output == OUTPUT_JSON {
+		return printJSON(records)
+	}
+	rows := [][]string{}
+	for _, record := range records {
+		rows = append(rows, []string{formatTime(record.Timestamp), record.Kind, describeRecord(record)})
+	}
+	return printTable([]string{"TIME", "KIND", "DETAILS"}, rows)
+}
+
+func runWhy(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk why", flag.ContinueOnError)
+	o.addFlags(fs)
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+
+	physicalNode, err := o.resolvePhysicalNode(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	records, err := o.history(ctx, physicalNode, 30*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	lines := controller.ExplainGoalState(physicalNode, records, time.Now())
+
+	if o.output == OUTPUT_JSON {
+		return printJSON(map[string]interface{}{
+			"physicalNode": physicalNode.Name,
+			"explanation":  lines,
+		})
+	}
+	fmt.Printf("Physical node %s:\n", physicalNode.Name)
+	for _, line := range lines {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
+
+// history returns the history of the physical node, oldest first, from the info server if
+// known, otherwise from the status history kept on the physical node.
+func (o *options) history(ctx context.Context, physicalNode *slonkv1.PhysicalNode, since time.Duration) ([]history.Record, error) {
+	if o.infoURL == "" {
+		return statusHistory(physicalNode)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, INFO_REQUEST_TIMEOUT)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("from", time.Now().Add(-since).Format(time.RFC3339))
+	requestURL := fmt.Sprintf("%s/history/%s?%s", strings.TrimSuffix(o.infoURL, "/"), url.PathEscape(physicalNode.Name), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create history request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("info server responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	records := []history.Record{}
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("decode history: %w", err)
+	}
+	return records, nil
+}
+
+// statusHistory turns the status history kept on the physical node into history records.
+func statusHistory(physicalNode *slonkv1.PhysicalNode) ([]history.Record, error) {
+	records := []history.Record{}
+	add := func(timestamp time.Time, kind string, data interface{}) error {
+		record, err := history.NewRecord(timestamp, physicalNode.Name, kind, data)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	}
+
+	status := physicalNode.Status
+	for _, slurmNodeStatus := range append([]slonkv1.SlurmNodeStatus{status.SlurmNodeStatus}, status.SlurmNodeStatusHistory...) {
+		if err := add(slurmNodeStatus.Timestamp.Time, history.KIND_SLURM_STATUS, slurmNodeStatus); err != nil {
+			return nil, err
+		}
+	}
+	for _, k8sNodeStatus := range append([]slonkv1.K8sNodeStatus{status.K8sNodeStatus}, status.K8sNodeStatusHistory...) {
+		if err := add(k8sNodeStatus.Timestamp.Time, history.KIND_K8S_STATUS, k8sNodeStatus); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(physicalNode.Spec.SlurmNodeSpec.Timestamp.Time, history.KIND_SLURM_GOAL_STATE, physicalNode.Spec.SlurmNodeSpec); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+	return records, nil
+}
+
+// describeRecord summarizes a history record in one line.
+func describeRecord(record history.Record) string {
+	switch record.Kind {
+	case history.KIND_SLURM_STATUS:
+		slurmNodeStatus := slonkv1.SlurmNodeStatus{}
+		if err := json.Unmarshal(record.Data, &slurmNodeStatus); err == nil {
+			if slurmNodeStatus.Removed {
+				return "slurm node removed"
+			}
+			return describeSlurmNode(slurmNodeStatus)
+		}
+	case history.KIND_K8S_STATUS:
+		k8sNodeStatus := slonkv1.K8sNodeStatus{}
+		if err := json.Unmarshal(record.Data, &k8sNodeStatus); err == nil {
+			if k8sNodeStatus.Removed {
+				return "k8s node removed"
+			}
+			return describeK8sNode(k8sNodeStatus)
+		}
+	case history.KIND_SLURM_GOAL_STATE:
+		slurmNodeSpec := slonkv1.SlurmNodeSpec{}
+		if err := json.Unmarshal(record.Data, &slurmNodeSpec); err == nil {
+			return describeGoalState(slurmNodeSpec.GoalState, slurmNodeSpec.Reason, slurmNodeSpec.Actor)
+		}
+	case history.KIND_K8S_GOAL_STATE:
+		k8sNodeSpec := slonkv1.K8sNodeSpec{}
+		if err := json.Unmarshal(record.Data, &k8sNodeSpec); err == nil {
+			return describeGoalState(k8sNodeSpec.GoalState, k8sNodeSpec.Reason, k8sNodeSpec.Actor)
+		}
+	}
+	return string(record.Data)
+}
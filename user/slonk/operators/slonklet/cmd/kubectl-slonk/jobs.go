@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/controller"
+)
+
+// JobNode is a physical node a slurm job ran on, with its current state.
+type JobNode struct {
+	RunID              int    `json:"runID"`
+	SlurmNodeName      string `json:"slurmNodeName"`
+	K8sNodeName        string `json:"k8sNodeName,omitempty"`
+	PhysicalNodeName   string `json:"physicalNodeName,omitempty"`
+	AccumulatedRuntime string `json:"accumulatedRuntime,omitempty"`
+	SlurmGoalState     string `json:"slurmGoalState,omitempty"`
+	K8sNodeReady       string `json:"k8sNodeReady,omitempty"`
+}
+
+func runJobNodes(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk job nodes", flag.ContinueOnError)
+	o.addFlags(fs)
+	allRuns := fs.Bool("all-runs", false, "Include the nodes of previous runs of a restarted job.")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return fmt.Errorf("invalid job ID %q", args[0])
+	}
+
+	k8sClient, err := o.client()
+	if err != nil {
+		return err
+	}
+	slurmJob := &slonkv1.SlurmJob{}
+	if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: o.namespace, Name: args[0]}, slurmJob); err != nil {
+		return fmt.Errorf("get slurm job %s: %w", args[0], err)
+	}
+	physicalNodeMap, err := o.listPhysicalNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	runs := []slonkv1.SlurmJobRunStatus{slurmJob.Status.SlurmJobRunCurrentStatus}
+	if *allRuns {
+		runs = append(runs, slurmJob.Status.SlurmJobRunStatusHistory...)
+	}
+	jobNodes := []JobNode{}
+	for _, run := range runs {
+		for slurmNodeName, snapshot := range run.PhysicalNodeSnapshots {
+			jobNode := JobNode{RunID: run.RunID, SlurmNodeName: slurmNodeName}
+			if snapshot != nil {
+				jobNode.K8sNodeName = snapshot.K8sNodeName
+				jobNode.PhysicalNodeName = snapshot.PhysicalNodeName
+				if snapshot.AccumulatedRuntime.Duration > 0 {
+					jobNode.AccumulatedRuntime = snapshot.AccumulatedRuntime.Duration.String()
+				}
+			}
+			if physicalNode, ok := physicalNodeMap[jobNode.PhysicalNodeName]; ok {
+				jobNode.SlurmGoalState = describeGoalState(physicalNode.Spec.SlurmNodeSpec.GoalState, physicalNode.Spec.SlurmNodeSpec.Reason, "")
+				jobNode.K8sNodeReady = isConditionTrue(physicalNode, controller.CONDITION_K8S_NODE_READY)
+			}
+			jobNodes = append(jobNodes, jobNode)
+		}
+	}
+	sort.Slice(jobNodes, func(i, j int) bool {
+		if jobNodes[i].RunID != jobNodes[j].RunID {
+			return jobNodes[i].RunID > jobNodes[j].RunID
+		}
+		return jobNodes[i].SlurmNodeName < jobNodes[j].SlurmNodeName
+	})
+
+	if o.output == OUTPUT_JSON {
+		return printJSON(jobNodes)
+	}
+	rows := [][]string{}
+	for _, jobNode := range jobNodes {
+		rows = append(rows, []string{
+			strconv.Itoa(jobNode.RunID),
+			jobNode.SlurmNodeName,
+			orDash(jobNode.K8sNodeName),
+			orDash(jobNode.PhysicalNodeName),
+			orDash(jobNode.AccumulatedRuntime),
+			orDash(jobNode.SlurmGoalState),
+			orDash(jobNode.K8sNodeReady),
+		})
+	}
+	fmt.Printf("Job %s (%s), run %d, state %s\n\n", slurmJob.Name, slurmJob.Spec.UserName,
+		slurmJob.Status.SlurmJobRunCurrentStatus.RunID, slurmJob.Status.SlurmJobRunCurrentStatus.State)
+	return printTable([]string{"RUN", "SLURM NODE", "K8S NODE", "PHYSICAL NODE", "RUNTIME", "GOAL STATE", "K8S READY"}, rows)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/fleet"
+)
+
+const (
+	FIELD_OWNER = "kubectl-slonk"
+
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, o *options, args []string) error
+}
+
+var commands = map[string]command{
+	"node show": {"node show <name>", "Show a physical node, by k8s, slurm or physical node name.", runNodeShow},
+	"drain":     {"drain <name> --reason <reason>", "Drain the slurm node of a physical node and manage it manually.", runDrain},
+	"undrain":   {"undrain <name>", "Set the slurm goal state of a physical node back to up and manage it automatically.", runUndrain},
+	"down":      {"down <name> --reason <reason>", "Take the slurm node of a physical node down and manage it manually.", runDown},
+	"history":   {"history <name>", "Show the history of a physical node.", runHistory},
+	"why":       {"why <name>", "Explain the current goal state of a physical node.", runWhy},
+	"job nodes": {"job nodes <id>", "Show the physical nodes a slurm job runs or ran on.", runJobNodes},
+	"resolve":   {"resolve <name>", "Find the physical nodes a k8s, slurm or physical node name belongs or belonged to.", runResolve},
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	namespace string
+	output    string
+	infoURL   string
+
+	k8sClient client.Client
+}
+
+func (o *options) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.namespace, "n", "slurm", "Namespace of the physical nodes and slurm jobs.")
+	fs.StringVar(&o.output, "o", OUTPUT_TABLE, "Output format, table or json.")
+	fs.StringVar(&o.infoURL, "info-url", os.Getenv("SLONK_INFO_URL"),
+		"URL of the slonklet-controller info server, e.g. http://localhost:18080 through a port-forward. "+
+			"Defaults to $SLONK_INFO_URL. Without it, history only covers what's kept in the status.")
+}
+
+func (o *options) client() (client.Client, error) {
+	if o.k8sClient != nil {
+		return o.k8sClient, nil
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("add clientgoscheme to scheme: %w", err)
+	}
+	if err := slonkv1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("add slonkv1 to scheme: %w", err)
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("get kubeconfig: %w", err)
+	}
+	o.k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	return o.k8sClient, nil
+}
+
+// listPhysicalNodes returns all physical nodes by name.
+func (o *options) listPhysicalNodes(ctx context.Context) (map[string]*slonkv1.PhysicalNode, error) {
+	k8sClient, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+	physicalNodeList := &slonkv1.PhysicalNodeList{}
+	if err := k8sClient.List(ctx, physicalNodeList, client.InNamespace(o.namespace)); err != nil {
+		return nil, fmt.Errorf("list physical nodes: %w", err)
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+	for i := range physicalNodeList.Items {
+		physicalNodeMap[physicalNodeList.Items[i].Name] = &physicalNodeList.Items[i]
+	}
+	return physicalNodeMap, nil
+}
+
+// resolvePhysicalNode returns the physical node a k8s, slurm or physical node name stands
+// for, see fleet.Resolver.ResolveOne.
+func (o *options) resolvePhysicalNode(ctx context.Context, name string) (*slonkv1.PhysicalNode, error) {
+	physicalNodeMap, err := o.listPhysicalNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	physicalNodes := make([]slonkv1.PhysicalNode, 0, len(physicalNodeMap))
+	for _, physicalNode := range physicalNodeMap {
+		physicalNodes = append(physicalNodes, *physicalNode)
+	}
+	match, candidates, ok := fleet.NewResolver(physicalNodes).ResolveOne(name)
+	if ok {
+		return physicalNodeMap[match.PhysicalNode], nil
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no physical node found for %s", name)
+	}
+	names := []string{}
+	for _, candidate := range candidates {
+		names = append(names, candidate.PhysicalNode)
+	}
+	return nil, fmt.Errorf("%s belonged to several physical nodes, pick one of %s", name, strings.Join(names, ", "))
+}
+
+// parseArgs parses flags placed anywhere among the arguments, as kubectl does, and returns
+// the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string, count int) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != count {
+		return nil, fmt.Errorf("expected %d argument(s), got %d", count, len(positional))
+	}
+	return positional, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: kubectl slonk <command> [flags]\n\nCommands:\n")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-32s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun kubectl slonk <command> -h for the flags of a command.\n")
+}
+
+// kubectl plugin for day-to-day operations on physical nodes and slurm jobs.
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	name := args[0]
+	args = args[1:]
+	if (name == "node" || name == "job") && len(args) > 0 {
+		name += " " + args[0]
+		args = args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(context.Background(), &options{}, args); errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
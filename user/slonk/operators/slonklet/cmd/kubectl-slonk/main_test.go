@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArgs(t *testing.T) {
+	newFlagSet := func() (*flag.FlagSet, *string) {
+		fs := flag.NewFlagSet("kubectl slonk drain", flag.ContinueOnError)
+		return fs, fs.String("reason", "", "")
+	}
+
+	// Flags may come before or after the positional arguments.
+	fs, reason := newFlagSet()
+	args, err := parseArgs(fs, []string{"abc", "--reason", "sdc suspect"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc"}, args)
+	assert.Equal(t, "sdc suspect", *reason)
+
+	fs, reason = newFlagSet()
+	args, err = parseArgs(fs, []string{"--reason=xid 79", "abc"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc"}, args)
+	assert.Equal(t, "xid 79", *reason)
+
+	fs, _ = newFlagSet()
+	_, err = parseArgs(fs, []string{"abc", "def"}, 1)
+	assert.ErrorContains(t, err, "expected 1 argument(s), got 2")
+
+	fs, _ = newFlagSet()
+	fs.SetOutput(io.Discard)
+	_, err = parseArgs(fs, []string{"abc", "--unknown"}, 1)
+	assert.Error(t, err)
+}
+
+func TestCheckOutput(t *testing.T) {
+	assert.NoError(t, checkOutput(OUTPUT_TABLE))
+	assert.NoError(t, checkOutput(OUTPUT_JSON))
+	assert.ErrorContains(t, checkOutput("yaml"), `unknown output format "yaml"`)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/controller"
+	"your-org.com/slonklet/internal/fleet"
+)
+
+func runNodeShow(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk node show", flag.ContinueOnError)
+	o.addFlags(fs)
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+
+	physicalNode, err := o.resolvePhysicalNode(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if o.output == OUTPUT_JSON {
+		return printJSON(physicalNode)
+	}
+
+	spec := physicalNode.Spec
+	status := physicalNode.Status
+	rows := [][]string{
+		{"Physical node", physicalNode.Name},
+		{"K8s node", describeK8sNode(status.K8sNodeStatus)},
+		{"Slurm node", describeSlurmNode(status.SlurmNodeStatus)},
+		{"Slurm goal state", describeGoalState(spec.SlurmNodeSpec.GoalState, spec.SlurmNodeSpec.Reason, spec.SlurmNodeSpec.Actor)},
+		{"K8s goal state", describeGoalState(spec.K8sNodeSpec.GoalState, spec.K8sNodeSpec.Reason, spec.K8sNodeSpec.Actor)},
+		{"Manual", strconv.FormatBool(spec.Manual)},
+	}
+	if override := spec.ManualOverride; spec.Manual && override != nil {
+		expiration := "never"
+		if override.ExpirationTimestamp != nil {
+			expiration = formatMetaTime(*override.ExpirationTimestamp)
+		}
+		rows = append(rows,
+			[]string{"Override owner", orDash(override.Owner)},
+			[]string{"Override ticket", orDash(override.Ticket)},
+			[]string{"Override expires", expiration},
+		)
+	}
+	for _, condition := range status.Conditions {
+		value := string(condition.Status)
+		if condition.Message != "" {
+			value += ": " + condition.Message
+		}
+		rows = append(rows, []string{condition.Type, value})
+	}
+	if topology := status.Topology; topology != nil {
+		rows = append(rows, []string{"Topology", fmt.Sprintf("zone=%s nodepool=%s rack=%s switch=%s nvlink=%s",
+			orDash(topology.Zone), orDash(topology.Nodepool), orDash(topology.Rack), orDash(topology.Switch), orDash(topology.NVLinkDomain))})
+	}
+	if inventory := status.Inventory; inventory != nil {
+		rows = append(rows, []string{"Hardware", fmt.Sprintf("%d GPUs, driver %s, %d CPUs, %d GiB, kernel %s",
+			len(inventory.GPUs), orDash(inventory.DriverVersion), inventory.CPUCount, inventory.MemoryBytes>>30, orDash(inventory.KernelVersion))})
+	}
+	if failure := status.SyncFailure; failure != nil {
+		rows = append(rows, []string{"Sync failures", fmt.Sprintf("%d since %s: %s", failure.Count, formatMetaTime(failure.FirstTimestamp), failure.Message)})
+	}
+	return printTable([]string{"FIELD", "VALUE"}, rows)
+}
+
+func runDrain(ctx context.Context, o *options, args []string) error {
+	return runSetGoalState(ctx, o, "drain", controller.GoalStateDrain, args)
+}
+
+// runUndrain sets the slurm goal state of a physical node back to up and hands it back to
+// automatic management, like an override reverted on expiry.
+func runUndrain(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk undrain", flag.ContinueOnError)
+	o.addFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "Only print what would change.")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+
+	physicalNode, err := o.resolvePhysicalNode(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	original := physicalNode.DeepCopy()
+
+	physicalNode.Spec.SlurmNodeSpec = slonkv1.SlurmNodeSpec{
+		GoalState: controller.GoalStateUp,
+		Timestamp: metav1.Now(),
+	}
+	physicalNode.Spec.Manual = false
+	physicalNode.Spec.ManualOverride = nil
+
+	if !*dryRun {
+		k8sClient, err := o.client()
+		if err != nil {
+			return err
+		}
+		if err := k8sClient.Patch(ctx, physicalNode, client.MergeFrom(original), client.FieldOwner(FIELD_OWNER)); err != nil {
+			return fmt.Errorf("update physical node %s: %w", physicalNode.Name, err)
+		}
+	}
+
+	if o.output == OUTPUT_JSON {
+		return printJSON(physicalNode)
+	}
+	verb := "Set"
+	if *dryRun {
+		verb = "Would set"
+	}
+	slurmNodeName := orDash(physicalNode.Status.SlurmNodeStatus.Name)
+	fmt.Printf("%s slurm goal state of physical node %s (slurm node %s) from %s to %s.\n",
+		verb, physicalNode.Name, slurmNodeName,
+		describeGoalState(original.Spec.SlurmNodeSpec.GoalState, original.Spec.SlurmNodeSpec.Reason, ""),
+		describeGoalState(controller.GoalStateUp, "", ""))
+	if original.Spec.Manual {
+		fmt.Printf("The physical node is now managed automatically.\n")
+	}
+	for _, state := range physicalNode.Status.SlurmNodeStatus.State {
+		if state == "DRAIN" && !controller.IsAutomaticSlurmDrainReason(physicalNode.Status.SlurmNodeStatus.Reason) {
+			fmt.Printf("Slurm node %s is still drained with reason %q, resume it or slonklet takes it as drained by hand again.\n",
+				slurmNodeName, physicalNode.Status.SlurmNodeStatus.Reason)
+		}
+	}
+	return nil
+}
+
+func runDown(ctx context.Context, o *options, args []string) error {
+	return runSetGoalState(ctx, o, "down", controller.GoalStateDown, args)
+}
+
+// runSetGoalState sets the slurm goal state of a physical node and marks it as manually
+// managed, so the controller enforces the goal state instead of deriving it.
+func runSetGoalState(ctx context.Context, o *options, name string, goalState string, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk "+name, flag.ContinueOnError)
+	o.addFlags(fs)
+	reason := fs.String("reason", "", "Why, shown in slurm as the node reason. Required.")
+	owner := fs.String("owner", "", "Person or team responsible for the manual override.")
+	ticket := fs.String("ticket", "", "Ticket tracking the manual override.")
+	expires := fs.Duration("expires", 0, "Expire the manual override after this long. 0 never expires it.")
+	onExpiry := fs.String("on-expiry", "", "What happens once the override expires, Revert or Alert. Defaults to Alert.")
+	dryRun := fs.Bool("dry-run", false, "Only print what would change.")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*reason) == "" {
+		return fmt.Errorf("--reason is required to %s a node", name)
+	}
+	if *onExpiry != "" && *onExpiry != controller.MANUAL_OVERRIDE_ON_EXPIRY_REVERT && *onExpiry != controller.MANUAL_OVERRIDE_ON_EXPIRY_ALERT {
+		return fmt.Errorf("--on-expiry must be %s or %s", controller.MANUAL_OVERRIDE_ON_EXPIRY_REVERT, controller.MANUAL_OVERRIDE_ON_EXPIRY_ALERT)
+	}
+
+	physicalNode, err := o.resolvePhysicalNode(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	original := physicalNode.DeepCopy()
+
+	now := metav1.Now()
+	physicalNode.Spec.SlurmNodeSpec.GoalState = goalState
+	physicalNode.Spec.SlurmNodeSpec.Reason = *reason
+	physicalNode.Spec.SlurmNodeSpec.Timestamp = now
+	if physicalNode.Spec.ManualOverride == nil || !physicalNode.Spec.Manual {
+		physicalNode.Spec.ManualOverride = &slonkv1.ManualOverride{StartTimestamp: now}
+	}
+	physicalNode.Spec.Manual = true
+	override := physicalNode.Spec.ManualOverride
+	if *owner != "" {
+		override.Owner = *owner
+	}
+	if *ticket != "" {
+		override.Ticket = *ticket
+	}
+	if *expires > 0 {
+		expiration := metav1.NewTime(now.Add(*expires))
+		override.ExpirationTimestamp = &expiration
+	}
+	if *onExpiry != "" {
+		override.OnExpiry = *onExpiry
+	}
+
+	if !*dryRun {
+		k8sClient, err := o.client()
+		if err != nil {
+			return err
+		}
+		if err := k8sClient.Patch(ctx, physicalNode, client.MergeFrom(original), client.FieldOwner(FIELD_OWNER)); err != nil {
+			return fmt.Errorf("update physical node %s: %w", physicalNode.Name, err)
+		}
+	}
+
+	if o.output == OUTPUT_JSON {
+		return printJSON(physicalNode)
+	}
+	verb := "Set"
+	if *dryRun {
+		verb = "Would set"
+	}
+	fmt.Printf("%s slurm goal state of physical node %s (slurm node %s) from %s to %s.\n",
+		verb, physicalNode.Name, orDash(physicalNode.Status.SlurmNodeStatus.Name),
+		describeGoalState(original.Spec.SlurmNodeSpec.GoalState, original.Spec.SlurmNodeSpec.Reason, ""),
+		describeGoalState(goalState, *reason, ""))
+	if !original.Spec.Manual {
+		fmt.Printf("The physical node is now managed manually, until its override expires or it is undrained.\n")
+	}
+	return nil
+}
+
+func runResolve(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("kubectl slonk resolve", flag.ContinueOnError)
+	o.addFlags(fs)
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkOutput(o.output); err != nil {
+		return err
+	}
+
+	physicalNodeMap, err := o.listPhysicalNodes(ctx)
+	if err != nil {
+		return err
+	}
+	physicalNodes := make([]slonkv1.PhysicalNode, 0, len(physicalNodeMap))
+	for _, physicalNode := range physicalNodeMap {
+		physicalNodes = append(physicalNodes, *physicalNode)
+	}
+	matches := fleet.NewResolver(physicalNodes).Resolve(args[0])
+	if len(matches) == 0 {
+		return fmt.Errorf("no physical node found for %s", args[0])
+	}
+	if o.output == OUTPUT_JSON {
+		return printJSON(matches)
+	}
+
+	rows := [][]string{}
+	for _, match := range matches {
+		status := physicalNodeMap[match.PhysicalNode].Status
+		lastSeen := "now"
+		if !match.IsCurrent() {
+			lastSeen = formatTime(match.LastSeen)
+		}
+		rows = append(rows, []string{
+			match.PhysicalNode,
+			match.MatchedBy,
+			lastSeen,
+			describeK8sNode(status.K8sNodeStatus),
+			describeSlurmNode(status.SlurmNodeStatus),
+		})
+	}
+	return printTable([]string{"PHYSICAL NODE", "MATCHED BY", "LAST SEEN", "K8S NODE", "SLURM NODE"}, rows)
+}
+
+func describeK8sNode(k8sNodeStatus slonkv1.K8sNodeStatus) string {
+	if k8sNodeStatus.Name == "" || k8sNodeStatus.Removed {
+		return "-"
+	}
+	if k8sNodeStatus.Unschedulable {
+		return k8sNodeStatus.Name + " (cordoned)"
+	}
+	return k8sNodeStatus.Name
+}
+
+func describeSlurmNode(slurmNodeStatus slonkv1.SlurmNodeStatus) string {
+	if slurmNodeStatus.Name == "" || slurmNodeStatus.Removed {
+		return "-"
+	}
+	description := fmt.Sprintf("%s (%s)", slurmNodeStatus.Name, strings.Join(slurmNodeStatus.State, ","))
+	if slurmNodeStatus.Reason != "" {
+		description += fmt.Sprintf(" %q", slurmNodeStatus.Reason)
+	}
+	return description
+}
+
+func describeGoalState(goalState string, reason string, actor string) string {
+	if goalState == "" {
+		goalState = controller.GoalStateUp
+	}
+	if reason != "" {
+		goalState += fmt.Sprintf(" %q", reason)
+	}
+	if actor != "" {
+		goalState += " by " + actor
+	}
+	return goalState
+}
+
+// isConditionTrue returns "yes", "no" or "-" for the condition of the physical node.
+func isConditionTrue(physicalNode *slonkv1.PhysicalNode, conditionType string) string {
+	condition := meta.FindStatusCondition(physicalNode.Status.Conditions, conditionType)
+	if condition == nil {
+		return "-"
+	}
+	if condition.Status == metav1.ConditionTrue {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/controller"
+)
+
+func newTestOptions(objects ...*slonkv1.PhysicalNode) *options {
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	builder := clientFake.NewClientBuilder().WithScheme(newScheme)
+	for _, object := range objects {
+		builder = builder.WithObjects(object)
+	}
+	return &options{k8sClient: builder.Build()}
+}
+
+func getPhysicalNode(t *testing.T, o *options, name string) *slonkv1.PhysicalNode {
+	physicalNode := &slonkv1.PhysicalNode{}
+	assert.NoError(t, o.k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "slurm", Name: name}, physicalNode))
+	return physicalNode
+}
+
+func TestRunSetGoalState(t *testing.T) {
+	ctx := context.Background()
+	o := newTestOptions(&slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: "slurm"},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: controller.GoalStateUp},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-h100-1"},
+		},
+	})
+
+	assert.ErrorContains(t, runDrain(ctx, o, []string{"abc"}), "--reason is required to drain a node")
+	assert.ErrorContains(t, runDrain(ctx, o, []string{"abc", "--reason", "sdc suspect", "--on-expiry", "Never"}), "--on-expiry must be")
+	assert.ErrorContains(t, runDrain(ctx, o, []string{"def", "--reason", "sdc suspect"}), "no physical node found for def")
+
+	// A dry run doesn't change the physical node.
+	assert.NoError(t, runDrain(ctx, o, []string{"abc", "--reason", "sdc suspect", "--dry-run"}))
+	assert.Equal(t, controller.GoalStateUp, getPhysicalNode(t, o, "abc").Spec.SlurmNodeSpec.GoalState)
+
+	// Resolved from the slurm node name.
+	assert.NoError(t, runDrain(ctx, o, []string{"slurm-h100-1", "--reason", "sdc suspect", "--owner", "alice", "--ticket", "INC-42", "--expires", "1h", "--on-expiry", controller.MANUAL_OVERRIDE_ON_EXPIRY_REVERT}))
+	physicalNode := getPhysicalNode(t, o, "abc")
+	assert.Equal(t, controller.GoalStateDrain, physicalNode.Spec.SlurmNodeSpec.GoalState)
+	assert.Equal(t, "sdc suspect", physicalNode.Spec.SlurmNodeSpec.Reason)
+	assert.True(t, physicalNode.Spec.Manual)
+	override := physicalNode.Spec.ManualOverride
+	assert.Equal(t, "alice", override.Owner)
+	assert.Equal(t, "INC-42", override.Ticket)
+	assert.Equal(t, controller.MANUAL_OVERRIDE_ON_EXPIRY_REVERT, override.OnExpiry)
+	assert.NotNil(t, override.ExpirationTimestamp)
+	start := override.StartTimestamp
+
+	// Changing the goal state of an override keeps its start and the fields not given.
+	assert.NoError(t, runDown(ctx, o, []string{"abc", "--reason", "xid 79"}))
+	physicalNode = getPhysicalNode(t, o, "abc")
+	assert.Equal(t, controller.GoalStateDown, physicalNode.Spec.SlurmNodeSpec.GoalState)
+	assert.Equal(t, start.Unix(), physicalNode.Spec.ManualOverride.StartTimestamp.Unix())
+	assert.Equal(t, "alice", physicalNode.Spec.ManualOverride.Owner)
+}
+
+func TestRunUndrain(t *testing.T) {
+	ctx := context.Background()
+	o := newTestOptions(&slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: "slurm"},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: controller.GoalStateDrain, Reason: "sdc suspect"},
+			Manual:        true,
+			ManualOverride: &slonkv1.ManualOverride{
+				Owner:          "alice",
+				StartTimestamp: metav1.Now(),
+			},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{
+				Name:   "slurm-h100-1",
+				State:  []string{"IDLE", "DRAIN"},
+				Reason: "sdc suspect",
+			},
+		},
+	})
+
+	assert.NoError(t, runUndrain(ctx, o, []string{"abc", "--dry-run"}))
+	assert.True(t, getPhysicalNode(t, o, "abc").Spec.Manual)
+
+	// Undrained nodes are handed back to automatic management.
+	assert.NoError(t, runUndrain(ctx, o, []string{"abc"}))
+	physicalNode := getPhysicalNode(t, o, "abc")
+	assert.Equal(t, controller.GoalStateUp, physicalNode.Spec.SlurmNodeSpec.GoalState)
+	assert.Empty(t, physicalNode.Spec.SlurmNodeSpec.Reason)
+	assert.False(t, physicalNode.Spec.Manual)
+	assert.Nil(t, physicalNode.Spec.ManualOverride)
+}
@@ -1,146 +1,288 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
-	slonkv1 "your-org.com/slonklet/api/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/fleet"
+)
+
+const (
+	FIELD_OWNER = "slonk-labeler"
+
+	RESULT_UPDATED   = "updated"
+	RESULT_WOULD     = "would-update"
+	RESULT_UNCHANGED = "unchanged"
+	RESULT_NOT_FOUND = "not-found"
+	RESULT_AMBIGUOUS = "ambiguous"
+	RESULT_FAILED    = "failed"
 )
 
-// Util to label physical nodes.
+// stringList is a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Result is what happened to a single input name.
+type Result struct {
+	Name         string        `json:"name"`
+	PhysicalNode string        `json:"physicalNode,omitempty"`
+	MatchedBy    string        `json:"matchedBy,omitempty"`
+	Status       string        `json:"status"`
+	Diff         []string      `json:"diff,omitempty"`
+	Matches      []fleet.Match `json:"matches,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Report is the JSON report of a run.
+type Report struct {
+	DryRun  bool           `json:"dryRun"`
+	Changes []string       `json:"changes"`
+	Counts  map[string]int `json:"counts"`
+	Results []Result       `json:"results"`
+}
+
+// Labels or annotates the physical nodes behind a list of k8s, slurm or physical node
+// names, current or historical, e.g. to mark the hosts of an incident hunt:
+//
+//	labeler -f hunt.txt --label sdc-hunt-20240507=true --dry-run --diff
 func main() {
-	// Create a new client.
-	cfg, err := config.GetConfig()
-	if err != nil {
-		fmt.Printf("Error getting kubeconfig: %s\n", err)
-		os.Exit(1)
+	var input string
+	var namespace string
+	var labels stringList
+	var annotations stringList
+	var snapshots stringList
+	var dryRun bool
+	var showDiff bool
+	var reportPath string
+	var allMatches bool
+	flag.StringVar(&input, "f", "-", "File with the node names to act on, one or more per line. - reads stdin.")
+	flag.StringVar(&namespace, "namespace", "slurm", "Namespace of the physical nodes.")
+	flag.Var(&labels, "label", "Label to set as key=value, or to remove as key-. May be repeated.")
+	flag.Var(&annotations, "annotate", "Annotation to set as key=value, or to remove as key-. May be repeated.")
+	flag.Var(&snapshots, "snapshot", "Older physical node list, e.g. from kubectl get -o yaml, to resolve names "+
+		"that fell out of the status history. May be repeated.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only print what would change.")
+	flag.BoolVar(&showDiff, "diff", false, "Print the label and annotation changes of every physical node.")
+	flag.StringVar(&reportPath, "report", "", "Write a JSON report to this file. - writes it to stdout.")
+	flag.BoolVar(&allMatches, "all-matches", false,
+		"Act on every physical node a historical name belonged to, instead of skipping ambiguous names.")
+	flag.Parse()
+
+	changes := []fleet.MetadataChange{}
+	for _, spec := range labels {
+		change, err := fleet.ParseMetadataChange(spec, false)
+		if err != nil {
+			fail("Invalid --label: %s", err)
+		}
+		changes = append(changes, change)
+	}
+	for _, spec := range annotations {
+		change, err := fleet.ParseMetadataChange(spec, true)
+		if err != nil {
+			fail("Invalid --annotate: %s", err)
+		}
+		changes = append(changes, change)
 	}
-	k8sClient, err := client.New(cfg, client.Options{})
+	if len(changes) == 0 {
+		fail("Nothing to do, give at least one --label or --annotate")
+	}
+
+	names, err := readNames(input)
 	if err != nil {
-		fmt.Printf("Error creating client: %s\n", err)
-		os.Exit(1)
+		fail("%s", err)
+	}
+	snapshotLists := [][]slonkv1.PhysicalNode{}
+	for _, path := range snapshots {
+		snapshot, err := readSnapshot(path)
+		if err != nil {
+			fail("%s", err)
+		}
+		snapshotLists = append(snapshotLists, snapshot)
 	}
 
-	// List CRs.
 	scheme := runtime.NewScheme()
-	groupVersionKind := schema.GroupVersionKind{
-		Group:   "slonk.your-org.com",
-		Version: "v1",
-		Kind:    "PhysicalNode",
-	}
 	if err := clientgoscheme.AddToScheme(scheme); err != nil {
-		fmt.Printf("Error adding clientgoscheme to scheme: %s\n", err)
+		fail("Error adding clientgoscheme to scheme: %s", err)
 	}
 	if err := slonkv1.AddToScheme(scheme); err != nil {
-		fmt.Printf("Error adding slonkv1 to scheme: %s\n", err)
-	}
-	list := &unstructured.UnstructuredList{}
-	list.SetGroupVersionKind(groupVersionKind)
-	if err := k8sClient.List(context.Background(), list, client.InNamespace("slurm")); err != nil {
-		panic(err)
-	}
-	fmt.Printf("list length: %d\n", len(list.Items))
-	var currentPhysicalNodeMap = make(map[string]*slonkv1.PhysicalNode)
-	for _, item := range list.Items {
-		// fmt.Printf("item: %v\n", item)
-		var currentPhysicalNode slonkv1.PhysicalNode
-		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &currentPhysicalNode); err != nil {
-			panic(err)
-		}
-		currentPhysicalNodeMap[currentPhysicalNode.Name] = &currentPhysicalNode
+		fail("Error adding slonkv1 to scheme: %s", err)
 	}
-
-	//rawPhysicalNodeListBytes, err := os.ReadFile("/Users/yiranwang/Code/physicalnodes_20240507_good.out")
-	rawPhysicalNodeListBytes, err := os.ReadFile("/Users/yiranwang/Code/physicalnodes_20240505.out")
+	cfg, err := config.GetConfig()
+	if err != nil {
+		fail("Error getting kubeconfig: %s", err)
+	}
+	k8sClient, err := client.New(cfg, client.Options{Scheme: scheme})
 	if err != nil {
-		panic(err)
+		fail("Error creating client: %s", err)
 	}
 
-	var physicalNodeList slonkv1.PhysicalNodeList
-	if err := yaml.Unmarshal(rawPhysicalNodeListBytes, &physicalNodeList); err != nil {
-		panic(err)
+	ctx := context.Background()
+	physicalNodeList := &slonkv1.PhysicalNodeList{}
+	if err := k8sClient.List(ctx, physicalNodeList, client.InNamespace(namespace)); err != nil {
+		fail("Error listing physical nodes: %s", err)
 	}
-	physicalNodeMap := make(map[string]*slonkv1.PhysicalNode)
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{}
 	for i := range physicalNodeList.Items {
-		physicalNode := physicalNodeList.Items[i]
-		physicalNodeMap[physicalNode.Name] = &physicalNode
+		physicalNodeMap[physicalNodeList.Items[i].Name] = &physicalNodeList.Items[i]
 	}
+	resolver := fleet.NewResolver(physicalNodeList.Items, snapshotLists...)
 
-	foundCount := 0
-	notFoundCount := 0
+	report := Report{
+		DryRun:  dryRun,
+		Changes: append(append([]string{}, labels...), annotations...),
+		Counts:  map[string]int{},
+		Results: []Result{},
+	}
+	for _, name := range names {
+		matches := []fleet.Match{}
+		if match, candidates, ok := resolver.ResolveOne(name); ok {
+			matches = append(matches, match)
+		} else if len(candidates) > 0 && allMatches {
+			matches = candidates
+		} else if len(candidates) > 0 {
+			report.Results = append(report.Results, Result{Name: name, Status: RESULT_AMBIGUOUS, Matches: candidates})
+			continue
+		}
+		if len(matches) == 0 {
+			report.Results = append(report.Results, Result{Name: name, Status: RESULT_NOT_FOUND})
+			continue
+		}
 
-	rawK8sNodeListFile, err := os.Open("/Users/yiranwang/Code/sdc_hunt_20240506.txt")
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer rawK8sNodeListFile.Close()
-	fileScanner := bufio.NewScanner(rawK8sNodeListFile)
-	fileScanner.Split(bufio.ScanLines)
-	for fileScanner.Scan() {
-		k8sNodeName := strings.Trim(fileScanner.Text(), " ")
-		found := false
-		var currentPhysicalNode *slonkv1.PhysicalNode
-		var ok bool
-		for _, physicalNode := range physicalNodeMap {
-			if physicalNode.Status.K8sNodeStatus.Name == k8sNodeName {
-				found = true
-				currentPhysicalNode, ok = currentPhysicalNodeMap[physicalNode.Name]
-				if !ok {
-					fmt.Printf("currentPhysicalNode not found: %s\n", physicalNode.Name)
-				}
-			} else {
-				for _, history := range physicalNode.Status.K8sNodeStatusHistory {
-					if history.Name == k8sNodeName {
-						found = true
-						currentPhysicalNode, ok = currentPhysicalNodeMap[physicalNode.Name]
-						if !ok {
-							fmt.Printf("currentPhysicalNode not found: %s\n", physicalNode.Name)
-						}
-						break
-					}
-				}
-			}
-			if found {
-				foundCount++
-				// fmt.Printf("k8sNode: %s, currentPhysicalNode: %s\n", k8sNodeName, currentPhysicalNode.Name)
-				newPhysicalNode := currentPhysicalNode.DeepCopy()
-				if newPhysicalNode.Labels == nil {
-					newPhysicalNode.Labels = make(map[string]string)
-				}
-				if newPhysicalNode.Labels["sdc-hunt-20240507"] == "true" {
-					// fmt.Printf("k8sNode: %s already has label\n", k8sNodeName)
+		for _, match := range matches {
+			result := Result{Name: name, PhysicalNode: match.PhysicalNode, MatchedBy: match.MatchedBy}
+			physicalNode := physicalNodeMap[match.PhysicalNode]
+			original := physicalNode.DeepCopy()
+			result.Diff = fleet.ApplyMetadataChanges(physicalNode, changes)
+			switch {
+			case len(result.Diff) == 0:
+				result.Status = RESULT_UNCHANGED
+			case dryRun:
+				result.Status = RESULT_WOULD
+			default:
+				err := k8sClient.Patch(ctx, physicalNode, client.MergeFrom(original), client.FieldOwner(FIELD_OWNER))
+				if err != nil {
+					// Keep the cached copy as it is on the server.
+					physicalNodeMap[match.PhysicalNode] = original
+					result.Status = RESULT_FAILED
+					result.Error = err.Error()
 				} else {
-					newPhysicalNode.Labels["sdc-hunt-20240507"] = "true"
-					u := &unstructured.Unstructured{}
-					u.Object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(newPhysicalNode)
-					if err != nil {
-						panic(err)
-					}
-					if err := k8sClient.Update(context.Background(), u); err != nil {
-						fmt.Printf("Error updating physical node: %s\n", err)
-					} else {
-						fmt.Printf("Updated physical node: %s\n", newPhysicalNode.Name)
-					}
+					result.Status = RESULT_UPDATED
 				}
-				break
 			}
+			report.Results = append(report.Results, result)
 		}
-		if !found {
-			notFoundCount++
-			fmt.Printf("k8sNodeName: %s not found\n", k8sNodeName)
+	}
+	for _, result := range report.Results {
+		report.Counts[result.Status]++
+	}
+
+	if reportPath != "-" {
+		printResults(os.Stdout, report, showDiff)
+	}
+	if reportPath != "" {
+		if err := writeReport(reportPath, report); err != nil {
+			fail("%s", err)
 		}
 	}
+	if report.Counts[RESULT_FAILED] > 0 {
+		os.Exit(1)
+	}
+}
+
+func readNames(path string) ([]string, error) {
+	if path == "-" {
+		return fleet.ReadNames(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open node names: %w", err)
+	}
+	defer f.Close()
+	return fleet.ReadNames(f)
+}
+
+func readSnapshot(path string) ([]slonkv1.PhysicalNode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	physicalNodeList := slonkv1.PhysicalNodeList{}
+	if err := yaml.Unmarshal(data, &physicalNodeList); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	return physicalNodeList.Items, nil
+}
+
+func printResults(w io.Writer, report Report, showDiff bool) {
+	for _, result := range report.Results {
+		switch result.Status {
+		case RESULT_NOT_FOUND:
+			fmt.Fprintf(w, "%s: not found\n", result.Name)
+		case RESULT_AMBIGUOUS:
+			candidates := []string{}
+			for _, match := range result.Matches {
+				candidates = append(candidates, fmt.Sprintf("%s (%s, last seen %s)",
+					match.PhysicalNode, match.MatchedBy, match.LastSeen.Format("2006-01-02 15:04")))
+			}
+			fmt.Fprintf(w, "%s: ambiguous, belonged to %s\n", result.Name, strings.Join(candidates, ", "))
+		case RESULT_FAILED:
+			fmt.Fprintf(w, "%s -> %s: failed: %s\n", result.Name, result.PhysicalNode, result.Error)
+		default:
+			fmt.Fprintf(w, "%s -> %s (%s): %s\n", result.Name, result.PhysicalNode, result.MatchedBy, result.Status)
+		}
+		if showDiff {
+			for _, line := range result.Diff {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+
+	counts := []string{}
+	for _, status := range []string{RESULT_UPDATED, RESULT_WOULD, RESULT_UNCHANGED, RESULT_NOT_FOUND, RESULT_AMBIGUOUS, RESULT_FAILED} {
+		if report.Counts[status] > 0 {
+			counts = append(counts, fmt.Sprintf("%s: %d", status, report.Counts[status]))
+		}
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(counts, ", "))
+}
+
+func writeReport(path string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal report: %w", err)
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
 
-	fmt.Printf("foundCount: %d\n", foundCount)
-	fmt.Printf("notFoundCount: %d\n", notFoundCount)
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
 }
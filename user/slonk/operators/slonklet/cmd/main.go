@@ -27,8 +27,13 @@ func main() {
 		command := r.URL.Query().Get("command")
 		if command == "" {
 			http.Error(w, "command is required", http.StatusBadRequest)
+			return
+		}
+		if _, err := localQueue.EnqueueShellCommandTask(taskID, command); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		localQueue.EnqueueShellCommandTask(taskID, command)
+		w.Write([]byte(uuid.UUID(taskID).String()))
 	})
 	http.HandleFunc("/job/state", func(w http.ResponseWriter, r *http.Request) {
 		taskIDStr := r.URL.Query().Get("id")
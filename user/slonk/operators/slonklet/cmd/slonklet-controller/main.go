@@ -19,7 +19,9 @@ package main
 import (
 	"context"
 	"flag"
+	"net"
 	"os"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -28,22 +30,45 @@ import (
 	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+	corev1 "k8s.io/api/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	slonkv1 "your-org.com/slonklet/api/v1"
+	slonkv1alpha2 "your-org.com/slonklet/api/v1alpha2"
+	"your-org.com/slonklet/internal/blame"
+	"your-org.com/slonklet/internal/budget"
 	"your-org.com/slonklet/internal/controller"
+	"your-org.com/slonklet/internal/history"
+	"your-org.com/slonklet/internal/metrics"
 	"your-org.com/slonklet/internal/server"
+	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/tools"
+	"your-org.com/slonklet/internal/topology"
 	//+kubebuilder:scaffold:imports
 )
 
+const (
+	// Reporting controller of the events emitted by the reconcilers.
+	EVENT_REPORTING_CONTROLLER = "slonklet-controller"
+	LEADER_ELECTION_ID         = "your-org-slonklet-controller" // TODO: Replace with your organization identifier
+	// The leader election lease is created in the namespace of the pod, like the manager does.
+	IN_CLUSTER_NAMESPACE_PATH = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -53,6 +78,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(slonkv1.AddToScheme(scheme))
+	utilruntime.Must(slonkv1alpha2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -64,6 +90,31 @@ func main() {
 	var identifier string
 	var logPath string
 	var autoRemediate bool
+	var disruptionBudgetConfig string
+	var topologyConfig string
+	var approvalRequiredActions string
+	var approvalThreshold int
+	var maintenanceDrain bool
+	var maintenanceJobSignal string
+	var evictionFallbackTimeout time.Duration
+	var drainDeadline time.Duration
+	var partitionDrainDeadlines string
+	var requeueOnDrainDeadline bool
+	var rebootMethod string
+	var agentPort int
+	var agentRebootCommand string
+	var rebootTimeout time.Duration
+	var unregisteredPodGracePeriod time.Duration
+	var unregisteredPodMaxRestarts int
+	var historyDir string
+	var historyRetention time.Duration
+	var blameWindow time.Duration
+	var blameMinFailures int
+	var blameSignificance float64
+	var labelSuspects bool
+	var enableWebhooks bool
+	var webhookPort int
+	var webhookCertDir string
 	flag.StringVar(&infoAddr, "info-bind-address", ":8080", "The address the info server binds to")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8082", "The address the metric endpoint binds to.")
@@ -73,6 +124,56 @@ func main() {
 	flag.StringVar(&identifier, "identifier", "gpu-uuid-hash", "The value to use to uniquely identify a physical machine.")
 	flag.StringVar(&logPath, "log-path", "/var/log/slurm/slonklet-controller.log", "The path to the log file.")
 	flag.BoolVar(&autoRemediate, "auto-remediate", true, "Enable auto-remediation of k8s nodes.")
+	flag.StringVar(&disruptionBudgetConfig, "disruption-budget-config", "",
+		"Path to a YAML file with disruption budgets for auto-remediation. Defaults to a per-nodepool budget.")
+	flag.StringVar(&topologyConfig, "topology-config", "",
+		"Path to a YAML file telling where to read the topology of hosts from. Defaults to the GKE and NVIDIA labels.")
+	flag.StringVar(&approvalRequiredActions, "approval-required-actions", controller.ACTION_K8S_NODE_DELETE,
+		"Comma separated remediation actions that need explicit approval before they run.")
+	flag.IntVar(&approvalThreshold, "approval-threshold", 10,
+		"Remediation plans with more disruptive actions than this need explicit approval. 0 disables it.")
+	flag.BoolVar(&maintenanceDrain, "maintenance-drain", true,
+		"Drain slurm nodes on hosts with a GCP maintenance taint and resume them afterwards.")
+	flag.StringVar(&maintenanceJobSignal, "maintenance-job-signal", "USR1",
+		"Signal sent to jobs on hosts entering GCP maintenance so they can checkpoint. Empty disables it.")
+	flag.DurationVar(&evictionFallbackTimeout, "eviction-fallback-timeout", tools.DEFAULT_EVICTION_FALLBACK,
+		"Pods blocked by a PodDisruptionBudget for longer than this are deleted when draining k8s nodes. "+
+			"Ingress pods are never deleted. 0 disables the fallback.")
+	flag.DurationVar(&drainDeadline, "drain-deadline", controller.DEFAULT_DRAIN_DEADLINE,
+		"How long jobs may keep running on a drained slurm node before its pod is removed.")
+	flag.StringVar(&partitionDrainDeadlines, "partition-drain-deadlines", "",
+		"Comma separated per-partition overrides of --drain-deadline, e.g. \"hero=24h,dev=30m\".")
+	flag.BoolVar(&requeueOnDrainDeadline, "requeue-on-drain-deadline", false,
+		"Requeue jobs still running when the drain deadline passes, instead of killing them.")
+	flag.StringVar(&rebootMethod, "reboot-method", controller.REBOOT_METHOD_AUTO,
+		"How hosts with a reboot taint are rebooted: \"scontrol\", \"agent\", or \"auto\" to use the agent only when slurm can't reach the node.")
+	flag.IntVar(&agentPort, "agent-port", 0,
+		"Port of the node-local slonklet agent on k8s nodes. 0 disables reboots through the agent.")
+	flag.StringVar(&agentRebootCommand, "agent-reboot-command", controller.DEFAULT_AGENT_REBOOT_COMMAND,
+		"Command the node-local slonklet agent runs to reboot its host.")
+	flag.DurationVar(&rebootTimeout, "reboot-timeout", controller.DEFAULT_REBOOT_TIMEOUT,
+		"How long a host may take to come back healthy after a reboot was requested.")
+	flag.DurationVar(&unregisteredPodGracePeriod, "unregistered-pod-grace-period", controller.DEFAULT_UNREGISTERED_POD_GRACE_PERIOD,
+		"Running slurm pods whose slurmd doesn't register with slurmctld for this long are restarted.")
+	flag.IntVar(&unregisteredPodMaxRestarts, "unregistered-pod-max-restarts", controller.DEFAULT_UNREGISTERED_POD_MAX_RESTARTS,
+		"Restarts of an unregistered slurm pod before its k8s node is tainted to be drained.")
+	flag.StringVar(&historyDir, "history-dir", "",
+		"Directory on a persistent volume for the long-term physical node history. Empty disables it.")
+	flag.DurationVar(&historyRetention, "history-retention", history.DEFAULT_RETENTION,
+		"How long the physical node history is kept. 0 keeps it forever.")
+	flag.DurationVar(&blameWindow, "blame-window", blame.DEFAULT_WINDOW,
+		"Job runs finished within this window are attributed to their physical nodes to find suspect hosts.")
+	flag.IntVar(&blameMinFailures, "blame-min-failures", blame.DEFAULT_MIN_FAILURES,
+		"Failed job runs a physical node needs before it can be a suspect.")
+	flag.Float64Var(&blameSignificance, "blame-significance", blame.DEFAULT_SIGNIFICANCE,
+		"Chance of flagging any innocent physical node as a suspect, split across the fleet.")
+	flag.BoolVar(&labelSuspects, "label-suspects", false,
+		"Set the "+controller.SUSPECT_LABEL+" label on suspect physical nodes. When unset, the labels set before are removed.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the PhysicalNode conversion and admission webhooks.")
+	flag.IntVar(&webhookPort, "webhook-port", webhook.DefaultPort, "The port the webhook server binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+		"Directory with the tls.crt and tls.key of the webhook server. Defaults to the controller-runtime one.")
 
 	w := zapcore.AddSync(&lumberjack.Logger{
 		Filename:   logPath,
@@ -105,8 +206,23 @@ func main() {
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "your-org-slonklet-controller", // TODO: Replace with your organization identifier
+		// Reads are served from the informer cache, only cache the pods of the namespaces
+		// the controller looks at.
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Pod{}: {Namespaces: map[string]cache.Config{
+					controller.SLURM_NAMESPACE:         {},
+					controller.SYSTEM_NAMESPACE:        {},
+					controller.NGINX_INGRESS_NAMESPACE: {},
+				}},
+			},
+		},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: LEADER_ELECTION_ID,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -117,16 +233,118 @@ func main() {
 		// the manager stops, so would be fine to enable this option. However,
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
-		// LeaderElectionReleaseOnCancel: true,
+		//
+		// The sync loop stops with the manager and main returns right after, so the lease is
+		// released for the other replica to take over without waiting.
+		LeaderElectionReleaseOnCancel: true,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	disruptionBudgets := budget.DefaultDisruptionBudgets()
+	if disruptionBudgetConfig != "" {
+		disruptionBudgets, err = budget.LoadDisruptionBudgets(disruptionBudgetConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load disruption budgets")
+			os.Exit(1)
+		}
+	}
+
+	topologyExtractorConfig := topology.DefaultConfig()
+	if topologyConfig != "" {
+		topologyExtractorConfig, err = topology.LoadConfig(topologyConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load topology config")
+			os.Exit(1)
+		}
+	}
+	topologyExtractor, err := topology.NewExtractor(topologyExtractorConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create topology extractor")
+		os.Exit(1)
+	}
+
+	approvalRequiredActionMap := map[string]bool{}
+	for _, action := range strings.Split(approvalRequiredActions, ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			approvalRequiredActionMap[action] = true
+		}
+	}
+
+	partitionDrainDeadlineMap := map[string]time.Duration{}
+	for _, entry := range strings.Split(partitionDrainDeadlines, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		partition, value, ok := strings.Cut(entry, "=")
+		deadline, err := time.ParseDuration(value)
+		if !ok || err != nil {
+			setupLog.Error(err, "invalid partition drain deadline", "entry", entry)
+			os.Exit(1)
+		}
+		partitionDrainDeadlineMap[partition] = deadline
+	}
+
+	slurm.Observer = metrics.ObserveSlurmAPI
+
+	infoServer := server.NewInfoServer(infoAddr)
+	infoServer.SetNodeAuthenticator(&server.TokenReviewAuthenticator{Client: mgr.GetClient()})
+
+	var historyStore *history.Store
+	if historyDir != "" {
+		historyStore, err = history.Open(historyDir, historyRetention)
+		if err != nil {
+			setupLog.Error(err, "unable to open physical node history", "dir", historyDir)
+			os.Exit(1)
+		}
+		defer historyStore.Close()
+		infoServer.SetHistory(historyStore)
+	}
+
+	// Events go through events.k8s.io/v1, which correlates repeated events into series.
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+	eventBroadcaster := events.NewBroadcaster(&events.EventSinkImpl{Interface: clientset.EventsV1()})
+	eventRecorder := eventBroadcaster.NewRecorder(mgr.GetScheme(), EVENT_REPORTING_CONTROLLER)
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		eventBroadcaster.StartRecordingToSink(ctx.Done())
+		<-ctx.Done()
+		eventBroadcaster.Shutdown()
+		return nil
+	})); err != nil {
+		setupLog.Error(err, "unable to add event broadcaster")
+		os.Exit(1)
+	}
+
+	// Remediations and node hunt diagnostics share the disruption budgets.
+	disruptionBudgetTracker := budget.NewTracker(disruptionBudgets)
 	nodeReconciler := &controller.PhysicalNodeReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                     mgr.GetClient(),
+		Recorder:                   eventRecorder,
+		Scheme:                     mgr.GetScheme(),
+		Budgets:                    disruptionBudgetTracker,
+		Topology:                   topologyExtractor,
+		History:                    historyStore,
+		ApprovalRequiredActions:    approvalRequiredActionMap,
+		ApprovalThreshold:          approvalThreshold,
+		Inventory:                  infoServer,
+		Evictor:                    tools.NewEvictor(mgr.GetClient(), evictionFallbackTimeout, controller.NGINX_INGRESS_NAMESPACE),
+		MaintenanceDrain:           maintenanceDrain,
+		MaintenanceJobSignal:       maintenanceJobSignal,
+		DrainDeadline:              drainDeadline,
+		PartitionDrainDeadlines:    partitionDrainDeadlineMap,
+		RequeueOnDrainDeadline:     requeueOnDrainDeadline,
+		RebootMethod:               rebootMethod,
+		AgentPort:                  agentPort,
+		AgentRebootCommand:         agentRebootCommand,
+		RebootTimeout:              rebootTimeout,
+		UnregisteredPodGracePeriod: unregisteredPodGracePeriod,
+		UnregisteredPodMaxRestarts: unregisteredPodMaxRestarts,
 	}
 
 	if err = nodeReconciler.SetupWithManager(mgr); err != nil {
@@ -135,14 +353,33 @@ func main() {
 	}
 
 	jobReconciler := &controller.SlurmJobReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Recorder: eventRecorder,
+		Scheme:   mgr.GetScheme(),
 	}
 
 	if err = jobReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create job controller", "controller", "SlurmJob")
 		os.Exit(1)
 	}
+	nodeHuntReconciler := &controller.NodeHuntReconciler{
+		Client:    mgr.GetClient(),
+		Recorder:  eventRecorder,
+		Scheme:    mgr.GetScheme(),
+		AgentPort: agentPort,
+		Budgets:   disruptionBudgetTracker,
+	}
+
+	if err = nodeHuntReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create node hunt controller", "controller", "NodeHunt")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = (&slonkv1.PhysicalNode{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PhysicalNode")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -154,58 +391,56 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupLog.Info("starting manager")
-	go func() {
-		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-			setupLog.Error(err, "problem running manager")
+	// Every replica serves the info server, only the leader runs the sync loop.
+	if err := mgr.Add(infoServer); err != nil {
+		setupLog.Error(err, "unable to add info server")
+		os.Exit(1)
+	}
+	blameConfig := blame.Config{
+		Window:       blameWindow,
+		MinFailures:  blameMinFailures,
+		Significance: blameSignificance,
+	}
+	if err := mgr.Add(&syncLoop{
+		nodeReconciler:     nodeReconciler,
+		jobReconciler:      jobReconciler,
+		nodeHuntReconciler: nodeHuntReconciler,
+		infoServer:         infoServer,
+		autoRemediate:      autoRemediate,
+		blameConfig:        blameConfig,
+		labelSuspects:      labelSuspects,
+	}); err != nil {
+		setupLog.Error(err, "unable to add sync loop")
+		os.Exit(1)
+	}
+	follower := &followerLoop{
+		client:      mgr.GetClient(),
+		elected:     mgr.Elected(),
+		infoServer:  infoServer,
+		blameConfig: blameConfig,
+		apiReader:   mgr.GetAPIReader(),
+	}
+	if enableLeaderElection {
+		namespace, err := os.ReadFile(IN_CLUSTER_NAMESPACE_PATH)
+		if err != nil {
+			setupLog.Error(err, "unable to read the namespace of the leader election lease, followers won't forward to the leader")
+		} else {
+			follower.leaseName = LEADER_ELECTION_ID
+			follower.leaseNamespace = strings.TrimSpace(string(namespace))
+		}
+		if _, follower.infoPort, err = net.SplitHostPort(infoAddr); err != nil {
+			setupLog.Error(err, "invalid info server address", "address", infoAddr)
 			os.Exit(1)
 		}
-	}()
-
-	setupLog.Info("starting info server")
-	infoServer := server.NewInfoServer(infoAddr)
-	go func() {
-		setupLog.Error(infoServer.Serve(), "Info server failed")
+	}
+	if err := mgr.Add(follower); err != nil {
+		setupLog.Error(err, "unable to add follower loop")
 		os.Exit(1)
-	}()
-
-	setupLog.Info("starting sync loop")
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-	iteration := 0
-	for {
-		select {
-		case <-ticker.C:
-			iteration++
-			physicalNodeMap, err := nodeReconciler.Sync(
-				context.Background(), "", autoRemediate,
-			)
-			if err != nil {
-				setupLog.Error(err, "unable to sync slurm and k8s nodes")
-				continue
-			}
-			if err := infoServer.UpdateNodes(physicalNodeMap); err != nil {
-				setupLog.Error(err, "unable to update physical nodes in info server")
-				continue
-			}
-
-			var slurmJobs map[int]*slonkv1.SlurmJob
-			if iteration%4 == 0 {
-				iteration = 0
-
-				slurmJobs, err = jobReconciler.Sync(
-					context.Background(), "", physicalNodeMap,
-				)
-				if err != nil {
-					setupLog.Error(err, "unable to sync slurm jobs")
-					continue
-				}
-				if err := infoServer.UpdateJobs(slurmJobs); err != nil {
-					setupLog.Error(err, "unable to update slurm jobs in info server")
-					continue
-				}
-			}
+	}
 
-		}
+	setupLog.Info("starting manager")
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "problem running manager")
+		os.Exit(1)
 	}
 }
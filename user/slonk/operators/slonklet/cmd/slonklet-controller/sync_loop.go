@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/blame"
+	"your-org.com/slonklet/internal/controller"
+	"your-org.com/slonklet/internal/metrics"
+	"your-org.com/slonklet/internal/server"
+)
+
+const (
+	SYNC_INTERVAL = 30 * time.Second
+	// Slurm jobs are synced every this many iterations of the sync loop.
+	JOB_SYNC_ITERATIONS = 4
+)
+
+// syncLoop periodically syncs physical nodes, node hunts and slurm jobs, and remediates
+// k8s nodes. It needs leader election, so only one replica acts on slurm and k8s.
+type syncLoop struct {
+	nodeReconciler     *controller.PhysicalNodeReconciler
+	jobReconciler      *controller.SlurmJobReconciler
+	nodeHuntReconciler *controller.NodeHuntReconciler
+	infoServer         *server.InfoServer
+
+	autoRemediate bool
+	blameConfig   blame.Config
+	labelSuspects bool
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (l *syncLoop) NeedLeaderElection() bool {
+	return true
+}
+
+// Start runs the sync loop until the context is cancelled. It implements
+// manager.Runnable, the manager starts it once the informer caches are synced and this
+// replica is elected.
+func (l *syncLoop) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Starting sync loop as the leader")
+	l.infoServer.SetLeader(true)
+
+	// Sync everything right away, so that a failover doesn't leave a whole interval
+	// without a leader acting.
+	iteration := 0
+	l.sync(ctx, true)
+
+	ticker := time.NewTicker(SYNC_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped sync loop")
+			return nil
+		case <-ticker.C:
+			iteration++
+			l.sync(ctx, iteration%JOB_SYNC_ITERATIONS == 0)
+		}
+	}
+}
+
+func (l *syncLoop) sync(ctx context.Context, syncJobs bool) {
+	logger := log.FromContext(ctx)
+
+	physicalNodeMap, err := l.nodeReconciler.Sync(ctx, "", l.autoRemediate)
+	if err != nil {
+		logger.Error(err, "unable to sync slurm and k8s nodes")
+		return
+	}
+	if err := l.infoServer.UpdateNodes(physicalNodeMap); err != nil {
+		logger.Error(err, "unable to update physical nodes in info server")
+		return
+	}
+	if err := l.infoServer.UpdateDisruptionBudgets(l.nodeReconciler.Budgets.Status()); err != nil {
+		logger.Error(err, "unable to update disruption budgets in info server")
+	}
+	if err := l.infoServer.UpdateRemediationPlan(l.nodeReconciler.RemediationPlan()); err != nil {
+		logger.Error(err, "unable to update remediation plan in info server")
+	}
+	if err := l.infoServer.UpdateUnregisteredSlurmPods(l.nodeReconciler.UnregisteredSlurmPods()); err != nil {
+		logger.Error(err, "unable to update unregistered slurm pods in info server")
+	}
+	if err := l.infoServer.UpdateManualOverrides(l.nodeReconciler.ManualOverrides()); err != nil {
+		logger.Error(err, "unable to update manual overrides in info server")
+	}
+	start := time.Now()
+	err = l.nodeHuntReconciler.Sync(ctx, "", physicalNodeMap)
+	metrics.ObservePhase(metrics.PHASE_NODE_HUNT_SYNC, start, err)
+	if err != nil {
+		logger.Error(err, "unable to sync node hunts")
+	}
+
+	if !syncJobs {
+		return
+	}
+	start = time.Now()
+	slurmJobs, err := l.jobReconciler.Sync(ctx, "", physicalNodeMap)
+	metrics.ObservePhase(metrics.PHASE_SLURM_JOB_SYNC, start, err)
+	if err != nil {
+		logger.Error(err, "unable to sync slurm jobs")
+		return
+	}
+	if err := l.infoServer.UpdateJobs(slurmJobs); err != nil {
+		logger.Error(err, "unable to update slurm jobs in info server")
+		return
+	}
+
+	blameReport := blame.Analyze(slurmJobs, blame.Groups(physicalNodeMap), l.blameConfig, time.Now())
+	if err := l.infoServer.UpdateBlame(blameReport); err != nil {
+		logger.Error(err, "unable to update blame report in info server")
+	}
+	// Also runs with labeling disabled, to remove the labels it set before.
+	l.nodeReconciler.LabelSuspectPhysicalNodes(ctx, physicalNodeMap, blameReport, l.labelSuspects)
+}
+
+// followerLoop fills the info server of a replica that is not the leader from its
+// informer cache, until the replica is elected and the sync loop takes over. The state
+// only the leader has, e.g. the remediation plan, is forwarded to the leader.
+type followerLoop struct {
+	client     client.Reader
+	elected    <-chan struct{}
+	infoServer *server.InfoServer
+
+	blameConfig blame.Config
+
+	// Uncached reader for the leader election lease and the pod of the leader.
+	apiReader client.Reader
+	// Leader election lease, empty if leader election is disabled.
+	leaseName      string
+	leaseNamespace string
+	// Port of the info server of the leader.
+	infoPort string
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (l *followerLoop) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (l *followerLoop) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	ticker := time.NewTicker(SYNC_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-l.elected:
+			logger.Info("Elected, stopped serving the info server from the cache")
+			return nil
+		case <-ticker.C:
+			if err := l.refresh(ctx); err != nil {
+				logger.Error(err, "unable to refresh info server from the cache")
+			}
+		}
+	}
+}
+
+func (l *followerLoop) refresh(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	leaderAddress, err := l.leaderAddress(ctx)
+	if err != nil {
+		// The views from the cache are still served.
+		logger.Info("Failed to find the leader", "error", err)
+	}
+	l.infoServer.SetLeaderAddress(leaderAddress)
+
+	physicalNodeList := &slonkv1.PhysicalNodeList{}
+	if err := l.client.List(ctx, physicalNodeList); err != nil {
+		return fmt.Errorf("list physical nodes: %w", err)
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+	for _, physicalNode := range physicalNodeList.Items {
+		physicalNodeCopy := physicalNode // Copy to avoid pointer reuse.
+		physicalNodeMap[physicalNode.Name] = &physicalNodeCopy
+	}
+	if err := l.infoServer.UpdateNodes(physicalNodeMap); err != nil {
+		return fmt.Errorf("update physical nodes in info server: %w", err)
+	}
+
+	slurmJobList := &slonkv1.SlurmJobList{}
+	if err := l.client.List(ctx, slurmJobList); err != nil {
+		return fmt.Errorf("list slurm jobs: %w", err)
+	}
+	slurmJobMap := map[int]*slonkv1.SlurmJob{}
+	for _, slurmJob := range slurmJobList.Items {
+		slurmJobCopy := slurmJob // Copy to avoid pointer reuse.
+		id, err := strconv.Atoi(slurmJob.Name)
+		if err != nil {
+			continue
+		}
+		slurmJobMap[id] = &slurmJobCopy
+	}
+	if err := l.infoServer.UpdateJobs(slurmJobMap); err != nil {
+		return fmt.Errorf("update slurm jobs in info server: %w", err)
+	}
+
+	if err := l.infoServer.UpdateBlame(blame.Analyze(slurmJobMap, blame.Groups(physicalNodeMap), l.blameConfig, time.Now())); err != nil {
+		return fmt.Errorf("update blame report in info server: %w", err)
+	}
+	return nil
+}
+
+// leaderAddress returns the info server address of the leader, from the pod holding the
+// leader election lease. It's empty if nobody holds the lease.
+func (l *followerLoop) leaderAddress(ctx context.Context) (string, error) {
+	if l.leaseName == "" {
+		return "", nil
+	}
+	lease := &coordinationv1.Lease{}
+	if err := l.apiReader.Get(ctx, types.NamespacedName{Name: l.leaseName, Namespace: l.leaseNamespace}, lease); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("get leader election lease: %w", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return "", nil
+	}
+	// Identities are the hostname, i.e. the pod name, followed by "_" and a unique suffix.
+	podName, _, _ := strings.Cut(*lease.Spec.HolderIdentity, "_")
+	pod := &corev1.Pod{}
+	if err := l.apiReader.Get(ctx, types.NamespacedName{Name: podName, Namespace: l.leaseNamespace}, pod); err != nil {
+		return "", fmt.Errorf("get leader pod %s: %w", podName, err)
+	}
+	if pod.Status.PodIP == "" {
+		return "", nil
+	}
+	return net.JoinHostPort(pod.Status.PodIP, l.infoPort), nil
+}
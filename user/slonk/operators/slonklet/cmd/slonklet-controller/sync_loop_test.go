@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/server"
+)
+
+func newFakeClientBuilder() *clientFake.ClientBuilder {
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+	_ = coordinationv1.AddToScheme(newScheme)
+	return clientFake.NewClientBuilder().WithScheme(newScheme)
+}
+
+func TestFollowerLoopLeaderAddress(t *testing.T) {
+	holderIdentity := "slonklet-controller-abcde_1b4e28ba-2fa1-11d2-883f-0016d3cca427"
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "slonklet-leader", Namespace: "slurm"},
+		Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holderIdentity},
+	}
+	leaderPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "slonklet-controller-abcde", Namespace: "slurm"},
+		Status:     corev1.PodStatus{PodIP: "10.0.0.7"},
+	}
+	loop := &followerLoop{
+		apiReader:      newFakeClientBuilder().WithObjects(lease, leaderPod).Build(),
+		leaseName:      "slonklet-leader",
+		leaseNamespace: "slurm",
+		infoPort:       "8082",
+	}
+	ctx := context.Background()
+
+	address, err := loop.leaderAddress(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.7:8082", address)
+
+	// Nobody holds the lease, e.g. right after the leader stepped down.
+	loop.apiReader = newFakeClientBuilder().WithObjects(&coordinationv1.Lease{ObjectMeta: lease.ObjectMeta}, leaderPod).Build()
+	address, err = loop.leaderAddress(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, address)
+
+	// The lease holder is gone.
+	loop.apiReader = newFakeClientBuilder().WithObjects(lease).Build()
+	_, err = loop.leaderAddress(ctx)
+	assert.ErrorContains(t, err, "get leader pod slonklet-controller-abcde")
+
+	// Leader election is disabled.
+	loop.leaseName = ""
+	address, err = loop.leaderAddress(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, address)
+}
+
+func TestFollowerLoopRefresh(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	infoServer := server.NewInfoServer(addr)
+	go infoServer.Start(ctx)
+
+	fakeClient := newFakeClientBuilder().WithObjects(
+		&slonkv1.PhysicalNode{
+			ObjectMeta: metav1.ObjectMeta{Name: "abc"},
+			Status: slonkv1.PhysicalNodeStatus{
+				K8sNodeStatus: slonkv1.K8sNodeStatus{Name: "gke-h100-0"},
+				Inventory:     &slonkv1.HardwareInventory{DriverVersion: "535.104.05"},
+			},
+		},
+		&slonkv1.SlurmJob{ObjectMeta: metav1.ObjectMeta{Name: "1"}},
+	).Build()
+	loop := &followerLoop{
+		client:     fakeClient,
+		apiReader:  fakeClient,
+		infoServer: infoServer,
+	}
+	assert.NoError(t, loop.refresh(ctx))
+
+	get := func(path string) string {
+		var body []byte
+		assert.Eventually(t, func() bool {
+			resp, err := http.Get(fmt.Sprintf("http://%s%s", addr, path))
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			body, err = io.ReadAll(resp.Body)
+			return err == nil && resp.StatusCode == http.StatusOK
+		}, 5*time.Second, 10*time.Millisecond)
+		return string(body)
+	}
+	assert.Contains(t, get("/nodes"), `"abc"`)
+	assert.Contains(t, get("/job/1"), `"name":"1"`)
+	assert.Contains(t, get("/inventory/gke-h100-0"), `"driverVersion":"535.104.05"`)
+	assert.JSONEq(t, `{"leader":false}`, get("/leader"))
+}
+
+func TestFollowerLoopStopsWhenElected(t *testing.T) {
+	elected := make(chan struct{})
+	loop := &followerLoop{elected: elected, infoServer: server.NewInfoServer(":0")}
+
+	done := make(chan error)
+	go func() {
+		done <- loop.Start(context.Background())
+	}()
+	close(elected)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower loop still running after the election")
+	}
+}
@@ -1,19 +1,36 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"your-org.com/slonklet/internal/inventory"
 	"your-org.com/slonklet/internal/task/core"
 	"your-org.com/slonklet/internal/task/queue"
 	"github.com/google/uuid"
 )
 
+const (
+	INVENTORY_RETRY_INTERVAL = time.Minute
+
+	SERVICE_ACCOUNT_TOKEN_PATH = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
 func main() {
 	port := flag.Int("port", 8080, "HTTP server port")
+	nodeName := flag.String("node-name", os.Getenv("NODE_NAME"), "Name of the k8s node the agent runs on")
+	controllerURL := flag.String("controller-url", "",
+		"URL of the slonklet-controller info server the hardware inventory is reported to, e.g. http://slonklet-api:18080. Empty disables it.")
+	inventoryInterval := flag.Duration("inventory-interval", time.Hour, "How often the hardware inventory is reported")
+	tokenFile := flag.String("token-file", SERVICE_ACCOUNT_TOKEN_PATH,
+		"Service account token the hardware inventory reports are authenticated with, it must be bound to a pod on the node")
 	flag.Parse()
 
 	localQueue, err := queue.NewLocalQueue("/etc/slurm/slonklet/task_state", "/etc/slurm/slonklet/task_log", log.Default())
@@ -26,8 +43,13 @@ func main() {
 		command := r.URL.Query().Get("command")
 		if command == "" {
 			http.Error(w, "command is required", http.StatusBadRequest)
+			return
 		}
-		localQueue.EnqueueShellCommandTask(taskID, command)
+		if _, err := localQueue.EnqueueShellCommandTask(taskID, command); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(uuid.UUID(taskID).String()))
 	})
 	http.HandleFunc("/job/state", func(w http.ResponseWriter, r *http.Request) {
 		taskIDStr := r.URL.Query().Get("id")
@@ -48,7 +70,57 @@ func main() {
 		w.Write([]byte(task.State))
 	})
 
+	http.HandleFunc("/inventory", func(w http.ResponseWriter, r *http.Request) {
+		hardwareInventory, err := inventory.Collect(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonResponse, err := json.Marshal(hardwareInventory)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonResponse)
+	})
+
+	if *controllerURL != "" {
+		if *nodeName == "" {
+			log.Fatalf("--node-name or NODE_NAME is required to report the hardware inventory\n")
+		}
+		go reportInventory(*controllerURL, *nodeName, *tokenFile, *inventoryInterval)
+	}
+
 	addr := fmt.Sprintf(":%d", *port)
 	log.Printf("Starting server on %s\n", addr)
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
+
+// reportInventory collects the hardware inventory and reports it to the controller, right
+// away and then on every interval.
+func reportInventory(controllerURL string, nodeName string, tokenFile string, interval time.Duration) {
+	for {
+		ctx := context.Background()
+		hardwareInventory, err := inventory.Collect(ctx)
+		if err != nil {
+			log.Printf("Failed to collect hardware inventory: %s\n", err)
+		} else if token, err := os.ReadFile(tokenFile); err != nil {
+			// Read on every report, the token is rotated.
+			log.Printf("Failed to read service account token: %s\n", err)
+		} else if err := inventory.Report(ctx, controllerURL, nodeName, strings.TrimSpace(string(token)), hardwareInventory); err != nil {
+			// Followers of a replicated controller reject reports, retry soon to reach the leader.
+			log.Printf("Failed to report hardware inventory: %s\n", err)
+			time.Sleep(minDuration(interval, INVENTORY_RETRY_INTERVAL))
+			continue
+		}
+		time.Sleep(interval)
+	}
+}
+
+func minDuration(a time.Duration, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,281 @@
+package blame
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	DEFAULT_WINDOW       = 14 * 24 * time.Hour
+	DEFAULT_MIN_FAILURES = 3
+	DEFAULT_SIGNIFICANCE = 0.01
+)
+
+// Failed slurm job states that say nothing about the hosts, the job was cancelled, ran out
+// of its time or its memory. Runs ending in them are ignored.
+var IGNORED_STATES = map[string]bool{
+	"CANCELLED":     true,
+	"TIMEOUT":       true,
+	"DEADLINE":      true,
+	"OUT_OF_MEMORY": true,
+}
+
+// Config tunes the analysis.
+type Config struct {
+	// Only runs last seen within this window are counted. 0 counts all of them.
+	Window time.Duration
+	// Physical nodes with fewer failed runs are never suspects, however unlikely their
+	// failure rate.
+	MinFailures int
+	// Family-wise significance level. It is divided by the number of physical nodes
+	// (Bonferroni), so a large fleet doesn't produce suspects by chance alone.
+	Significance float64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Window:       DEFAULT_WINDOW,
+		MinFailures:  DEFAULT_MIN_FAILURES,
+		Significance: DEFAULT_SIGNIFICANCE,
+	}
+}
+
+// NodeStats are the finished runs of the physical node and how unlikely its failures are.
+type NodeStats struct {
+	PhysicalNode string `json:"physicalNode"`
+	// Physical nodes are compared within their group, e.g. the same GPU type.
+	Group    string `json:"group,omitempty"`
+	Runs     int    `json:"runs"`
+	Failed   int    `json:"failed"`
+	NodeFail int    `json:"nodeFail"`
+	// Failed runs over runs.
+	FailureRate float64 `json:"failureRate"`
+	// Failure rate of the rest of its group.
+	BaselineRate float64 `json:"baselineRate"`
+	// Probability of at least this many failed runs if the physical node failed at the
+	// baseline rate.
+	PValue  float64 `json:"pValue"`
+	Suspect bool    `json:"suspect"`
+	// Failed job IDs, most recent first.
+	FailedJobs []int `json:"failedJobs,omitempty"`
+}
+
+// Report is the outcome of an analysis.
+type Report struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Window       string    `json:"window"`
+	Runs         int       `json:"runs"`
+	Failed       int       `json:"failed"`
+	BaselineRate float64   `json:"baselineRate"`
+	// Per physical node p-value below which it is a suspect.
+	Threshold float64 `json:"threshold"`
+	// Suspects first, then by ascending p-value.
+	Nodes []*NodeStats `json:"nodes"`
+}
+
+// Suspects returns the names of the suspect physical nodes.
+func (r *Report) Suspects() map[string]bool {
+	suspects := map[string]bool{}
+	for _, stats := range r.Nodes {
+		if stats.Suspect {
+			suspects[stats.PhysicalNode] = true
+		}
+	}
+	return suspects
+}
+
+// run is the final observed state of a job run.
+type run struct {
+	jobID    int
+	state    string
+	lastSeen time.Time
+	nodes    map[string]bool
+}
+
+// Analyze attributes the finished runs of the slurm jobs to the physical nodes they ran
+// on, and flags the physical nodes failing significantly more often than the rest of their
+// group, so e.g. GPU types with different failure rates don't make each other suspect.
+// groups maps physical node names to their group, see Groups, nodes missing from it form
+// a group of their own. A failed multi-node run is blamed on all of its nodes: an innocent
+// node shares the blame with different hosts each time, a bad one keeps showing up.
+func Analyze(slurmJobMap map[int]*slonkv1.SlurmJob, groups map[string]string, config Config, now time.Time) *Report {
+	report := &Report{
+		Timestamp: now,
+		Window:    config.Window.String(),
+		Nodes:     []*NodeStats{},
+	}
+
+	statsMap := map[string]*NodeStats{}
+	failedJobTimes := map[string]map[int]time.Time{}
+	for jobID, slurmJob := range slurmJobMap {
+		for _, run := range jobRuns(jobID, slurmJob) {
+			finished := slurm.SLURM_JOB_COMPLETED_STATES[run.state] || slurm.SLURM_JOB_FAILED_STATES[run.state]
+			if !finished || IGNORED_STATES[run.state] || len(run.nodes) == 0 {
+				continue
+			}
+			if config.Window > 0 && now.Sub(run.lastSeen) > config.Window {
+				continue
+			}
+			failed := slurm.SLURM_JOB_FAILED_STATES[run.state]
+			report.Runs++
+			if failed {
+				report.Failed++
+			}
+			for physicalNodeName := range run.nodes {
+				stats, ok := statsMap[physicalNodeName]
+				if !ok {
+					stats = &NodeStats{PhysicalNode: physicalNodeName, Group: groups[physicalNodeName]}
+					statsMap[physicalNodeName] = stats
+					failedJobTimes[physicalNodeName] = map[int]time.Time{}
+				}
+				stats.Runs++
+				if !failed {
+					continue
+				}
+				stats.Failed++
+				if run.state == "NODE_FAIL" {
+					stats.NodeFail++
+				}
+				if run.lastSeen.After(failedJobTimes[physicalNodeName][run.jobID]) {
+					failedJobTimes[physicalNodeName][run.jobID] = run.lastSeen
+				}
+			}
+		}
+	}
+	if report.Runs > 0 {
+		report.BaselineRate = float64(report.Failed) / float64(report.Runs)
+	}
+	if len(statsMap) > 0 {
+		report.Threshold = config.Significance / float64(len(statsMap))
+	}
+
+	// Runs of a node are compared with the runs of the nodes of its group. A multi-node run
+	// counts once per node, so the totals are summed over nodes rather than taken from the
+	// report.
+	totalRuns, totalFailed := map[string]int{}, map[string]int{}
+	for _, stats := range statsMap {
+		totalRuns[stats.Group] += stats.Runs
+		totalFailed[stats.Group] += stats.Failed
+	}
+	for physicalNodeName, stats := range statsMap {
+		stats.FailureRate = float64(stats.Failed) / float64(stats.Runs)
+		// Leave the node itself out of its baseline, so a bad node doesn't raise the bar
+		// it's measured against. A node alone in its group is measured against the fleet.
+		otherRuns := totalRuns[stats.Group] - stats.Runs
+		if otherRuns > 0 {
+			stats.BaselineRate = float64(totalFailed[stats.Group]-stats.Failed) / float64(otherRuns)
+		} else {
+			stats.BaselineRate = report.BaselineRate
+		}
+		stats.PValue = BinomialTail(stats.Runs, stats.Failed, stats.BaselineRate)
+		stats.Suspect = stats.Failed >= config.MinFailures &&
+			stats.FailureRate > stats.BaselineRate &&
+			stats.PValue < report.Threshold
+
+		for jobID := range failedJobTimes[physicalNodeName] {
+			stats.FailedJobs = append(stats.FailedJobs, jobID)
+		}
+		times := failedJobTimes[physicalNodeName]
+		sort.Slice(stats.FailedJobs, func(i, j int) bool {
+			ti, tj := times[stats.FailedJobs[i]], times[stats.FailedJobs[j]]
+			if !ti.Equal(tj) {
+				return ti.After(tj)
+			}
+			return stats.FailedJobs[i] > stats.FailedJobs[j]
+		})
+		report.Nodes = append(report.Nodes, stats)
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		a, b := report.Nodes[i], report.Nodes[j]
+		if a.Suspect != b.Suspect {
+			return a.Suspect
+		}
+		if a.PValue != b.PValue {
+			return a.PValue < b.PValue
+		}
+		return a.PhysicalNode < b.PhysicalNode
+	})
+	return report
+}
+
+// Groups returns the group of each physical node, the product name of its GPUs from its
+// inventory, or its nodepool until the agent reports one.
+func Groups(physicalNodeMap map[string]*slonkv1.PhysicalNode) map[string]string {
+	groups := map[string]string{}
+	for name, physicalNode := range physicalNodeMap {
+		status := physicalNode.Status
+		if status.Inventory != nil && len(status.Inventory.GPUs) > 0 && status.Inventory.GPUs[0].ProductName != "" {
+			groups[name] = status.Inventory.GPUs[0].ProductName
+		} else if status.Topology != nil && status.Topology.Nodepool != "" {
+			groups[name] = status.Topology.Nodepool
+		}
+	}
+	return groups
+}
+
+// jobRuns returns the final observed state of each run of the slurm job. The status keeps
+// a record per state change, the latest record of a run tells how it ended.
+func jobRuns(jobID int, slurmJob *slonkv1.SlurmJob) []*run {
+	statuses := append([]slonkv1.SlurmJobRunStatus{}, slurmJob.Status.SlurmJobRunStatusHistory...)
+	if !slurmJob.Status.SlurmJobRunCurrentStatus.Removed {
+		statuses = append(statuses, slurmJob.Status.SlurmJobRunCurrentStatus)
+	}
+
+	latest := map[int]*slonkv1.SlurmJobRunStatus{}
+	for i := range statuses {
+		status := &statuses[i]
+		if status.Removed {
+			continue
+		}
+		if existing, ok := latest[status.RunID]; !ok || status.LastSyncTimestamp.After(existing.LastSyncTimestamp.Time) {
+			latest[status.RunID] = status
+		}
+	}
+
+	runs := []*run{}
+	for _, status := range latest {
+		nodes := map[string]bool{}
+		for _, snapshot := range status.PhysicalNodeSnapshots {
+			if snapshot != nil && snapshot.PhysicalNodeName != "" {
+				nodes[snapshot.PhysicalNodeName] = true
+			}
+		}
+		runs = append(runs, &run{
+			jobID:    jobID,
+			state:    status.State,
+			lastSeen: status.LastSyncTimestamp.Time,
+			nodes:    nodes,
+		})
+	}
+	return runs
+}
+
+// BinomialTail returns the probability of at least k successes in n trials of
+// probability p.
+func BinomialTail(n int, k int, p float64) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if k > n {
+		return 0
+	}
+	if p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return 1
+	}
+	lgn, _ := math.Lgamma(float64(n + 1))
+	logP, logQ := math.Log(p), math.Log1p(-p)
+	tail := 0.0
+	for i := k; i <= n; i++ {
+		lgi, _ := math.Lgamma(float64(i + 1))
+		lgni, _ := math.Lgamma(float64(n - i + 1))
+		tail += math.Exp(lgn - lgi - lgni + float64(i)*logP + float64(n-i)*logQ)
+	}
+	return math.Min(tail, 1)
+}
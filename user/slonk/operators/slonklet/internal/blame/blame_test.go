@@ -0,0 +1,183 @@
+package blame
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func newRunStatus(runID int, state string, lastSeen time.Time, physicalNodeNames ...string) slonkv1.SlurmJobRunStatus {
+	snapshots := map[string]*slonkv1.PhysicalNodeSnapshot{}
+	for _, name := range physicalNodeNames {
+		snapshots["slurm-"+name] = &slonkv1.PhysicalNodeSnapshot{PhysicalNodeName: name}
+	}
+	return slonkv1.SlurmJobRunStatus{
+		RunID:                 runID,
+		State:                 state,
+		PhysicalNodeSnapshots: snapshots,
+		LastSyncTimestamp:     metav1.NewTime(lastSeen),
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Hour)
+	slurmJobMap := map[int]*slonkv1.SlurmJob{}
+
+	// 40 two-node jobs spread over 20 nodes, with a few unrelated failures.
+	for i := 0; i < 40; i++ {
+		state := "COMPLETED"
+		if i%10 == 0 {
+			state = "FAILED"
+		}
+		slurmJobMap[i] = &slonkv1.SlurmJob{Status: slonkv1.SlurmJobStatus{
+			SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{
+				newRunStatus(0, "RUNNING", recent.Add(-time.Minute), fmt.Sprintf("pn-%d", i%20), fmt.Sprintf("pn-%d", (i+1)%20)),
+				newRunStatus(0, state, recent, fmt.Sprintf("pn-%d", i%20), fmt.Sprintf("pn-%d", (i+1)%20)),
+			},
+			SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true},
+		}}
+	}
+	// The bad node fails most jobs it runs, alongside different healthy nodes.
+	for i := 0; i < 6; i++ {
+		state := "FAILED"
+		if i == 0 {
+			state = "NODE_FAIL"
+		}
+		slurmJobMap[100+i] = &slonkv1.SlurmJob{Status: slonkv1.SlurmJobStatus{
+			SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{
+				newRunStatus(0, state, recent.Add(time.Duration(i)*time.Minute), "pn-bad", fmt.Sprintf("pn-%d", i)),
+			},
+			SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true},
+		}}
+	}
+	// Still running, cancelled and old runs don't count.
+	slurmJobMap[200] = &slonkv1.SlurmJob{Status: slonkv1.SlurmJobStatus{
+		SlurmJobRunCurrentStatus: newRunStatus(0, "RUNNING", recent, "pn-bad"),
+	}}
+	slurmJobMap[201] = &slonkv1.SlurmJob{Status: slonkv1.SlurmJobStatus{
+		SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{newRunStatus(0, "CANCELLED", recent, "pn-bad")},
+		SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true},
+	}}
+	slurmJobMap[202] = &slonkv1.SlurmJob{Status: slonkv1.SlurmJobStatus{
+		SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{newRunStatus(0, "FAILED", now.Add(-30*24*time.Hour), "pn-0")},
+		SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true},
+	}}
+
+	report := Analyze(slurmJobMap, nil, DefaultConfig(), now)
+	assert.Equal(t, 46, report.Runs)
+	assert.Equal(t, 10, report.Failed)
+	assert.Equal(t, map[string]bool{"pn-bad": true}, report.Suspects())
+
+	bad := report.Nodes[0]
+	assert.Equal(t, "pn-bad", bad.PhysicalNode)
+	assert.Equal(t, 6, bad.Runs)
+	assert.Equal(t, 6, bad.Failed)
+	assert.Equal(t, 1, bad.NodeFail)
+	assert.Equal(t, []int{105, 104, 103, 102, 101, 100}, bad.FailedJobs)
+	assert.Less(t, bad.PValue, report.Threshold)
+
+	for _, stats := range report.Nodes[1:] {
+		assert.False(t, stats.Suspect, stats.PhysicalNode)
+	}
+
+	// Too few failures to tell.
+	config := DefaultConfig()
+	config.MinFailures = 7
+	assert.Empty(t, Analyze(slurmJobMap, nil, config, now).Suspects())
+}
+
+func TestAnalyzeRestartedRuns(t *testing.T) {
+	now := time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC)
+	slurmJobMap := map[int]*slonkv1.SlurmJob{
+		1: {Status: slonkv1.SlurmJobStatus{
+			SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{
+				newRunStatus(1, "RUNNING", now.Add(-2*time.Hour), "pn-0"),
+				newRunStatus(1, "NODE_FAIL", now.Add(-90*time.Minute), "pn-0"),
+				newRunStatus(2, "RUNNING", now.Add(-time.Hour), "pn-1"),
+			},
+			SlurmJobRunCurrentStatus: newRunStatus(2, "COMPLETED", now.Add(-time.Minute), "pn-1"),
+		}},
+	}
+	report := Analyze(slurmJobMap, nil, DefaultConfig(), now)
+	assert.Equal(t, 2, report.Runs)
+	assert.Equal(t, 1, report.Failed)
+	for _, stats := range report.Nodes {
+		switch stats.PhysicalNode {
+		case "pn-0":
+			assert.Equal(t, 1, stats.NodeFail)
+			assert.Equal(t, []int{1}, stats.FailedJobs)
+		case "pn-1":
+			assert.Equal(t, 0, stats.Failed)
+			assert.Equal(t, 1, stats.Runs)
+		}
+	}
+}
+
+func TestAnalyzeGroups(t *testing.T) {
+	now := time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC)
+	slurmJobMap := map[int]*slonkv1.SlurmJob{}
+	addRuns := func(physicalNodeName string, runs int, failed int) {
+		for i := 0; i < runs; i++ {
+			state := "COMPLETED"
+			if i < failed {
+				state = "FAILED"
+			}
+			slurmJobMap[len(slurmJobMap)] = &slonkv1.SlurmJob{Status: slonkv1.SlurmJobStatus{
+				SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{newRunStatus(0, state, now.Add(-time.Hour), physicalNodeName)},
+				SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true},
+			}}
+		}
+	}
+
+	// A GPU type failing half of its jobs, next to a reliable one.
+	groups := map[string]string{}
+	for i := 0; i < 5; i++ {
+		addRuns(fmt.Sprintf("a100-%d", i), 20, 10)
+		groups[fmt.Sprintf("a100-%d", i)] = "NVIDIA A100-SXM4-80GB"
+		addRuns(fmt.Sprintf("h100-%d", i), 100, 0)
+		groups[fmt.Sprintf("h100-%d", i)] = "NVIDIA H100 80GB HBM3"
+	}
+
+	// Against the whole fleet, every A100 stands out.
+	assert.Len(t, Analyze(slurmJobMap, nil, DefaultConfig(), now).Suspects(), 5)
+
+	// Against the other A100s, none does.
+	report := Analyze(slurmJobMap, groups, DefaultConfig(), now)
+	assert.Empty(t, report.Suspects())
+	for _, stats := range report.Nodes {
+		assert.Equal(t, groups[stats.PhysicalNode], stats.Group)
+		if stats.Group == "NVIDIA A100-SXM4-80GB" {
+			assert.InDelta(t, 0.5, stats.BaselineRate, 1e-9)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"inventory": {Status: slonkv1.PhysicalNodeStatus{
+			Inventory: &slonkv1.HardwareInventory{GPUs: []slonkv1.GPUInventory{{ProductName: "NVIDIA H100 80GB HBM3"}}},
+			Topology:  &slonkv1.Topology{Nodepool: "h100"},
+		}},
+		"nodepool": {Status: slonkv1.PhysicalNodeStatus{Topology: &slonkv1.Topology{Nodepool: "h100"}}},
+		"unknown":  {},
+	}
+	assert.Equal(t, map[string]string{
+		"inventory": "NVIDIA H100 80GB HBM3",
+		"nodepool":  "h100",
+	}, Groups(physicalNodeMap))
+}
+
+func TestBinomialTail(t *testing.T) {
+	assert.Equal(t, 1.0, BinomialTail(10, 0, 0.1))
+	assert.Equal(t, 0.0, BinomialTail(10, 11, 0.1))
+	assert.Equal(t, 0.0, BinomialTail(10, 1, 0))
+	assert.InDelta(t, 0.5, BinomialTail(1, 1, 0.5), 1e-9)
+	assert.InDelta(t, 1-0.9*0.9, BinomialTail(2, 1, 0.1), 1e-9)
+	assert.InDelta(t, 1e-6, BinomialTail(6, 6, 0.1), 1e-12)
+}
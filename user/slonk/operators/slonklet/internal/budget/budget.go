@@ -0,0 +1,374 @@
+package budget
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	LABEL_GKE_NODEPOOL = "cloud.google.com/gke-nodepool"
+	LABEL_ZONE         = "topology.kubernetes.io/zone"
+
+	// Physical node name of a k8s node, see controller.GPU_UUID_HASH_ANNOTATION.
+	ANNOTATION_GPU_UUID_HASH = "slonk.your-org.com/gpu-uuid-hash"
+
+	DEFAULT_WINDOW = time.Hour
+)
+
+// DisruptionBudget limits how many physical nodes in a group of k8s nodes can be
+// remediated. Groups are formed by the values of LabelKeys, e.g. one group per
+// nodepool and zone.
+type DisruptionBudget struct {
+	Name string `json:"name"`
+
+	// K8s node label keys used to partition nodes into groups.
+	LabelKeys []string `json:"labelKeys,omitempty"`
+	// Only k8s nodes matching all of these labels are subject to the budget.
+	Selector map[string]string `json:"selector,omitempty"`
+
+	// Maximum number of distinct physical nodes disrupted per group within the window.
+	// Zero means no absolute limit.
+	MaxDisruptions int `json:"maxDisruptions,omitempty"`
+	// Maximum percentage of nodes in a group disrupted within the window, rounded up.
+	// Zero means no percentage limit.
+	MaxDisruptionsPercent int `json:"maxDisruptionsPercent,omitempty"`
+	// Sliding window for MaxDisruptions and MaxDisruptionsPercent.
+	Window metav1.Duration `json:"window,omitempty"`
+	// Maximum number of remediations in flight per group, i.e. acted on but the
+	// k8s node still carries a lifecycle taint. Zero means no limit.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// DisruptionBudgetStatus is a snapshot of a budget for a single group.
+type DisruptionBudgetStatus struct {
+	Name        string   `json:"name"`
+	Group       string   `json:"group"`
+	GroupSize   int      `json:"groupSize"`
+	Limit       int      `json:"limit"`
+	Used        int      `json:"used"`
+	InFlight    int      `json:"inFlight"`
+	MaxInFlight int      `json:"maxInFlight,omitempty"`
+	Exhausted   bool     `json:"exhausted"`
+	Blocked     []string `json:"blocked,omitempty"`
+}
+
+// DefaultDisruptionBudgets returns the budgets used when no config is given. They only
+// group by nodepool, budgets per zone or GPU type need a config with those label keys.
+func DefaultDisruptionBudgets() []DisruptionBudget {
+	return []DisruptionBudget{
+		{
+			Name:                  "nodepool",
+			LabelKeys:             []string{LABEL_GKE_NODEPOOL},
+			MaxDisruptionsPercent: 10,
+			Window:                metav1.Duration{Duration: DEFAULT_WINDOW},
+			MaxInFlight:           10,
+		},
+	}
+}
+
+// LoadDisruptionBudgets reads a list of budgets from a YAML or JSON file.
+func LoadDisruptionBudgets(path string) ([]DisruptionBudget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read disruption budget config: %w", err)
+	}
+	budgets := []DisruptionBudget{}
+	if err := yaml.Unmarshal(data, &budgets); err != nil {
+		return nil, fmt.Errorf("decode disruption budget config: %w", err)
+	}
+	for i := range budgets {
+		if budgets[i].Name == "" {
+			return nil, fmt.Errorf("disruption budget %d has no name", i)
+		}
+		if budgets[i].Window.Duration == 0 {
+			budgets[i].Window.Duration = DEFAULT_WINDOW
+		}
+	}
+	return budgets, nil
+}
+
+type disruption struct {
+	physicalNodeName string
+	k8sNodeName      string
+	timestamp        time.Time
+}
+
+// Tracker keeps track of disruptions per budget group. All methods are safe to
+// call on a nil tracker, in which case every disruption is allowed.
+//
+// Disruptions within the window are only kept in memory and start over after a restart or
+// a failover. Remediations in flight are rebuilt from the k8s nodes on every refresh.
+type Tracker struct {
+	sync.RWMutex
+
+	budgets []DisruptionBudget
+
+	// Budget name -> group -> disruptions within the window.
+	disruptions map[string]map[string][]disruption
+	// Budget name -> group -> number of k8s nodes in the group.
+	groupSizes map[string]map[string]int
+	// Budget name -> group -> physical nodes blocked in the current iteration.
+	blocked map[string]map[string]map[string]bool
+	// Physical node name -> k8s node name, for remediations still in flight.
+	inFlight map[string]string
+	// K8s node name -> labels, for nodes seen in the last refresh.
+	nodeLabels map[string]map[string]string
+}
+
+func NewTracker(budgets []DisruptionBudget) *Tracker {
+	return &Tracker{
+		budgets:     budgets,
+		disruptions: map[string]map[string][]disruption{},
+		groupSizes:  map[string]map[string]int{},
+		blocked:     map[string]map[string]map[string]bool{},
+		inFlight:    map[string]string{},
+		nodeLabels:  map[string]map[string]string{},
+	}
+}
+
+// Refresh recomputes group sizes and in-flight remediations from the current k8s
+// nodes, and expires disruptions that fall out of their window. It should be
+// called once per iteration before Allow and Record. K8s nodes in flight are tracked
+// by the physical node in their gpu uuid hash annotation, so that remediations started
+// before a restart or by a former leader still count.
+func (t *Tracker) Refresh(
+	k8sNodeMap map[string]*corev1.Node,
+	isInFlight func(*corev1.Node) bool,
+	now time.Time,
+) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	t.nodeLabels = map[string]map[string]string{}
+	t.groupSizes = map[string]map[string]int{}
+	t.blocked = map[string]map[string]map[string]bool{}
+	for _, b := range t.budgets {
+		t.groupSizes[b.Name] = map[string]int{}
+		for _, k8sNode := range k8sNodeMap {
+			if !b.matches(k8sNode.Labels) {
+				continue
+			}
+			t.groupSizes[b.Name][b.group(k8sNode.Labels)]++
+		}
+	}
+	for _, k8sNode := range k8sNodeMap {
+		t.nodeLabels[k8sNode.Name] = k8sNode.Labels
+	}
+
+	// A remediation is finished once its k8s node is gone or no longer needs action.
+	for physicalNodeName, k8sNodeName := range t.inFlight {
+		k8sNode, ok := k8sNodeMap[k8sNodeName]
+		if !ok || !isInFlight(k8sNode) {
+			delete(t.inFlight, physicalNodeName)
+		}
+	}
+	for _, k8sNode := range k8sNodeMap {
+		physicalNodeName := k8sNode.Annotations[ANNOTATION_GPU_UUID_HASH]
+		if physicalNodeName == "" || !isInFlight(k8sNode) {
+			continue
+		}
+		if _, ok := t.inFlight[physicalNodeName]; !ok {
+			t.inFlight[physicalNodeName] = k8sNode.Name
+		}
+	}
+
+	for _, b := range t.budgets {
+		for group, records := range t.disruptions[b.Name] {
+			kept := []disruption{}
+			for _, d := range records {
+				if now.Sub(d.timestamp) < b.Window.Duration {
+					kept = append(kept, d)
+				}
+			}
+			if len(kept) == 0 {
+				delete(t.disruptions[b.Name], group)
+			} else {
+				t.disruptions[b.Name][group] = kept
+			}
+		}
+	}
+}
+
+// Allow returns whether the physical node on the given k8s node can be disrupted
+// without exceeding any budget. Nodes already counted in a budget window or still
+// in flight are always allowed, so an ongoing remediation can make progress.
+func (t *Tracker) Allow(k8sNode *corev1.Node, physicalNodeName string) (bool, string) {
+	if t == nil {
+		return true, ""
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.inFlight[physicalNodeName]; ok {
+		return true, ""
+	}
+
+	for _, b := range t.budgets {
+		if !b.matches(k8sNode.Labels) {
+			continue
+		}
+		group := b.group(k8sNode.Labels)
+		if t.counted(b.Name, group, physicalNodeName) {
+			continue
+		}
+
+		limit := b.limit(t.groupSizes[b.Name][group])
+		used := len(t.disruptions[b.Name][group])
+		if limit >= 0 && used >= limit {
+			t.block(b.Name, group, physicalNodeName)
+			return false, fmt.Sprintf("budget %s exhausted for group %q: %d/%d disruptions within %s", b.Name, group, used, limit, b.Window.Duration)
+		}
+		inFlight := t.countInFlight(b, group)
+		if b.MaxInFlight > 0 && inFlight >= b.MaxInFlight {
+			t.block(b.Name, group, physicalNodeName)
+			return false, fmt.Sprintf("budget %s exhausted for group %q: %d/%d remediations in flight", b.Name, group, inFlight, b.MaxInFlight)
+		}
+	}
+
+	return true, ""
+}
+
+// Record counts a disruption of the physical node against every matching budget.
+func (t *Tracker) Record(k8sNode *corev1.Node, physicalNodeName string, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	t.inFlight[physicalNodeName] = k8sNode.Name
+	t.nodeLabels[k8sNode.Name] = k8sNode.Labels
+	for _, b := range t.budgets {
+		if !b.matches(k8sNode.Labels) {
+			continue
+		}
+		group := b.group(k8sNode.Labels)
+		if t.counted(b.Name, group, physicalNodeName) {
+			continue
+		}
+		if _, ok := t.disruptions[b.Name]; !ok {
+			t.disruptions[b.Name] = map[string][]disruption{}
+		}
+		t.disruptions[b.Name][group] = append(t.disruptions[b.Name][group], disruption{
+			physicalNodeName: physicalNodeName,
+			k8sNodeName:      k8sNode.Name,
+			timestamp:        now,
+		})
+	}
+}
+
+// Status returns a snapshot of all budget groups, sorted by budget and group name.
+func (t *Tracker) Status() []DisruptionBudgetStatus {
+	if t == nil {
+		return nil
+	}
+	t.RLock()
+	defer t.RUnlock()
+
+	statuses := []DisruptionBudgetStatus{}
+	for _, b := range t.budgets {
+		for group, size := range t.groupSizes[b.Name] {
+			limit := b.limit(size)
+			used := len(t.disruptions[b.Name][group])
+			inFlight := t.countInFlight(b, group)
+			blocked := []string{}
+			for name := range t.blocked[b.Name][group] {
+				blocked = append(blocked, name)
+			}
+			sort.Strings(blocked)
+			statuses = append(statuses, DisruptionBudgetStatus{
+				Name:        b.Name,
+				Group:       group,
+				GroupSize:   size,
+				Limit:       limit,
+				Used:        used,
+				InFlight:    inFlight,
+				MaxInFlight: b.MaxInFlight,
+				Exhausted:   (limit >= 0 && used >= limit) || (b.MaxInFlight > 0 && inFlight >= b.MaxInFlight),
+				Blocked:     blocked,
+			})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Name != statuses[j].Name {
+			return statuses[i].Name < statuses[j].Name
+		}
+		return statuses[i].Group < statuses[j].Group
+	})
+	return statuses
+}
+
+func (t *Tracker) counted(budgetName string, group string, physicalNodeName string) bool {
+	for _, d := range t.disruptions[budgetName][group] {
+		if d.physicalNodeName == physicalNodeName {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tracker) countInFlight(b DisruptionBudget, group string) int {
+	count := 0
+	for _, k8sNodeName := range t.inFlight {
+		labels, ok := t.nodeLabels[k8sNodeName]
+		if ok && b.matches(labels) && b.group(labels) == group {
+			count++
+		}
+	}
+	return count
+}
+
+func (t *Tracker) block(budgetName string, group string, physicalNodeName string) {
+	if _, ok := t.blocked[budgetName]; !ok {
+		t.blocked[budgetName] = map[string]map[string]bool{}
+	}
+	if _, ok := t.blocked[budgetName][group]; !ok {
+		t.blocked[budgetName][group] = map[string]bool{}
+	}
+	t.blocked[budgetName][group][physicalNodeName] = true
+}
+
+func (b *DisruptionBudget) matches(labels map[string]string) bool {
+	for k, v := range b.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *DisruptionBudget) group(labels map[string]string) string {
+	values := make([]string, 0, len(b.LabelKeys))
+	for _, key := range b.LabelKeys {
+		values = append(values, labels[key])
+	}
+	return strings.Join(values, "/")
+}
+
+// limit returns the number of disruptions allowed in a group of the given size,
+// or -1 if the budget has no window limit.
+func (b *DisruptionBudget) limit(groupSize int) int {
+	limit := -1
+	if b.MaxDisruptions > 0 {
+		limit = b.MaxDisruptions
+	}
+	if b.MaxDisruptionsPercent > 0 {
+		percentLimit := int(math.Ceil(float64(groupSize) * float64(b.MaxDisruptionsPercent) / 100))
+		if limit < 0 || percentLimit < limit {
+			limit = percentLimit
+		}
+	}
+	return limit
+}
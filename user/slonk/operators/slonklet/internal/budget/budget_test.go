@@ -0,0 +1,155 @@
+package budget
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func makeNodes(pool string, zone string, count int) map[string]*corev1.Node {
+	nodes := map[string]*corev1.Node{}
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s-%s-%d", pool, zone, i)
+		nodes[name] = &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					LABEL_GKE_NODEPOOL: pool,
+					LABEL_ZONE:         zone,
+				},
+			},
+		}
+	}
+	return nodes
+}
+
+func TestTrackerPercentLimit(t *testing.T) {
+	nodes := makeNodes("h100", "a", 20)
+	for name, node := range makeNodes("a100", "a", 10) {
+		nodes[name] = node
+	}
+	tracker := NewTracker([]DisruptionBudget{
+		{
+			Name:                  "nodepool",
+			LabelKeys:             []string{LABEL_GKE_NODEPOOL},
+			MaxDisruptionsPercent: 10,
+			Window:                metav1.Duration{Duration: time.Hour},
+		},
+	})
+	now := time.Now()
+	inFlight := func(*corev1.Node) bool { return true }
+	tracker.Refresh(nodes, inFlight, now)
+
+	// 10% of 20 nodes is 2 disruptions.
+	for i := 0; i < 2; i++ {
+		node := nodes[fmt.Sprintf("h100-a-%d", i)]
+		allowed, _ := tracker.Allow(node, node.Name)
+		assert.True(t, allowed)
+		tracker.Record(node, node.Name, now)
+	}
+	allowed, reason := tracker.Allow(nodes["h100-a-2"], "h100-a-2")
+	assert.False(t, allowed)
+	assert.Contains(t, reason, "nodepool")
+
+	// Already disrupted nodes can still make progress.
+	allowed, _ = tracker.Allow(nodes["h100-a-0"], "h100-a-0")
+	assert.True(t, allowed)
+
+	// Other pools are not affected.
+	allowed, _ = tracker.Allow(nodes["a100-a-0"], "a100-a-0")
+	assert.True(t, allowed)
+
+	statuses := tracker.Status()
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, "h100", statuses[1].Group)
+	assert.True(t, statuses[1].Exhausted)
+	assert.Equal(t, []string{"h100-a-2"}, statuses[1].Blocked)
+
+	// Disruptions expire after the window once remediations are done.
+	tracker.Refresh(nodes, func(*corev1.Node) bool { return false }, now.Add(2*time.Hour))
+	allowed, _ = tracker.Allow(nodes["h100-a-2"], "h100-a-2")
+	assert.True(t, allowed)
+}
+
+func TestTrackerAbsoluteAndInFlightLimit(t *testing.T) {
+	nodes := makeNodes("h100", "a", 100)
+	tracker := NewTracker([]DisruptionBudget{
+		{
+			Name:           "zone",
+			LabelKeys:      []string{LABEL_GKE_NODEPOOL, LABEL_ZONE},
+			MaxDisruptions: 5,
+			Window:         metav1.Duration{Duration: time.Hour},
+			MaxInFlight:    1,
+		},
+	})
+	now := time.Now()
+	tainted := map[string]bool{}
+	inFlight := func(node *corev1.Node) bool { return tainted[node.Name] }
+	tracker.Refresh(nodes, inFlight, now)
+
+	node0 := nodes["h100-a-0"]
+	allowed, _ := tracker.Allow(node0, node0.Name)
+	assert.True(t, allowed)
+	tracker.Record(node0, node0.Name, now)
+	tainted[node0.Name] = true
+
+	// Only one remediation may be in flight.
+	node1 := nodes["h100-a-1"]
+	allowed, reason := tracker.Allow(node1, node1.Name)
+	assert.False(t, allowed)
+	assert.Contains(t, reason, "in flight")
+
+	// Once the first remediation finishes, the next one can start.
+	tainted[node0.Name] = false
+	tracker.Refresh(nodes, inFlight, now.Add(time.Minute))
+	allowed, _ = tracker.Allow(node1, node1.Name)
+	assert.True(t, allowed)
+	assert.Equal(t, "h100/a", tracker.Status()[0].Group)
+	assert.Equal(t, 1, tracker.Status()[0].Used)
+}
+
+func TestTrackerInFlightAfterRestart(t *testing.T) {
+	nodes := makeNodes("h100", "a", 10)
+	for name, node := range nodes {
+		node.Annotations = map[string]string{ANNOTATION_GPU_UUID_HASH: "physical-" + name}
+	}
+	budgets := []DisruptionBudget{
+		{
+			Name:        "nodepool",
+			LabelKeys:   []string{LABEL_GKE_NODEPOOL},
+			Window:      metav1.Duration{Duration: time.Hour},
+			MaxInFlight: 1,
+		},
+	}
+	tainted := map[string]bool{"h100-a-0": true}
+	inFlight := func(node *corev1.Node) bool { return tainted[node.Name] }
+
+	// A new tracker, e.g. of a new leader, picks up the remediation still in flight.
+	tracker := NewTracker(budgets)
+	tracker.Refresh(nodes, inFlight, time.Now())
+	assert.Equal(t, 1, tracker.Status()[0].InFlight)
+	allowed, reason := tracker.Allow(nodes["h100-a-1"], "physical-h100-a-1")
+	assert.False(t, allowed)
+	assert.Contains(t, reason, "1/1 remediations in flight")
+	allowed, _ = tracker.Allow(nodes["h100-a-0"], "physical-h100-a-0")
+	assert.True(t, allowed)
+
+	tainted["h100-a-0"] = false
+	tracker.Refresh(nodes, inFlight, time.Now())
+	assert.Equal(t, 0, tracker.Status()[0].InFlight)
+	allowed, _ = tracker.Allow(nodes["h100-a-1"], "physical-h100-a-1")
+	assert.True(t, allowed)
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	tracker.Refresh(nil, nil, time.Now())
+	allowed, _ := tracker.Allow(&corev1.Node{}, "node")
+	assert.True(t, allowed)
+	tracker.Record(&corev1.Node{}, "node", time.Now())
+	assert.Nil(t, tracker.Status())
+}
@@ -0,0 +1,235 @@
+package capacity
+
+import (
+	"strconv"
+	"strings"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	GRES_GPU = "gpu"
+
+	// States of a GPU. Healthy GPUs are either allocated or idle, drained ones are on slurm
+	// nodes that can't take new jobs.
+	STATE_HEALTHY   = "healthy"
+	STATE_ALLOCATED = "allocated"
+	STATE_IDLE      = "idle"
+	STATE_DRAINED   = "drained"
+)
+
+// Slurm node states and state flags whose GPUs can't be allocated to new jobs.
+var UNAVAILABLE_STATES = map[string]bool{
+	"DOWN":           true,
+	"DRAIN":          true,
+	"FAIL":           true,
+	"FUTURE":         true,
+	"INVALID":        true,
+	"INVALID_REG":    true,
+	"MAINTENANCE":    true,
+	"NOT_RESPONDING": true,
+	"POWERED_DOWN":   true,
+	"REBOOT_ISSUED":  true,
+}
+
+// Key groups GPUs by where they can be scheduled.
+type Key struct {
+	Partition string
+	Nodepool  string
+	GPUType   string
+}
+
+// GPUCount counts the GPUs of a group by state. Healthy is Allocated plus Idle.
+type GPUCount struct {
+	Healthy   int `json:"healthy"`
+	Allocated int `json:"allocated"`
+	Idle      int `json:"idle"`
+	Drained   int `json:"drained"`
+}
+
+// GPUs counts the GPUs of every slurm node by partition, nodepool and GPU type. Slurm
+// nodes in several partitions are counted in each of them. The nodepool is read from the
+// topology of the physical node, the GPU type from the slurm gres, or the GPU inventory
+// of the physical node for untyped gres.
+func GPUs(
+	slurmNodeMap map[string]*slurm.SlurmNode,
+	physicalNodeMap map[string]*slonkv1.PhysicalNode,
+) map[Key]*GPUCount {
+	physicalNodeBySlurmNode := map[string]*slonkv1.PhysicalNode{}
+	for _, physicalNode := range physicalNodeMap {
+		if name := physicalNode.Status.SlurmNodeStatus.Name; name != "" {
+			physicalNodeBySlurmNode[name] = physicalNode
+		}
+	}
+
+	result := map[Key]*GPUCount{}
+	for _, slurmNode := range slurmNodeMap {
+		total := ParseGPUGres(slurmNode.Gres)
+		if len(total) == 0 {
+			continue
+		}
+		used := ParseGPUGres(slurmNode.GresUsed)
+		usedTotal := 0
+		for _, count := range used {
+			usedTotal += count
+		}
+		unavailable := IsUnavailable(slurmNode.State)
+
+		nodepool := ""
+		physicalNode := physicalNodeBySlurmNode[slurmNode.Name]
+		if physicalNode != nil && physicalNode.Status.Topology != nil {
+			nodepool = physicalNode.Status.Topology.Nodepool
+		}
+		partitions := slurmNode.Partitions
+		if len(partitions) == 0 {
+			partitions = []string{""}
+		}
+
+		for gpuType, count := range total {
+			allocated := used[gpuType]
+			if len(total) == 1 {
+				// Typed and untyped gres of a single GPU type are the same GPUs.
+				allocated = usedTotal
+			}
+			if allocated > count {
+				allocated = count
+			}
+			if gpuType == "" {
+				gpuType = inventoryGPUType(physicalNode)
+			}
+
+			for _, partition := range partitions {
+				key := Key{Partition: partition, Nodepool: nodepool, GPUType: gpuType}
+				if result[key] == nil {
+					result[key] = &GPUCount{}
+				}
+				if unavailable {
+					result[key].Drained += count
+					continue
+				}
+				result[key].Healthy += count
+				result[key].Allocated += allocated
+				result[key].Idle += count - allocated
+			}
+		}
+	}
+	return result
+}
+
+// PendingGPUs sums the GPUs requested by pending jobs per partition. Jobs pending in
+// several partitions are counted in the first one.
+func PendingGPUs(slurmJobs []slurm.SlurmJob) map[string]int {
+	result := map[string]int{}
+	for _, slurmJob := range slurmJobs {
+		if slurmJob.JobState != "PENDING" {
+			continue
+		}
+		partition := strings.Split(slurmJob.Partition, ",")[0]
+		result[partition] += JobGPUs(slurmJob)
+	}
+	return result
+}
+
+// IsUnavailable returns whether a slurm node in the state can't take new jobs.
+func IsUnavailable(state []string) bool {
+	for _, s := range state {
+		if UNAVAILABLE_STATES[strings.ToUpper(s)] {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGPUGres returns the GPU count per GPU type of a slurm gres string, e.g.
+// "gpu:h100:8(S:0-1)" or "gpu:8". Untyped GPUs have an empty type.
+func ParseGPUGres(gres string) map[string]int {
+	result := map[string]int{}
+	for _, item := range strings.Split(stripParentheses(gres), ",") {
+		fields := strings.Split(strings.TrimSpace(item), ":")
+		if len(fields) < 2 || fields[0] != GRES_GPU {
+			continue
+		}
+		count, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil {
+			continue
+		}
+		gpuType := ""
+		if len(fields) > 2 {
+			gpuType = fields[1]
+		}
+		result[gpuType] += count
+	}
+	return result
+}
+
+// JobGPUs returns the GPUs requested by a job in total, read from its requested TRES, e.g.
+// "cpu=208,node=2,gres/gpu=16", or else from its TRES per node times its node count.
+func JobGPUs(slurmJob slurm.SlurmJob) int {
+	typed := 0
+	for _, item := range strings.Split(slurmJob.TresReqStr, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		if name == "gres/"+GRES_GPU {
+			return count
+		}
+		if strings.HasPrefix(name, "gres/"+GRES_GPU+":") {
+			typed += count
+		}
+	}
+	if typed > 0 {
+		return typed
+	}
+
+	perNode := 0
+	for _, item := range strings.Split(slurmJob.TresPerNode, ",") {
+		// Both "gres/gpu:8" and the older "gres:gpu:8" are used.
+		item = strings.Replace(strings.TrimSpace(item), "gres/", "gres:", 1)
+		fields := strings.Split(item, ":")
+		if len(fields) < 3 || fields[0] != "gres" || fields[1] != GRES_GPU {
+			continue
+		}
+		if count, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			perNode += count
+		}
+	}
+	nodeCount := slurmJob.NodeCount.Number
+	if nodeCount < 1 {
+		nodeCount = 1
+	}
+	return perNode * nodeCount
+}
+
+// inventoryGPUType returns the product name of the first GPU in the inventory, if any.
+func inventoryGPUType(physicalNode *slonkv1.PhysicalNode) string {
+	if physicalNode == nil || physicalNode.Status.Inventory == nil || len(physicalNode.Status.Inventory.GPUs) == 0 {
+		return ""
+	}
+	return physicalNode.Status.Inventory.GPUs[0].ProductName
+}
+
+// stripParentheses removes the socket and index lists from a gres string, as they may
+// contain commas themselves.
+func stripParentheses(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, c := range s {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
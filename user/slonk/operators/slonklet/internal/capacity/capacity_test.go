@@ -0,0 +1,77 @@
+package capacity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestParseGPUGres(t *testing.T) {
+	assert.Equal(t, map[string]int{"h100": 8}, ParseGPUGres("gpu:h100:8(S:0-1)"))
+	assert.Equal(t, map[string]int{"": 8}, ParseGPUGres("gpu:8"))
+	assert.Equal(t, map[string]int{"h100": 4}, ParseGPUGres("gpu:h100:4(IDX:0,2,4,6)"))
+	assert.Equal(t, map[string]int{"": 0}, ParseGPUGres("gpu:0(IDX:N/A)"))
+	assert.Equal(t, map[string]int{"a100": 2}, ParseGPUGres("shard:4,gpu:a100:2"))
+	assert.Equal(t, map[string]int{}, ParseGPUGres(""))
+	assert.Equal(t, map[string]int{}, ParseGPUGres("(null)"))
+}
+
+func TestJobGPUs(t *testing.T) {
+	assert.Equal(t, 16, JobGPUs(slurm.SlurmJob{TresReqStr: "cpu=416,mem=3600G,node=2,billing=416,gres/gpu=16"}))
+	assert.Equal(t, 8, JobGPUs(slurm.SlurmJob{TresReqStr: "cpu=208,gres/gpu:h100=8"}))
+	assert.Equal(t, 8, JobGPUs(slurm.SlurmJob{TresReqStr: "cpu=208,gres/gpu=8,gres/gpu:h100=8"}))
+	assert.Equal(t, 32, JobGPUs(slurm.SlurmJob{TresPerNode: "gres/gpu:8", NodeCount: slurm.FlagType{Number: 4, Set: true}}))
+	assert.Equal(t, 4, JobGPUs(slurm.SlurmJob{TresPerNode: "gres:gpu:h100:4"}))
+	assert.Equal(t, 0, JobGPUs(slurm.SlurmJob{TresReqStr: "cpu=4,mem=16G,node=1"}))
+}
+
+func TestGPUs(t *testing.T) {
+	slurmNodeMap := map[string]*slurm.SlurmNode{
+		"slurm-node-1": {Name: "slurm-node-1", State: []string{"MIXED"}, Partitions: []string{"general"},
+			Gres: "gpu:h100:8(S:0-1)", GresUsed: "gpu:h100:4(IDX:0-3)"},
+		"slurm-node-2": {Name: "slurm-node-2", State: []string{"IDLE"}, Partitions: []string{"general", "debug"},
+			Gres: "gpu:h100:8(S:0-1)", GresUsed: "gpu:h100:0(IDX:N/A)"},
+		"slurm-node-3": {Name: "slurm-node-3", State: []string{"ALLOCATED", "DRAIN"}, Partitions: []string{"general"},
+			Gres: "gpu:h100:8(S:0-1)", GresUsed: "gpu:h100:8(IDX:0-7)"},
+		"slurm-node-4": {Name: "slurm-node-4", State: []string{"IDLE"}, Partitions: []string{"general"},
+			Gres: "gpu:8", GresUsed: "gpu:0"},
+		"slurm-node-5": {Name: "slurm-node-5", State: []string{"IDLE"}, Partitions: []string{"cpu"}},
+	}
+	newPhysicalNode := func(slurmNodeName string, nodepool string, gpuProductName string) *slonkv1.PhysicalNode {
+		physicalNode := &slonkv1.PhysicalNode{Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: slurmNodeName},
+			Topology:        &slonkv1.Topology{Nodepool: nodepool},
+		}}
+		if gpuProductName != "" {
+			physicalNode.Status.Inventory = &slonkv1.HardwareInventory{
+				GPUs: []slonkv1.GPUInventory{{ProductName: gpuProductName}},
+			}
+		}
+		return physicalNode
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"pn-1": newPhysicalNode("slurm-node-1", "pool-a", ""),
+		"pn-2": newPhysicalNode("slurm-node-2", "pool-a", ""),
+		"pn-3": newPhysicalNode("slurm-node-3", "pool-b", ""),
+		"pn-4": newPhysicalNode("slurm-node-4", "pool-b", "NVIDIA A100-SXM4-80GB"),
+	}
+
+	assert.Equal(t, map[Key]*GPUCount{
+		{Partition: "general", Nodepool: "pool-a", GPUType: "h100"}:                  {Healthy: 16, Allocated: 4, Idle: 12},
+		{Partition: "debug", Nodepool: "pool-a", GPUType: "h100"}:                    {Healthy: 8, Idle: 8},
+		{Partition: "general", Nodepool: "pool-b", GPUType: "h100"}:                  {Drained: 8},
+		{Partition: "general", Nodepool: "pool-b", GPUType: "NVIDIA A100-SXM4-80GB"}: {Healthy: 8, Idle: 8},
+	}, GPUs(slurmNodeMap, physicalNodeMap))
+}
+
+func TestPendingGPUs(t *testing.T) {
+	assert.Equal(t, map[string]int{"general": 24, "debug": 1}, PendingGPUs([]slurm.SlurmJob{
+		{JobID: 1, JobState: "PENDING", Partition: "general", TresReqStr: "gres/gpu=16"},
+		{JobID: 2, JobState: "PENDING", Partition: "general,debug", TresReqStr: "gres/gpu=8"},
+		{JobID: 3, JobState: "PENDING", Partition: "debug", TresReqStr: "gres/gpu=1"},
+		{JobID: 4, JobState: "RUNNING", Partition: "general", TresReqStr: "gres/gpu=64"},
+	}))
+}
@@ -0,0 +1,666 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/budget"
+	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/task/core"
+	"your-org.com/slonklet/internal/tools"
+)
+
+const (
+	NODE_HUNT_PHASE_RUNNING   = "Running"
+	NODE_HUNT_PHASE_SUSPENDED = "Suspended"
+	NODE_HUNT_PHASE_COMPLETED = "Completed"
+	NODE_HUNT_PHASE_ABORTED   = "Aborted"
+	NODE_HUNT_PHASE_INVALID   = "Invalid"
+
+	NODE_HUNT_NODE_PENDING = "Pending"
+	NODE_HUNT_NODE_RUNNING = "Running"
+	NODE_HUNT_NODE_PASSED  = "Passed"
+	NODE_HUNT_NODE_FAILED  = "Failed"
+	NODE_HUNT_NODE_SKIPPED = "Skipped"
+
+	// Values of the result label of a hunt on the physical nodes.
+	NODE_HUNT_RESULT_PASSED = "passed"
+	NODE_HUNT_RESULT_FAILED = "failed"
+
+	// Result labels default to this prefix followed by the name of the hunt.
+	NODE_HUNT_LABEL_PREFIX    = "slonk.your-org.com/hunt-"
+	DEFAULT_NODE_HUNT_TIMEOUT = time.Hour
+	// Every selected physical node has an entry in the status of the hunt, which has to fit
+	// in a single etcd object. Keep in sync with the maximum of maxNodes.
+	MAX_NODE_HUNT_NODES = 1000
+
+	REASON_SLONKLET_NODE_HUNT_FAILED    = "SlonkletNodeHuntFailed"
+	REASON_SLONKLET_NODE_HUNT_COMPLETED = "SlonkletNodeHuntCompleted"
+	REASON_SLONKLET_NODE_HUNT_ABORTED   = "SlonkletNodeHuntAborted"
+)
+
+// NodeHuntReconciler runs NodeHunt campaigns
+type NodeHuntReconciler struct {
+	client.Client
+	Recorder events.EventRecorder
+	Scheme   *runtime.Scheme
+
+	// Port of the node-local slonklet agent on k8s nodes. Zero makes hunts with an agent
+	// command invalid.
+	AgentPort int
+
+	// Disruption budgets shared with the physical node reconciler, diagnostics take nodes out
+	// of service like remediations do. Nil allows every diagnostic.
+	Budgets *budget.Tracker
+}
+
+//+kubebuilder:rbac:groups=slonk.your-org.com,resources=nodehunts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=slonk.your-org.com,resources=nodehunts/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=slonk.your-org.com,resources=nodehunts/finalizers,verbs=update
+
+// Reconcile is a no-op, hunts are advanced by Sync from the sync loop like physical nodes
+// and slurm jobs.
+func (r *NodeHuntReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+
+	return ctrl.Result{}, nil
+}
+
+// Sync advances all node hunts: collects the results of running diagnostics, labels the
+// physical nodes with them, and starts new diagnostics within the concurrency of each hunt.
+func (r *NodeHuntReconciler) Sync(
+	ctx context.Context,
+	socketPath string,
+	physicalNodeMap map[string]*slonkv1.PhysicalNode,
+) error {
+	logger := log.FromContext(ctx)
+
+	nodeHuntList := &slonkv1.NodeHuntList{}
+	if err := r.Client.List(ctx, nodeHuntList); err != nil {
+		return fmt.Errorf("list node hunts: %w", err)
+	}
+	if len(nodeHuntList.Items) == 0 {
+		return nil
+	}
+	logger.Info("Started syncing node hunts", "count", len(nodeHuntList.Items))
+
+	// Slurm jobs are only listed if a hunt has a slurm job diagnostic running.
+	var slurmJobMap map[int]*slurm.SlurmJob
+	getSlurmJobMap := func() (map[int]*slurm.SlurmJob, error) {
+		if slurmJobMap != nil {
+			return slurmJobMap, nil
+		}
+		slurmJobList, err := slurm.SyncSlurmJobs(socketPath)
+		if err != nil {
+			return nil, fmt.Errorf("list slurm jobs: %w", err)
+		}
+		slurmJobMap = map[int]*slurm.SlurmJob{}
+		for i := range slurmJobList {
+			slurmJobMap[slurmJobList[i].JobID] = &slurmJobList[i]
+		}
+		return slurmJobMap, nil
+	}
+
+	now := time.Now()
+	for i := range nodeHuntList.Items {
+		nodeHunt := &nodeHuntList.Items[i]
+		if err := r.syncNodeHunt(ctx, socketPath, nodeHunt, physicalNodeMap, getSlurmJobMap, now); err != nil {
+			logger.Error(err, "Failed to sync node hunt", "node hunt", nodeHunt.Name, "namespace", nodeHunt.Namespace)
+		}
+	}
+
+	logger.Info("Finished syncing node hunts")
+	return nil
+}
+
+func (r *NodeHuntReconciler) syncNodeHunt(
+	ctx context.Context,
+	socketPath string,
+	nodeHunt *slonkv1.NodeHunt,
+	physicalNodeMap map[string]*slonkv1.PhysicalNode,
+	getSlurmJobMap func() (map[int]*slurm.SlurmJob, error),
+	now time.Time,
+) error {
+	logger := log.FromContext(ctx)
+	spec := nodeHunt.Spec
+	status := nodeHunt.Status.DeepCopy()
+
+	switch status.Phase {
+	case NODE_HUNT_PHASE_COMPLETED, NODE_HUNT_PHASE_ABORTED:
+		return nil
+	}
+	if err := r.validateNodeHunt(nodeHunt); err != nil {
+		status.Phase = NODE_HUNT_PHASE_INVALID
+		status.Message = err.Error()
+		return r.patchNodeHuntStatus(ctx, nodeHunt, status)
+	}
+
+	// The physical nodes are selected once, when the hunt starts.
+	if status.StartTimestamp == nil {
+		selector := labels.Everything()
+		if spec.Selector != nil {
+			var err error
+			if selector, err = metav1.LabelSelectorAsSelector(spec.Selector); err != nil {
+				status.Phase = NODE_HUNT_PHASE_INVALID
+				status.Message = fmt.Sprintf("Invalid selector: %v.", err)
+				return r.patchNodeHuntStatus(ctx, nodeHunt, status)
+			}
+		}
+		names := []string{}
+		for name, physicalNode := range physicalNodeMap {
+			if physicalNode.Namespace == nodeHunt.Namespace && selector.Matches(labels.Set(physicalNode.Labels)) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		maxNodes := spec.MaxNodes
+		if maxNodes <= 0 || maxNodes > MAX_NODE_HUNT_NODES {
+			maxNodes = MAX_NODE_HUNT_NODES
+		}
+		if len(names) > maxNodes {
+			names = names[:maxNodes]
+		}
+		status.Nodes = []slonkv1.NodeHuntNodeStatus{}
+		for _, name := range names {
+			status.Nodes = append(status.Nodes, slonkv1.NodeHuntNodeStatus{PhysicalNode: name, Phase: NODE_HUNT_NODE_PENDING})
+		}
+		start := metav1.NewTime(now)
+		status.StartTimestamp = &start
+		status.Message = ""
+		logger.Info("Started node hunt", "node hunt", nodeHunt.Name, "physical nodes", len(names))
+	}
+
+	// Collect the results of the running diagnostics.
+	for i := range status.Nodes {
+		nodeStatus := &status.Nodes[i]
+		if nodeStatus.Phase != NODE_HUNT_NODE_RUNNING {
+			continue
+		}
+		result, message, err := r.checkNodeHuntDiagnostic(ctx, socketPath, nodeHunt, nodeStatus, physicalNodeMap, getSlurmJobMap, now)
+		if err != nil {
+			// Try again on the next sync.
+			logger.Info("Failed to check node hunt diagnostic", "node hunt", nodeHunt.Name,
+				"physical node", nodeStatus.PhysicalNode, "error", err)
+			continue
+		}
+		if result == "" {
+			continue
+		}
+		finish := metav1.NewTime(now)
+		nodeStatus.CompletionTimestamp = &finish
+		nodeStatus.Message = message
+		switch {
+		case result == NODE_HUNT_NODE_PASSED:
+			nodeStatus.Phase = NODE_HUNT_NODE_PASSED
+		case result == NODE_HUNT_NODE_SKIPPED:
+			// Never ran, e.g. the slurm node was busy, which says nothing about the node.
+			nodeStatus.Phase = NODE_HUNT_NODE_SKIPPED
+		case nodeStatus.Attempts <= spec.Criteria.Retries:
+			nodeStatus.Phase = NODE_HUNT_NODE_PENDING
+			nodeStatus.Message = fmt.Sprintf("Attempt %d failed, retrying: %s", nodeStatus.Attempts, message)
+		default:
+			nodeStatus.Phase = NODE_HUNT_NODE_FAILED
+			if physicalNode := physicalNodeMap[nodeStatus.PhysicalNode]; physicalNode != nil && r.Recorder != nil {
+				r.Recorder.Eventf(physicalNode, nodeHunt, corev1.EventTypeWarning, REASON_SLONKLET_NODE_HUNT_FAILED,
+					eventAction(REASON_SLONKLET_NODE_HUNT_FAILED), "Failed node hunt %s: %s", nodeHunt.Name, message)
+			}
+		}
+	}
+
+	// Label the physical nodes with their results. Runs on every sync, so failed patches
+	// are retried.
+	resultLabel := nodeHuntResultLabel(nodeHunt)
+	for _, nodeStatus := range status.Nodes {
+		value := ""
+		switch nodeStatus.Phase {
+		case NODE_HUNT_NODE_PASSED:
+			value = NODE_HUNT_RESULT_PASSED
+		case NODE_HUNT_NODE_FAILED:
+			value = NODE_HUNT_RESULT_FAILED
+		default:
+			continue
+		}
+		physicalNode := physicalNodeMap[nodeStatus.PhysicalNode]
+		if physicalNode == nil || physicalNode.Labels[resultLabel] == value {
+			continue
+		}
+		original := physicalNode.DeepCopy()
+		if physicalNode.Labels == nil {
+			physicalNode.Labels = map[string]string{}
+		}
+		physicalNode.Labels[resultLabel] = value
+		if err := r.Client.Patch(ctx, physicalNode, client.MergeFrom(original), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+			logger.Info("Failed to label physical node with node hunt result", "node hunt", nodeHunt.Name,
+				"physical node", physicalNode.Name, "error", err)
+			physicalNodeMap[physicalNode.Name] = original
+		}
+	}
+
+	countNodeHuntNodes(status)
+	aborting := spec.MaxFailures > 0 && status.Failed >= spec.MaxFailures
+
+	// Start new diagnostics.
+	concurrency := spec.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	for i := range status.Nodes {
+		if spec.Suspend || aborting || status.Running >= concurrency {
+			break
+		}
+		nodeStatus := &status.Nodes[i]
+		if nodeStatus.Phase != NODE_HUNT_NODE_PENDING {
+			continue
+		}
+		k8sNode, allowed, reason := r.allowNodeHuntDiagnostic(ctx, physicalNodeMap[nodeStatus.PhysicalNode])
+		if !allowed {
+			// Stays pending until the budget allows it.
+			nodeStatus.Message = fmt.Sprintf("Waiting for the disruption budget: %s.", reason)
+			continue
+		}
+		if err := r.startNodeHuntDiagnostic(ctx, socketPath, nodeHunt, nodeStatus, physicalNodeMap, now); err != nil {
+			nodeStatus.Phase = NODE_HUNT_NODE_SKIPPED
+			nodeStatus.Message = err.Error()
+			logger.Info("Skipped physical node in node hunt", "node hunt", nodeHunt.Name,
+				"physical node", nodeStatus.PhysicalNode, "error", err)
+		} else if k8sNode != nil {
+			r.Budgets.Record(k8sNode, nodeStatus.PhysicalNode, now)
+		}
+		countNodeHuntNodes(status)
+	}
+
+	switch {
+	case aborting && status.Running == 0:
+		for i := range status.Nodes {
+			if status.Nodes[i].Phase == NODE_HUNT_NODE_PENDING {
+				status.Nodes[i].Phase = NODE_HUNT_NODE_SKIPPED
+				status.Nodes[i].Message = "The hunt was aborted."
+			}
+		}
+		countNodeHuntNodes(status)
+		status.Phase = NODE_HUNT_PHASE_ABORTED
+		status.Message = fmt.Sprintf("Aborted after %d physical nodes failed.", status.Failed)
+	case aborting:
+		status.Phase = NODE_HUNT_PHASE_RUNNING
+		status.Message = fmt.Sprintf("%d physical nodes failed, aborting once the running diagnostics finish.", status.Failed)
+	case status.Pending == 0 && status.Running == 0:
+		status.Phase = NODE_HUNT_PHASE_COMPLETED
+		status.Message = strings.TrimSpace(fmt.Sprintf("%d passed, %d failed, %d skipped. %s",
+			status.Passed, status.Failed, status.Skipped, nodeHuntSelectionMessage(nodeHunt, status)))
+	case spec.Suspend:
+		status.Phase = NODE_HUNT_PHASE_SUSPENDED
+		status.Message = nodeHuntSelectionMessage(nodeHunt, status)
+	default:
+		status.Phase = NODE_HUNT_PHASE_RUNNING
+		status.Message = nodeHuntSelectionMessage(nodeHunt, status)
+	}
+	if status.Phase == NODE_HUNT_PHASE_COMPLETED || status.Phase == NODE_HUNT_PHASE_ABORTED {
+		finish := metav1.NewTime(now)
+		status.CompletionTimestamp = &finish
+		if r.Recorder != nil {
+			eventType, reason := corev1.EventTypeNormal, REASON_SLONKLET_NODE_HUNT_COMPLETED
+			if status.Phase == NODE_HUNT_PHASE_ABORTED {
+				eventType, reason = corev1.EventTypeWarning, REASON_SLONKLET_NODE_HUNT_ABORTED
+			}
+			r.Recorder.Eventf(nodeHunt, nil, eventType, reason, eventAction(reason), "%s", status.Message)
+		}
+		logger.Info("Finished node hunt", "node hunt", nodeHunt.Name, "phase", status.Phase, "message", status.Message)
+	}
+
+	return r.patchNodeHuntStatus(ctx, nodeHunt, status)
+}
+
+func (r *NodeHuntReconciler) validateNodeHunt(nodeHunt *slonkv1.NodeHunt) error {
+	diagnostic := nodeHunt.Spec.Diagnostic
+	switch {
+	case diagnostic.SlurmJob != nil && diagnostic.AgentCommand != "":
+		return fmt.Errorf("only one of diagnostic.slurmJob and diagnostic.agentCommand may be set")
+	case diagnostic.SlurmJob != nil && diagnostic.SlurmJob.Script == "":
+		return fmt.Errorf("diagnostic.slurmJob.script is required")
+	case diagnostic.AgentCommand != "" && r.AgentPort == 0:
+		return fmt.Errorf("agent commands need the slonklet agent, which is disabled on this controller")
+	case diagnostic.SlurmJob == nil && diagnostic.AgentCommand == "":
+		return fmt.Errorf("one of diagnostic.slurmJob and diagnostic.agentCommand is required")
+	}
+	return nil
+}
+
+// nodeHuntSelectionMessage notes that the selection of the hunt was cut at MAX_NODE_HUNT_NODES,
+// so the remaining physical nodes need another hunt.
+func nodeHuntSelectionMessage(nodeHunt *slonkv1.NodeHunt, status *slonkv1.NodeHuntStatus) string {
+	if nodeHunt.Spec.MaxNodes > 0 && nodeHunt.Spec.MaxNodes <= MAX_NODE_HUNT_NODES {
+		return ""
+	}
+	if len(status.Nodes) < MAX_NODE_HUNT_NODES {
+		return ""
+	}
+	return fmt.Sprintf("Only the first %d selected physical nodes are hunted, narrow the selector to hunt the rest.", MAX_NODE_HUNT_NODES)
+}
+
+// allowNodeHuntDiagnostic returns whether the disruption budgets allow diagnosing the physical
+// node, and its k8s node to record the disruption against. Physical nodes without a k8s node
+// aren't subject to any budget.
+func (r *NodeHuntReconciler) allowNodeHuntDiagnostic(
+	ctx context.Context,
+	physicalNode *slonkv1.PhysicalNode,
+) (*corev1.Node, bool, string) {
+	if r.Budgets == nil || physicalNode == nil {
+		return nil, true, ""
+	}
+	k8sNodeStatus := physicalNode.Status.K8sNodeStatus
+	if k8sNodeStatus.Name == "" || k8sNodeStatus.Removed {
+		return nil, true, ""
+	}
+	k8sNode := &corev1.Node{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: k8sNodeStatus.Name}, k8sNode); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, true, ""
+		}
+		return nil, false, fmt.Sprintf("get k8s node %s: %v", k8sNodeStatus.Name, err)
+	}
+	if allowed, reason := r.Budgets.Allow(k8sNode, physicalNode.Name); !allowed {
+		return nil, false, reason
+	}
+	return k8sNode, true, ""
+}
+
+// startNodeHuntDiagnostic submits the diagnostic of the hunt on the physical node. An error
+// means the physical node can't be diagnosed.
+func (r *NodeHuntReconciler) startNodeHuntDiagnostic(
+	ctx context.Context,
+	socketPath string,
+	nodeHunt *slonkv1.NodeHunt,
+	nodeStatus *slonkv1.NodeHuntNodeStatus,
+	physicalNodeMap map[string]*slonkv1.PhysicalNode,
+	now time.Time,
+) error {
+	physicalNode := physicalNodeMap[nodeStatus.PhysicalNode]
+	if physicalNode == nil {
+		return fmt.Errorf("the physical node no longer exists")
+	}
+	// Nodes on their way out of service, e.g. drained for repair, are not diagnosed.
+	if goalState := physicalNode.Spec.SlurmNodeSpec.GoalState; goalState != "" && goalState != GoalStateUp {
+		return fmt.Errorf("the slurm goal state of the physical node is %s", goalState)
+	}
+	if goalState := physicalNode.Spec.K8sNodeSpec.GoalState; goalState != "" && goalState != GoalStateUp {
+		return fmt.Errorf("the k8s goal state of the physical node is %s", goalState)
+	}
+	diagnostic := nodeHunt.Spec.Diagnostic
+
+	nodeStatus.JobID = 0
+	nodeStatus.TaskID = ""
+	if diagnostic.SlurmJob != nil {
+		slurmNodeStatus := physicalNode.Status.SlurmNodeStatus
+		if slurmNodeStatus.Name == "" || slurmNodeStatus.Removed {
+			return fmt.Errorf("the physical node has no slurm node")
+		}
+		jobID, err := slurm.SubmitSlurmJob(socketPath, slurm.SlurmJobSubmission{
+			Name:      fmt.Sprintf("nodehunt-%s", nodeHunt.Name),
+			Script:    diagnostic.SlurmJob.Script,
+			NodeName:  slurmNodeStatus.Name,
+			Partition: diagnostic.SlurmJob.Partition,
+			Comment:   fmt.Sprintf("Node hunt %s/%s on physical node %s", nodeHunt.Namespace, nodeHunt.Name, physicalNode.Name),
+			TimeLimit: diagnostic.SlurmJob.TimeLimitMinutes,
+		})
+		if err != nil {
+			return fmt.Errorf("submit slurm job: %w", err)
+		}
+		nodeStatus.SlurmNodeName = slurmNodeStatus.Name
+		nodeStatus.JobID = jobID
+	} else {
+		k8sNodeStatus := physicalNode.Status.K8sNodeStatus
+		if k8sNodeStatus.Name == "" || k8sNodeStatus.Removed {
+			return fmt.Errorf("the physical node has no k8s node")
+		}
+		k8sNode := &corev1.Node{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: k8sNodeStatus.Name}, k8sNode); err != nil {
+			return fmt.Errorf("get k8s node %s: %w", k8sNodeStatus.Name, err)
+		}
+		address := getK8sNodeInternalIP(k8sNode)
+		if address == "" {
+			return fmt.Errorf("k8s node %s has no internal IP", k8sNode.Name)
+		}
+		taskID, err := enqueueAgentCommand(ctx, net.JoinHostPort(address, strconv.Itoa(r.AgentPort)), diagnostic.AgentCommand)
+		if err != nil {
+			return fmt.Errorf("enqueue agent command: %w", err)
+		}
+		nodeStatus.K8sNodeName = k8sNode.Name
+		nodeStatus.TaskID = taskID
+	}
+
+	start := metav1.NewTime(now)
+	nodeStatus.Phase = NODE_HUNT_NODE_RUNNING
+	nodeStatus.Attempts++
+	nodeStatus.StartTimestamp = &start
+	nodeStatus.RunningTimestamp = nil
+	nodeStatus.CompletionTimestamp = nil
+	nodeStatus.Message = ""
+	return nil
+}
+
+// checkNodeHuntDiagnostic returns the phase the physical node moves to once the diagnostic
+// running on it finished and why, or an empty phase while it's still queued or running.
+// Errors are transient.
+func (r *NodeHuntReconciler) checkNodeHuntDiagnostic(
+	ctx context.Context,
+	socketPath string,
+	nodeHunt *slonkv1.NodeHunt,
+	nodeStatus *slonkv1.NodeHuntNodeStatus,
+	physicalNodeMap map[string]*slonkv1.PhysicalNode,
+	getSlurmJobMap func() (map[int]*slurm.SlurmJob, error),
+	now time.Time,
+) (string, string, error) {
+	criteria := nodeHunt.Spec.Criteria
+	timeout := DEFAULT_NODE_HUNT_TIMEOUT
+	if criteria.Timeout != nil && criteria.Timeout.Duration > 0 {
+		timeout = criteria.Timeout.Duration
+	}
+
+	if nodeStatus.JobID != 0 {
+		state, err := r.slurmJobState(ctx, nodeStatus.JobID, getSlurmJobMap)
+		if err != nil {
+			return "", "", err
+		}
+		if slurm.SLURM_JOB_COMPLETED_STATES[state] || slurm.SLURM_JOB_FAILED_STATES[state] {
+			passStates := criteria.PassStates
+			if len(passStates) == 0 {
+				passStates = []string{"COMPLETED"}
+			}
+			for _, passState := range passStates {
+				if state == passState {
+					return NODE_HUNT_NODE_PASSED, fmt.Sprintf("Slurm job %d finished with %s.", nodeStatus.JobID, state), nil
+				}
+			}
+			return NODE_HUNT_NODE_FAILED, fmt.Sprintf("Slurm job %d finished with %s.", nodeStatus.JobID, state), nil
+		}
+		if state == "" {
+			return NODE_HUNT_NODE_FAILED, fmt.Sprintf("Slurm job %d vanished before its final state was seen.", nodeStatus.JobID), nil
+		}
+
+		result, message := "", ""
+		if state == "PENDING" {
+			if isNodeHuntDiagnosticTimedOut(nodeStatus.StartTimestamp, now, timeout) {
+				result, message = NODE_HUNT_NODE_SKIPPED, fmt.Sprintf("Slurm job %d was still queued after %s.", nodeStatus.JobID, timeout)
+			}
+		} else {
+			markNodeHuntDiagnosticRunning(nodeStatus, now)
+			if isNodeHuntDiagnosticTimedOut(nodeStatus.RunningTimestamp, now, timeout) {
+				result, message = NODE_HUNT_NODE_FAILED, fmt.Sprintf("Slurm job %d was still %s after running for %s.", nodeStatus.JobID, state, timeout)
+			}
+		}
+		if result != "" {
+			if err := slurm.CancelSlurmJob(socketPath, nodeStatus.JobID); err != nil {
+				log.FromContext(ctx).Info("Failed to cancel timed out node hunt job", "job id", nodeStatus.JobID, "error", err)
+			}
+		}
+		return result, message, nil
+	}
+
+	physicalNode := physicalNodeMap[nodeStatus.PhysicalNode]
+	if physicalNode == nil {
+		return NODE_HUNT_NODE_FAILED, "The physical node no longer exists.", nil
+	}
+	k8sNode := &corev1.Node{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: nodeStatus.K8sNodeName}, k8sNode); err != nil {
+		if apierrors.IsNotFound(err) {
+			return NODE_HUNT_NODE_FAILED, fmt.Sprintf("K8s node %s was deleted while the agent command ran.", nodeStatus.K8sNodeName), nil
+		}
+		return "", "", fmt.Errorf("get k8s node %s: %w", nodeStatus.K8sNodeName, err)
+	}
+	address := getK8sNodeInternalIP(k8sNode)
+	state, err := getAgentTaskState(ctx, net.JoinHostPort(address, strconv.Itoa(r.AgentPort)), nodeStatus.TaskID)
+	if errors.Is(err, os.ErrNotExist) {
+		return NODE_HUNT_NODE_FAILED, fmt.Sprintf("The agent on k8s node %s lost task %s.", nodeStatus.K8sNodeName, nodeStatus.TaskID), nil
+	} else if err != nil {
+		// An agent unreachable for longer than the timeout fails the node.
+		lastSeen := nodeStatus.RunningTimestamp
+		if lastSeen == nil {
+			lastSeen = nodeStatus.StartTimestamp
+		}
+		if isNodeHuntDiagnosticTimedOut(lastSeen, now, timeout) {
+			return NODE_HUNT_NODE_FAILED, fmt.Sprintf("The agent on k8s node %s didn't report task %s within %s: %v.", nodeStatus.K8sNodeName, nodeStatus.TaskID, timeout, err), nil
+		}
+		return "", "", err
+	}
+	switch core.TaskState(state) {
+	case core.Succeeded:
+		return NODE_HUNT_NODE_PASSED, "The agent command succeeded.", nil
+	case core.Failed, core.Invalid, core.Killed:
+		return NODE_HUNT_NODE_FAILED, fmt.Sprintf("The agent command %s.", state), nil
+	case core.Queued:
+		if isNodeHuntDiagnosticTimedOut(nodeStatus.StartTimestamp, now, timeout) {
+			return NODE_HUNT_NODE_SKIPPED, fmt.Sprintf("The agent command was still queued after %s.", timeout), nil
+		}
+		return "", "", nil
+	}
+	markNodeHuntDiagnosticRunning(nodeStatus, now)
+	if isNodeHuntDiagnosticTimedOut(nodeStatus.RunningTimestamp, now, timeout) {
+		return NODE_HUNT_NODE_FAILED, fmt.Sprintf("The agent command was still %s after running for %s.", state, timeout), nil
+	}
+	return "", "", nil
+}
+
+// markNodeHuntDiagnosticRunning records when the diagnostic was first seen running.
+func markNodeHuntDiagnosticRunning(nodeStatus *slonkv1.NodeHuntNodeStatus, now time.Time) {
+	if nodeStatus.RunningTimestamp == nil {
+		running := metav1.NewTime(now)
+		nodeStatus.RunningTimestamp = &running
+	}
+}
+
+func isNodeHuntDiagnosticTimedOut(since *metav1.Time, now time.Time, timeout time.Duration) bool {
+	return since != nil && now.Sub(since.Time) > timeout
+}
+
+// slurmJobState returns the state of the slurm job, from slurm while it's known there and
+// from its SlurmJob afterwards. Empty if neither knows the final state.
+func (r *NodeHuntReconciler) slurmJobState(
+	ctx context.Context,
+	jobID int,
+	getSlurmJobMap func() (map[int]*slurm.SlurmJob, error),
+) (string, error) {
+	slurmJobMap, err := getSlurmJobMap()
+	if err != nil {
+		return "", err
+	}
+	if slurmJob, ok := slurmJobMap[jobID]; ok {
+		return slurmJob.JobState, nil
+	}
+
+	slurmJob := &slonkv1.SlurmJob{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: strconv.Itoa(jobID), Namespace: SLURM_NAMESPACE}, slurmJob); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("get slurm job %d: %w", jobID, err)
+	}
+	var last *slonkv1.SlurmJobRunStatus
+	statuses := append([]slonkv1.SlurmJobRunStatus{slurmJob.Status.SlurmJobRunCurrentStatus}, slurmJob.Status.SlurmJobRunStatusHistory...)
+	for i := range statuses {
+		if statuses[i].Removed {
+			continue
+		}
+		if last == nil || statuses[i].LastSyncTimestamp.After(last.LastSyncTimestamp.Time) {
+			last = &statuses[i]
+		}
+	}
+	if last == nil || !(slurm.SLURM_JOB_COMPLETED_STATES[last.State] || slurm.SLURM_JOB_FAILED_STATES[last.State]) {
+		return "", nil
+	}
+	return last.State, nil
+}
+
+func (r *NodeHuntReconciler) patchNodeHuntStatus(
+	ctx context.Context,
+	nodeHunt *slonkv1.NodeHunt,
+	status *slonkv1.NodeHuntStatus,
+) error {
+	if equality.Semantic.DeepEqual(&nodeHunt.Status, status) {
+		return nil
+	}
+	original := nodeHunt.DeepCopy()
+	nodeHunt.Status = *status
+	if err := r.Client.Status().Patch(ctx, nodeHunt, client.MergeFrom(original), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+		return fmt.Errorf("update node hunt status: %w", err)
+	}
+	return nil
+}
+
+// nodeHuntResultLabel returns the label the results of the hunt are set in.
+func nodeHuntResultLabel(nodeHunt *slonkv1.NodeHunt) string {
+	if nodeHunt.Spec.ResultLabel != "" {
+		return nodeHunt.Spec.ResultLabel
+	}
+	// The name of a label, after the prefix domain, is at most 63 characters.
+	label := NODE_HUNT_LABEL_PREFIX + nodeHunt.Name
+	if _, name, _ := strings.Cut(label, "/"); len(name) > 63 {
+		label = strings.TrimRight(label[:len(label)-len(name)+63], "-.")
+	}
+	return label
+}
+
+func countNodeHuntNodes(status *slonkv1.NodeHuntStatus) {
+	status.Total = len(status.Nodes)
+	status.Pending, status.Running, status.Passed, status.Failed, status.Skipped = 0, 0, 0, 0, 0
+	for _, nodeStatus := range status.Nodes {
+		switch nodeStatus.Phase {
+		case NODE_HUNT_NODE_PENDING:
+			status.Pending++
+		case NODE_HUNT_NODE_RUNNING:
+			status.Running++
+		case NODE_HUNT_NODE_PASSED:
+			status.Passed++
+		case NODE_HUNT_NODE_FAILED:
+			status.Failed++
+		case NODE_HUNT_NODE_SKIPPED:
+			status.Skipped++
+		}
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NodeHuntReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&slonkv1.NodeHunt{}).
+		Complete(r)
+}
@@ -0,0 +1,383 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/budget"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestSyncNodeHunt(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	socketPath := "/tmp/test-nodehunt.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, slurm.SlurmResponse{})
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	newPhysicalNode := func(name string, pool string, slurmNodeName string) *slonkv1.PhysicalNode {
+		return &slonkv1.PhysicalNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE, Labels: map[string]string{"pool": pool}},
+			Status: slonkv1.PhysicalNodeStatus{
+				SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: slurmNodeName},
+			},
+		}
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"pn-1": newPhysicalNode("pn-1", "h100", "slurm-node-1"),
+		"pn-2": newPhysicalNode("pn-2", "h100", "slurm-node-2"),
+		"pn-3": newPhysicalNode("pn-3", "a100", "slurm-node-3"),
+	}
+	nodeHunt := &slonkv1.NodeHunt{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdc-hunt-20240507", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.NodeHuntSpec{
+			Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "h100"}},
+			Diagnostic:  slonkv1.NodeHuntDiagnostic{SlurmJob: &slonkv1.NodeHuntSlurmJob{Script: "#!/bin/bash\ndcgmi diag -r 3\n"}},
+			Concurrency: 1,
+		},
+	}
+	objects := []runtime.Object{nodeHunt}
+	for _, physicalNode := range physicalNodeMap {
+		objects = append(objects, physicalNode.DeepCopy())
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(objects...).
+		WithStatusSubresource(&slonkv1.NodeHunt{}).
+		Build()
+	recorder := events.NewFakeRecorder(10)
+	r := &NodeHuntReconciler{
+		Client:   fakeClient,
+		Recorder: recorder,
+		Scheme:   scheme.Scheme,
+	}
+	ctx := context.Background()
+	getNodeHunt := func() *slonkv1.NodeHunt {
+		nodeHunt := &slonkv1.NodeHunt{}
+		assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "sdc-hunt-20240507", Namespace: SLURM_NAMESPACE}, nodeHunt))
+		return nodeHunt
+	}
+	getLabel := func(name string) string {
+		physicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: name, Namespace: SLURM_NAMESPACE}, physicalNode))
+		return physicalNode.Labels["slonk.your-org.com/hunt-sdc-hunt-20240507"]
+	}
+	// finishJob makes the job leave slurm with its final state recorded in its SlurmJob.
+	finishJob := func(jobID int, state string) {
+		assert.NoError(t, slurm.CancelSlurmJob(socketPath, jobID))
+		assert.NoError(t, fakeClient.Create(ctx, &slonkv1.SlurmJob{
+			ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(jobID), Namespace: SLURM_NAMESPACE},
+			Status: slonkv1.SlurmJobStatus{
+				SlurmJobRunStatusHistory: []slonkv1.SlurmJobRunStatus{
+					{State: "RUNNING", LastSyncTimestamp: metav1.NewTime(time.Now().Add(-time.Minute))},
+					{State: state, LastSyncTimestamp: metav1.Now()},
+				},
+				SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true, LastSyncTimestamp: metav1.Now()},
+			},
+		}))
+	}
+
+	// The h100 nodes are selected, one is diagnosed at a time.
+	assert.NoError(t, r.Sync(ctx, socketPath, physicalNodeMap))
+	status := getNodeHunt().Status
+	assert.Equal(t, NODE_HUNT_PHASE_RUNNING, status.Phase)
+	assert.Equal(t, 2, status.Total)
+	assert.Equal(t, 1, status.Running)
+	assert.Equal(t, 1, status.Pending)
+	assert.Equal(t, "pn-1", status.Nodes[0].PhysicalNode)
+	assert.Equal(t, NODE_HUNT_NODE_RUNNING, status.Nodes[0].Phase)
+	assert.Equal(t, 1, status.Nodes[0].JobID)
+	assert.Equal(t, "slurm-node-1", status.Nodes[0].SlurmNodeName)
+
+	// Still running.
+	assert.NoError(t, r.Sync(ctx, socketPath, physicalNodeMap))
+	assert.Equal(t, status, getNodeHunt().Status)
+
+	// The first node passes and the second one is diagnosed.
+	finishJob(1, "COMPLETED")
+	assert.NoError(t, r.Sync(ctx, socketPath, physicalNodeMap))
+	status = getNodeHunt().Status
+	assert.Equal(t, NODE_HUNT_NODE_PASSED, status.Nodes[0].Phase)
+	assert.Equal(t, NODE_HUNT_NODE_RUNNING, status.Nodes[1].Phase)
+	assert.Equal(t, 2, status.Nodes[1].JobID)
+	assert.Equal(t, NODE_HUNT_RESULT_PASSED, getLabel("pn-1"))
+
+	// The second node fails, which completes the hunt.
+	finishJob(2, "NODE_FAIL")
+	assert.NoError(t, r.Sync(ctx, socketPath, physicalNodeMap))
+	status = getNodeHunt().Status
+	assert.Equal(t, NODE_HUNT_PHASE_COMPLETED, status.Phase)
+	assert.Equal(t, NODE_HUNT_NODE_FAILED, status.Nodes[1].Phase)
+	assert.Equal(t, "Slurm job 2 finished with NODE_FAIL.", status.Nodes[1].Message)
+	assert.Equal(t, 1, status.Passed)
+	assert.Equal(t, 1, status.Failed)
+	assert.NotNil(t, status.CompletionTimestamp)
+	assert.Equal(t, NODE_HUNT_RESULT_FAILED, getLabel("pn-2"))
+	assert.Equal(t, "", getLabel("pn-3"))
+	assert.Len(t, recorder.Events, 2)
+}
+
+func TestSyncNodeHuntInvalid(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+
+	nodeHunt := &slonkv1.NodeHunt{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent-hunt", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.NodeHuntSpec{
+			Diagnostic: slonkv1.NodeHuntDiagnostic{AgentCommand: "dcgmi diag -r 3"},
+		},
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(nodeHunt).
+		WithStatusSubresource(&slonkv1.NodeHunt{}).
+		Build()
+	r := &NodeHuntReconciler{Client: fakeClient, Scheme: scheme.Scheme}
+
+	assert.NoError(t, r.Sync(context.Background(), "", map[string]*slonkv1.PhysicalNode{}))
+	updatedNodeHunt := &slonkv1.NodeHunt{}
+	assert.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(nodeHunt), updatedNodeHunt))
+	assert.Equal(t, NODE_HUNT_PHASE_INVALID, updatedNodeHunt.Status.Phase)
+	assert.Nil(t, updatedNodeHunt.Status.StartTimestamp)
+}
+
+func TestNodeHuntResultLabel(t *testing.T) {
+	nodeHunt := &slonkv1.NodeHunt{ObjectMeta: metav1.ObjectMeta{Name: "sdc"}}
+	assert.Equal(t, "slonk.your-org.com/hunt-sdc", nodeHuntResultLabel(nodeHunt))
+
+	nodeHunt.Name = strings.Repeat("a", 57) + "-b"
+	assert.Equal(t, "slonk.your-org.com/hunt-"+strings.Repeat("a", 57), nodeHuntResultLabel(nodeHunt))
+
+	nodeHunt.Spec.ResultLabel = "example.com/hunted"
+	assert.Equal(t, "example.com/hunted", nodeHuntResultLabel(nodeHunt))
+}
+
+func TestSyncNodeHuntTimeouts(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	socketPath := "/tmp/test-nodehunt-timeouts.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, slurm.SlurmResponse{
+		Jobs: []slurm.SlurmJob{{JobID: 7, JobState: "RUNNING", Nodes: "slurm-node-3"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	newPhysicalNode := func(name string, slurmNodeName string, goalState string) *slonkv1.PhysicalNode {
+		return &slonkv1.PhysicalNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE},
+			Spec: slonkv1.PhysicalNodeSpec{
+				SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: goalState},
+			},
+			Status: slonkv1.PhysicalNodeStatus{
+				SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: slurmNodeName},
+			},
+		}
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"pn-1": newPhysicalNode("pn-1", "slurm-node-1", GoalStateUp),
+		"pn-2": newPhysicalNode("pn-2", "slurm-node-2", GoalStateDrain),
+		"pn-3": newPhysicalNode("pn-3", "slurm-node-3", GoalStateUp),
+	}
+	now := time.Now()
+	// The diagnostic of pn-3 was queued for longer than the timeout before it started running.
+	submitted := metav1.NewTime(now.Add(-3 * time.Hour))
+	nodeHunt := &slonkv1.NodeHunt{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdc-hunt", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.NodeHuntSpec{
+			Diagnostic:  slonkv1.NodeHuntDiagnostic{SlurmJob: &slonkv1.NodeHuntSlurmJob{Script: "#!/bin/bash\ndcgmi diag -r 3\n"}},
+			Concurrency: 3,
+		},
+		Status: slonkv1.NodeHuntStatus{
+			Phase:          NODE_HUNT_PHASE_RUNNING,
+			StartTimestamp: &submitted,
+			Nodes: []slonkv1.NodeHuntNodeStatus{
+				{PhysicalNode: "pn-1", Phase: NODE_HUNT_NODE_PENDING},
+				{PhysicalNode: "pn-2", Phase: NODE_HUNT_NODE_PENDING},
+				{PhysicalNode: "pn-3", Phase: NODE_HUNT_NODE_RUNNING, JobID: 7, SlurmNodeName: "slurm-node-3", Attempts: 1, StartTimestamp: &submitted},
+			},
+		},
+	}
+	objects := []runtime.Object{nodeHunt}
+	for _, physicalNode := range physicalNodeMap {
+		objects = append(objects, physicalNode.DeepCopy())
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(objects...).
+		WithStatusSubresource(&slonkv1.NodeHunt{}).
+		Build()
+	recorder := events.NewFakeRecorder(10)
+	r := &NodeHuntReconciler{
+		Client:   fakeClient,
+		Recorder: recorder,
+		Scheme:   scheme.Scheme,
+	}
+	ctx := context.Background()
+	sync := func(now time.Time) slonkv1.NodeHuntStatus {
+		key := client.ObjectKeyFromObject(nodeHunt)
+		nodeHunt := &slonkv1.NodeHunt{}
+		assert.NoError(t, fakeClient.Get(ctx, key, nodeHunt))
+		getSlurmJobMap := func() (map[int]*slurm.SlurmJob, error) {
+			slurmJobList, err := slurm.SyncSlurmJobs(socketPath)
+			slurmJobMap := map[int]*slurm.SlurmJob{}
+			for i := range slurmJobList {
+				slurmJobMap[slurmJobList[i].JobID] = &slurmJobList[i]
+			}
+			return slurmJobMap, err
+		}
+		assert.NoError(t, r.syncNodeHunt(ctx, socketPath, nodeHunt, physicalNodeMap, getSlurmJobMap, now))
+		assert.NoError(t, fakeClient.Get(ctx, key, nodeHunt))
+		return nodeHunt.Status
+	}
+
+	// The queue time of pn-3 doesn't count, pn-1 is queued and pn-2 is being drained.
+	status := sync(now)
+	assert.Equal(t, NODE_HUNT_NODE_RUNNING, status.Nodes[0].Phase)
+	assert.Equal(t, 8, status.Nodes[0].JobID)
+	assert.Nil(t, status.Nodes[0].RunningTimestamp)
+	assert.Equal(t, NODE_HUNT_NODE_SKIPPED, status.Nodes[1].Phase)
+	assert.Contains(t, status.Nodes[1].Message, GoalStateDrain)
+	assert.Equal(t, 0, status.Nodes[1].JobID)
+	assert.Equal(t, NODE_HUNT_NODE_RUNNING, status.Nodes[2].Phase)
+	assert.Equal(t, now.Unix(), status.Nodes[2].RunningTimestamp.Unix())
+
+	// pn-3 ran for longer than the timeout and fails, pn-1 never left the queue and is skipped.
+	status = sync(now.Add(90 * time.Minute))
+	assert.Equal(t, NODE_HUNT_NODE_SKIPPED, status.Nodes[0].Phase)
+	assert.Equal(t, "Slurm job 8 was still queued after 1h0m0s.", status.Nodes[0].Message)
+	assert.Equal(t, NODE_HUNT_NODE_FAILED, status.Nodes[2].Phase)
+	assert.Equal(t, "Slurm job 7 was still RUNNING after running for 1h0m0s.", status.Nodes[2].Message)
+	assert.Equal(t, NODE_HUNT_PHASE_COMPLETED, status.Phase)
+	assert.Equal(t, 1, status.Failed)
+	assert.Equal(t, 2, status.Skipped)
+	slurmJobList, err := slurm.SyncSlurmJobs(socketPath)
+	assert.NoError(t, err)
+	assert.Empty(t, slurmJobList)
+	assert.Len(t, recorder.Events, 2)
+}
+
+func TestSyncNodeHuntDisruptionBudget(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	socketPath := "/tmp/test-nodehunt-budget.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, slurm.SlurmResponse{})
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	k8sNodeMap := map[string]*corev1.Node{}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+	objects := []runtime.Object{}
+	for _, name := range []string{"pn-1", "pn-2"} {
+		k8sNode := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "k8s-" + name, Labels: map[string]string{budget.LABEL_GKE_NODEPOOL: "h100"}},
+		}
+		k8sNodeMap[k8sNode.Name] = k8sNode
+		physicalNodeMap[name] = &slonkv1.PhysicalNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE},
+			Status: slonkv1.PhysicalNodeStatus{
+				SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-" + name},
+				K8sNodeStatus:   slonkv1.K8sNodeStatus{Name: k8sNode.Name},
+			},
+		}
+		objects = append(objects, k8sNode, physicalNodeMap[name].DeepCopy())
+	}
+	nodeHunt := &slonkv1.NodeHunt{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdc-hunt", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.NodeHuntSpec{
+			Diagnostic:  slonkv1.NodeHuntDiagnostic{SlurmJob: &slonkv1.NodeHuntSlurmJob{Script: "#!/bin/bash\ndcgmi diag -r 3\n"}},
+			Concurrency: 2,
+		},
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(append(objects, nodeHunt)...).
+		WithStatusSubresource(&slonkv1.NodeHunt{}).
+		Build()
+	tracker := budget.NewTracker([]budget.DisruptionBudget{{
+		Name:           "nodepool",
+		LabelKeys:      []string{budget.LABEL_GKE_NODEPOOL},
+		MaxDisruptions: 1,
+		Window:         metav1.Duration{Duration: time.Hour},
+	}})
+	tracker.Refresh(k8sNodeMap, func(*corev1.Node) bool { return false }, time.Now())
+	r := &NodeHuntReconciler{
+		Client:  fakeClient,
+		Scheme:  scheme.Scheme,
+		Budgets: tracker,
+	}
+
+	// Only one physical node of the nodepool can be disrupted at a time.
+	assert.NoError(t, r.Sync(context.Background(), socketPath, physicalNodeMap))
+	updatedNodeHunt := &slonkv1.NodeHunt{}
+	assert.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(nodeHunt), updatedNodeHunt))
+	status := updatedNodeHunt.Status
+	assert.Equal(t, NODE_HUNT_NODE_RUNNING, status.Nodes[0].Phase)
+	assert.Equal(t, NODE_HUNT_NODE_PENDING, status.Nodes[1].Phase)
+	assert.Contains(t, status.Nodes[1].Message, "budget nodepool exhausted")
+	assert.Equal(t, 0, status.Nodes[1].JobID)
+	assert.Equal(t, 1, tracker.Status()[0].Used)
+}
+
+func TestSyncNodeHuntMaxNodes(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+	for i := 0; i < MAX_NODE_HUNT_NODES+1; i++ {
+		name := fmt.Sprintf("pn-%04d", i)
+		physicalNodeMap[name] = &slonkv1.PhysicalNode{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE}}
+	}
+	nodeHunt := &slonkv1.NodeHunt{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdc-hunt", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.NodeHuntSpec{
+			Diagnostic: slonkv1.NodeHuntDiagnostic{SlurmJob: &slonkv1.NodeHuntSlurmJob{Script: "#!/bin/bash\ndcgmi diag -r 3\n"}},
+			Suspend:    true,
+		},
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(nodeHunt).
+		WithStatusSubresource(&slonkv1.NodeHunt{}).
+		Build()
+	r := &NodeHuntReconciler{Client: fakeClient, Scheme: scheme.Scheme}
+
+	// Selecting every physical node is capped, and the hunt says so.
+	assert.NoError(t, r.Sync(context.Background(), "", physicalNodeMap))
+	updatedNodeHunt := &slonkv1.NodeHunt{}
+	assert.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(nodeHunt), updatedNodeHunt))
+	assert.Len(t, updatedNodeHunt.Status.Nodes, MAX_NODE_HUNT_NODES)
+	assert.Equal(t, "pn-0999", updatedNodeHunt.Status.Nodes[MAX_NODE_HUNT_NODES-1].PhysicalNode)
+	assert.Contains(t, updatedNodeHunt.Status.Message, "first 1000 selected physical nodes")
+}
@@ -19,16 +19,22 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/budget"
+	"your-org.com/slonklet/internal/history"
+	"your-org.com/slonklet/internal/metrics"
 	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/tools"
+	"your-org.com/slonklet/internal/topology"
 )
 
 const (
@@ -59,14 +65,76 @@ const (
 // PhysicalNodeReconciler reconciles a PhysicalNode object
 type PhysicalNodeReconciler struct {
 	client.Client
-	Recorder record.EventRecorder
+	Recorder events.EventRecorder
 	Scheme   *runtime.Scheme
+
+	// Budgets limits disruptions per group of k8s nodes. Nil means unlimited.
+	Budgets *budget.Tracker
+
+	// Topology reads the topology of hosts into their status. Nil uses the default labels.
+	Topology *topology.Extractor
+
+	// Inventory provides the hardware inventories reported by the node-local agents. Optional.
+	Inventory InventorySource
+
+	// History archives status transitions, goal state changes and events of physical
+	// nodes beyond what fits in their status. Nil disables it.
+	History *history.Store
+
+	// Remediation actions of these types need approval before they are executed.
+	ApprovalRequiredActions map[string]bool
+	// All disruptive actions need approval if a plan has more of them than this. Zero disables it.
+	ApprovalThreshold int
+
+	// Evictor removes pods from k8s nodes being drained. Defaults to one that never deletes
+	// ingress pods blocked by disruption budgets.
+	Evictor *tools.Evictor
+
+	// How long jobs may keep running on a slurm node drained before its pod is removed.
+	// Zero means DEFAULT_DRAIN_DEADLINE.
+	DrainDeadline time.Duration
+	// Per-partition overrides of DrainDeadline.
+	PartitionDrainDeadlines map[string]time.Duration
+	// Requeue jobs still running when the drain deadline passes, instead of killing them.
+	RequeueOnDrainDeadline bool
+
+	// How hosts with a reboot taint are rebooted, see REBOOT_METHOD_*. Empty means
+	// REBOOT_METHOD_AUTO.
+	RebootMethod string
+	// Port of the node-local slonklet agent on the k8s node. Zero disables reboots through
+	// the agent.
+	AgentPort int
+	// Command the agent runs to reboot its host. Empty means DEFAULT_AGENT_REBOOT_COMMAND.
+	AgentRebootCommand string
+	// How long a host may take to come back healthy after a reboot was requested. Zero
+	// means DEFAULT_REBOOT_TIMEOUT.
+	RebootTimeout time.Duration
+
+	// Running slurm pods whose slurmd doesn't register with slurmctld for this long are
+	// restarted. Zero means DEFAULT_UNREGISTERED_POD_GRACE_PERIOD.
+	UnregisteredPodGracePeriod time.Duration
+	// After this many restarts of an unregistered slurm pod its k8s node is tainted to be
+	// drained. Zero means DEFAULT_UNREGISTERED_POD_MAX_RESTARTS.
+	UnregisteredPodMaxRestarts int
+
+	// Drain slurm nodes on hosts with a GCP maintenance taint and resume them afterwards.
+	MaintenanceDrain bool
+	// Signal sent to jobs on hosts entering maintenance, e.g. "USR1". Empty disables it.
+	MaintenanceJobSignal string
+
+	planCache            remediationPlanCache
+	unregisteredPodCache unregisteredSlurmPodCache
+	overrideCache        manualOverrideCache
+	recentEvents         recentEventCache
+	syncRetries          syncRetryQueue
 }
 
 //+kubebuilder:rbac:groups=slonk.your-org.com,resources=physicalnodes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=slonk.your-org.com,resources=physicalnodes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=slonk.your-org.com,resources=physicalnodes/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch;update
 //+kubebuilder:rbac:groups="",namespace=slurm,resources=pods,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -88,13 +156,20 @@ func (r *PhysicalNodeReconciler) Sync(
 	ctx context.Context,
 	socketPath string,
 	autoRemediate bool,
-) (map[string]*slonkv1.PhysicalNode, error) {
+) (_ map[string]*slonkv1.PhysicalNode, err error) {
 	logger := log.FromContext(ctx)
 
 	logger.Info("----------")
 	logger.Info("Started syncing physical nodes")
 
+	syncStart := time.Now()
+	defer func() {
+		metrics.ObservePhase(metrics.PHASE_PHYSICAL_NODE_TOTAL, syncStart, err)
+	}()
+
+	start := time.Now()
 	slurmNodeList, err := slurm.ListSlurmNodes(socketPath)
+	metrics.ObservePhase(metrics.PHASE_SLURM_FETCH, start, err)
 	if err != nil {
 		return nil, fmt.Errorf("fetch slurm nodes: %w", err)
 	}
@@ -104,34 +179,11 @@ func (r *PhysicalNodeReconciler) Sync(
 		slurmNodeMap[slurmNode.Name] = &slurmNodeCopy
 	}
 
-	slurmPodList := corev1.PodList{}
-	if err := r.Client.List(ctx, &slurmPodList, client.InNamespace(SLURM_NAMESPACE)); err != nil {
-		return nil, fmt.Errorf("list slurm pods: %w", err)
-	}
-	slurmPodMap := map[string]*corev1.Pod{}
-	for _, slurmPod := range slurmPodList.Items {
-		slurmPodCopy := slurmPod // Copy to avoid pointer reuse.
-		slurmPodMap[slurmPod.Name] = &slurmPodCopy
-	}
-
-	k8sNodeList := corev1.NodeList{}
-	if err := r.Client.List(ctx, &k8sNodeList); err != nil {
-		return nil, fmt.Errorf("list k8s nodes: %w", err)
-	}
-	k8sNodeMap := map[string]*corev1.Node{}
-	for _, k8sNode := range k8sNodeList.Items {
-		k8sNodeCopy := k8sNode // Copy to avoid pointer reuse.
-		k8sNodeMap[k8sNode.Name] = &k8sNodeCopy
-	}
-
-	existingPhysicalNodeList := slonkv1.PhysicalNodeList{}
-	if err := r.Client.List(ctx, &existingPhysicalNodeList); err != nil {
-		return nil, fmt.Errorf("list physical nodes: %w", err)
-	}
-	existingPhysicalNodeMap := map[string]*slonkv1.PhysicalNode{}
-	for _, existingPhysicalNode := range existingPhysicalNodeList.Items {
-		existingPhysicalNodeCopy := existingPhysicalNode // Copy to avoid pointer reuse.
-		existingPhysicalNodeMap[existingPhysicalNode.Name] = &existingPhysicalNodeCopy
+	start = time.Now()
+	slurmPodMap, k8sNodeMap, existingPhysicalNodeMap, err := r.listK8sObjects(ctx)
+	metrics.ObservePhase(metrics.PHASE_K8S_LIST, start, err)
+	if err != nil {
+		return nil, err
 	}
 	logger.Info("Fetched data",
 		"slurm node map", len(slurmNodeMap),
@@ -140,41 +192,121 @@ func (r *PhysicalNodeReconciler) Sync(
 		"physical node map", len(existingPhysicalNodeMap),
 	)
 
-	if _, err := r.SyncSlurmAndK8sNodeSpecAndStatus(ctx, slurmNodeMap, slurmPodMap, k8sNodeMap, existingPhysicalNodeMap); err != nil {
+	start = time.Now()
+	_, err = r.SyncSlurmAndK8sNodeSpecAndStatus(ctx, slurmNodeMap, slurmPodMap, k8sNodeMap, existingPhysicalNodeMap)
+	metrics.ObservePhase(metrics.PHASE_STATUS_SYNC, start, err)
+	if err != nil {
 		return nil, fmt.Errorf("sync slurm and k8s node specs and statuses: %w", err)
 	}
 
-	// TODO (yiran): Remove this block.
-	if err := r.Client.List(ctx, &existingPhysicalNodeList); err != nil {
-		return nil, fmt.Errorf("list physical nodes: %w", err)
+	r.Budgets.Refresh(k8sNodeMap, func(k8sNode *corev1.Node) bool {
+		return getLifecycleTaint(k8sNode) != nil
+	}, time.Now())
+
+	start = time.Now()
+	_, err = r.HandleManualOverrides(ctx, socketPath, slurmNodeMap, existingPhysicalNodeMap, autoRemediate)
+	metrics.ObservePhase(metrics.PHASE_MANUAL_OVERRIDES, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("handle manual overrides: %w", err)
 	}
-	existingPhysicalNodeMap = map[string]*slonkv1.PhysicalNode{}
-	for _, existingPhysicalNode := range existingPhysicalNodeList.Items {
-		existingPhysicalNodeCopy := existingPhysicalNode // Copy to avoid pointer reuse.
-		existingPhysicalNodeMap[existingPhysicalNode.Name] = &existingPhysicalNodeCopy
+
+	start = time.Now()
+	_, err = r.HandleUnregisteredSlurmPods(ctx, slurmNodeMap, slurmPodMap, k8sNodeMap, existingPhysicalNodeMap, autoRemediate)
+	metrics.ObservePhase(metrics.PHASE_UNREGISTERED_PODS, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("handle unregistered slurm pods: %w", err)
 	}
 
 	// if _, err := r.PropogateSlurmReservationToK8sNodeTaints(ctx, k8sNodeMap); err != nil {
 	// 	return nil, fmt.Errorf("propogate k8s goal state to slurm node annotations: %w", err)
 	// }
 
-	if _, err := r.PropogateSlurmGoalStateToK8sNodeTaints(ctx, slurmNodeMap, k8sNodeMap, existingPhysicalNodeMap); err != nil {
+	start = time.Now()
+	_, err = r.PropogateSlurmGoalStateToK8sNodeTaints(ctx, slurmNodeMap, k8sNodeMap, existingPhysicalNodeMap)
+	metrics.ObservePhase(metrics.PHASE_TAINT_PROPAGATION, start, err)
+	if err != nil {
 		return nil, fmt.Errorf("propogate slurm goal state to k8s node taints: %w", err)
 	}
 
+	if r.MaintenanceDrain {
+		start = time.Now()
+		_, err = r.HandleMaintenance(ctx, socketPath, slurmNodeMap, k8sNodeMap, existingPhysicalNodeMap)
+		metrics.ObservePhase(metrics.PHASE_MAINTENANCE, start, err)
+		if err != nil {
+			return nil, fmt.Errorf("handle gcp maintenance: %w", err)
+		}
+	}
+
 	if autoRemediate {
-		if _, err := r.AutoRemediate(ctx, slurmNodeMap, k8sNodeMap, existingPhysicalNodeMap, false); err != nil {
+		start = time.Now()
+		_, err = r.AutoRemediate(ctx, socketPath, slurmNodeMap, k8sNodeMap, existingPhysicalNodeMap, false)
+		metrics.ObservePhase(metrics.PHASE_REMEDIATION, start, err)
+		if err != nil {
 			return nil, fmt.Errorf("auto-remediate k8s nodes: %w", err)
 		}
 	}
 
+	start = time.Now()
+	_, err = r.UpdateConditions(ctx, k8sNodeMap, existingPhysicalNodeMap)
+	metrics.ObservePhase(metrics.PHASE_CONDITIONS, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("update physical node conditions: %w", err)
+	}
+
+	updatePhysicalNodeMetrics(existingPhysicalNodeMap, k8sNodeMap)
+	updateCapacityMetrics(slurmNodeMap, existingPhysicalNodeMap)
+	metrics.UpdateDisruptionBudgets(r.Budgets.Status())
+
 	logger.Info("Finished syncing physical nodes")
 
 	return existingPhysicalNodeMap, nil
 }
 
+// listK8sObjects lists the slurm pods, k8s nodes and physical nodes, keyed by name.
+func (r *PhysicalNodeReconciler) listK8sObjects(ctx context.Context) (
+	map[string]*corev1.Pod,
+	map[string]*corev1.Node,
+	map[string]*slonkv1.PhysicalNode,
+	error,
+) {
+	slurmPodList := corev1.PodList{}
+	if err := r.Client.List(ctx, &slurmPodList, client.InNamespace(SLURM_NAMESPACE)); err != nil {
+		return nil, nil, nil, fmt.Errorf("list slurm pods: %w", err)
+	}
+	slurmPodMap := map[string]*corev1.Pod{}
+	for _, slurmPod := range slurmPodList.Items {
+		slurmPodCopy := slurmPod // Copy to avoid pointer reuse.
+		slurmPodMap[slurmPod.Name] = &slurmPodCopy
+	}
+
+	k8sNodeList := corev1.NodeList{}
+	if err := r.Client.List(ctx, &k8sNodeList); err != nil {
+		return nil, nil, nil, fmt.Errorf("list k8s nodes: %w", err)
+	}
+	k8sNodeMap := map[string]*corev1.Node{}
+	for _, k8sNode := range k8sNodeList.Items {
+		k8sNodeCopy := k8sNode // Copy to avoid pointer reuse.
+		k8sNodeMap[k8sNode.Name] = &k8sNodeCopy
+	}
+
+	existingPhysicalNodeList := slonkv1.PhysicalNodeList{}
+	if err := r.Client.List(ctx, &existingPhysicalNodeList); err != nil {
+		return nil, nil, nil, fmt.Errorf("list physical nodes: %w", err)
+	}
+	existingPhysicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+	for _, existingPhysicalNode := range existingPhysicalNodeList.Items {
+		existingPhysicalNodeCopy := existingPhysicalNode // Copy to avoid pointer reuse.
+		existingPhysicalNodeMap[existingPhysicalNode.Name] = &existingPhysicalNodeCopy
+	}
+
+	return slurmPodMap, k8sNodeMap, existingPhysicalNodeMap, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PhysicalNodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := SetupFieldIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&slonkv1.PhysicalNode{}).
 		Complete(r)
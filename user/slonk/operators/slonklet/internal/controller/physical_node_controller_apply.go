@@ -8,6 +8,7 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -26,6 +27,7 @@ const (
 	ACTION_SLURM_POD_KEEP    = "SlurmPodKeep"
 	ACTION_SLURM_POD_DELETE  = "SlurmPodDelete"
 	ACTION_SLURM_POD_RESTART = "SlurmPodRestart"
+	ACTION_SLURM_NODE_REBOOT = "SlurmNodeReboot"
 
 	ACTION_K8S_NODE_KEEP   = "K8sNodeKeep"
 	ACTION_K8S_NODE_DRAIN  = "K8sNodeDrain"
@@ -75,18 +77,19 @@ func (r *PhysicalNodeReconciler) PropogateSlurmReservationToK8sNodeTaints(
 			Value:  SLURM_RESERVATION_TAINT_VALUE,
 			Effect: corev1.TaintEffectNoSchedule,
 		}
-		newTaints := []corev1.Taint{}
-		for _, taint := range currentK8sNode.Spec.Taints {
-			if taint.Key == SLURM_RESERVATION_TAINT_KEY && taint.Value == SLURM_RESERVATION_TAINT_VALUE {
-				// Ignore existing taint with same key and value but different effect.
-				continue
+		if _, err := tools.PatchNode(ctx, r.Client, currentK8sNode, func(node *corev1.Node) bool {
+			newTaints := []corev1.Taint{}
+			for _, taint := range node.Spec.Taints {
+				if taint.Key == SLURM_RESERVATION_TAINT_KEY && taint.Value == SLURM_RESERVATION_TAINT_VALUE {
+					// Ignore existing taint with same key and value but different effect.
+					continue
+				}
+				newTaints = append(newTaints, taint)
 			}
-			newTaints = append(newTaints, taint)
-		}
-		newTaints = append(newTaints, newTaint)
-
-		currentK8sNode.Spec.Taints = newTaints
-		if err := r.Client.Update(ctx, currentK8sNode); err != nil {
+			newTaints = append(newTaints, newTaint)
+			node.Spec.Taints = newTaints
+			return true
+		}); err != nil {
 			// Log and continue.
 			logger.Info(
 				"Failed to add taint to k8s node",
@@ -151,16 +154,11 @@ func (r *PhysicalNodeReconciler) PropogateSlurmGoalStateToK8sNodeTaints(
 				var newAnnotation string
 				var newTaint corev1.Taint
 
-				if val, ok := currentK8sNode.Annotations[SLURM_GOAL_STATE_ANNOTATION]; !ok || val != existingPhysicalNode.Spec.SlurmNodeSpec.GoalState {
-					currentK8sNode.Annotations[SLURM_GOAL_STATE_ANNOTATION] = existingPhysicalNode.Spec.SlurmNodeSpec.GoalState
+				goalState := existingPhysicalNode.Spec.SlurmNodeSpec.GoalState
+				reason := existingPhysicalNode.Spec.SlurmNodeSpec.Reason
+				if val, ok := currentK8sNode.Annotations[SLURM_GOAL_STATE_ANNOTATION]; !ok || val != goalState {
 					updateAnnotations = true
-					newAnnotation = fmt.Sprintf("%s:%s", SLURM_GOAL_STATE_ANNOTATION, existingPhysicalNode.Spec.SlurmNodeSpec.GoalState)
-					// Also include reason, or clear previous reason.
-					if existingPhysicalNode.Spec.SlurmNodeSpec.Reason != "" {
-						currentK8sNode.Annotations[SLURM_REASON_ANNOTATION] = existingPhysicalNode.Spec.SlurmNodeSpec.Reason
-					} else {
-						delete(currentK8sNode.Annotations, SLURM_REASON_ANNOTATION)
-					}
+					newAnnotation = fmt.Sprintf("%s:%s", SLURM_GOAL_STATE_ANNOTATION, goalState)
 				}
 
 				if existingPhysicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateDown {
@@ -180,11 +178,14 @@ func (r *PhysicalNodeReconciler) PropogateSlurmGoalStateToK8sNodeTaints(
 							}
 						}
 						if !exists {
-							currentK8sNode.Spec.Taints = append(currentK8sNode.Spec.Taints, taint)
-							newTaint = taint
-							updateTaints = true
-							taintCountInIteration++
-							taintCountTotal++
+							if allowed, reason := r.Budgets.Allow(currentK8sNode, existingPhysicalNode.Name); !allowed {
+								logger.Info("Disruption budget exhausted, pausing taint", "name", currentK8sNode.Name, "physical node", existingPhysicalNode.Name, "reason", reason)
+							} else {
+								newTaint = taint
+								updateTaints = true
+								taintCountInIteration++
+								taintCountTotal++
+							}
 						}
 					} else {
 						// If we have already tainted enough nodes, stop tainting more nodes in this iteration.
@@ -216,9 +217,27 @@ func (r *PhysicalNodeReconciler) PropogateSlurmGoalStateToK8sNodeTaints(
 					}
 				}
 
-				// Commit annotations and taints to k8s node.
+				// Commit annotations and taints to k8s node. Only the changed annotations and
+				// taints are patched, on top of the latest k8s node.
 				if updateAnnotations || updateTaints {
-					if err := r.Client.Update(ctx, currentK8sNode); err != nil {
+					if _, err := tools.PatchNode(ctx, r.Client, currentK8sNode, func(node *corev1.Node) bool {
+						if updateAnnotations {
+							if node.Annotations == nil {
+								node.Annotations = map[string]string{}
+							}
+							node.Annotations[SLURM_GOAL_STATE_ANNOTATION] = goalState
+							// Also include reason, or clear previous reason.
+							if reason != "" {
+								node.Annotations[SLURM_REASON_ANNOTATION] = reason
+							} else {
+								delete(node.Annotations, SLURM_REASON_ANNOTATION)
+							}
+						}
+						if updateTaints && !hasTaint(node, newTaint) {
+							node.Spec.Taints = append(node.Spec.Taints, newTaint)
+						}
+						return true
+					}); err != nil {
 						// Log and continue.
 						logger.Info(
 							"Failed to add annotations and taints to k8s node",
@@ -228,6 +247,7 @@ func (r *PhysicalNodeReconciler) PropogateSlurmGoalStateToK8sNodeTaints(
 						)
 					} else {
 						if updateTaints {
+							r.Budgets.Record(currentK8sNode, existingPhysicalNode.Name, time.Now())
 							logger.Info(
 								"Added annotations and taints to k8s node",
 								"name", currentK8sNode.Name,
@@ -253,9 +273,11 @@ func (r *PhysicalNodeReconciler) PropogateSlurmGoalStateToK8sNodeTaints(
 	return ctrl.Result{}, nil
 }
 
-// AutoRemediate deletes one node with known lifecycle taint.
+// AutoRemediate plans remediation actions for k8s nodes with lifecycle taints and
+// executes the ones that are allowed.
 func (r *PhysicalNodeReconciler) AutoRemediate(
 	ctx context.Context,
+	socketPath string,
 	slurmNodeMap map[string]*slurm.SlurmNode,
 	k8sNodeMap map[string]*corev1.Node,
 	existingPhysicalNodeMap map[string]*slonkv1.PhysicalNode,
@@ -265,358 +287,374 @@ func (r *PhysicalNodeReconciler) AutoRemediate(
 
 	logger.Info("Started auto-remediation for k8s nodes with lifecycle taints")
 
-	slurmPodList := corev1.PodList{}
-	if err := r.Client.List(ctx, &slurmPodList, client.InNamespace(SLURM_NAMESPACE)); err != nil {
-		return ctrl.Result{}, fmt.Errorf("list slurm pods: %w", err)
-	}
-	systemPodListUnfiltered := corev1.PodList{}
-	if err := r.Client.List(ctx, &systemPodListUnfiltered, client.InNamespace(SYSTEM_NAMESPACE)); err != nil {
-		return ctrl.Result{}, fmt.Errorf("list system pods: %w", err)
+	if r.Evictor == nil {
+		r.Evictor = tools.NewEvictor(r.Client, tools.DEFAULT_EVICTION_FALLBACK, NGINX_INGRESS_NAMESPACE)
 	}
-	systemPodList := corev1.PodList{}
-	for _, pod := range systemPodListUnfiltered.Items {
-		if len(pod.ObjectMeta.OwnerReferences) > 0 && pod.ObjectMeta.OwnerReferences[0].Kind == "ReplicaSet" {
-			systemPodList.Items = append(systemPodList.Items, pod)
+
+	// Only the pods on k8s nodes with a lifecycle taint matter for remediation.
+	lifecycleTaintedK8sNodeNames := []string{}
+	for _, k8sNode := range k8sNodeMap {
+		if getLifecycleTaint(k8sNode) != nil {
+			lifecycleTaintedK8sNodeNames = append(lifecycleTaintedK8sNodeNames, k8sNode.Name)
 		}
 	}
-	ingressPodList := corev1.PodList{}
-	if err := r.Client.List(ctx, &ingressPodList, client.InNamespace(NGINX_INGRESS_NAMESPACE)); err != nil {
-		return ctrl.Result{}, fmt.Errorf("list ingress pods: %w", err)
+	podLists, err := r.listPodsOnK8sNodes(ctx, lifecycleTaintedK8sNodeNames)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("list pods on tainted k8s nodes: %w", err)
 	}
-	podLists := map[string]corev1.PodList{
-		SLURM_NAMESPACE:         slurmPodList,
-		SYSTEM_NAMESPACE:        systemPodList,
-		NGINX_INGRESS_NAMESPACE: ingressPodList,
+
+	plan := &RemediationPlan{
+		Timestamp: time.Now(),
+		Dryrun:    dryrun,
+		Actions:   r.PlanRemediation(ctx, slurmNodeMap, k8sNodeMap, existingPhysicalNodeMap, podLists, time.Now()),
 	}
 
+	// Jobs are only fetched when a slurm pod is about to be deleted or rebooted.
+	var slurmJobs []slurm.SlurmJob
+	slurmJobsFetched := false
+
+	// Reboots and drains started in previous iterations count towards the limit until they
+	// finish, so that the limit caps the actions in flight and not only the new ones.
 	actionLimit := 30
 	actionCount := 0
-	for _, k8sNode := range k8sNodeMap {
-		if k8sNode.Spec.Taints != nil {
-			// Only proceeed if the k8s node has a lifecycle taint.
-			var lifecycleTaint *corev1.Taint
-			for _, taint := range k8sNode.Spec.Taints {
-				if strings.HasPrefix(taint.Key, SLURM_TAINT_PREFIX) ||
-					taint.Key == GCP_MAINTENANCE_STARTED ||
-					taint.Key == GCP_MAINTENANCE_IMPENDING_TERMINATION {
-					lifecycleTaint = taint.DeepCopy()
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+		if action.IsDisruptive() && isRemediationStarted(action, existingPhysicalNodeMap[action.PhysicalNodeName]) {
+			actionCount++
+		}
+	}
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+		logger.Info("Action: "+action.Type,
+			"rationale", action.Rationale,
+			"taint", action.taintString(),
+			"pod", action.SlurmPodName,
+			"k8s node", action.K8sNodeName,
+			"physical node", action.PhysicalNodeName,
+		)
+
+		if !action.IsDisruptive() {
+			action.Outcome = OUTCOME_SKIPPED
+			continue
+		}
+
+		if dryrun {
+			logger.Info("Dryrun, abort action.")
+			action.Outcome = OUTCOME_DRYRUN
+			continue
+		}
+
+		physicalNode := existingPhysicalNodeMap[action.PhysicalNodeName]
+		started := isRemediationStarted(action, physicalNode)
+		if !started && actionCount >= actionLimit {
+			action.Outcome = OUTCOME_SKIPPED
+			action.Message = fmt.Sprintf("reached action limit %d", actionLimit)
+			continue
+		}
+
+		if action.HighRisk && !r.isRemediationApproved(physicalNode, action) {
+			logger.Info("Action requires approval",
+				"action", action.Type,
+				"k8s node", action.K8sNodeName,
+				"physical node", action.PhysicalNodeName,
+			)
+			action.Outcome = OUTCOME_PENDING_APPROVAL
+			continue
+		}
+
+		k8sNode := k8sNodeMap[action.K8sNodeName]
+		if allowed, reason := r.Budgets.Allow(k8sNode, action.PhysicalNodeName); !allowed {
+			logger.Info("Disruption budget exhausted, pausing action",
+				"action", action.Type,
+				"reason", reason,
+				"k8s node", action.K8sNodeName,
+				"physical node", action.PhysicalNodeName,
+			)
+			action.Outcome = OUTCOME_BUDGET_EXHAUSTED
+			action.Message = reason
+			continue
+		}
+
+		if action.Type == ACTION_SLURM_POD_DELETE || action.Type == ACTION_SLURM_NODE_REBOOT {
+			if !slurmJobsFetched {
+				jobs, err := slurm.SyncSlurmJobs(socketPath)
+				if err != nil {
+					logger.Info("Failed to fetch slurm jobs", "error", err)
+					action.Outcome = OUTCOME_FAILED
+					action.Message = fmt.Sprintf("fetch slurm jobs: %s", err)
+					continue
 				}
+				slurmJobs = jobs
+				slurmJobsFetched = true
 			}
-			if lifecycleTaint == nil {
+		}
+
+		if action.Type == ACTION_SLURM_NODE_REBOOT {
+			// Reboots span several iterations, until the host is back with a new boot time.
+			done, err := r.rebootSlurmNode(ctx, socketPath, action, k8sNode, physicalNode, slurmNodeMap[action.SlurmPodName], slurmJobs, time.Now())
+			if err != nil {
+				logger.Info("Failed to reboot slurm node",
+					"error", err,
+					"pod", action.SlurmPodName,
+					"k8s node", action.K8sNodeName,
+					"physical node", action.PhysicalNodeName,
+				)
+				action.Outcome = OUTCOME_FAILED
+				action.Message = err.Error()
 				continue
 			}
-
-			// Find the physical node corresponding to the k8s node.
-			physicalNodeName := ""
-			var physicalNode *slonkv1.PhysicalNode
-			var err error
-			var ok bool
-			physicalNodeName, err = r.getPhysicalNodeName(k8sNode, IDENTIFIER_GPU_UUID_HASH)
-			if err != nil || physicalNodeName == "" {
-				if !strings.Contains(k8sNode.Name, "cpu") {
-					logger.Info("No physical host name found for k8s node", "name", k8sNode.Name)
+			r.Budgets.Record(k8sNode, action.PhysicalNodeName, time.Now())
+			if !started {
+				actionCount++
+			}
+			if !done {
+				action.Outcome = OUTCOME_IN_PROGRESS
+				if physicalNode.Status.Reboot != nil {
+					action.Message = physicalNode.Status.Reboot.Message
+				} else if physicalNode.Status.SlurmDrain != nil {
+					action.Message = physicalNode.Status.SlurmDrain.Message
 				}
 				continue
 			}
-			physicalNode, ok = existingPhysicalNodeMap[physicalNodeName]
-			if !ok {
-				logger.Info("Physical node not found for k8s node", "name", k8sNode.Name, "physical node", physicalNodeName)
-				continue
+			action.Outcome = OUTCOME_EXECUTED
+			if action.HighRisk {
+				r.consumeRemediationApproval(ctx, physicalNode)
 			}
+			continue
+		}
 
-			// Check if there are running pods. Don't delete the node if there are still running pods on it.
-			// Also wait for ~1 hour before deleting the pods if they are already in drain/down state in slurm as intended.
-			hasPods := false
-			action := ""
-			var slurmPod *corev1.Pod
-			slurmPodName := ""
-			for _, podList := range podLists {
-				for _, pod := range podList.Items {
-					if pod.Spec.NodeName == k8sNode.Name {
-						hasPods = true
-
-						if _, ok := slurmNodeMap[pod.Name]; ok {
-							slurmPod = &pod
-							slurmPodName = pod.Name
-
-							if lifecycleTaint.Key == SLURM_TAINT_GOAL_STATE {
-								for _, state := range slurmNodeMap[pod.Name].State {
-									if ((strings.EqualFold(state, "DOWN") && physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateDown) ||
-										(strings.EqualFold(state, "DRAIN") && physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateDrain)) &&
-										(pod.Status.StartTime != nil && time.Since(pod.Status.StartTime.Time) < time.Minute*5) {
-										logger.Info("Action: keeping slurm pod on tainted k8s node for a while",
-											"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-											"pod", pod.Name,
-											"k8s node", k8sNode.Name,
-											"physical node", physicalNodeName,
-										)
-										action = ACTION_SLURM_POD_KEEP
-										break
-									}
-								}
-								if action == "" {
-									logger.Info("Action: delete slurm pod",
-										"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-										"pod", pod.Name,
-										"k8s node", k8sNode.Name,
-										"physical node", physicalNodeName,
-									)
-									action = ACTION_SLURM_POD_DELETE
-								}
-							} else if lifecycleTaint.Key == SLURM_TAINT_ACTION_QUIT {
-								logger.Info("Action: restart slurm pod",
-									"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-									"pod", pod.Name,
-									"k8s node", k8sNode.Name,
-									"physical node", physicalNodeName,
-								)
-								action = ACTION_SLURM_POD_RESTART
-							} else if lifecycleTaint.Key == SLURM_TAINT_ACTION_REBOOT ||
-								lifecycleTaint.Key == SLURM_TAINT_ACTION_MANUAL ||
-								lifecycleTaint.Key == SLURM_TAINT_ACTION_RMA {
-								logger.Info("Action: delete slurm pod",
-									"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-									"pod", pod.Name,
-									"k8s node", k8sNode.Name,
-									"physical node", physicalNodeName,
-								)
-								action = ACTION_SLURM_POD_DELETE
-							} else if lifecycleTaint.Key == GCP_MAINTENANCE_STARTED ||
-								lifecycleTaint.Key == GCP_MAINTENANCE_IMPENDING_TERMINATION {
-								logger.Info("Action: keeping slurm pod on tainted k8s node for now after getting maintenance taint",
-									"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-									"pod", pod.Name,
-									"k8s node", k8sNode.Name,
-									"physical node", physicalNodeName,
-								)
-								action = ACTION_K8S_NODE_KEEP
-							} else {
-								logger.Info("action: delete slurm pod with unknown taint",
-									"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-									"pod", pod.Name,
-									"k8s node", k8sNode.Name,
-									"physical node", physicalNodeName,
-								)
-								action = ACTION_SLURM_POD_DELETE
-							}
-
-							break
-						}
-					}
-				}
+		if action.Type == ACTION_SLURM_POD_DELETE {
+			// Drain the slurm node and wait for its jobs before deleting the pod.
+			done, err := r.drainSlurmNode(ctx, socketPath, action, physicalNode, slurmNodeMap[action.SlurmPodName], slurmJobs, time.Now())
+			if err != nil {
+				logger.Info("Failed to drain slurm node",
+					"error", err,
+					"pod", action.SlurmPodName,
+					"k8s node", action.K8sNodeName,
+					"physical node", action.PhysicalNodeName,
+				)
+				action.Outcome = OUTCOME_FAILED
+				action.Message = err.Error()
+				continue
 			}
-
-			if action == "" {
-				if lifecycleTaint.Key == SLURM_TAINT_ACTION_QUIT {
-					// TODO (yiran): this is special case for a corner case.
-					logger.Info("Action: untaint k8s node since slurm pod was already deleted",
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-					action = ACTION_SLURM_POD_RESTART
-				} else if hasPods || !k8sNode.Spec.Unschedulable {
-					logger.Info("Action: drain k8s node",
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-					action = ACTION_K8S_NODE_DRAIN
-				} else if time.Since(k8sNode.CreationTimestamp.Time) < time.Minute*15 {
-					logger.Info("Action: keeping k8s node with lifecycle taint for a while",
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-					action = ACTION_K8S_NODE_KEEP
-				} else {
-					logger.Info("Action: delete k8s node",
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-					action = ACTION_K8S_NODE_DELETE
+			if !done {
+				action.Outcome = OUTCOME_IN_PROGRESS
+				action.Message = physicalNode.Status.SlurmDrain.Message
+				r.Budgets.Record(k8sNode, action.PhysicalNodeName, time.Now())
+				if !started {
+					actionCount++
 				}
-			}
-
-			if dryrun {
-				logger.Info("Dryrun, abort action.")
 				continue
 			}
+		}
 
-			if actionCount >= actionLimit {
-				logger.Info("Reached action limit", "limit", actionLimit, "count", actionCount)
-				break
+		if err := r.executeRemediationAction(ctx, action, k8sNode, physicalNode, podLists); err != nil {
+			logger.Info("Failed to execute action",
+				"error", err,
+				"action", action.Type,
+				"taint", action.taintString(),
+				"pod", action.SlurmPodName,
+				"k8s node", action.K8sNodeName,
+				"physical node", action.PhysicalNodeName,
+			)
+			action.Outcome = OUTCOME_FAILED
+			action.Message = err.Error()
+		} else {
+			action.Outcome = OUTCOME_EXECUTED
+			if action.HighRisk {
+				r.consumeRemediationApproval(ctx, physicalNode)
 			}
+		}
 
-			// Perform the action.
-			acted := false
-			if action == ACTION_SLURM_POD_KEEP {
-				continue
-			} else if action == ACTION_SLURM_POD_RESTART {
-				if slurmPod != nil {
-					podLists := map[string]corev1.PodList{
-						SLURM_NAMESPACE: {Items: []corev1.Pod{*slurmPod}},
-					}
-					if _, err := tools.DeletePodsOnNode(ctx, r.Client, podLists, k8sNode.Name); err != nil {
-						logger.Info("Failed to delete slurm pod",
-							"error", err,
-							"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-							"pod", slurmPodName,
-							"k8s node", k8sNode.Name,
-							"physical node", physicalNodeName,
-						)
-						continue
-					}
-				}
-				k8sNodeCopy := k8sNode.DeepCopy()
-				if _, err := tools.MaybeRemoveTaintFromNode(ctx, r.Client, k8sNodeCopy, *lifecycleTaint); err != nil {
-					logger.Info("Failed to remove taint from k8s node",
-						"error", err,
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"pod", slurmPodName,
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-				}
+		// Failed actions may have partially disrupted the node, count them as well. Drains
+		// started in previous iterations are already counted.
+		if !started {
+			actionCount++
+		}
+		r.Budgets.Record(k8sNode, action.PhysicalNodeName, time.Now())
+	}
+	if actionCount >= actionLimit {
+		logger.Info("Reached action limit", "limit", actionLimit, "count", actionCount)
+	}
+	r.setRemediationPlan(plan)
+	if !dryrun {
+		recordRemediationMetrics(plan)
+	}
 
-				acted = true
-
-				message := fmt.Sprintf(
-					"Auto untainted k8s node. Lifecycle taint %s. K8s node: %s. Physical node: %s.",
-					fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-					k8sNode.Name,
-					physicalNodeName)
-				if slurmPod != nil {
-					message = fmt.Sprintf(
-						"Auto removed pod %s for lifecycle taint %s, and untainted k8s node %s. Physical node: %s.",
-						slurmPodName,
-						fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						k8sNode.Name,
-						physicalNodeName)
-				}
-				if err := r.emitAndRecordEvent(
-					physicalNode,
-					REASON_SLONKLET_AUTO_SLURM_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit and record eviction event", "error", err)
-					continue
-				}
-			} else if action == ACTION_SLURM_POD_DELETE {
-				podLists := map[string]corev1.PodList{
-					SLURM_NAMESPACE: {Items: []corev1.Pod{*slurmPod}},
-				}
-				if _, err := tools.DeletePodsOnNode(ctx, r.Client, podLists, k8sNode.Name); err != nil {
-					logger.Info("Failed to delete slurm pod",
-						"error", err,
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"pod", slurmPodName,
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-				}
+	for _, status := range r.Budgets.Status() {
+		if status.Exhausted {
+			logger.Info("Disruption budget exhausted",
+				"budget", status.Name,
+				"group", status.Group,
+				"used", status.Used,
+				"limit", status.Limit,
+				"in flight", status.InFlight,
+				"blocked", status.Blocked,
+			)
+		}
+	}
+	logger.Info("Finished auto-remediation for k8s nodes with lifecycle taints", "actionCount", actionCount)
 
-				acted = true
-
-				message := fmt.Sprintf(
-					"Auto removed Pod %s for lifecycle taint %s. K8s node: %s. Physical node: %s.",
-					slurmPodName,
-					fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-					k8sNode.Name,
-					physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					physicalNode,
-					REASON_SLONKLET_AUTO_SLURM_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit and record eviction event", "error", err)
-					continue
-				}
-			} else if action == ACTION_K8S_NODE_KEEP {
-				continue
-			} else if action == ACTION_K8S_NODE_DRAIN {
-				k8sNodeCopy := k8sNode.DeepCopy()
-				k8sNodeCopy.Spec.Unschedulable = true
-				if err := r.Client.Update(ctx, k8sNodeCopy); err != nil {
-					logger.Info("Failed to mark k8s node as unschedulable",
-						"error", err,
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"pod", slurmPodName,
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-				}
+	return ctrl.Result{}, nil
+}
 
-				if _, err := tools.DeletePodsOnNode(ctx, r.Client, podLists, k8sNode.Name); err != nil {
-					logger.Info("Failed to evict pods on tainted k8s node",
-						"error", err,
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"pod", slurmPodName,
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-				}
+// isRemediationStarted returns whether a reboot or slurm drain of the action was started in
+// a previous iteration and hasn't finished yet.
+func isRemediationStarted(action *RemediationAction, physicalNode *slonkv1.PhysicalNode) bool {
+	if physicalNode == nil {
+		return false
+	}
+	drain := physicalNode.Status.SlurmDrain
+	draining := drain != nil && drain.SlurmNodeName == action.SlurmPodName && drain.Phase == DRAIN_PHASE_DRAINING
+	switch action.Type {
+	case ACTION_SLURM_NODE_REBOOT:
+		reboot := physicalNode.Status.Reboot
+		return draining || (reboot != nil && reboot.SlurmNodeName == action.SlurmPodName &&
+			(reboot.Phase == REBOOT_PHASE_REQUESTED || reboot.Phase == REBOOT_PHASE_REBOOTED))
+	case ACTION_SLURM_POD_DELETE:
+		return draining
+	}
+	return false
+}
 
-				acted = true
-
-				message := fmt.Sprintf(
-					"Auto drained K8s node %s for lifecycle taint %s. Physical node: %s.",
-					k8sNode.Name,
-					fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-					physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					physicalNode,
-					REASON_SLONKLET_AUTO_K8S_NODE_DRAIN,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit and record eviction event", "error", err)
-					continue
-				}
-			} else if action == ACTION_K8S_NODE_DELETE {
-				k8sNodeCopy := k8sNode.DeepCopy()
-				if err := r.Client.Delete(ctx, k8sNodeCopy); err != nil {
-					logger.Info("Failed to delete k8s node with lifecycle taint",
-						"error", err,
-						"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-						"pod", slurmPodName,
-						"k8s node", k8sNode.Name,
-						"physical node", physicalNodeName,
-					)
-				}
+// executeRemediationAction performs a single planned action. It is safe to execute the
+// same action again, e.g. in the next iteration after a partial failure.
+func (r *PhysicalNodeReconciler) executeRemediationAction(
+	ctx context.Context,
+	action *RemediationAction,
+	k8sNode *corev1.Node,
+	physicalNode *slonkv1.PhysicalNode,
+	podLists map[string]corev1.PodList,
+) error {
+	logger := log.FromContext(ctx)
 
-				acted = true
-
-				message := fmt.Sprintf(
-					"Auto deleted K8s node %s for lifecycle taint %s. Physical node: %s.",
-					k8sNode.Name,
-					fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-					physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					physicalNode,
-					REASON_SLONKLET_AUTO_K8S_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit and record eviction event", "error", err)
-					continue
-				}
-			} else {
-				logger.Info("Unknown action",
-					"action", action,
-					"taint", fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
-					"pod", slurmPodName,
-					"k8s node", k8sNode.Name,
-					"physical node", physicalNodeName)
+	var slurmPod *corev1.Pod
+	for _, pod := range podLists[SLURM_NAMESPACE].Items {
+		if pod.Name == action.SlurmPodName && pod.Spec.NodeName == action.K8sNodeName {
+			slurmPod = pod.DeepCopy()
+			break
+		}
+	}
+
+	var reason, message string
+	switch action.Type {
+	case ACTION_SLURM_POD_RESTART:
+		if slurmPod != nil {
+			slurmPodLists := map[string]corev1.PodList{
+				SLURM_NAMESPACE: {Items: []corev1.Pod{*slurmPod}},
+			}
+			if _, err := tools.DeletePodsOnNode(ctx, r.Client, slurmPodLists, action.K8sNodeName); err != nil {
+				return fmt.Errorf("delete slurm pod: %w", err)
 			}
+		}
+		if _, err := tools.MaybeRemoveTaintFromNode(ctx, r.Client, k8sNode.DeepCopy(), action.Taint); err != nil {
+			logger.Info("Failed to remove taint from k8s node",
+				"error", err,
+				"taint", action.taintString(),
+				"pod", action.SlurmPodName,
+				"k8s node", action.K8sNodeName,
+				"physical node", action.PhysicalNodeName,
+			)
+		}
 
-			// Emit event accordingly.
-			if acted {
-				actionCount++
+		reason = REASON_SLONKLET_AUTO_SLURM_NODE_DELETION
+		message = fmt.Sprintf(
+			"Auto untainted k8s node. Lifecycle taint %s. K8s node: %s. Physical node: %s.",
+			action.taintString(),
+			action.K8sNodeName,
+			action.PhysicalNodeName)
+		if slurmPod != nil {
+			message = fmt.Sprintf(
+				"Auto removed pod %s for lifecycle taint %s, and untainted k8s node %s. Physical node: %s.",
+				action.SlurmPodName,
+				action.taintString(),
+				action.K8sNodeName,
+				action.PhysicalNodeName)
+		}
+	case ACTION_SLURM_POD_DELETE:
+		if slurmPod != nil {
+			slurmPodLists := map[string]corev1.PodList{
+				SLURM_NAMESPACE: {Items: []corev1.Pod{*slurmPod}},
+			}
+			if _, err := tools.DeletePodsOnNode(ctx, r.Client, slurmPodLists, action.K8sNodeName); err != nil {
+				return fmt.Errorf("delete slurm pod: %w", err)
+			}
+		}
+
+		reason = REASON_SLONKLET_AUTO_SLURM_NODE_DELETION
+		message = fmt.Sprintf(
+			"Auto removed Pod %s for lifecycle taint %s. K8s node: %s. Physical node: %s.",
+			action.SlurmPodName,
+			action.taintString(),
+			action.K8sNodeName,
+			action.PhysicalNodeName)
+	case ACTION_K8S_NODE_DRAIN:
+		if !k8sNode.Spec.Unschedulable {
+			k8sNodeCopy := k8sNode.DeepCopy()
+			k8sNodeCopy.Spec.Unschedulable = true
+			if err := r.Client.Patch(ctx, k8sNodeCopy, client.MergeFrom(k8sNode), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+				return fmt.Errorf("mark k8s node as unschedulable: %w", err)
 			}
+		}
+
+		evictionResult, err := r.Evictor.EvictPodsOnNode(ctx, podLists, action.K8sNodeName)
+		if err != nil {
+			return fmt.Errorf("evict pods: %w", err)
+		}
+		if !evictionResult.Done() {
+			logger.Info("Pod evictions blocked by disruption budgets, retrying in the next iteration",
+				"pods", evictionResult,
+				"k8s node", action.K8sNodeName,
+				"physical node", action.PhysicalNodeName,
+			)
+			action.Message = fmt.Sprintf("pod evictions blocked: %v", evictionResult)
+		}
 
+		reason = REASON_SLONKLET_AUTO_K8S_NODE_DRAIN
+		message = fmt.Sprintf(
+			"Auto drained K8s node %s for lifecycle taint %s. Physical node: %s.",
+			action.K8sNodeName,
+			action.taintString(),
+			action.PhysicalNodeName)
+	case ACTION_K8S_NODE_DELETE:
+		if err := r.Client.Delete(ctx, k8sNode.DeepCopy()); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete k8s node: %w", err)
 		}
+
+		reason = REASON_SLONKLET_AUTO_K8S_NODE_DELETION
+		message = fmt.Sprintf(
+			"Auto deleted K8s node %s for lifecycle taint %s. Physical node: %s.",
+			action.K8sNodeName,
+			action.taintString(),
+			action.PhysicalNodeName)
+	default:
+		return fmt.Errorf("unknown action %s", action.Type)
 	}
-	logger.Info("Finished auto-remediation for k8s nodes with lifecycle taints", "actionCount", actionCount)
 
-	return ctrl.Result{}, nil
+	r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, reason, message)
+
+	return nil
+}
+
+// getLifecycleTaint returns the last slonk or GCP maintenance taint on the k8s node, or nil.
+func getLifecycleTaint(k8sNode *corev1.Node) *corev1.Taint {
+	var lifecycleTaint *corev1.Taint
+	for _, taint := range k8sNode.Spec.Taints {
+		if strings.HasPrefix(taint.Key, SLURM_TAINT_PREFIX) ||
+			taint.Key == GCP_MAINTENANCE_STARTED ||
+			taint.Key == GCP_MAINTENANCE_IMPENDING_TERMINATION {
+			lifecycleTaint = taint.DeepCopy()
+		}
+	}
+	return lifecycleTaint
+}
+
+// hasTaint returns whether the k8s node has the taint, with the same key, value and effect.
+func hasTaint(k8sNode *corev1.Node, taint corev1.Taint) bool {
+	for _, nodeTaint := range k8sNode.Spec.Taints {
+		if nodeTaint.Key == taint.Key && nodeTaint.Value == taint.Value && nodeTaint.Effect == taint.Effect {
+			return true
+		}
+	}
+	return false
 }
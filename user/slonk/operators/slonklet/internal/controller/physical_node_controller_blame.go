@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/blame"
+)
+
+const (
+	// Set on physical nodes failing significantly more jobs than the rest of their group.
+	SUSPECT_LABEL = "slonk.your-org.com/suspect"
+
+	REASON_SLONKLET_SUSPECT         = "SlonkletSuspect"
+	REASON_SLONKLET_SUSPECT_CLEARED = "SlonkletSuspectCleared"
+)
+
+// LabelSuspectPhysicalNodes sets the suspect label on the suspect physical nodes of the
+// blame report and removes it from the others, or from all of them if labeling is not
+// enabled. It only labels, what to do with a suspect is left to operators.
+func (r *PhysicalNodeReconciler) LabelSuspectPhysicalNodes(
+	ctx context.Context,
+	physicalNodeMap map[string]*slonkv1.PhysicalNode,
+	report *blame.Report,
+	enabled bool,
+) {
+	logger := log.FromContext(ctx)
+
+	statsMap := map[string]*blame.NodeStats{}
+	for _, stats := range report.Nodes {
+		statsMap[stats.PhysicalNode] = stats
+	}
+
+	labelCount, clearCount := 0, 0
+	for name, physicalNode := range physicalNodeMap {
+		stats := statsMap[name]
+		suspect := enabled && stats != nil && stats.Suspect
+		if _, labeled := physicalNode.Labels[SUSPECT_LABEL]; labeled == suspect {
+			continue
+		}
+
+		original := physicalNode.DeepCopy()
+		if err := r.patchPhysicalNode(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+			if suspect {
+				if physicalNode.Labels == nil {
+					physicalNode.Labels = map[string]string{}
+				}
+				physicalNode.Labels[SUSPECT_LABEL] = "true"
+			} else {
+				delete(physicalNode.Labels, SUSPECT_LABEL)
+			}
+		}); err != nil {
+			logger.Info("Failed to update suspect label", "physical node", name, "suspect", suspect, "error", err)
+			physicalNodeMap[name] = original
+			continue
+		}
+
+		if suspect {
+			labelCount++
+			r.emitEvent(ctx, physicalNode, corev1.EventTypeWarning, REASON_SLONKLET_SUSPECT,
+				fmt.Sprintf("%d of %d job runs failed (%d NODE_FAIL) in the last %s, against %.1f%% for the rest of its group (p=%.2g). Failed jobs: %v.",
+					stats.Failed, stats.Runs, stats.NodeFail, report.Window, 100*stats.BaselineRate, stats.PValue, stats.FailedJobs))
+		} else {
+			clearCount++
+			message := fmt.Sprintf("Job failures no longer stand out in the last %s.", report.Window)
+			if !enabled {
+				message = "Suspect labeling is disabled."
+			}
+			r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_SUSPECT_CLEARED, message)
+		}
+	}
+
+	logger.Info("Finished labeling suspect physical nodes", "labeled", labelCount, "cleared", clearCount)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/blame"
+)
+
+func TestLabelSuspectPhysicalNodes(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	newPhysicalNode := func(name string, labels map[string]string) *slonkv1.PhysicalNode {
+		return &slonkv1.PhysicalNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE, Labels: labels},
+		}
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"bad":     newPhysicalNode("bad", nil),
+		"cleared": newPhysicalNode("cleared", map[string]string{SUSPECT_LABEL: "true", "pool": "h100"}),
+		"good":    newPhysicalNode("good", map[string]string{"pool": "h100"}),
+	}
+	objects := []runtime.Object{}
+	for _, physicalNode := range physicalNodeMap {
+		objects = append(objects, physicalNode.DeepCopy())
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(objects...).
+		Build()
+	for name := range physicalNodeMap {
+		// Physical nodes are listed with their resource version.
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: SLURM_NAMESPACE}, physicalNodeMap[name]))
+	}
+	recorder := events.NewFakeRecorder(10)
+	r := &PhysicalNodeReconciler{
+		Client:   fakeClient,
+		Recorder: recorder,
+		Scheme:   scheme.Scheme,
+	}
+
+	report := &blame.Report{
+		Window: "336h0m0s",
+		Nodes: []*blame.NodeStats{
+			{PhysicalNode: "bad", Runs: 6, Failed: 6, NodeFail: 1, BaselineRate: 0.05, PValue: 1e-8, Suspect: true, FailedJobs: []int{3, 2, 1}},
+			{PhysicalNode: "cleared", Runs: 10, Failed: 1, BaselineRate: 0.05, PValue: 0.4},
+			{PhysicalNode: "good", Runs: 10, BaselineRate: 0.05, PValue: 1},
+		},
+	}
+	r.LabelSuspectPhysicalNodes(context.Background(), physicalNodeMap, report, true)
+
+	getLabels := func(name string) map[string]string {
+		physicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: SLURM_NAMESPACE}, physicalNode))
+		return physicalNode.Labels
+	}
+	assert.Equal(t, map[string]string{SUSPECT_LABEL: "true"}, getLabels("bad"))
+	assert.Equal(t, map[string]string{"pool": "h100"}, getLabels("cleared"))
+	assert.Equal(t, map[string]string{"pool": "h100"}, getLabels("good"))
+	assert.Len(t, recorder.Events, 2)
+
+	// Nothing left to change.
+	r.LabelSuspectPhysicalNodes(context.Background(), physicalNodeMap, report, true)
+	assert.Len(t, recorder.Events, 2)
+
+	// Disabling labeling removes the labels it set.
+	r.LabelSuspectPhysicalNodes(context.Background(), physicalNodeMap, report, false)
+	assert.Empty(t, getLabels("bad"))
+	assert.Len(t, recorder.Events, 3)
+}
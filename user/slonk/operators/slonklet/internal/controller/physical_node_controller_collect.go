@@ -9,12 +9,19 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/history"
 	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/tools"
+	"your-org.com/slonklet/internal/topology"
 )
 
+// SyncSlurmAndK8sNodeSpecAndStatus creates and updates physical nodes from the slurm and k8s
+// nodes. The physical nodes it writes replace the ones in existingPhysicalNodeMap, so later
+// steps see them without listing again from a cache that may not have caught up yet.
 func (r *PhysicalNodeReconciler) SyncSlurmAndK8sNodeSpecAndStatus(
 	ctx context.Context,
 	slurmNodeMap map[string]*slurm.SlurmNode,
@@ -99,16 +106,26 @@ func (r *PhysicalNodeReconciler) SyncSlurmAndK8sNodeSpecAndStatus(
 	)
 
 	// Compare existing and fresh nodes, update, create or mark as inactive as needed.
+	// A physical node that fails is retried later with a backoff, without holding back the others.
+	now := time.Now()
+	summary := SyncSummary{}
 	updateCount := 0
 	for physicalHostName, freshPhysicalNodeStatus := range freshPhysicalNodeStatusMap {
+		if !r.syncRetries.Ready(physicalHostName, now) {
+			summary.Skipped++
+			continue
+		}
 		if existingPhysicalNode, ok := existingPhysicalNodeMap[physicalHostName]; ok {
 			// Update existing node if anything changed.
 			updatedNode, err := r.maybeUpdatePhysicalNode(ctx, physicalHostName, existingPhysicalNode, freshPhysicalNodeStatus)
 			if err != nil {
-				return ctrl.Result{}, fmt.Errorf("update physical node: %w", err)
+				r.recordPhysicalNodeSyncFailure(ctx, physicalHostName, existingPhysicalNode, fmt.Errorf("update physical node: %w", err), now)
+				summary.Failed++
+				continue
 			}
 			if updatedNode != nil {
 				// logger.Info("Updated physical node", "name", updatedNode.Name, "spec", updatedNode.Spec, "status", updatedNode.Status)
+				existingPhysicalNodeMap[physicalHostName] = updatedNode
 				updateCount++
 			}
 		} else {
@@ -116,31 +133,52 @@ func (r *PhysicalNodeReconciler) SyncSlurmAndK8sNodeSpecAndStatus(
 			// Note: Creation would ignore and overwrite status field, so we need to update status after creation.
 			updatedNode, err := r.maybeUpdatePhysicalNode(ctx, physicalHostName, nil, freshPhysicalNodeStatus)
 			if err != nil {
-				return ctrl.Result{}, fmt.Errorf("create physical node: %w", err)
+				r.recordPhysicalNodeSyncFailure(ctx, physicalHostName, nil, fmt.Errorf("create physical node: %w", err), now)
+				summary.Failed++
+				continue
 			}
 			if updatedNode != nil {
 				logger.Info("Created new physical node", "name", updatedNode.Name, "spec", updatedNode.Spec, "status", updatedNode.Status)
+				existingPhysicalNodeMap[physicalHostName] = updatedNode
 			} else {
 				logger.Info("skipped creating new physical node due to incomplate data", "name", physicalHostName)
+				summary.Skipped++
+				continue
 			}
 		}
+		r.recordPhysicalNodeSyncSuccess(ctx, physicalHostName, existingPhysicalNodeMap[physicalHostName])
+		summary.Succeeded++
 	}
 
 	for physicalHostName, existingPhysicalNode := range existingPhysicalNodeMap {
 		// Check if the physical node is removed from slurm and k8s.
 		if _, ok := freshPhysicalNodeStatusMap[physicalHostName]; !ok {
+			if !r.syncRetries.Ready(physicalHostName, now) {
+				summary.Skipped++
+				continue
+			}
 			updatedNode, err := r.maybeUpdatePhysicalNode(ctx, physicalHostName, existingPhysicalNode, nil)
 			if err != nil {
-				return ctrl.Result{}, fmt.Errorf("update physical node: %w", err)
+				r.recordPhysicalNodeSyncFailure(ctx, physicalHostName, existingPhysicalNode, fmt.Errorf("update physical node: %w", err), now)
+				summary.Failed++
+				continue
 			}
 			if updatedNode != nil {
 				logger.Info("Marked physical node as removed", "name", updatedNode.Name)
+				existingPhysicalNodeMap[physicalHostName] = updatedNode
 				updateCount++
 			}
+			r.recordPhysicalNodeSyncSuccess(ctx, physicalHostName, existingPhysicalNodeMap[physicalHostName])
+			summary.Succeeded++
 		}
 	}
 
-	logger.Info("Finished syncing slurm and k8s nodes spec and status", "updateCount", updateCount)
+	logger.Info("Finished syncing slurm and k8s nodes spec and status",
+		"updateCount", updateCount,
+		"succeeded", summary.Succeeded,
+		"failed", summary.Failed,
+		"skipped", summary.Skipped,
+	)
 
 	return ctrl.Result{}, nil
 }
@@ -221,6 +259,8 @@ func (r *PhysicalNodeReconciler) constructPhysicalNodeStatus(
 		SlurmNodeStatusHistory: []slonkv1.SlurmNodeStatus{},
 		K8sNodeStatus:          k8sNodeStatus,
 		K8sNodeStatusHistory:   []slonkv1.K8sNodeStatus{},
+		Topology:               r.Topology.Extract(k8sNode, slurmNodeStatus.Name),
+		Inventory:              r.k8sNodeInventory(k8sNode),
 	}
 
 	return &freshPhysicalNodeStatus
@@ -254,17 +294,24 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNode(
 				},
 				Spec: *updatedSpec,
 			}
-			if err := r.Client.Create(ctx, updatedPhysicalNode); err != nil {
+			if err := r.Client.Create(ctx, updatedPhysicalNode, client.FieldOwner(tools.FIELD_OWNER)); err != nil {
 				return nil, fmt.Errorf("create physical node: %w", err)
 			}
 		} else {
 			logger.Info("Updating physical node spec", "name", physicalNodeName, "spec", updatedSpec)
 			updatedPhysicalNode = existingPhysicalNode.DeepCopy()
-			updatedPhysicalNode.Spec = *updatedSpec
-			if err := r.Client.Update(ctx, updatedPhysicalNode); err != nil {
+			if err := r.patchPhysicalNode(ctx, updatedPhysicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+				physicalNode.Spec = *updatedSpec
+			}); err != nil {
 				return nil, fmt.Errorf("update physical node spec: %w", err)
 			}
 		}
+		if existingSpec == nil || !existingSpec.SlurmNodeSpec.IsEqual(updatedSpec.SlurmNodeSpec) {
+			r.recordHistory(ctx, physicalNodeName, history.KIND_SLURM_GOAL_STATE, updatedSpec.SlurmNodeSpec)
+		}
+		if existingSpec == nil || !existingSpec.K8sNodeSpec.IsEqual(updatedSpec.K8sNodeSpec) {
+			r.recordHistory(ctx, physicalNodeName, history.KIND_K8S_GOAL_STATE, updatedSpec.K8sNodeSpec)
+		}
 	}
 
 	updatedStatus, removedSlurmNode, removedK8sNode := r.maybeUpdatePhysicalNodeStatus(
@@ -274,23 +321,26 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNode(
 			updatedPhysicalNode = existingPhysicalNode.DeepCopy()
 		}
 
-		updatedPhysicalNode.Status = *updatedStatus
-		if err := r.Client.Status().Update(ctx, updatedPhysicalNode); err != nil {
+		if err := r.patchPhysicalNodeStatus(ctx, updatedPhysicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+			physicalNode.Status = *updatedStatus
+		}); err != nil {
 			return nil, fmt.Errorf("update physical node slurm node status: %w", err)
 		}
+		if existingStatus == nil || !existingStatus.SlurmNodeStatus.IsEqual(updatedStatus.SlurmNodeStatus) {
+			r.recordHistory(ctx, physicalNodeName, history.KIND_SLURM_STATUS, updatedStatus.SlurmNodeStatus)
+		}
+		if existingStatus == nil || !existingStatus.K8sNodeStatus.IsEqual(updatedStatus.K8sNodeStatus) {
+			r.recordHistory(ctx, physicalNodeName, history.KIND_K8S_STATUS, updatedStatus.K8sNodeStatus)
+		}
+		var existingInventory *slonkv1.HardwareInventory
+		if existingStatus != nil {
+			existingInventory = existingStatus.Inventory
+		}
+		r.recordInventoryChange(ctx, physicalNodeName, existingInventory, updatedStatus.Inventory)
 		if removedSlurmNode != "" {
-			matchingEventRecord := false
-			for _, eventRecord := range updatedPhysicalNode.EventRecords {
-				if eventRecord.Event.Reason == REASON_SLONKLET_AUTO_SLURM_NODE_DELETION &&
-					strings.Contains(eventRecord.Event.Message, removedSlurmNode) &&
-					eventRecord.AckTimestamp.Add(1*time.Hour).After(time.Now()) {
-					matchingEventRecord = true
-				}
-			}
-
-			if matchingEventRecord {
+			if r.hasRecentEvent(physicalNodeName, []string{REASON_SLONKLET_AUTO_SLURM_NODE_DELETION}, removedSlurmNode, RECENT_EVENT_WINDOW) {
 				logger.Info(
-					"Event record already exists for slurm node removal, skipping event emission",
+					"Event already emitted for slurm node removal, skipping event emission",
 					"slurm node", removedSlurmNode,
 					"physical node", physicalNodeName,
 				)
@@ -299,40 +349,19 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNode(
 				logger.Info("Emitting event for passive slurm node removal", "slurm node", removedSlurmNode, "physical node", physicalNodeName)
 
 				message := fmt.Sprintf("Passive removal of slurm node %s. Physical node: %s.", removedSlurmNode, physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					updatedPhysicalNode,
-					REASON_SLONKLET_AUTO_SLURM_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit slurm node removal event", "error", err)
-				}
+				r.emitEvent(ctx, updatedPhysicalNode, corev1.EventTypeNormal, REASON_SLONKLET_AUTO_SLURM_NODE_DELETION, message)
 			} else {
 				logger.Info("Emitting event for unexpected slurm node removal", "slurm node", removedSlurmNode, "physical node", physicalNodeName)
 
 				message := fmt.Sprintf("Unexpected removal of slurm node %s. Physical node: %s.", removedSlurmNode, physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					updatedPhysicalNode,
-					REASON_SLONKLET_UNEXPECTED_SLURM_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit slurm node removal event", "error", err)
-				}
+				r.emitEvent(ctx, updatedPhysicalNode, corev1.EventTypeWarning, REASON_SLONKLET_UNEXPECTED_SLURM_NODE_DELETION, message)
 			}
 		}
 		if removedK8sNode != "" {
-			matchingEventRecord := false
-			for _, eventRecord := range updatedPhysicalNode.EventRecords {
-				if (eventRecord.Event.Reason == REASON_SLONKLET_AUTO_K8S_NODE_DELETION ||
-					eventRecord.Event.Reason == REASON_SLONKLET_AUTO_K8S_NODE_DRAIN) &&
-					strings.Contains(eventRecord.Event.Message, removedK8sNode) &&
-					eventRecord.AckTimestamp.Add(1*time.Hour).After(time.Now()) {
-					matchingEventRecord = true
-				}
-			}
-
-			if matchingEventRecord {
+			reasons := []string{REASON_SLONKLET_AUTO_K8S_NODE_DELETION, REASON_SLONKLET_AUTO_K8S_NODE_DRAIN}
+			if r.hasRecentEvent(physicalNodeName, reasons, removedK8sNode, RECENT_EVENT_WINDOW) {
 				logger.Info(
-					"Event record already exists for k8s node removal, skipping event emission",
+					"Event already emitted for k8s node removal, skipping event emission",
 					"k8s node", removedK8sNode,
 					"physical node", physicalNodeName,
 				)
@@ -342,24 +371,12 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNode(
 				logger.Info("Emitting event for passive k8s node removal", "k8s node", removedK8sNode, "physical node", physicalNodeName)
 
 				message := fmt.Sprintf("Passive removal of K8s node %s. Physical node: %s.", removedK8sNode, physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					updatedPhysicalNode,
-					REASON_SLONKLET_AUTO_K8S_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit k8s node removal event", "error", err)
-				}
+				r.emitEvent(ctx, updatedPhysicalNode, corev1.EventTypeNormal, REASON_SLONKLET_AUTO_K8S_NODE_DELETION, message)
 			} else {
 				logger.Info("Emitting event for unexpected k8s node removal", "k8s node", removedK8sNode, "physical node", physicalNodeName)
 
 				message := fmt.Sprintf("Unexpected removal of K8s node %s. Physical node: %s.", removedK8sNode, physicalNodeName)
-				if err := r.emitAndRecordEvent(
-					updatedPhysicalNode,
-					REASON_SLONKLET_UNEXPECTED_K8S_NODE_DELETION,
-					message,
-				); err != nil {
-					logger.Info("Failed to emit k8s node removal event", "error", err)
-				}
+				r.emitEvent(ctx, updatedPhysicalNode, corev1.EventTypeWarning, REASON_SLONKLET_UNEXPECTED_K8S_NODE_DELETION, message)
 			}
 		}
 	}
@@ -370,6 +387,46 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNode(
 	return nil, nil
 }
 
+// Slurm drain reasons set by slurm itself, reboots, health checks or slonklet, rather than by
+// someone draining the slurm node by hand.
+var (
+	automaticSlurmDrainReasons = []string{
+		"reboot",
+		"reboot ASAP",
+		"Reboot ASAP",
+		"reboot requested",
+		"Not responding",
+		"Kill task failed",
+		"failed_health_check",
+		SLURM_REASON_MAINTENANCE,
+	}
+	automaticSlurmDrainReasonPrefixes = []string{
+		"Init error",
+		"Epilog error",
+		"Prolog error",
+		SLONKLET_DRAIN_REASON_PREFIX,
+	}
+)
+
+// IsAutomaticSlurmDrainReason returns whether a slurm node drained with the reason was not
+// drained by hand, in which case the slurm goal state doesn't follow the drain.
+func IsAutomaticSlurmDrainReason(reason string) bool {
+	if reason == "" {
+		return true
+	}
+	for _, automaticReason := range automaticSlurmDrainReasons {
+		if reason == automaticReason {
+			return true
+		}
+	}
+	for _, prefix := range automaticSlurmDrainReasonPrefixes {
+		if strings.HasPrefix(reason, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNodeSpec(
 	existingPhysicalNodeSpec *slonkv1.PhysicalNodeSpec,
 	freshPhysicalNodeStatus *slonkv1.PhysicalNodeStatus,
@@ -384,6 +441,7 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNodeSpec(
 	//  - Slurm node is in DRAIN state
 	//  - Not caused by manually execute scontrol reboot or prolog/epilog failures
 	//  - Not caused by following goal state enforced by slonklet
+	//  - Not caused by draining for GCP maintenance
 
 	// By default, slurm node is not found and we have no info from physical node, set goal state to true.
 	slurmNodeSpec := slonkv1.SlurmNodeSpec{
@@ -407,17 +465,7 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNodeSpec(
 
 	manualDrain := false
 	if freshPhysicalNodeStatus != nil && freshPhysicalNodeStatus.SlurmNodeStatus.Name != "" {
-		if freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "reboot" &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "reboot ASAP" &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "Reboot ASAP" &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "reboot requested" &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "Not responding" &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "Kill task failed" &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "failed_health_check" &&
-			!strings.HasPrefix(freshPhysicalNodeStatus.SlurmNodeStatus.Reason, "Init error") &&
-			!strings.HasPrefix(freshPhysicalNodeStatus.SlurmNodeStatus.Reason, "Epilog error") &&
-			!strings.HasPrefix(freshPhysicalNodeStatus.SlurmNodeStatus.Reason, "Prolog error") &&
-			freshPhysicalNodeStatus.SlurmNodeStatus.Reason != "" {
+		if !IsAutomaticSlurmDrainReason(freshPhysicalNodeStatus.SlurmNodeStatus.Reason) {
 			for _, state := range freshPhysicalNodeStatus.SlurmNodeStatus.State {
 				if state == "DRAIN" {
 					manualDrain = true
@@ -446,11 +494,20 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNodeSpec(
 	if existingPhysicalNodeSpec == nil ||
 		!existingPhysicalNodeSpec.SlurmNodeSpec.IsEqual(slurmNodeSpec) ||
 		!existingPhysicalNodeSpec.K8sNodeSpec.IsEqual(k8sNodeSpec) {
-		return &slonkv1.PhysicalNodeSpec{
+		updatedSpec := &slonkv1.PhysicalNodeSpec{
 			SlurmNodeSpec: slurmNodeSpec,
 			K8sNodeSpec:   k8sNodeSpec,
 			Manual:        manualDrain,
 		}
+		if manualDrain {
+			// Someone drained the slurm node by hand, record it so the override can be
+			// found and given an owner later.
+			updatedSpec.ManualOverride = &slonkv1.ManualOverride{
+				Notes:          fmt.Sprintf("Slurm node drained outside of slonklet: %s", freshPhysicalNodeStatus.SlurmNodeStatus.Reason),
+				StartTimestamp: v1.Now(),
+			}
+		}
+		return updatedSpec
 	}
 
 	return nil
@@ -536,8 +593,73 @@ func (r *PhysicalNodeReconciler) maybeUpdatePhysicalNodeStatus(
 		}
 	}
 
+	// Keep the last known inventory while the agent doesn't report, and only follow changes
+	// of the hardware rather than every report.
+	if freshPhysicalNodeStatus != nil && freshPhysicalNodeStatus.Inventory != nil &&
+		!resultPhysicalNodeStatus.Inventory.IsEqual(freshPhysicalNodeStatus.Inventory) {
+		resultPhysicalNodeStatus.Inventory = freshPhysicalNodeStatus.Inventory.DeepCopy()
+		updateStatus = true
+	}
+
+	// Keep the last known topology while the nodes are gone, levels only read from a missing
+	// node are kept too.
+	if freshPhysicalNodeStatus != nil && freshPhysicalNodeStatus.Topology != nil {
+		merged := topology.Merge(resultPhysicalNodeStatus.Topology, freshPhysicalNodeStatus.Topology)
+		if resultPhysicalNodeStatus.Topology == nil || *resultPhysicalNodeStatus.Topology != *merged {
+			resultPhysicalNodeStatus.Topology = merged
+			updateStatus = true
+		}
+	}
+
 	if updateStatus {
 		return resultPhysicalNodeStatus, removedSlurmNode, removedK8sNode
 	}
 	return nil, removedSlurmNode, removedK8sNode
 }
+
+// recordPhysicalNodeSyncFailure holds the physical node back until its retry, and counts the
+// failure in its status when it exists.
+func (r *PhysicalNodeReconciler) recordPhysicalNodeSyncFailure(
+	ctx context.Context,
+	physicalNodeName string,
+	physicalNode *slonkv1.PhysicalNode,
+	syncErr error,
+	now time.Time,
+) {
+	logger := log.FromContext(ctx)
+
+	retryAt := r.syncRetries.Failed(physicalNodeName, now)
+	logger.Info("Failed to sync physical node",
+		"physical node", physicalNodeName,
+		"failures", r.syncRetries.Failures(physicalNodeName),
+		"retry at", retryAt,
+		"error", syncErr,
+	)
+	if physicalNode == nil {
+		return
+	}
+	// Only the status is patched, so the failure is recorded even if the spec is rejected.
+	if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Status.SyncFailure = nextSyncFailure(physicalNode.Status.SyncFailure, syncErr, v1.NewTime(now))
+	}); err != nil {
+		logger.Info("Failed to record sync failure", "physical node", physicalNodeName, "error", err)
+	}
+}
+
+// recordPhysicalNodeSyncSuccess resets the backoff of the physical node, and clears the
+// failures in its status.
+func (r *PhysicalNodeReconciler) recordPhysicalNodeSyncSuccess(
+	ctx context.Context,
+	physicalNodeName string,
+	physicalNode *slonkv1.PhysicalNode,
+) {
+	r.syncRetries.Succeeded(physicalNodeName)
+	if physicalNode == nil || physicalNode.Status.SyncFailure == nil {
+		return
+	}
+	if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Status.SyncFailure = nil
+	}); err != nil {
+		log.FromContext(ctx).Info("Failed to clear sync failure", "physical node", physicalNodeName, "error", err)
+	}
+}
@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+const (
+	// The slurm node of the host is registered with slurmctld.
+	CONDITION_SLURM_REGISTERED = "SlurmRegistered"
+	// The k8s node of the host exists and is Ready.
+	CONDITION_K8S_NODE_READY = "K8sNodeReady"
+	// The slurm and k8s nodes match the goal states in the spec.
+	CONDITION_GOAL_STATE_REACHED = "GoalStateReached"
+	// A disruptive remediation, drain or reboot of the host is in progress.
+	CONDITION_REMEDIATING = "Remediating"
+	// More than one k8s node claims the identity of the host.
+	CONDITION_IDENTITY_CONFLICT = "IdentityConflict"
+
+	CONDITION_REASON_REGISTERED            = "Registered"
+	CONDITION_REASON_SLURMD_NOT_REGISTERED = "SlurmdNotRegistered"
+	CONDITION_REASON_SLURM_NODE_MISSING    = "SlurmNodeMissing"
+	CONDITION_REASON_K8S_NODE_MISSING      = "K8sNodeMissing"
+	CONDITION_REASON_K8S_NODE_READY        = "KubeletReady"
+	CONDITION_REASON_K8S_NODE_NOT_READY    = "KubeletNotReady"
+	CONDITION_REASON_GOAL_STATE_REACHED    = "GoalStateReached"
+	CONDITION_REASON_SLURM_GOAL_NOT_MET    = "SlurmGoalStateNotReached"
+	CONDITION_REASON_K8S_GOAL_NOT_MET      = "K8sGoalStateNotReached"
+	CONDITION_REASON_NO_REMEDIATION        = "NoRemediation"
+	CONDITION_REASON_DRAINING              = "Draining"
+	CONDITION_REASON_REBOOTING             = "Rebooting"
+	CONDITION_REASON_UNIQUE_IDENTITY       = "UniqueIdentity"
+	CONDITION_REASON_MULTIPLE_K8S_NODES    = "MultipleK8sNodes"
+)
+
+// UpdateConditions recomputes the conditions of every physical node from the latest slurm,
+// k8s and remediation state, and patches the status of those that changed. A failed patch
+// doesn't stop the others, the failures are returned together.
+func (r *PhysicalNodeReconciler) UpdateConditions(
+	ctx context.Context,
+	k8sNodeMap map[string]*corev1.Node,
+	existingPhysicalNodeMap map[string]*slonkv1.PhysicalNode,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Started updating physical node conditions")
+
+	actionMap := map[string]RemediationAction{}
+	if plan := r.RemediationPlan(); plan != nil {
+		for _, action := range plan.Actions {
+			actionMap[action.PhysicalNodeName] = action
+		}
+	}
+
+	updateCount := 0
+	patchErrs := []error{}
+	for _, physicalNode := range existingPhysicalNodeMap {
+		// K8s nodes claiming the physical node.
+		claimingK8sNodeList := corev1.NodeList{}
+		if err := r.Client.List(ctx, &claimingK8sNodeList, client.MatchingFields{K8S_NODE_GPU_UUID_HASH_INDEX: physicalNode.Name}); err != nil {
+			return ctrl.Result{}, fmt.Errorf("list k8s nodes claiming physical node %s: %w", physicalNode.Name, err)
+		}
+		claimingK8sNodeNames := []string{}
+		for _, k8sNode := range claimingK8sNodeList.Items {
+			claimingK8sNodeNames = append(claimingK8sNodeNames, k8sNode.Name)
+		}
+
+		conditions := physicalNodeConditions(physicalNode, k8sNodeMap, claimingK8sNodeNames, actionMap)
+		updatedConditions := physicalNode.Status.DeepCopy().Conditions
+		for _, condition := range conditions {
+			meta.SetStatusCondition(&updatedConditions, condition)
+		}
+		if equality.Semantic.DeepEqual(physicalNode.Status.Conditions, updatedConditions) {
+			continue
+		}
+
+		// Patch instead of update, the conditions are recomputed from scratch every
+		// iteration and shouldn't conflict with other status writes.
+		if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+			for _, condition := range conditions {
+				meta.SetStatusCondition(&physicalNode.Status.Conditions, condition)
+			}
+		}); err != nil {
+			patchErrs = append(patchErrs, fmt.Errorf("patch conditions of physical node %s: %w", physicalNode.Name, err))
+			continue
+		}
+		updateCount++
+	}
+
+	logger.Info("Finished updating physical node conditions", "updateCount", updateCount, "failedCount", len(patchErrs))
+
+	return ctrl.Result{}, errors.Join(patchErrs...)
+}
+
+func physicalNodeConditions(
+	physicalNode *slonkv1.PhysicalNode,
+	k8sNodeMap map[string]*corev1.Node,
+	claimingK8sNodes []string,
+	actionMap map[string]RemediationAction,
+) []metav1.Condition {
+	status := physicalNode.Status
+	newCondition := func(conditionType string, conditionStatus metav1.ConditionStatus, reason string, message string) metav1.Condition {
+		return metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			ObservedGeneration: physicalNode.Generation,
+			Reason:             reason,
+			Message:            message,
+		}
+	}
+	conditions := []metav1.Condition{}
+
+	slurmRegistered := status.SlurmNodeStatus.Name != "" && !status.SlurmNodeStatus.Removed
+	if slurmRegistered {
+		conditions = append(conditions, newCondition(CONDITION_SLURM_REGISTERED, metav1.ConditionTrue, CONDITION_REASON_REGISTERED,
+			fmt.Sprintf("Slurm node %s is registered with slurmctld.", status.SlurmNodeStatus.Name)))
+	} else if status.UnregisteredSlurmPod != nil {
+		conditions = append(conditions, newCondition(CONDITION_SLURM_REGISTERED, metav1.ConditionFalse, CONDITION_REASON_SLURMD_NOT_REGISTERED,
+			fmt.Sprintf("Slurm pod %s is running since %s without a slurm node.",
+				status.UnregisteredSlurmPod.PodName, status.UnregisteredSlurmPod.SinceTimestamp.UTC().Format("2006-01-02T15:04:05Z"))))
+	} else {
+		conditions = append(conditions, newCondition(CONDITION_SLURM_REGISTERED, metav1.ConditionFalse, CONDITION_REASON_SLURM_NODE_MISSING,
+			"No slurm node is registered for the host."))
+	}
+
+	k8sNode := k8sNodeMap[status.K8sNodeStatus.Name]
+	if status.K8sNodeStatus.Removed || k8sNode == nil {
+		conditions = append(conditions, newCondition(CONDITION_K8S_NODE_READY, metav1.ConditionFalse, CONDITION_REASON_K8S_NODE_MISSING,
+			"No k8s node exists for the host."))
+	} else {
+		condition := newCondition(CONDITION_K8S_NODE_READY, metav1.ConditionUnknown, CONDITION_REASON_K8S_NODE_NOT_READY,
+			fmt.Sprintf("K8s node %s reports no Ready condition.", k8sNode.Name))
+		for _, nodeCondition := range k8sNode.Status.Conditions {
+			if nodeCondition.Type != corev1.NodeReady {
+				continue
+			}
+			condition.Status = metav1.ConditionStatus(nodeCondition.Status)
+			condition.Reason = nodeCondition.Reason
+			if condition.Reason == "" {
+				condition.Reason = CONDITION_REASON_K8S_NODE_NOT_READY
+				if nodeCondition.Status == corev1.ConditionTrue {
+					condition.Reason = CONDITION_REASON_K8S_NODE_READY
+				}
+			}
+			condition.Message = fmt.Sprintf("K8s node %s: %s", k8sNode.Name, nodeCondition.Message)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if reached, message := isSlurmGoalStateReached(physicalNode); !reached {
+		conditions = append(conditions, newCondition(CONDITION_GOAL_STATE_REACHED, metav1.ConditionFalse, CONDITION_REASON_SLURM_GOAL_NOT_MET, message))
+	} else if reached, message := isK8sGoalStateReached(physicalNode); !reached {
+		conditions = append(conditions, newCondition(CONDITION_GOAL_STATE_REACHED, metav1.ConditionFalse, CONDITION_REASON_K8S_GOAL_NOT_MET, message))
+	} else {
+		conditions = append(conditions, newCondition(CONDITION_GOAL_STATE_REACHED, metav1.ConditionTrue, CONDITION_REASON_GOAL_STATE_REACHED,
+			fmt.Sprintf("Slurm goal state %q and k8s goal state %q are reached.",
+				physicalNode.Spec.SlurmNodeSpec.GoalState, physicalNode.Spec.K8sNodeSpec.GoalState)))
+	}
+
+	if action, ok := actionMap[physicalNode.Name]; ok && action.IsDisruptive() &&
+		action.Outcome != OUTCOME_EXECUTED && action.Outcome != OUTCOME_SKIPPED && action.Outcome != OUTCOME_DRYRUN {
+		conditions = append(conditions, newCondition(CONDITION_REMEDIATING, metav1.ConditionTrue, action.Type,
+			fmt.Sprintf("%s of k8s node %s for taint %s is %s. %s", action.Type, action.K8sNodeName, action.taintString(), action.Outcome, action.Rationale)))
+	} else if status.Reboot != nil && (status.Reboot.Phase == REBOOT_PHASE_REQUESTED || status.Reboot.Phase == REBOOT_PHASE_REBOOTED) {
+		conditions = append(conditions, newCondition(CONDITION_REMEDIATING, metav1.ConditionTrue, CONDITION_REASON_REBOOTING,
+			fmt.Sprintf("Reboot of slurm node %s is %s: %s", status.Reboot.SlurmNodeName, status.Reboot.Phase, status.Reboot.Message)))
+	} else if status.SlurmDrain != nil && status.SlurmDrain.Phase == DRAIN_PHASE_DRAINING {
+		conditions = append(conditions, newCondition(CONDITION_REMEDIATING, metav1.ConditionTrue, CONDITION_REASON_DRAINING,
+			fmt.Sprintf("Slurm node %s is draining, waiting for jobs %v.", status.SlurmDrain.SlurmNodeName, status.SlurmDrain.RunningJobs)))
+	} else {
+		conditions = append(conditions, newCondition(CONDITION_REMEDIATING, metav1.ConditionFalse, CONDITION_REASON_NO_REMEDIATION,
+			"No remediation is in progress."))
+	}
+
+	if len(claimingK8sNodes) > 1 {
+		sort.Strings(claimingK8sNodes)
+		conditions = append(conditions, newCondition(CONDITION_IDENTITY_CONFLICT, metav1.ConditionTrue, CONDITION_REASON_MULTIPLE_K8S_NODES,
+			fmt.Sprintf("K8s nodes %s all claim the identity of the host.", strings.Join(claimingK8sNodes, ", "))))
+	} else {
+		conditions = append(conditions, newCondition(CONDITION_IDENTITY_CONFLICT, metav1.ConditionFalse, CONDITION_REASON_UNIQUE_IDENTITY,
+			"At most one k8s node claims the identity of the host."))
+	}
+
+	return conditions
+}
+
+// IsPhysicalNodeHealthy returns whether the host is registered with slurm and k8s, not being
+// remediated and meant to run jobs.
+func IsPhysicalNodeHealthy(physicalNode *slonkv1.PhysicalNode) bool {
+	conditions := physicalNode.Status.Conditions
+	return meta.IsStatusConditionTrue(conditions, CONDITION_SLURM_REGISTERED) &&
+		meta.IsStatusConditionTrue(conditions, CONDITION_K8S_NODE_READY) &&
+		!meta.IsStatusConditionTrue(conditions, CONDITION_REMEDIATING) &&
+		physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateUp
+}
+
+// isSlurmGoalStateReached returns whether the slurm node matches the slurm goal state, and
+// why not.
+func isSlurmGoalStateReached(physicalNode *slonkv1.PhysicalNode) (bool, string) {
+	goalState := physicalNode.Spec.SlurmNodeSpec.GoalState
+	slurmNodeStatus := physicalNode.Status.SlurmNodeStatus
+	present := slurmNodeStatus.Name != "" && !slurmNodeStatus.Removed
+	drained, down := false, false
+	for _, state := range slurmNodeStatus.State {
+		if state == "DRAIN" {
+			drained = true
+		} else if state == "DOWN" {
+			down = true
+		}
+	}
+
+	switch goalState {
+	case GoalStateUp:
+		if !present || drained || down {
+			return false, fmt.Sprintf("Slurm goal state is up, slurm node %q is %s.", slurmNodeStatus.Name, describeSlurmNodeState(slurmNodeStatus))
+		}
+	case GoalStateDrain:
+		if present && !drained && !down {
+			return false, fmt.Sprintf("Slurm goal state is drain, slurm node %q is %s.", slurmNodeStatus.Name, describeSlurmNodeState(slurmNodeStatus))
+		}
+	case GoalStateDown:
+		if present && !down {
+			return false, fmt.Sprintf("Slurm goal state is down, slurm node %q is %s.", slurmNodeStatus.Name, describeSlurmNodeState(slurmNodeStatus))
+		}
+	}
+	return true, ""
+}
+
+// isK8sGoalStateReached returns whether the k8s node matches the k8s goal state, and why
+// not.
+func isK8sGoalStateReached(physicalNode *slonkv1.PhysicalNode) (bool, string) {
+	goalState := physicalNode.Spec.K8sNodeSpec.GoalState
+	k8sNodeStatus := physicalNode.Status.K8sNodeStatus
+	present := k8sNodeStatus.Name != "" && !k8sNodeStatus.Removed
+
+	switch goalState {
+	case GoalStateUp:
+		if !present {
+			return false, "K8s goal state is up, no k8s node exists."
+		}
+	case GoalStateDown:
+		if present {
+			return false, fmt.Sprintf("K8s goal state is down, k8s node %s still exists.", k8sNodeStatus.Name)
+		}
+	}
+	return true, ""
+}
+
+func describeSlurmNodeState(slurmNodeStatus slonkv1.SlurmNodeStatus) string {
+	if slurmNodeStatus.Name == "" || slurmNodeStatus.Removed {
+		return "missing"
+	}
+	return strings.Join(slurmNodeStatus.State, ",")
+}
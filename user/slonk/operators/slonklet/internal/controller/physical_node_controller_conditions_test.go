@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestUpdateConditions(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	k8sNode := testNodes[0].(*corev1.Node).DeepCopy()
+	// A second k8s node claiming the same gpus.
+	conflictingK8sNode := testNodes[1].(*corev1.Node).DeepCopy()
+	conflictingK8sNode.Annotations[GPU_UUID_HASH_ANNOTATION] = "cba"
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "cba", Namespace: SLURM_NAMESPACE, Generation: 3},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: GoalStateDrain},
+			K8sNodeSpec:   slonkv1.K8sNodeSpec{GoalState: GoalStateUp},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-node-1", State: []string{"IDLE"}},
+			K8sNodeStatus:   slonkv1.K8sNodeStatus{Name: k8sNode.Name},
+			SlurmDrain:      &slonkv1.SlurmDrainStatus{SlurmNodeName: "slurm-node-1", Phase: DRAIN_PHASE_DRAINING},
+		},
+	}
+
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, conflictingK8sNode, physicalNode).
+		WithStatusSubresource(physicalNode).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client: fakeClient,
+		Scheme: scheme.Scheme,
+	}
+	k8sNodeMap := map[string]*corev1.Node{k8sNode.Name: k8sNode, conflictingK8sNode.Name: conflictingK8sNode}
+	getPhysicalNode := func() *slonkv1.PhysicalNode {
+		updatedPhysicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+		return updatedPhysicalNode
+	}
+	update := func() []metav1.Condition {
+		_, err := r.UpdateConditions(context.Background(), k8sNodeMap, map[string]*slonkv1.PhysicalNode{"cba": getPhysicalNode()})
+		assert.NoError(t, err)
+		return getPhysicalNode().Status.Conditions
+	}
+
+	// The node is registered and ready, but still draining.
+	conditions := update()
+	assert.Equal(t, 5, len(conditions))
+	assert.True(t, meta.IsStatusConditionTrue(conditions, CONDITION_SLURM_REGISTERED))
+	assert.True(t, meta.IsStatusConditionTrue(conditions, CONDITION_K8S_NODE_READY))
+	goalStateReached := meta.FindStatusCondition(conditions, CONDITION_GOAL_STATE_REACHED)
+	assert.Equal(t, metav1.ConditionFalse, goalStateReached.Status)
+	assert.Equal(t, CONDITION_REASON_SLURM_GOAL_NOT_MET, goalStateReached.Reason)
+	assert.Equal(t, int64(3), goalStateReached.ObservedGeneration)
+	remediating := meta.FindStatusCondition(conditions, CONDITION_REMEDIATING)
+	assert.Equal(t, metav1.ConditionTrue, remediating.Status)
+	assert.Equal(t, CONDITION_REASON_DRAINING, remediating.Reason)
+	identityConflict := meta.FindStatusCondition(conditions, CONDITION_IDENTITY_CONFLICT)
+	assert.Equal(t, metav1.ConditionTrue, identityConflict.Status)
+	assert.Contains(t, identityConflict.Message, "k8s-node-1, k8s-node-2")
+
+	// The drain finishes, the conflicting k8s node goes away, and the k8s node turns not ready.
+	updatedPhysicalNode := getPhysicalNode()
+	updatedPhysicalNode.Status.SlurmNodeStatus.State = []string{"IDLE", "DRAIN"}
+	updatedPhysicalNode.Status.SlurmDrain.Phase = DRAIN_PHASE_DRAINED
+	assert.NoError(t, fakeClient.Status().Update(context.Background(), updatedPhysicalNode))
+	delete(k8sNodeMap, conflictingK8sNode.Name)
+	assert.NoError(t, fakeClient.Delete(context.Background(), conflictingK8sNode))
+	k8sNode.Status.Conditions[0].Status = corev1.ConditionFalse
+	conditions = update()
+	assert.True(t, meta.IsStatusConditionTrue(conditions, CONDITION_GOAL_STATE_REACHED))
+	assert.True(t, meta.IsStatusConditionFalse(conditions, CONDITION_REMEDIATING))
+	assert.True(t, meta.IsStatusConditionFalse(conditions, CONDITION_IDENTITY_CONFLICT))
+	k8sNodeReady := meta.FindStatusCondition(conditions, CONDITION_K8S_NODE_READY)
+	assert.Equal(t, metav1.ConditionFalse, k8sNodeReady.Status)
+	assert.Equal(t, CONDITION_REASON_K8S_NODE_NOT_READY, k8sNodeReady.Reason)
+	lastTransitionTime := meta.FindStatusCondition(conditions, CONDITION_IDENTITY_CONFLICT).LastTransitionTime
+
+	// The slurm node disappears, the unchanged conditions keep their transition time.
+	updatedPhysicalNode = getPhysicalNode()
+	updatedPhysicalNode.Status.SlurmNodeStatus.Removed = true
+	assert.NoError(t, fakeClient.Status().Update(context.Background(), updatedPhysicalNode))
+	conditions = update()
+	slurmRegistered := meta.FindStatusCondition(conditions, CONDITION_SLURM_REGISTERED)
+	assert.Equal(t, metav1.ConditionFalse, slurmRegistered.Status)
+	assert.Equal(t, CONDITION_REASON_SLURM_NODE_MISSING, slurmRegistered.Reason)
+	assert.True(t, meta.IsStatusConditionTrue(conditions, CONDITION_GOAL_STATE_REACHED))
+	assert.True(t, lastTransitionTime.Equal(&meta.FindStatusCondition(conditions, CONDITION_IDENTITY_CONFLICT).LastTransitionTime))
+}
+
+func TestUpdateConditionsReturnsPatchErrors(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	objects := []client.Object{}
+	for _, name := range []string{"abc", "cba", "fed"} {
+		objects = append(objects, &slonkv1.PhysicalNode{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE}})
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&slonkv1.PhysicalNode{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, cli client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				if obj.GetName() == "abc" || obj.GetName() == "fed" {
+					return fmt.Errorf("etcdserver: request timed out")
+				}
+				return cli.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client: fakeClient,
+		Scheme: scheme.Scheme,
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+	for _, object := range objects {
+		physicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(object), physicalNode))
+		physicalNodeMap[physicalNode.Name] = physicalNode
+	}
+
+	// The failures don't stop the other physical nodes and are all returned.
+	_, err := r.UpdateConditions(context.Background(), map[string]*corev1.Node{}, physicalNodeMap)
+	assert.ErrorContains(t, err, "patch conditions of physical node abc: etcdserver: request timed out")
+	assert.ErrorContains(t, err, "patch conditions of physical node fed: etcdserver: request timed out")
+	updatedPhysicalNode := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+	assert.Len(t, updatedPhysicalNode.Status.Conditions, 5)
+}
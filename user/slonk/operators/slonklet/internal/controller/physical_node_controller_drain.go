@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	DRAIN_PHASE_DRAINING          = "Draining"
+	DRAIN_PHASE_DRAINED           = "Drained"
+	DRAIN_PHASE_DEADLINE_EXCEEDED = "DeadlineExceeded"
+
+	DEFAULT_DRAIN_DEADLINE = 2 * time.Hour
+
+	// Prefix of the reason of slurm nodes drained or rebooted by slonklet, recognised as an
+	// automatic drain so that the node doesn't become a manual override.
+	SLONKLET_DRAIN_REASON_PREFIX = "slonklet:"
+)
+
+// slonkletDrainReason returns the slurm reason of a drain or reboot done for the action.
+func slonkletDrainReason(action *RemediationAction) string {
+	return fmt.Sprintf("%s %s", SLONKLET_DRAIN_REASON_PREFIX, action.taintString())
+}
+
+// drainSlurmNode drains the slurm node of a slurm pod about to be deleted or rebooted,
+// and waits until the jobs running on it finish, or the drain deadline of their partitions
+// passes. Progress is recorded in the physical node status. Returns whether the node can
+// be disrupted now.
+func (r *PhysicalNodeReconciler) drainSlurmNode(
+	ctx context.Context,
+	socketPath string,
+	action *RemediationAction,
+	physicalNode *slonkv1.PhysicalNode,
+	slurmNode *slurm.SlurmNode,
+	slurmJobs []slurm.SlurmJob,
+	now time.Time,
+) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	// The drain of the slurm node is kept once it is drained or past its deadline, until the
+	// pod is deleted or the reboot requested, so that a failed or held back disruption
+	// doesn't restart the deadline. It only starts over once the slurm node was resumed.
+	drain := physicalNode.Status.SlurmDrain.DeepCopy()
+	if drain == nil || drain.SlurmNodeName != action.SlurmPodName || (slurmNode != nil && !isSlurmNodeDrainedOrDown(slurmNode)) {
+		if slurmNode != nil && !isSlurmNodeDrainedOrDown(slurmNode) {
+			reason := slonkletDrainReason(action)
+			if err := slurm.UpdateSlurmNodeState(socketPath, action.SlurmPodName, "DRAIN", reason); err != nil {
+				return false, fmt.Errorf("drain slurm node: %w", err)
+			}
+			logger.Info("Drained slurm node before disrupting it", "slurm node", action.SlurmPodName, "physical node", physicalNode.Name, "reason", reason)
+		}
+		drain = &slonkv1.SlurmDrainStatus{
+			Phase:          DRAIN_PHASE_DRAINING,
+			SlurmNodeName:  action.SlurmPodName,
+			Reason:         action.taintString(),
+			StartTimestamp: metav1.NewTime(now),
+		}
+	}
+
+	// Jobs within their partition's deadline block the removal.
+	drain.RunningJobs = nil
+	drain.Deadline = nil
+	blockingJobs := []int{}
+	expiredJobs := []int{}
+	for _, job := range slurmJobs {
+		if !slurm.SLURM_JOB_RUNNING_STATES[job.JobState] || !isJobOnSlurmNode(job, action.SlurmPodName) {
+			continue
+		}
+		drain.RunningJobs = append(drain.RunningJobs, job.JobID)
+		deadline := drain.StartTimestamp.Add(r.drainDeadline(job.Partition))
+		if drain.Deadline == nil || deadline.After(drain.Deadline.Time) {
+			drain.Deadline = &metav1.Time{Time: deadline}
+		}
+		if now.Before(deadline) {
+			blockingJobs = append(blockingJobs, job.JobID)
+		} else {
+			expiredJobs = append(expiredJobs, job.JobID)
+		}
+	}
+
+	done := false
+	if len(blockingJobs) > 0 {
+		drain.Message = fmt.Sprintf("waiting for %d running jobs", len(blockingJobs))
+	} else if len(expiredJobs) > 0 {
+		drain.Phase = DRAIN_PHASE_DEADLINE_EXCEEDED
+		drain.Message = fmt.Sprintf("drain deadline passed with %d running jobs", len(expiredJobs))
+		if r.RequeueOnDrainDeadline {
+			requeued := map[int]bool{}
+			for _, jobID := range drain.RequeuedJobs {
+				requeued[jobID] = true
+			}
+			for _, jobID := range expiredJobs {
+				if requeued[jobID] {
+					continue
+				}
+				if err := slurm.RequeueSlurmJob(socketPath, jobID); err != nil {
+					logger.Info("Failed to requeue slurm job", "job", jobID, "slurm node", action.SlurmPodName, "error", err)
+					continue
+				}
+				drain.RequeuedJobs = append(drain.RequeuedJobs, jobID)
+			}
+			drain.Message = fmt.Sprintf("%s, requeued %d", drain.Message, len(drain.RequeuedJobs))
+		}
+		done = true
+	} else {
+		drain.Phase = DRAIN_PHASE_DRAINED
+		drain.Message = "no running jobs"
+		done = true
+	}
+	drain.Timestamp = metav1.NewTime(now)
+
+	logger.Info("Slurm node drain progress",
+		"phase", drain.Phase,
+		"message", drain.Message,
+		"running jobs", drain.RunningJobs,
+		"slurm node", action.SlurmPodName,
+		"physical node", physicalNode.Name,
+	)
+
+	if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Status.SlurmDrain = drain
+	}); err != nil {
+		return false, fmt.Errorf("update physical node drain status: %w", err)
+	}
+
+	return done, nil
+}
+
+// drainDeadline returns how long jobs in the partition may run after their node started
+// draining.
+func (r *PhysicalNodeReconciler) drainDeadline(partition string) time.Duration {
+	if deadline, ok := r.PartitionDrainDeadlines[partition]; ok {
+		return deadline
+	}
+	if r.DrainDeadline > 0 {
+		return r.DrainDeadline
+	}
+	return DEFAULT_DRAIN_DEADLINE
+}
+
+func isSlurmNodeDrainedOrDown(slurmNode *slurm.SlurmNode) bool {
+	for _, state := range slurmNode.State {
+		if strings.EqualFold(state, "DRAIN") || strings.EqualFold(state, "DOWN") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestAutoRemediateDrainsSlurmNode(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	k8sNode := testNodes[0].(*corev1.Node).DeepCopy()
+	k8sNode.Spec.Taints = []corev1.Taint{{Key: SLURM_TAINT_GOAL_STATE, Value: GoalStateDown, Effect: corev1.TaintEffectNoSchedule}}
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "cba", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: GoalStateDown, Reason: "bad gpu"},
+		},
+	}
+
+	testData := slurm.SlurmResponse{
+		Nodes: []slurm.SlurmNode{
+			{Name: "slurm-node-1", State: []string{"ALLOCATED"}},
+		},
+		Jobs: []slurm.SlurmJob{
+			{JobID: 1, JobState: "RUNNING", Partition: "hero", Nodes: "slurm-node-1"},
+			{JobID: 2, JobState: "RUNNING", Partition: "dev", Nodes: "slurm-node-2"},
+		},
+	}
+
+	// Start the test slurmrestd server.
+	socketPath := "/tmp/test.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, testData)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, testPods[0], physicalNode).
+		WithStatusSubresource(physicalNode).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client:                  fakeClient,
+		Recorder:                &events.FakeRecorder{},
+		Scheme:                  scheme.Scheme,
+		PartitionDrainDeadlines: map[string]time.Duration{"hero": time.Hour},
+	}
+	slurmNodeMap := map[string]*slurm.SlurmNode{"slurm-node-1": &testData.Nodes[0]}
+	k8sNodeMap := map[string]*corev1.Node{k8sNode.Name: k8sNode}
+
+	// The slurm node is drained, and the pod is kept while the job runs.
+	_, err = r.AutoRemediate(context.Background(), socketPath, slurmNodeMap, k8sNodeMap,
+		map[string]*slonkv1.PhysicalNode{"cba": physicalNode}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_IN_PROGRESS, r.RemediationPlan().Actions[0].Outcome)
+
+	slurmNodes, err := slurm.ListSlurmNodes(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DRAIN"}, slurmNodes[0].State)
+	assert.Equal(t, "slonklet: "+SLURM_TAINT_GOAL_STATE+":"+GoalStateDown, slurmNodes[0].Reason)
+
+	// The next sync recognises the drain as slonklet's own and keeps the node automatic.
+	syncedPhysicalNode := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, syncedPhysicalNode))
+	_, err = r.SyncSlurmAndK8sNodeSpecAndStatus(context.Background(),
+		map[string]*slurm.SlurmNode{"slurm-node-1": &slurmNodes[0]},
+		map[string]*corev1.Pod{"slurm-node-1": testPods[0].(*corev1.Pod)},
+		k8sNodeMap,
+		map[string]*slonkv1.PhysicalNode{"cba": syncedPhysicalNode})
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, syncedPhysicalNode))
+	assert.False(t, syncedPhysicalNode.Spec.Manual)
+	assert.Nil(t, syncedPhysicalNode.Spec.ManualOverride)
+
+	pod := &corev1.Pod{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "slurm-node-1", Namespace: SLURM_NAMESPACE}, pod))
+
+	updatedPhysicalNode := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+	drain := updatedPhysicalNode.Status.SlurmDrain
+	assert.NotNil(t, drain)
+	assert.Equal(t, DRAIN_PHASE_DRAINING, drain.Phase)
+	assert.Equal(t, "slurm-node-1", drain.SlurmNodeName)
+	assert.Equal(t, []int{1}, drain.RunningJobs)
+	assert.Equal(t, drain.StartTimestamp.Add(time.Hour).Unix(), drain.Deadline.Unix())
+
+	// Once the deadline passes the job is requeued and the pod is deleted.
+	r.PartitionDrainDeadlines["hero"] = 0
+	r.RequeueOnDrainDeadline = true
+	_, err = r.AutoRemediate(context.Background(), socketPath, map[string]*slurm.SlurmNode{"slurm-node-1": &slurmNodes[0]}, k8sNodeMap,
+		map[string]*slonkv1.PhysicalNode{"cba": updatedPhysicalNode}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_EXECUTED, r.RemediationPlan().Actions[0].Outcome)
+
+	err = fakeClient.Get(context.Background(), types.NamespacedName{Name: "slurm-node-1", Namespace: SLURM_NAMESPACE}, pod)
+	assert.Error(t, err)
+
+	updatedPhysicalNode = &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+	assert.Equal(t, DRAIN_PHASE_DEADLINE_EXCEEDED, updatedPhysicalNode.Status.SlurmDrain.Phase)
+	assert.Equal(t, drain.StartTimestamp.Unix(), updatedPhysicalNode.Status.SlurmDrain.StartTimestamp.Unix())
+	assert.Equal(t, []int{1}, updatedPhysicalNode.Status.SlurmDrain.RequeuedJobs)
+	jobs, err := slurm.SyncSlurmJobs(socketPath)
+	assert.NoError(t, err)
+	for _, job := range jobs {
+		if job.JobID == 1 {
+			assert.Equal(t, "PENDING", job.JobState)
+		}
+	}
+}
+
+func TestAutoRemediateKeepsDrainAcrossFailedDelete(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	k8sNode := testNodes[0].(*corev1.Node).DeepCopy()
+	k8sNode.Spec.Taints = []corev1.Taint{{Key: SLURM_TAINT_GOAL_STATE, Value: GoalStateDown, Effect: corev1.TaintEffectNoSchedule}}
+	// Drained by slonklet two hours ago.
+	drainStart := metav1.NewTime(time.Now().Add(-2 * time.Hour).Truncate(time.Second))
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "cba", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: GoalStateDown, Reason: "bad gpu"},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			SlurmDrain: &slonkv1.SlurmDrainStatus{
+				Phase:          DRAIN_PHASE_DRAINING,
+				SlurmNodeName:  "slurm-node-1",
+				Reason:         SLURM_TAINT_GOAL_STATE + ":" + GoalStateDown,
+				StartTimestamp: drainStart,
+			},
+		},
+	}
+
+	testData := slurm.SlurmResponse{
+		Nodes: []slurm.SlurmNode{
+			{Name: "slurm-node-1", State: []string{"ALLOCATED", "DRAIN"}},
+		},
+		Jobs: []slurm.SlurmJob{
+			{JobID: 1, JobState: "RUNNING", Partition: "hero", Nodes: "slurm-node-1"},
+		},
+	}
+	socketPath := "/tmp/test.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, testData)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	failDelete := true
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, testPods[0], physicalNode).
+		WithStatusSubresource(physicalNode).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Delete: func(ctx context.Context, cli client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				if _, ok := obj.(*corev1.Pod); ok && failDelete {
+					return fmt.Errorf("etcdserver: request timed out")
+				}
+				return cli.Delete(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client:                  fakeClient,
+		Recorder:                &events.FakeRecorder{},
+		Scheme:                  scheme.Scheme,
+		PartitionDrainDeadlines: map[string]time.Duration{"hero": time.Hour},
+		RequeueOnDrainDeadline:  true,
+	}
+	k8sNodeMap := map[string]*corev1.Node{k8sNode.Name: k8sNode}
+	autoRemediate := func() *slonkv1.PhysicalNode {
+		slurmNodes, err := slurm.ListSlurmNodes(socketPath)
+		assert.NoError(t, err)
+		currentPhysicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, currentPhysicalNode))
+		_, err = r.AutoRemediate(context.Background(), socketPath,
+			map[string]*slurm.SlurmNode{"slurm-node-1": &slurmNodes[0]}, k8sNodeMap,
+			map[string]*slonkv1.PhysicalNode{"cba": currentPhysicalNode}, false)
+		assert.NoError(t, err)
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, currentPhysicalNode))
+		return currentPhysicalNode
+	}
+
+	// The deadline passed, the job is requeued but the pod can't be deleted.
+	updatedPhysicalNode := autoRemediate()
+	assert.Equal(t, OUTCOME_FAILED, r.RemediationPlan().Actions[0].Outcome)
+	drain := updatedPhysicalNode.Status.SlurmDrain
+	assert.Equal(t, DRAIN_PHASE_DEADLINE_EXCEEDED, drain.Phase)
+	assert.Equal(t, []int{1}, drain.RequeuedJobs)
+
+	// The next iteration retries the delete with the same drain, instead of starting over.
+	failDelete = false
+	updatedPhysicalNode = autoRemediate()
+	assert.Equal(t, OUTCOME_EXECUTED, r.RemediationPlan().Actions[0].Outcome)
+	drain = updatedPhysicalNode.Status.SlurmDrain
+	assert.Equal(t, drainStart.Unix(), drain.StartTimestamp.Unix())
+	assert.Equal(t, []int{1}, drain.RequeuedJobs)
+	pod := &corev1.Pod{}
+	assert.Error(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "slurm-node-1", Namespace: SLURM_NAMESPACE}, pod))
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/history"
+)
+
+const EXPLAIN_TIME_FORMAT = "2006-01-02 15:04 MST"
+
+// ExplainGoalState describes in a few sentences why the physical node has its current goal
+// states, from its spec, status and history records. Records may be empty when the history
+// is disabled.
+func ExplainGoalState(physicalNode *slonkv1.PhysicalNode, records []history.Record, now time.Time) []string {
+	spec := physicalNode.Spec
+	status := physicalNode.Status
+	lines := []string{}
+
+	slurmGoalState := spec.SlurmNodeSpec.GoalState
+	if slurmGoalState == "" {
+		slurmGoalState = GoalStateUp
+	}
+	line := fmt.Sprintf("Slurm goal state is %s", slurmGoalState)
+	if spec.SlurmNodeSpec.Reason != "" {
+		line += fmt.Sprintf(" with reason %q", spec.SlurmNodeSpec.Reason)
+	}
+	if !spec.SlurmNodeSpec.Timestamp.IsZero() {
+		line += fmt.Sprintf(", last set %s", describeTime(spec.SlurmNodeSpec.Timestamp, now))
+	}
+	if spec.SlurmNodeSpec.Actor != "" {
+		line += fmt.Sprintf(" by %s", spec.SlurmNodeSpec.Actor)
+	}
+	lines = append(lines, line+".")
+	if spec.K8sNodeSpec.GoalState != "" && spec.K8sNodeSpec.GoalState != GoalStateUp {
+		line = fmt.Sprintf("K8s goal state is %s", spec.K8sNodeSpec.GoalState)
+		if spec.K8sNodeSpec.Reason != "" {
+			line += fmt.Sprintf(" with reason %q", spec.K8sNodeSpec.Reason)
+		}
+		lines = append(lines, line+".")
+	}
+
+	slurmNodeStatus := status.SlurmNodeStatus
+	slurmDrained := false
+	for _, state := range slurmNodeStatus.State {
+		if state == "DRAIN" {
+			slurmDrained = true
+		}
+	}
+
+	if spec.Manual {
+		line = "The physical node is managed manually, slonklet enforces its goal states instead of following the slurm node until it is undrained or its override is reverted"
+		if override := spec.ManualOverride; override != nil {
+			if override.Owner != "" {
+				line += fmt.Sprintf(". Owner: %s", override.Owner)
+			}
+			if override.Ticket != "" {
+				line += fmt.Sprintf(". Ticket: %s", override.Ticket)
+			}
+			if !override.StartTimestamp.IsZero() {
+				line += fmt.Sprintf(". Since %s", describeTime(override.StartTimestamp, now))
+			}
+			if override.ExpirationTimestamp != nil {
+				onExpiry := override.OnExpiry
+				if onExpiry == "" {
+					onExpiry = MANUAL_OVERRIDE_ON_EXPIRY_ALERT
+				}
+				verb := "Expires"
+				if override.ExpirationTimestamp.Time.Before(now) {
+					verb = "Expired"
+				}
+				line += fmt.Sprintf(". %s %s, then %s", verb, describeTime(*override.ExpirationTimestamp, now), onExpiry)
+			}
+			if override.Notes != "" {
+				line += fmt.Sprintf(". Notes: %s", override.Notes)
+			}
+		}
+		lines = append(lines, line+".")
+		if slurmDrained && !IsAutomaticSlurmDrainReason(slurmNodeStatus.Reason) &&
+			slurmGoalState == GoalStateDrain && spec.SlurmNodeSpec.Actor == "" {
+			lines = append(lines, fmt.Sprintf(
+				"Slurm node %s was drained outside of slonklet with reason %q, which slurm or slonklet don't set themselves, so the goal state follows it.",
+				slurmNodeStatus.Name, slurmNodeStatus.Reason))
+		}
+	} else {
+		lines = append(lines, "The physical node is managed automatically, its slurm goal state only turns to drain when the slurm node is drained by hand.")
+		if slurmDrained && IsAutomaticSlurmDrainReason(slurmNodeStatus.Reason) {
+			lines = append(lines, fmt.Sprintf(
+				"Slurm node %s is drained with reason %q, which is set by slurm, reboots, health checks or the remediations of slonklet, so it doesn't change the goal state.",
+				slurmNodeStatus.Name, slurmNodeStatus.Reason))
+		}
+	}
+
+	if condition := meta.FindStatusCondition(status.Conditions, CONDITION_GOAL_STATE_REACHED); condition != nil &&
+		condition.Status == metav1.ConditionFalse {
+		lines = append(lines, fmt.Sprintf("Goal state not reached: %s", condition.Message))
+	}
+	if condition := meta.FindStatusCondition(status.Conditions, CONDITION_REMEDIATING); condition != nil &&
+		condition.Status == metav1.ConditionTrue {
+		lines = append(lines, fmt.Sprintf("Remediating: %s", condition.Message))
+	}
+
+	// The goal state changes leading here, most recent first.
+	changes := []string{}
+	for i := len(records) - 1; i >= 0 && len(changes) < 3; i-- {
+		if records[i].Kind != history.KIND_SLURM_GOAL_STATE {
+			continue
+		}
+		slurmNodeSpec := slonkv1.SlurmNodeSpec{}
+		if err := json.Unmarshal(records[i].Data, &slurmNodeSpec); err != nil {
+			continue
+		}
+		change := fmt.Sprintf("%s: %s", records[i].Timestamp.Format(EXPLAIN_TIME_FORMAT), slurmNodeSpec.GoalState)
+		if slurmNodeSpec.Reason != "" {
+			change += fmt.Sprintf(" (%s)", slurmNodeSpec.Reason)
+		}
+		if slurmNodeSpec.Actor != "" {
+			change += fmt.Sprintf(" by %s", slurmNodeSpec.Actor)
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) > 0 {
+		lines = append(lines, "Recent slurm goal state changes:")
+		for _, change := range changes {
+			lines = append(lines, "  "+change)
+		}
+	}
+	return lines
+}
+
+func describeTime(t metav1.Time, now time.Time) string {
+	age := now.Sub(t.Time)
+	if age < 0 {
+		return fmt.Sprintf("%s (in %s)", t.Format(EXPLAIN_TIME_FORMAT), (-age).Round(time.Minute))
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(EXPLAIN_TIME_FORMAT), age.Round(time.Minute))
+}
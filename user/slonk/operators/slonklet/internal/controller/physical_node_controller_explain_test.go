@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/history"
+)
+
+func TestExplainGoalState(t *testing.T) {
+	now := time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC)
+
+	// Drained by hand in slurm, then picked up by the controller.
+	physicalNode := &slonkv1.PhysicalNode{
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{
+				GoalState: GoalStateDrain,
+				Reason:    "sdc suspect",
+				Timestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+			},
+			K8sNodeSpec: slonkv1.K8sNodeSpec{GoalState: GoalStateUp},
+			Manual:      true,
+			ManualOverride: &slonkv1.ManualOverride{
+				Notes:          "Slurm node drained outside of slonklet: sdc suspect",
+				StartTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+			},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{
+				Name:   "slurm-h100-1",
+				State:  []string{"IDLE", "DRAIN"},
+				Reason: "sdc suspect",
+			},
+		},
+	}
+	record, err := history.NewRecord(now.Add(-2*time.Hour), "abc", history.KIND_SLURM_GOAL_STATE, physicalNode.Spec.SlurmNodeSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`Slurm goal state is drain with reason "sdc suspect", last set 2024-05-07 10:00 UTC (2h0m0s ago).`,
+		"The physical node is managed manually, slonklet enforces its goal states instead of following the slurm node until it is undrained or its override is reverted. Since 2024-05-07 10:00 UTC (2h0m0s ago). Notes: Slurm node drained outside of slonklet: sdc suspect.",
+		`Slurm node slurm-h100-1 was drained outside of slonklet with reason "sdc suspect", which slurm or slonklet don't set themselves, so the goal state follows it.`,
+		"Recent slurm goal state changes:",
+		"  2024-05-07 10:00 UTC: drain (sdc suspect)",
+	}, ExplainGoalState(physicalNode, []history.Record{record}, now))
+
+	// Drained by slurm itself.
+	physicalNode = &slonkv1.PhysicalNode{
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: GoalStateUp},
+		},
+		Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{
+				Name:   "slurm-h100-2",
+				State:  []string{"IDLE", "DRAIN"},
+				Reason: "Prolog error",
+			},
+			Conditions: []metav1.Condition{
+				{
+					Type:    CONDITION_GOAL_STATE_REACHED,
+					Status:  metav1.ConditionFalse,
+					Message: `Slurm goal state is up, slurm node "slurm-h100-2" is IDLE,DRAIN.`,
+				},
+			},
+		},
+	}
+	assert.Equal(t, []string{
+		"Slurm goal state is up.",
+		"The physical node is managed automatically, its slurm goal state only turns to drain when the slurm node is drained by hand.",
+		`Slurm node slurm-h100-2 is drained with reason "Prolog error", which is set by slurm, reboots, health checks or the remediations of slonklet, so it doesn't change the goal state.`,
+		`Goal state not reached: Slurm goal state is up, slurm node "slurm-h100-2" is IDLE,DRAIN.`,
+	}, ExplainGoalState(physicalNode, nil, now))
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Index of pods by the k8s node they are scheduled on.
+	POD_NODE_NAME_INDEX = "spec.nodeName"
+	// Index of k8s nodes by the physical node they claim with the GPU UUID hash annotation.
+	K8S_NODE_GPU_UUID_HASH_INDEX = "metadata.annotations.gpu-uuid-hash"
+)
+
+// SetupFieldIndexes registers the field indexes the controller looks objects up by in the
+// informer cache.
+func SetupFieldIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &corev1.Pod{}, POD_NODE_NAME_INDEX, indexPodByNodeName); err != nil {
+		return fmt.Errorf("index pods by node name: %w", err)
+	}
+	if err := indexer.IndexField(ctx, &corev1.Node{}, K8S_NODE_GPU_UUID_HASH_INDEX, indexK8sNodeByGPUUUIDHash); err != nil {
+		return fmt.Errorf("index k8s nodes by gpu uuid hash: %w", err)
+	}
+	return nil
+}
+
+func indexPodByNodeName(obj client.Object) []string {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil
+	}
+	return []string{pod.Spec.NodeName}
+}
+
+func indexK8sNodeByGPUUUIDHash(obj client.Object) []string {
+	k8sNode, ok := obj.(*corev1.Node)
+	if !ok {
+		return nil
+	}
+	if value, ok := k8sNode.Annotations[GPU_UUID_HASH_ANNOTATION]; ok && value != "" {
+		return []string{value}
+	}
+	return nil
+}
+
+// listPodsOnK8sNodes returns the pods scheduled on the k8s nodes that remediation cares
+// about, by namespace. Only pods owned by a ReplicaSet are kept in the system namespace.
+func (r *PhysicalNodeReconciler) listPodsOnK8sNodes(
+	ctx context.Context,
+	k8sNodeNames []string,
+) (map[string]corev1.PodList, error) {
+	podLists := map[string]corev1.PodList{
+		SLURM_NAMESPACE:         {},
+		SYSTEM_NAMESPACE:        {},
+		NGINX_INGRESS_NAMESPACE: {},
+	}
+	for _, k8sNodeName := range k8sNodeNames {
+		podList := corev1.PodList{}
+		if err := r.Client.List(ctx, &podList, client.MatchingFields{POD_NODE_NAME_INDEX: k8sNodeName}); err != nil {
+			return nil, fmt.Errorf("list pods on k8s node %s: %w", k8sNodeName, err)
+		}
+		for _, pod := range podList.Items {
+			namespacePodList, ok := podLists[pod.Namespace]
+			if !ok {
+				continue
+			}
+			if pod.Namespace == SYSTEM_NAMESPACE &&
+				(len(pod.ObjectMeta.OwnerReferences) == 0 || pod.ObjectMeta.OwnerReferences[0].Kind != "ReplicaSet") {
+				continue
+			}
+			namespacePodList.Items = append(namespacePodList.Items, pod)
+			podLists[pod.Namespace] = namespacePodList
+		}
+	}
+	return podLists, nil
+}
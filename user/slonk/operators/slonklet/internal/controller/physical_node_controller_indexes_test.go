@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestListPodsOnK8sNodes(t *testing.T) {
+	newPod := func(namespace string, name string, nodeName string, ownerKind string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+		}
+		if ownerKind != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: "owner"}}
+		}
+		return pod
+	}
+	objects := []runtime.Object{
+		newPod(SLURM_NAMESPACE, "slurm-node-1", "k8s-node-1", ""),
+		newPod(SLURM_NAMESPACE, "slurm-node-2", "k8s-node-2", ""),
+		newPod(SYSTEM_NAMESPACE, "kube-dns", "k8s-node-1", "ReplicaSet"),
+		newPod(SYSTEM_NAMESPACE, "kube-proxy", "k8s-node-1", "DaemonSet"),
+		newPod(NGINX_INGRESS_NAMESPACE, "controller", "k8s-node-1", "ReplicaSet"),
+		newPod("default", "other", "k8s-node-1", ""),
+	}
+	r := &PhysicalNodeReconciler{
+		Client: newFakeClientBuilder().WithRuntimeObjects(objects...).Build(),
+		Scheme: scheme.Scheme,
+	}
+
+	podLists, err := r.listPodsOnK8sNodes(context.Background(), []string{"k8s-node-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(podLists))
+	podNames := func(namespace string) []string {
+		names := []string{}
+		for _, pod := range podLists[namespace].Items {
+			names = append(names, pod.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"slurm-node-1"}, podNames(SLURM_NAMESPACE))
+	assert.Equal(t, []string{"kube-dns"}, podNames(SYSTEM_NAMESPACE))
+	assert.Equal(t, []string{"controller"}, podNames(NGINX_INGRESS_NAMESPACE))
+
+	podLists, err = r.listPodsOnK8sNodes(context.Background(), []string{})
+	assert.NoError(t, err)
+	assert.Empty(t, podLists[SLURM_NAMESPACE].Items)
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/history"
+	"your-org.com/slonklet/internal/inventory"
+)
+
+// InventorySource provides the hardware inventories reported by the node-local slonklet
+// agents.
+type InventorySource interface {
+	// Inventory returns the latest inventory reported from the k8s node, nil if none.
+	Inventory(k8sNodeName string) *slonkv1.HardwareInventory
+}
+
+func (r *PhysicalNodeReconciler) k8sNodeInventory(k8sNode *corev1.Node) *slonkv1.HardwareInventory {
+	if r.Inventory == nil || k8sNode == nil {
+		return nil
+	}
+	return r.Inventory.Inventory(k8sNode.Name)
+}
+
+// recordInventoryChange archives what changed in the hardware of the host.
+func (r *PhysicalNodeReconciler) recordInventoryChange(
+	ctx context.Context,
+	physicalNodeName string,
+	existingInventory *slonkv1.HardwareInventory,
+	updatedInventory *slonkv1.HardwareInventory,
+) {
+	if existingInventory.IsEqual(updatedInventory) {
+		return
+	}
+	changes := inventory.Diff(existingInventory, updatedInventory)
+	if existingInventory != nil {
+		log.FromContext(ctx).Info("Hardware inventory changed", "physical node", physicalNodeName, "changes", changes)
+	}
+	r.recordHistory(ctx, physicalNodeName, history.KIND_INVENTORY, changes)
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestMaybeUpdatePhysicalNodeStatusFollowsInventoryChanges(t *testing.T) {
+	r := &PhysicalNodeReconciler{}
+	inventory := &slonkv1.HardwareInventory{
+		DriverVersion: "535.104.05",
+		GPUs:          []slonkv1.GPUInventory{{Index: 0, Serial: "1652923030874"}},
+		Timestamp:     metav1.NewTime(time.Now().Add(-time.Hour)),
+	}
+	existingStatus := &slonkv1.PhysicalNodeStatus{
+		SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-node-1"},
+		K8sNodeStatus:   slonkv1.K8sNodeStatus{Name: "k8s-node-1"},
+		Inventory:       inventory,
+	}
+
+	// Another report of the same hardware doesn't update the status.
+	freshStatus := existingStatus.DeepCopy()
+	freshStatus.Inventory.Timestamp = metav1.Now()
+	updatedStatus, _, _ := r.maybeUpdatePhysicalNodeStatus(existingStatus, freshStatus)
+	assert.Nil(t, updatedStatus)
+
+	// Nor does the agent not reporting.
+	freshStatus.Inventory = nil
+	updatedStatus, _, _ = r.maybeUpdatePhysicalNodeStatus(existingStatus, freshStatus)
+	assert.Nil(t, updatedStatus)
+
+	// A driver upgrade does.
+	freshStatus.Inventory = inventory.DeepCopy()
+	freshStatus.Inventory.DriverVersion = "550.54.15"
+	updatedStatus, _, _ = r.maybeUpdatePhysicalNodeStatus(existingStatus, freshStatus)
+	assert.NotNil(t, updatedStatus)
+	assert.Equal(t, "550.54.15", updatedStatus.Inventory.DriverVersion)
+	assert.Equal(t, "535.104.05", existingStatus.Inventory.DriverVersion)
+}
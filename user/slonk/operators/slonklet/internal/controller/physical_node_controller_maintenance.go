@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	SLURM_REASON_MAINTENANCE           = "maintenance"
+	MAINTENANCE_EPISODE_HISTORY_LENGTH = 20
+)
+
+// HandleMaintenance drains slurm nodes whose k8s node carries a GCP maintenance taint,
+// signals the jobs running on them so they can checkpoint, and resumes the slurm nodes
+// once the taint is gone. Each maintenance episode is recorded in the physical node status.
+func (r *PhysicalNodeReconciler) HandleMaintenance(
+	ctx context.Context,
+	socketPath string,
+	slurmNodeMap map[string]*slurm.SlurmNode,
+	k8sNodeMap map[string]*corev1.Node,
+	existingPhysicalNodeMap map[string]*slonkv1.PhysicalNode,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Started handling GCP maintenance")
+
+	// Jobs are only fetched when a new maintenance episode starts.
+	var slurmJobs []slurm.SlurmJob
+	slurmJobsFetched := false
+
+	startCount := 0
+	endCount := 0
+	for _, physicalNode := range existingPhysicalNodeMap {
+		episode := getOpenMaintenanceEpisode(&physicalNode.Status)
+
+		k8sNode, ok := k8sNodeMap[physicalNode.Status.K8sNodeStatus.Name]
+		if physicalNode.Status.K8sNodeStatus.Name == "" || !ok {
+			// The host is gone, e.g. terminated by GCP.
+			if episode != nil {
+				if err := r.patchPhysicalNodeStatus(ctx, physicalNode, endMaintenanceEpisode); err != nil {
+					logger.Info("Failed to end maintenance episode", "physical node", physicalNode.Name, "error", err)
+				} else {
+					endCount++
+				}
+			}
+			continue
+		}
+
+		slurmNodeName := physicalNode.Status.SlurmNodeStatus.Name
+		slurmNode := slurmNodeMap[slurmNodeName]
+		maintenanceTaint := getMaintenanceTaint(k8sNode)
+
+		if maintenanceTaint != nil && episode == nil {
+			logger.Info("K8s node entered GCP maintenance", "name", k8sNode.Name, "physical node", physicalNode.Name, "slurm node", slurmNodeName, "taint", maintenanceTaint.Key)
+
+			if slurmNode != nil && physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateUp && !physicalNode.Spec.Manual {
+				if err := slurm.UpdateSlurmNodeState(socketPath, slurmNodeName, "DRAIN", SLURM_REASON_MAINTENANCE); err != nil {
+					// Log and retry in the next iteration.
+					logger.Info("Failed to drain slurm node for maintenance", "slurm node", slurmNodeName, "physical node", physicalNode.Name, "error", err)
+					continue
+				}
+				if err := r.patchPhysicalNode(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+					physicalNode.Spec.SlurmNodeSpec = slonkv1.SlurmNodeSpec{
+						GoalState: GoalStateDrain,
+						Reason:    SLURM_REASON_MAINTENANCE,
+						Timestamp: metav1.Now(),
+					}
+				}); err != nil {
+					logger.Info("Failed to update physical node spec for maintenance", "physical node", physicalNode.Name, "error", err)
+					continue
+				}
+			}
+
+			newEpisode := slonkv1.MaintenanceEpisode{
+				Taint:         maintenanceTaint.Key,
+				K8sNodeName:   k8sNode.Name,
+				SlurmNodeName: slurmNodeName,
+				Drained: physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateDrain &&
+					physicalNode.Spec.SlurmNodeSpec.Reason == SLURM_REASON_MAINTENANCE,
+				StartTimestamp: metav1.Now(),
+			}
+
+			if slurmNode != nil && r.MaintenanceJobSignal != "" {
+				if !slurmJobsFetched {
+					jobs, err := slurm.SyncSlurmJobs(socketPath)
+					if err != nil {
+						logger.Info("Failed to fetch slurm jobs for maintenance", "error", err)
+					}
+					slurmJobs = jobs
+					slurmJobsFetched = true
+				}
+				for _, job := range slurmJobs {
+					if job.JobState != "RUNNING" || !isJobOnSlurmNode(job, slurmNodeName) {
+						continue
+					}
+					if err := slurm.SignalSlurmJob(socketPath, job.JobID, r.MaintenanceJobSignal); err != nil {
+						logger.Info("Failed to signal slurm job for maintenance", "job", job.JobID, "slurm node", slurmNodeName, "error", err)
+						continue
+					}
+					newEpisode.SignaledJobs = append(newEpisode.SignaledJobs, job.JobID)
+				}
+			}
+
+			if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+				physicalNode.Status.MaintenanceEpisodes = append(
+					[]slonkv1.MaintenanceEpisode{newEpisode},
+					physicalNode.Status.MaintenanceEpisodes...,
+				)
+				if len(physicalNode.Status.MaintenanceEpisodes) > MAINTENANCE_EPISODE_HISTORY_LENGTH {
+					physicalNode.Status.MaintenanceEpisodes = physicalNode.Status.MaintenanceEpisodes[:MAINTENANCE_EPISODE_HISTORY_LENGTH]
+				}
+				physicalNode.Status.MaintenanceCount++
+			}); err != nil {
+				logger.Info("Failed to record maintenance episode", "physical node", physicalNode.Name, "error", err)
+				continue
+			}
+			startCount++
+
+			message := fmt.Sprintf(
+				"Drained slurm node %s for GCP maintenance taint %s, signaled jobs %v. K8s node: %s. Physical node: %s.",
+				slurmNodeName,
+				maintenanceTaint.Key,
+				newEpisode.SignaledJobs,
+				k8sNode.Name,
+				physicalNode.Name)
+			r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_MAINTENANCE_DRAIN, message)
+		} else if maintenanceTaint == nil {
+			if episode != nil {
+				logger.Info("K8s node left GCP maintenance", "name", k8sNode.Name, "physical node", physicalNode.Name, "slurm node", slurmNodeName)
+				if err := r.patchPhysicalNodeStatus(ctx, physicalNode, endMaintenanceEpisode); err != nil {
+					logger.Info("Failed to end maintenance episode", "physical node", physicalNode.Name, "error", err)
+					continue
+				}
+				endCount++
+			}
+
+			if physicalNode.Spec.SlurmNodeSpec.GoalState != GoalStateDrain ||
+				physicalNode.Spec.SlurmNodeSpec.Reason != SLURM_REASON_MAINTENANCE ||
+				physicalNode.Spec.Manual {
+				continue
+			}
+			// Only resume slurm nodes that nobody else drained in the meantime.
+			if slurmNode != nil && slurmNode.Reason == SLURM_REASON_MAINTENANCE {
+				if err := slurm.UpdateSlurmNodeState(socketPath, slurmNodeName, "RESUME", ""); err != nil {
+					logger.Info("Failed to resume slurm node after maintenance", "slurm node", slurmNodeName, "physical node", physicalNode.Name, "error", err)
+					continue
+				}
+			}
+			if err := r.patchPhysicalNode(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+				physicalNode.Spec.SlurmNodeSpec = slonkv1.SlurmNodeSpec{
+					GoalState: GoalStateUp,
+					Timestamp: metav1.Now(),
+				}
+			}); err != nil {
+				logger.Info("Failed to update physical node spec after maintenance", "physical node", physicalNode.Name, "error", err)
+				continue
+			}
+
+			message := fmt.Sprintf(
+				"Resumed slurm node %s after GCP maintenance. K8s node: %s. Physical node: %s.",
+				slurmNodeName,
+				k8sNode.Name,
+				physicalNode.Name)
+			r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_MAINTENANCE_RESUME, message)
+		}
+	}
+
+	logger.Info("Finished handling GCP maintenance", "startCount", startCount, "endCount", endCount)
+
+	return ctrl.Result{}, nil
+}
+
+// getMaintenanceTaint returns the GCP maintenance taint on the k8s node, or nil.
+func getMaintenanceTaint(k8sNode *corev1.Node) *corev1.Taint {
+	for _, taint := range k8sNode.Spec.Taints {
+		if taint.Key == GCP_MAINTENANCE_STARTED || taint.Key == GCP_MAINTENANCE_IMPENDING_TERMINATION {
+			return taint.DeepCopy()
+		}
+	}
+	return nil
+}
+
+// getOpenMaintenanceEpisode returns the ongoing maintenance episode in the status, or nil.
+func getOpenMaintenanceEpisode(status *slonkv1.PhysicalNodeStatus) *slonkv1.MaintenanceEpisode {
+	if len(status.MaintenanceEpisodes) > 0 && status.MaintenanceEpisodes[0].EndTimestamp == nil {
+		return &status.MaintenanceEpisodes[0]
+	}
+	return nil
+}
+
+// endMaintenanceEpisode ends the open maintenance episode of the physical node, if any.
+func endMaintenanceEpisode(physicalNode *slonkv1.PhysicalNode) {
+	if episode := getOpenMaintenanceEpisode(&physicalNode.Status); episode != nil {
+		now := metav1.Now()
+		episode.EndTimestamp = &now
+	}
+}
+
+func isJobOnSlurmNode(job slurm.SlurmJob, slurmNodeName string) bool {
+	if len(job.JobResources.AllocatedNodes) > 0 {
+		for _, node := range job.JobResources.AllocatedNodes {
+			if node.NodeName == slurmNodeName {
+				return true
+			}
+		}
+		return false
+	}
+	nodes, err := slurm.ParseJobNodeList(job.Nodes)
+	if err != nil {
+		return false
+	}
+	for _, node := range nodes {
+		if strings.TrimSpace(node) == slurmNodeName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestHandleMaintenance(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+	testNodes[1].(*corev1.Node).Spec.Taints = []corev1.Taint{
+		{Key: GCP_MAINTENANCE_STARTED, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+	}
+	runtimeObjects := append(testPods, testNodes...)
+
+	testData := slurm.SlurmResponse{
+		Nodes: []slurm.SlurmNode{
+			{Name: "slurm-node-1", State: []string{"ALLOCATED"}},
+			{Name: "slurm-node-2", State: []string{"ALLOCATED"}},
+		},
+		Jobs: []slurm.SlurmJob{
+			{JobID: 1, JobState: "RUNNING", Nodes: "slurm-node-1"},
+			{JobID: 2, JobState: "RUNNING", Nodes: "slurm-node-[1-2]"},
+		},
+	}
+
+	// Start the test slurmrestd server.
+	socketPath := "/tmp/test.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, testData)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	// Create a fake reconciler.
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(runtimeObjects...).
+		WithStatusSubresource(&slonkv1.PhysicalNode{}).
+		Build()
+	testPhysicalNodeReconciler := &PhysicalNodeReconciler{
+		Client:               fakeClient,
+		Recorder:             &events.FakeRecorder{},
+		Scheme:               scheme.Scheme,
+		MaintenanceDrain:     true,
+		MaintenanceJobSignal: "USR1",
+	}
+
+	// Execute sync function, the tainted host should be drained.
+	_, err = testPhysicalNodeReconciler.Sync(context.Background(), socketPath, false)
+	assert.NoError(t, err)
+
+	physicalNode := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "fed", Namespace: SLURM_NAMESPACE}, physicalNode))
+	assert.Equal(t, GoalStateDrain, physicalNode.Spec.SlurmNodeSpec.GoalState)
+	assert.Equal(t, SLURM_REASON_MAINTENANCE, physicalNode.Spec.SlurmNodeSpec.Reason)
+	assert.False(t, physicalNode.Spec.Manual)
+	assert.Equal(t, 1, physicalNode.Status.MaintenanceCount)
+	assert.Equal(t, 1, len(physicalNode.Status.MaintenanceEpisodes))
+	episode := physicalNode.Status.MaintenanceEpisodes[0]
+	assert.Equal(t, GCP_MAINTENANCE_STARTED, episode.Taint)
+	assert.Equal(t, "slurm-node-2", episode.SlurmNodeName)
+	assert.True(t, episode.Drained)
+	assert.Equal(t, []int{2}, episode.SignaledJobs)
+	assert.Nil(t, episode.EndTimestamp)
+
+	slurmNodes, err := slurm.ListSlurmNodes(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DRAIN"}, slurmNodes[1].State)
+	assert.Equal(t, SLURM_REASON_MAINTENANCE, slurmNodes[1].Reason)
+
+	// The untainted host is left alone.
+	physicalNode = &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, physicalNode))
+	assert.Equal(t, GoalStateUp, physicalNode.Spec.SlurmNodeSpec.GoalState)
+	assert.Equal(t, 0, physicalNode.Status.MaintenanceCount)
+
+	// The drain for maintenance isn't mistaken for a manual drain, and the episode isn't recorded twice.
+	_, err = testPhysicalNodeReconciler.Sync(context.Background(), socketPath, false)
+	assert.NoError(t, err)
+	physicalNode = &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "fed", Namespace: SLURM_NAMESPACE}, physicalNode))
+	assert.False(t, physicalNode.Spec.Manual)
+	assert.Equal(t, 1, physicalNode.Status.MaintenanceCount)
+
+	// Remove the maintenance taint, the host should be resumed.
+	k8sNode := &corev1.Node{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "k8s-node-2"}, k8sNode))
+	k8sNode.Spec.Taints = nil
+	assert.NoError(t, fakeClient.Update(context.Background(), k8sNode))
+
+	_, err = testPhysicalNodeReconciler.Sync(context.Background(), socketPath, false)
+	assert.NoError(t, err)
+	physicalNode = &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "fed", Namespace: SLURM_NAMESPACE}, physicalNode))
+	assert.Equal(t, GoalStateUp, physicalNode.Spec.SlurmNodeSpec.GoalState)
+	assert.Equal(t, "", physicalNode.Spec.SlurmNodeSpec.Reason)
+	assert.Equal(t, 1, physicalNode.Status.MaintenanceCount)
+	assert.NotNil(t, physicalNode.Status.MaintenanceEpisodes[0].EndTimestamp)
+
+	slurmNodes, err = slurm.ListSlurmNodes(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"IDLE"}, slurmNodes[1].State)
+}
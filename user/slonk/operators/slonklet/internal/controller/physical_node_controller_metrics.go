@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/capacity"
+	"your-org.com/slonklet/internal/metrics"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	METRICS_STATUS_MISSING       = "Missing"
+	METRICS_STATUS_REMOVED       = "Removed"
+	METRICS_STATUS_TAINTED       = "Tainted"
+	METRICS_STATUS_UNSCHEDULABLE = "Unschedulable"
+	METRICS_STATUS_SCHEDULABLE   = "Schedulable"
+)
+
+// updatePhysicalNodeMetrics replaces the physical node and taint series with the state
+// of this iteration.
+func updatePhysicalNodeMetrics(physicalNodeMap map[string]*slonkv1.PhysicalNode, k8sNodeMap map[string]*corev1.Node) {
+	metrics.PhysicalNodes.Reset()
+	for _, physicalNode := range physicalNodeMap {
+		metrics.PhysicalNodes.WithLabelValues(
+			physicalNode.Spec.SlurmNodeSpec.GoalState,
+			physicalNode.Spec.K8sNodeSpec.GoalState,
+			slurmStateMetricLabel(physicalNode.Status.SlurmNodeStatus),
+			k8sStatusMetricLabel(physicalNode.Status.K8sNodeStatus),
+		).Inc()
+	}
+
+	metrics.TaintedK8sNodes.Reset()
+	for _, k8sNode := range k8sNodeMap {
+		if lifecycleTaint := getLifecycleTaint(k8sNode); lifecycleTaint != nil {
+			metrics.TaintedK8sNodes.WithLabelValues(lifecycleTaint.Key).Inc()
+		}
+	}
+	metrics.TaintLimit.Set(TAINT_LIMIT_TOTAL)
+}
+
+// slurmStateMetricLabel joins the slurm node state and its flags, e.g. "IDLE+DRAIN".
+func slurmStateMetricLabel(status slonkv1.SlurmNodeStatus) string {
+	if status.Name == "" {
+		return METRICS_STATUS_MISSING
+	}
+	if status.Removed {
+		return METRICS_STATUS_REMOVED
+	}
+	return strings.Join(status.State, "+")
+}
+
+func k8sStatusMetricLabel(status slonkv1.K8sNodeStatus) string {
+	if status.Name == "" {
+		return METRICS_STATUS_MISSING
+	}
+	if status.Removed {
+		return METRICS_STATUS_REMOVED
+	}
+	for _, taint := range status.Taints {
+		if strings.HasPrefix(taint.Key, SLURM_TAINT_PREFIX) ||
+			taint.Key == GCP_MAINTENANCE_STARTED ||
+			taint.Key == GCP_MAINTENANCE_IMPENDING_TERMINATION {
+			return METRICS_STATUS_TAINTED
+		}
+	}
+	if status.Unschedulable {
+		return METRICS_STATUS_UNSCHEDULABLE
+	}
+	return METRICS_STATUS_SCHEDULABLE
+}
+
+// recordRemediationMetrics counts the executed and failed actions of the plan, and replaces
+// the series of the actions that are still planned, which are planned again in every
+// iteration until they are acted on.
+func recordRemediationMetrics(plan *RemediationPlan) {
+	metrics.RemediationPlannedActions.Reset()
+	for _, action := range plan.Actions {
+		switch action.Outcome {
+		case OUTCOME_EXECUTED, OUTCOME_FAILED:
+			metrics.RemediationActions.WithLabelValues(action.Type, action.Outcome).Inc()
+		default:
+			metrics.RemediationPlannedActions.WithLabelValues(action.Type, action.Outcome).Inc()
+		}
+	}
+}
+
+// updateSlurmJobMetrics replaces the slurm job and pending GPU series with the jobs in the
+// queue.
+func updateSlurmJobMetrics(rawSlurmJobList []slurm.SlurmJob) {
+	metrics.SlurmJobs.Reset()
+	for _, rawSlurmJob := range rawSlurmJobList {
+		metrics.SlurmJobs.WithLabelValues(rawSlurmJob.JobState, rawSlurmJob.Partition).Inc()
+	}
+
+	metrics.CapacityPendingGPUs.Reset()
+	for partition, gpus := range capacity.PendingGPUs(rawSlurmJobList) {
+		metrics.CapacityPendingGPUs.WithLabelValues(partition).Set(float64(gpus))
+	}
+}
+
+// updateCapacityMetrics replaces the GPU capacity series with the slurm nodes of this
+// iteration.
+func updateCapacityMetrics(slurmNodeMap map[string]*slurm.SlurmNode, physicalNodeMap map[string]*slonkv1.PhysicalNode) {
+	metrics.CapacityGPUs.Reset()
+	for key, count := range capacity.GPUs(slurmNodeMap, physicalNodeMap) {
+		for state, value := range map[string]int{
+			capacity.STATE_HEALTHY:   count.Healthy,
+			capacity.STATE_ALLOCATED: count.Allocated,
+			capacity.STATE_IDLE:      count.Idle,
+			capacity.STATE_DRAINED:   count.Drained,
+		} {
+			metrics.CapacityGPUs.WithLabelValues(key.Partition, key.Nodepool, key.GPUType, state).Set(float64(value))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/metrics"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestUpdatePhysicalNodeMetrics(t *testing.T) {
+	newPhysicalNode := func(slurmGoalState string, slurmStatus slonkv1.SlurmNodeStatus, k8sStatus slonkv1.K8sNodeStatus) *slonkv1.PhysicalNode {
+		return &slonkv1.PhysicalNode{
+			Spec: slonkv1.PhysicalNodeSpec{
+				SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: slurmGoalState},
+				K8sNodeSpec:   slonkv1.K8sNodeSpec{GoalState: GoalStateUp},
+			},
+			Status: slonkv1.PhysicalNodeStatus{SlurmNodeStatus: slurmStatus, K8sNodeStatus: k8sStatus},
+		}
+	}
+	goalStateTaint := corev1.Taint{Key: SLURM_TAINT_GOAL_STATE, Value: GoalStateDown, Effect: corev1.TaintEffectNoSchedule}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"pn-1": newPhysicalNode(GoalStateUp,
+			slonkv1.SlurmNodeStatus{Name: "slurm-node-1", State: []string{"IDLE"}},
+			slonkv1.K8sNodeStatus{Name: "k8s-node-1"}),
+		"pn-2": newPhysicalNode(GoalStateUp,
+			slonkv1.SlurmNodeStatus{Name: "slurm-node-2", State: []string{"IDLE"}},
+			slonkv1.K8sNodeStatus{Name: "k8s-node-2"}),
+		"pn-3": newPhysicalNode(GoalStateDown,
+			slonkv1.SlurmNodeStatus{Name: "slurm-node-3", State: []string{"IDLE", "DRAIN"}},
+			slonkv1.K8sNodeStatus{Name: "k8s-node-3", Unschedulable: true, Taints: []corev1.Taint{goalStateTaint}}),
+		"pn-4": newPhysicalNode(GoalStateUp,
+			slonkv1.SlurmNodeStatus{},
+			slonkv1.K8sNodeStatus{Name: "k8s-node-4", Removed: true}),
+	}
+	k8sNodeMap := map[string]*corev1.Node{
+		"k8s-node-1": {ObjectMeta: metav1.ObjectMeta{Name: "k8s-node-1"}},
+		"k8s-node-3": {
+			ObjectMeta: metav1.ObjectMeta{Name: "k8s-node-3"},
+			Spec:       corev1.NodeSpec{Taints: []corev1.Taint{goalStateTaint}},
+		},
+	}
+
+	updatePhysicalNodeMetrics(physicalNodeMap, k8sNodeMap)
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.PhysicalNodes))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.PhysicalNodes.WithLabelValues(GoalStateUp, GoalStateUp, "IDLE", METRICS_STATUS_SCHEDULABLE)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.PhysicalNodes.WithLabelValues(GoalStateDown, GoalStateUp, "IDLE+DRAIN", METRICS_STATUS_TAINTED)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.PhysicalNodes.WithLabelValues(GoalStateUp, GoalStateUp, METRICS_STATUS_MISSING, METRICS_STATUS_REMOVED)))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.TaintedK8sNodes))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.TaintedK8sNodes.WithLabelValues(SLURM_TAINT_GOAL_STATE)))
+	assert.Equal(t, float64(TAINT_LIMIT_TOTAL), testutil.ToFloat64(metrics.TaintLimit))
+
+	// Series of previous iterations are dropped.
+	delete(physicalNodeMap, "pn-3")
+	delete(k8sNodeMap, "k8s-node-3")
+	updatePhysicalNodeMetrics(physicalNodeMap, k8sNodeMap)
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.PhysicalNodes))
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.TaintedK8sNodes))
+}
+
+func TestRecordRemediationMetrics(t *testing.T) {
+	metrics.RemediationActions.Reset()
+	plan := &RemediationPlan{Actions: []RemediationAction{
+		{Type: ACTION_SLURM_POD_DELETE, Outcome: OUTCOME_EXECUTED},
+		{Type: ACTION_K8S_NODE_DELETE, Outcome: OUTCOME_FAILED},
+		{Type: ACTION_SLURM_POD_DELETE, Outcome: OUTCOME_BUDGET_EXHAUSTED},
+		{Type: ACTION_K8S_NODE_DELETE, Outcome: OUTCOME_PENDING_APPROVAL},
+		{Type: ACTION_K8S_NODE_DELETE, Outcome: OUTCOME_PENDING_APPROVAL},
+	}}
+
+	// Executed and failed actions are counted, the others only show up in the current plan.
+	recordRemediationMetrics(plan)
+	recordRemediationMetrics(plan)
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.RemediationActions.WithLabelValues(ACTION_SLURM_POD_DELETE, OUTCOME_EXECUTED)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.RemediationActions.WithLabelValues(ACTION_K8S_NODE_DELETE, OUTCOME_FAILED)))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.RemediationActions))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RemediationPlannedActions.WithLabelValues(ACTION_SLURM_POD_DELETE, OUTCOME_BUDGET_EXHAUSTED)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.RemediationPlannedActions.WithLabelValues(ACTION_K8S_NODE_DELETE, OUTCOME_PENDING_APPROVAL)))
+
+	// Actions that are no longer planned are dropped.
+	recordRemediationMetrics(&RemediationPlan{})
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.RemediationPlannedActions))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.RemediationActions))
+}
+
+func TestUpdateSlurmJobMetrics(t *testing.T) {
+	updateSlurmJobMetrics([]slurm.SlurmJob{
+		{JobID: 1, JobState: "RUNNING", Partition: "h100"},
+		{JobID: 2, JobState: "RUNNING", Partition: "h100"},
+		{JobID: 3, JobState: "PENDING", Partition: "h100"},
+		{JobID: 4, JobState: "RUNNING", Partition: "a100"},
+	})
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.SlurmJobs))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.SlurmJobs.WithLabelValues("RUNNING", "h100")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.SlurmJobs.WithLabelValues("PENDING", "h100")))
+
+	updateSlurmJobMetrics(nil)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.SlurmJobs))
+}
+
+func TestUpdateCapacityMetrics(t *testing.T) {
+	slurmNodeMap := map[string]*slurm.SlurmNode{
+		"slurm-node-1": {Name: "slurm-node-1", State: []string{"MIXED"}, Partitions: []string{"general"},
+			Gres: "gpu:h100:8(S:0-1)", GresUsed: "gpu:h100:2(IDX:0-1)"},
+		"slurm-node-2": {Name: "slurm-node-2", State: []string{"IDLE", "DRAIN"}, Partitions: []string{"general"},
+			Gres: "gpu:h100:8(S:0-1)", GresUsed: "gpu:h100:0(IDX:N/A)"},
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"pn-1": {Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-node-1"},
+			Topology:        &slonkv1.Topology{Nodepool: "pool-a"},
+		}},
+		"pn-2": {Status: slonkv1.PhysicalNodeStatus{
+			SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-node-2"},
+			Topology:        &slonkv1.Topology{Nodepool: "pool-a"},
+		}},
+	}
+
+	updateCapacityMetrics(slurmNodeMap, physicalNodeMap)
+	assert.Equal(t, 4, testutil.CollectAndCount(metrics.CapacityGPUs))
+	assert.Equal(t, 8.0, testutil.ToFloat64(metrics.CapacityGPUs.WithLabelValues("general", "pool-a", "h100", "healthy")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.CapacityGPUs.WithLabelValues("general", "pool-a", "h100", "allocated")))
+	assert.Equal(t, 6.0, testutil.ToFloat64(metrics.CapacityGPUs.WithLabelValues("general", "pool-a", "h100", "idle")))
+	assert.Equal(t, 8.0, testutil.ToFloat64(metrics.CapacityGPUs.WithLabelValues("general", "pool-a", "h100", "drained")))
+
+	updateSlurmJobMetrics([]slurm.SlurmJob{
+		{JobID: 1, JobState: "PENDING", Partition: "general", TresReqStr: "gres/gpu=16"},
+		{JobID: 2, JobState: "RUNNING", Partition: "general", TresReqStr: "gres/gpu=2"},
+	})
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.CapacityPendingGPUs))
+	assert.Equal(t, 16.0, testutil.ToFloat64(metrics.CapacityPendingGPUs.WithLabelValues("general")))
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/history"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	// Return the physical node to automatic management once the override expires.
+	MANUAL_OVERRIDE_ON_EXPIRY_REVERT = "Revert"
+	// Keep the override once it expires, and warn about it.
+	MANUAL_OVERRIDE_ON_EXPIRY_ALERT = "Alert"
+)
+
+// ManualOverride is a physical node manually managed instead of by the controller.
+type ManualOverride struct {
+	PhysicalNodeName string     `json:"physicalNodeName"`
+	SlurmNodeName    string     `json:"slurmNodeName,omitempty"`
+	GoalState        string     `json:"goalState"`
+	Reason           string     `json:"reason,omitempty"`
+	Actor            string     `json:"actor,omitempty"`
+	Owner            string     `json:"owner,omitempty"`
+	Ticket           string     `json:"ticket,omitempty"`
+	Notes            string     `json:"notes,omitempty"`
+	Since            time.Time  `json:"since"`
+	Expiration       *time.Time `json:"expiration,omitempty"`
+	OnExpiry         string     `json:"onExpiry"`
+	Expired          bool       `json:"expired"`
+}
+
+type manualOverrideCache struct {
+	sync.RWMutex
+	overrides []ManualOverride
+}
+
+// HandleManualOverrides tracks the manually managed physical nodes and handles expired
+// overrides. With remediate set, expired overrides asking for it are reverted to automatic
+// management, otherwise expired overrides only raise warning events.
+func (r *PhysicalNodeReconciler) HandleManualOverrides(
+	ctx context.Context,
+	socketPath string,
+	slurmNodeMap map[string]*slurm.SlurmNode,
+	existingPhysicalNodeMap map[string]*slonkv1.PhysicalNode,
+	remediate bool,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Started handling manual overrides")
+
+	now := time.Now()
+	overrides := []ManualOverride{}
+	revertCount := 0
+	for _, physicalNode := range existingPhysicalNodeMap {
+		if !physicalNode.Spec.Manual {
+			continue
+		}
+
+		spec := physicalNode.Spec.ManualOverride
+		if spec == nil || spec.StartTimestamp.IsZero() {
+			// Overrides made without the webhook, backfill the start from the goal state.
+			if spec == nil {
+				spec = &slonkv1.ManualOverride{}
+			}
+			spec.StartTimestamp = physicalNode.Spec.SlurmNodeSpec.Timestamp
+			if spec.StartTimestamp.IsZero() {
+				spec.StartTimestamp = metav1.NewTime(now)
+			}
+			if err := r.patchPhysicalNode(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+				physicalNode.Spec.ManualOverride = spec
+			}); err != nil {
+				logger.Info("Failed to backfill manual override", "physical node", physicalNode.Name, "error", err)
+			}
+		}
+
+		override := ManualOverride{
+			PhysicalNodeName: physicalNode.Name,
+			SlurmNodeName:    physicalNode.Status.SlurmNodeStatus.Name,
+			GoalState:        physicalNode.Spec.SlurmNodeSpec.GoalState,
+			Reason:           physicalNode.Spec.SlurmNodeSpec.Reason,
+			Actor:            physicalNode.Spec.SlurmNodeSpec.Actor,
+			Owner:            spec.Owner,
+			Ticket:           spec.Ticket,
+			Notes:            spec.Notes,
+			Since:            spec.StartTimestamp.Time,
+			OnExpiry:         spec.OnExpiry,
+		}
+		if override.OnExpiry == "" {
+			override.OnExpiry = MANUAL_OVERRIDE_ON_EXPIRY_ALERT
+		}
+		if spec.ExpirationTimestamp != nil {
+			expiration := spec.ExpirationTimestamp.Time
+			override.Expiration = &expiration
+			override.Expired = !now.Before(expiration)
+		}
+
+		if override.Expired {
+			reverted, message := false, ""
+			if override.OnExpiry == MANUAL_OVERRIDE_ON_EXPIRY_REVERT && remediate {
+				var err error
+				reverted, message, err = r.revertManualOverride(ctx, socketPath, slurmNodeMap, physicalNode)
+				if err != nil {
+					logger.Info("Failed to revert expired manual override", "physical node", physicalNode.Name, "error", err)
+					message = fmt.Sprintf("Failed to revert: %v.", err)
+				}
+			}
+			if reverted {
+				revertCount++
+				r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_MANUAL_OVERRIDE_REVERT,
+					fmt.Sprintf("Manual override by %q (ticket %q) expired at %s, reverted to automatic management. %s",
+						override.Owner, override.Ticket, override.Expiration.UTC().Format(time.RFC3339), message))
+				continue
+			}
+			if !r.hasRecentEvent(physicalNode.Name, []string{REASON_SLONKLET_MANUAL_OVERRIDE_EXPIRED}, "", RECENT_EVENT_WINDOW) {
+				r.emitEvent(ctx, physicalNode, corev1.EventTypeWarning, REASON_SLONKLET_MANUAL_OVERRIDE_EXPIRED,
+					fmt.Sprintf("Manual override by %q (ticket %q) expired at %s, slurm goal state is still %q. %s",
+						override.Owner, override.Ticket, override.Expiration.UTC().Format(time.RFC3339), override.GoalState, message))
+			}
+		}
+		overrides = append(overrides, override)
+	}
+
+	// Oldest first.
+	sort.Slice(overrides, func(i, j int) bool {
+		if !overrides[i].Since.Equal(overrides[j].Since) {
+			return overrides[i].Since.Before(overrides[j].Since)
+		}
+		return overrides[i].PhysicalNodeName < overrides[j].PhysicalNodeName
+	})
+	r.overrideCache.Lock()
+	r.overrideCache.overrides = overrides
+	r.overrideCache.Unlock()
+
+	logger.Info("Finished handling manual overrides", "overrideCount", len(overrides), "revertCount", revertCount)
+
+	return ctrl.Result{}, nil
+}
+
+// revertManualOverride returns the physical node to automatic management. A slurm node
+// drained by the override is resumed first, otherwise it would be taken as manually
+// drained again. Down goal states are left to a human.
+func (r *PhysicalNodeReconciler) revertManualOverride(
+	ctx context.Context,
+	socketPath string,
+	slurmNodeMap map[string]*slurm.SlurmNode,
+	physicalNode *slonkv1.PhysicalNode,
+) (bool, string, error) {
+	goalState := physicalNode.Spec.SlurmNodeSpec.GoalState
+	message := ""
+	switch goalState {
+	case GoalStateDown:
+		return false, "Down goal states are not reverted automatically.", nil
+	case GoalStateDrain:
+		slurmNodeName := physicalNode.Status.SlurmNodeStatus.Name
+		if slurmNode, ok := slurmNodeMap[slurmNodeName]; ok && isSlurmNodeDrained(slurmNode) {
+			if err := slurm.UpdateSlurmNodeState(socketPath, slurmNodeName, "RESUME", ""); err != nil {
+				return false, "", fmt.Errorf("resume slurm node %s: %w", slurmNodeName, err)
+			}
+			message = fmt.Sprintf("Resumed slurm node %s.", slurmNodeName)
+		}
+	}
+
+	if err := r.patchPhysicalNode(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Spec.Manual = false
+		physicalNode.Spec.ManualOverride = nil
+		if goalState != GoalStateUp {
+			physicalNode.Spec.SlurmNodeSpec = slonkv1.SlurmNodeSpec{
+				GoalState: GoalStateUp,
+				Timestamp: metav1.Now(),
+			}
+		}
+	}); err != nil {
+		return false, "", fmt.Errorf("patch physical node: %w", err)
+	}
+	if goalState != GoalStateUp {
+		r.recordHistory(ctx, physicalNode.Name, history.KIND_SLURM_GOAL_STATE, physicalNode.Spec.SlurmNodeSpec)
+	}
+	return true, message, nil
+}
+
+// ManualOverrides returns the manually managed physical nodes found in the latest
+// iteration, oldest first.
+func (r *PhysicalNodeReconciler) ManualOverrides() []ManualOverride {
+	r.overrideCache.RLock()
+	defer r.overrideCache.RUnlock()
+	return r.overrideCache.overrides
+}
+
+func isSlurmNodeDrained(slurmNode *slurm.SlurmNode) bool {
+	for _, state := range slurmNode.State {
+		if state == "DRAIN" {
+			return true
+		}
+	}
+	return false
+}
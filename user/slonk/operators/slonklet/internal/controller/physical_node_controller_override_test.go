@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestHandleManualOverrides(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	now := time.Now()
+	expired := metav1.NewTime(now.Add(-time.Minute))
+	later := metav1.NewTime(now.Add(time.Hour))
+	newPhysicalNode := func(name string, goalState string, start time.Time, override *slonkv1.ManualOverride) *slonkv1.PhysicalNode {
+		if override != nil {
+			override.StartTimestamp = metav1.NewTime(start)
+		}
+		return &slonkv1.PhysicalNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: SLURM_NAMESPACE},
+			Spec: slonkv1.PhysicalNodeSpec{
+				SlurmNodeSpec:  slonkv1.SlurmNodeSpec{GoalState: goalState, Reason: "bad gpu", Timestamp: metav1.NewTime(start)},
+				K8sNodeSpec:    slonkv1.K8sNodeSpec{GoalState: GoalStateUp},
+				Manual:         override != nil || name == "legacy",
+				ManualOverride: override,
+			},
+		}
+	}
+	physicalNodes := []*slonkv1.PhysicalNode{
+		// Expired, reverted.
+		newPhysicalNode("revert", GoalStateUp, now.Add(-2*time.Hour), &slonkv1.ManualOverride{
+			Owner: "alice", ExpirationTimestamp: &expired, OnExpiry: MANUAL_OVERRIDE_ON_EXPIRY_REVERT,
+		}),
+		// Expired, alerted.
+		newPhysicalNode("alert", GoalStateDrain, now.Add(-3*time.Hour), &slonkv1.ManualOverride{
+			Owner: "bob", Ticket: "INC-1", ExpirationTimestamp: &expired,
+		}),
+		// Active.
+		newPhysicalNode("active", GoalStateDrain, now.Add(-time.Hour), &slonkv1.ManualOverride{
+			Owner: "carol", ExpirationTimestamp: &later, OnExpiry: MANUAL_OVERRIDE_ON_EXPIRY_REVERT,
+		}),
+		// Set before overrides had details.
+		newPhysicalNode("legacy", GoalStateDrain, now.Add(-24*time.Hour), nil),
+		// Not overridden.
+		newPhysicalNode("auto", GoalStateUp, now, nil),
+	}
+	objects := []runtime.Object{}
+	for _, physicalNode := range physicalNodes {
+		objects = append(objects, physicalNode)
+	}
+
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(objects...).
+		Build()
+	recorder := events.NewFakeRecorder(10)
+	r := &PhysicalNodeReconciler{
+		Client:   fakeClient,
+		Recorder: recorder,
+		Scheme:   scheme.Scheme,
+	}
+	getPhysicalNode := func(name string) *slonkv1.PhysicalNode {
+		physicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: SLURM_NAMESPACE}, physicalNode))
+		return physicalNode
+	}
+	handle := func() {
+		existingPhysicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+		for _, physicalNode := range physicalNodes {
+			existingPhysicalNodeMap[physicalNode.Name] = getPhysicalNode(physicalNode.Name)
+		}
+		_, err := r.HandleManualOverrides(context.Background(), "", map[string]*slurm.SlurmNode{}, existingPhysicalNodeMap, true)
+		assert.NoError(t, err)
+	}
+
+	handle()
+
+	// The reverted node is back to automatic management.
+	reverted := getPhysicalNode("revert")
+	assert.False(t, reverted.Spec.Manual)
+	assert.Nil(t, reverted.Spec.ManualOverride)
+	assert.Equal(t, GoalStateUp, reverted.Spec.SlurmNodeSpec.GoalState)
+
+	// The others are listed oldest first, with the legacy override backfilled.
+	overrides := r.ManualOverrides()
+	assert.Equal(t, 3, len(overrides))
+	assert.Equal(t, "legacy", overrides[0].PhysicalNodeName)
+	assert.Equal(t, "alert", overrides[1].PhysicalNodeName)
+	assert.True(t, overrides[1].Expired)
+	assert.Equal(t, MANUAL_OVERRIDE_ON_EXPIRY_ALERT, overrides[1].OnExpiry)
+	assert.Equal(t, "active", overrides[2].PhysicalNodeName)
+	assert.False(t, overrides[2].Expired)
+	legacy := getPhysicalNode("legacy")
+	assert.NotNil(t, legacy.Spec.ManualOverride)
+	assert.Equal(t, now.Add(-24*time.Hour).Unix(), legacy.Spec.ManualOverride.StartTimestamp.Unix())
+
+	assert.Equal(t, 2, len(recorder.Events))
+	emitted := []string{<-recorder.Events, <-recorder.Events}
+	assert.Contains(t, emitted, "Normal "+REASON_SLONKLET_MANUAL_OVERRIDE_REVERT+" Manual override by \"alice\" (ticket \"\") expired at "+
+		expired.UTC().Format(time.RFC3339)+", reverted to automatic management. ")
+	assert.Contains(t, emitted[0]+emitted[1], "Warning "+REASON_SLONKLET_MANUAL_OVERRIDE_EXPIRED)
+
+	// The expired override keeps alerting, but not on every iteration.
+	handle()
+	assert.Equal(t, 0, len(recorder.Events))
+	assert.True(t, r.hasRecentEvent("alert", []string{REASON_SLONKLET_MANUAL_OVERRIDE_EXPIRED}, "INC-1", RECENT_EVENT_WINDOW))
+}
@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/tools"
+)
+
+const (
+	// Set on a physical node to approve a high-risk remediation action. The value is
+	// either the action type, e.g. "K8sNodeDelete", or "all". It is removed once an
+	// approved action was executed.
+	REMEDIATION_APPROVAL_ANNOTATION = "slonk.your-org.com/remediation-approved"
+	REMEDIATION_APPROVAL_ALL        = "all"
+
+	OUTCOME_PLANNED          = "Planned"
+	OUTCOME_EXECUTED         = "Executed"
+	OUTCOME_FAILED           = "Failed"
+	OUTCOME_SKIPPED          = "Skipped"
+	OUTCOME_PENDING_APPROVAL = "PendingApproval"
+	OUTCOME_BUDGET_EXHAUSTED = "BudgetExhausted"
+	OUTCOME_DRYRUN           = "Dryrun"
+	OUTCOME_IN_PROGRESS      = "InProgress"
+)
+
+// RemediationAction is a single step decided by the remediation planner.
+type RemediationAction struct {
+	Type             string       `json:"type"`
+	PhysicalNodeName string       `json:"physicalNodeName"`
+	K8sNodeName      string       `json:"k8sNodeName"`
+	SlurmPodName     string       `json:"slurmPodName,omitempty"`
+	Taint            corev1.Taint `json:"taint"`
+
+	// Human readable explanation of why the action was chosen.
+	Rationale string `json:"rationale"`
+	// Observed values that led to the decision.
+	Inputs map[string]string `json:"inputs,omitempty"`
+
+	HighRisk bool   `json:"highRisk,omitempty"`
+	Outcome  string `json:"outcome,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// IsDisruptive returns whether executing the action removes pods or nodes.
+func (a *RemediationAction) IsDisruptive() bool {
+	return a.Type != ACTION_SLURM_POD_KEEP && a.Type != ACTION_K8S_NODE_KEEP
+}
+
+func (a *RemediationAction) taintString() string {
+	return fmt.Sprintf("%s:%s", a.Taint.Key, a.Taint.Value)
+}
+
+// RemediationPlan is the result of one remediation iteration.
+type RemediationPlan struct {
+	Timestamp time.Time           `json:"timestamp"`
+	Dryrun    bool                `json:"dryrun"`
+	Actions   []RemediationAction `json:"actions"`
+}
+
+type remediationPlanCache struct {
+	sync.RWMutex
+	plan *RemediationPlan
+}
+
+// PlanRemediation decides the remediation action for every k8s node with a lifecycle
+// taint. It doesn't modify any object, the returned actions are executed separately.
+func (r *PhysicalNodeReconciler) PlanRemediation(
+	ctx context.Context,
+	slurmNodeMap map[string]*slurm.SlurmNode,
+	k8sNodeMap map[string]*corev1.Node,
+	existingPhysicalNodeMap map[string]*slonkv1.PhysicalNode,
+	podLists map[string]corev1.PodList,
+	now time.Time,
+) []RemediationAction {
+	logger := log.FromContext(ctx)
+
+	actions := []RemediationAction{}
+	for _, k8sNode := range k8sNodeMap {
+		// Only proceeed if the k8s node has a lifecycle taint.
+		lifecycleTaint := getLifecycleTaint(k8sNode)
+		if lifecycleTaint == nil {
+			continue
+		}
+
+		// Find the physical node corresponding to the k8s node.
+		physicalNodeName, err := r.getPhysicalNodeName(k8sNode, IDENTIFIER_GPU_UUID_HASH)
+		if err != nil || physicalNodeName == "" {
+			if !strings.Contains(k8sNode.Name, "cpu") {
+				logger.Info("No physical host name found for k8s node", "name", k8sNode.Name)
+			}
+			continue
+		}
+		physicalNode, ok := existingPhysicalNodeMap[physicalNodeName]
+		if !ok {
+			logger.Info("Physical node not found for k8s node", "name", k8sNode.Name, "physical node", physicalNodeName)
+			continue
+		}
+
+		action := RemediationAction{
+			PhysicalNodeName: physicalNodeName,
+			K8sNodeName:      k8sNode.Name,
+			Taint:            *lifecycleTaint,
+			Outcome:          OUTCOME_PLANNED,
+			Inputs: map[string]string{
+				"taint":            fmt.Sprintf("%s:%s", lifecycleTaint.Key, lifecycleTaint.Value),
+				"slurmGoalState":   physicalNode.Spec.SlurmNodeSpec.GoalState,
+				"k8sUnschedulable": fmt.Sprintf("%t", k8sNode.Spec.Unschedulable),
+			},
+		}
+
+		// Check if there are running pods. Don't delete the node if there are still running pods on it.
+		// Also wait for a while before deleting the pods if they are already in drain/down state in slurm as intended.
+		hasPods := false
+		for _, podList := range podLists {
+			for _, pod := range podList.Items {
+				if pod.Spec.NodeName != k8sNode.Name || tools.IsDaemonSetOrMirrorPod(&pod) {
+					continue
+				}
+				hasPods = true
+
+				slurmNode, ok := slurmNodeMap[pod.Name]
+				if !ok {
+					continue
+				}
+				action.SlurmPodName = pod.Name
+				action.Inputs["slurmState"] = strings.Join(slurmNode.State, ",")
+				if pod.Status.StartTime != nil {
+					action.Inputs["slurmPodAge"] = now.Sub(pod.Status.StartTime.Time).Round(time.Second).String()
+				}
+
+				if lifecycleTaint.Key == SLURM_TAINT_GOAL_STATE {
+					for _, state := range slurmNode.State {
+						if ((strings.EqualFold(state, "DOWN") && physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateDown) ||
+							(strings.EqualFold(state, "DRAIN") && physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateDrain)) &&
+							(pod.Status.StartTime != nil && now.Sub(pod.Status.StartTime.Time) < time.Minute*5) {
+							action.Type = ACTION_SLURM_POD_KEEP
+							action.Rationale = "Slurm node already reached its goal state and the slurm pod started recently, keeping it for a while"
+							break
+						}
+					}
+					if action.Type == "" {
+						action.Type = ACTION_SLURM_POD_DELETE
+						action.Rationale = "K8s node is tainted for slurm goal state, deleting slurm pod"
+					}
+				} else if lifecycleTaint.Key == SLURM_TAINT_ACTION_QUIT {
+					action.Type = ACTION_SLURM_POD_RESTART
+					action.Rationale = "K8s node is tainted to quit slurmd, restarting slurm pod"
+				} else if lifecycleTaint.Key == SLURM_TAINT_ACTION_REBOOT {
+					action.Type = ACTION_SLURM_NODE_REBOOT
+					action.Rationale = "K8s node is tainted for reboot, draining the slurm node and rebooting the host"
+				} else if lifecycleTaint.Key == SLURM_TAINT_ACTION_MANUAL ||
+					lifecycleTaint.Key == SLURM_TAINT_ACTION_RMA {
+					action.Type = ACTION_SLURM_POD_DELETE
+					action.Rationale = "K8s node is tainted for a lifecycle action, deleting slurm pod"
+				} else if lifecycleTaint.Key == GCP_MAINTENANCE_STARTED ||
+					lifecycleTaint.Key == GCP_MAINTENANCE_IMPENDING_TERMINATION {
+					action.Type = ACTION_K8S_NODE_KEEP
+					action.Rationale = "K8s node has a GCP maintenance taint, slurm node is drained for maintenance, keeping slurm pod"
+				} else {
+					action.Type = ACTION_SLURM_POD_DELETE
+					action.Rationale = "K8s node has an unknown lifecycle taint, deleting slurm pod"
+				}
+				break
+			}
+			if action.Type != "" {
+				break
+			}
+		}
+		action.Inputs["hasPods"] = fmt.Sprintf("%t", hasPods)
+
+		if action.Type == "" {
+			nodeAge := now.Sub(k8sNode.CreationTimestamp.Time)
+			action.Inputs["k8sNodeAge"] = nodeAge.Round(time.Second).String()
+			reboot := physicalNode.Status.Reboot
+			if lifecycleTaint.Key == SLURM_TAINT_ACTION_QUIT {
+				// TODO (yiran): this is special case for a corner case.
+				action.Type = ACTION_SLURM_POD_RESTART
+				action.Rationale = "Slurm pod was already deleted, untainting k8s node"
+			} else if lifecycleTaint.Key == SLURM_TAINT_ACTION_REBOOT && reboot != nil &&
+				(reboot.Phase == REBOOT_PHASE_REQUESTED || reboot.Phase == REBOOT_PHASE_REBOOTED) {
+				// The slurm pod is gone while the host reboots.
+				action.Type = ACTION_SLURM_NODE_REBOOT
+				action.SlurmPodName = reboot.SlurmNodeName
+				action.Rationale = "Host is rebooting, waiting for the slurm node to come back"
+			} else if hasPods || !k8sNode.Spec.Unschedulable {
+				action.Type = ACTION_K8S_NODE_DRAIN
+				action.Rationale = "K8s node with lifecycle taint still has pods or is schedulable, draining it"
+			} else if nodeAge < time.Minute*15 {
+				action.Type = ACTION_K8S_NODE_KEEP
+				action.Rationale = "K8s node with lifecycle taint was created recently, keeping it for a while"
+			} else {
+				action.Type = ACTION_K8S_NODE_DELETE
+				action.Rationale = "K8s node with lifecycle taint is drained, deleting it"
+			}
+		}
+
+		actions = append(actions, action)
+	}
+
+	// Keep the plan stable across iterations.
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].K8sNodeName < actions[j].K8sNodeName
+	})
+
+	disruptiveCount := 0
+	for _, action := range actions {
+		if action.IsDisruptive() {
+			disruptiveCount++
+		}
+	}
+	for i := range actions {
+		if !actions[i].IsDisruptive() {
+			continue
+		}
+		if r.ApprovalRequiredActions[actions[i].Type] ||
+			(r.ApprovalThreshold > 0 && disruptiveCount > r.ApprovalThreshold) {
+			actions[i].HighRisk = true
+		}
+	}
+
+	return actions
+}
+
+// isRemediationApproved returns whether a high-risk action was approved by annotation on
+// the physical node. Only operators allowed to write physical nodes can approve actions.
+func (r *PhysicalNodeReconciler) isRemediationApproved(
+	physicalNode *slonkv1.PhysicalNode,
+	action *RemediationAction,
+) bool {
+	value, ok := physicalNode.Annotations[REMEDIATION_APPROVAL_ANNOTATION]
+	return ok && (value == REMEDIATION_APPROVAL_ALL || value == action.Type)
+}
+
+// consumeRemediationApproval removes the approval annotation once the approved action
+// was executed, so that an approval doesn't also approve later actions on the same node.
+func (r *PhysicalNodeReconciler) consumeRemediationApproval(ctx context.Context, physicalNode *slonkv1.PhysicalNode) {
+	if _, ok := physicalNode.Annotations[REMEDIATION_APPROVAL_ANNOTATION]; !ok {
+		return
+	}
+	if err := r.patchPhysicalNode(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+		delete(physicalNode.Annotations, REMEDIATION_APPROVAL_ANNOTATION)
+	}); err != nil {
+		// Log and retry after the next execution, the action is idempotent.
+		log.FromContext(ctx).Info("Failed to consume remediation approval", "physical node", physicalNode.Name, "error", err)
+	}
+}
+
+// RemediationPlan returns the plan of the last remediation iteration, or nil.
+func (r *PhysicalNodeReconciler) RemediationPlan() *RemediationPlan {
+	r.planCache.RLock()
+	defer r.planCache.RUnlock()
+	return r.planCache.plan
+}
+
+func (r *PhysicalNodeReconciler) setRemediationPlan(plan *RemediationPlan) {
+	r.planCache.Lock()
+	defer r.planCache.Unlock()
+	r.planCache.plan = plan
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestPlanRemediation(t *testing.T) {
+	setupTest(t)
+
+	now := time.Now()
+	goalStateTaint := corev1.Taint{Key: SLURM_TAINT_GOAL_STATE, Value: GoalStateDown, Effect: corev1.TaintEffectNoSchedule}
+	k8sNodeMap := map[string]*corev1.Node{}
+	for _, obj := range testNodes {
+		node := obj.(*corev1.Node).DeepCopy()
+		node.Spec.Taints = []corev1.Taint{goalStateTaint}
+		k8sNodeMap[node.Name] = node
+	}
+	// The second node has no pods left, is cordoned and old enough to be deleted.
+	k8sNodeMap["k8s-node-2"].Spec.Unschedulable = true
+	k8sNodeMap["k8s-node-2"].CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+
+	podLists := map[string]corev1.PodList{
+		SLURM_NAMESPACE: {Items: []corev1.Pod{*testPods[0].(*corev1.Pod)}},
+	}
+	slurmNodeMap := map[string]*slurm.SlurmNode{
+		"slurm-node-1": {Name: "slurm-node-1", State: []string{"IDLE"}},
+	}
+	physicalNodeMap := map[string]*slonkv1.PhysicalNode{
+		"cba": {ObjectMeta: metav1.ObjectMeta{Name: "cba"}},
+		"fed": {ObjectMeta: metav1.ObjectMeta{Name: "fed"}},
+	}
+
+	r := &PhysicalNodeReconciler{
+		ApprovalRequiredActions: map[string]bool{ACTION_K8S_NODE_DELETE: true},
+	}
+	actions := r.PlanRemediation(context.Background(), slurmNodeMap, k8sNodeMap, physicalNodeMap, podLists, now)
+	assert.Equal(t, 2, len(actions))
+	assert.Equal(t, ACTION_SLURM_POD_DELETE, actions[0].Type)
+	assert.Equal(t, "slurm-node-1", actions[0].SlurmPodName)
+	assert.Equal(t, "IDLE", actions[0].Inputs["slurmState"])
+	assert.False(t, actions[0].HighRisk)
+	assert.Equal(t, ACTION_K8S_NODE_DELETE, actions[1].Type)
+	assert.Equal(t, "fed", actions[1].PhysicalNodeName)
+	assert.True(t, actions[1].HighRisk)
+	assert.NotEmpty(t, actions[1].Rationale)
+
+	// Plans larger than the threshold need approval for every disruptive action.
+	r = &PhysicalNodeReconciler{ApprovalThreshold: 1}
+	actions = r.PlanRemediation(context.Background(), slurmNodeMap, k8sNodeMap, physicalNodeMap, podLists, now)
+	assert.True(t, actions[0].HighRisk)
+	assert.True(t, actions[1].HighRisk)
+}
+
+func TestAutoRemediateApproval(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	k8sNode := testNodes[1].(*corev1.Node).DeepCopy()
+	k8sNode.Spec.Unschedulable = true
+	k8sNode.Spec.Taints = []corev1.Taint{{Key: SLURM_TAINT_ACTION_RMA, Value: "true", Effect: corev1.TaintEffectNoSchedule}}
+	k8sNode.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "fed", Namespace: SLURM_NAMESPACE},
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, physicalNode).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client:                  fakeClient,
+		Recorder:                &events.FakeRecorder{},
+		Scheme:                  scheme.Scheme,
+		ApprovalRequiredActions: map[string]bool{ACTION_K8S_NODE_DELETE: true},
+	}
+	k8sNodeMap := map[string]*corev1.Node{k8sNode.Name: k8sNode}
+
+	// Without approval the k8s node is kept.
+	_, err := r.AutoRemediate(context.Background(), "", map[string]*slurm.SlurmNode{}, k8sNodeMap,
+		map[string]*slonkv1.PhysicalNode{"fed": physicalNode}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_PENDING_APPROVAL, r.RemediationPlan().Actions[0].Outcome)
+	nodes := &corev1.NodeList{}
+	assert.NoError(t, fakeClient.List(context.Background(), nodes))
+	assert.Equal(t, 1, len(nodes.Items))
+
+	// Approve by annotation.
+	physicalNode.Annotations = map[string]string{REMEDIATION_APPROVAL_ANNOTATION: ACTION_K8S_NODE_DELETE}
+	assert.NoError(t, fakeClient.Update(context.Background(), physicalNode))
+	_, err = r.AutoRemediate(context.Background(), "", map[string]*slurm.SlurmNode{}, k8sNodeMap,
+		map[string]*slonkv1.PhysicalNode{"fed": physicalNode}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_EXECUTED, r.RemediationPlan().Actions[0].Outcome)
+	nodes = &corev1.NodeList{}
+	assert.NoError(t, fakeClient.List(context.Background(), nodes))
+	assert.Equal(t, 0, len(nodes.Items))
+
+	// The approval is single use.
+	updatedPhysicalNode := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "fed", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+	assert.NotContains(t, updatedPhysicalNode.Annotations, REMEDIATION_APPROVAL_ANNOTATION)
+}
+
+func TestAutoRemediateReportsFailedActions(t *testing.T) {
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	k8sNode := testNodes[1].(*corev1.Node).DeepCopy()
+	k8sNode.Spec.Unschedulable = true
+	k8sNode.Spec.Taints = []corev1.Taint{{Key: SLURM_TAINT_ACTION_RMA, Value: "true", Effect: corev1.TaintEffectNoSchedule}}
+	k8sNode.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "fed", Namespace: SLURM_NAMESPACE},
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, physicalNode).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Delete: func(ctx context.Context, cli client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				return fmt.Errorf("etcdserver: request timed out")
+			},
+		}).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client:   fakeClient,
+		Recorder: &events.FakeRecorder{},
+		Scheme:   scheme.Scheme,
+	}
+
+	_, err := r.AutoRemediate(context.Background(), "", map[string]*slurm.SlurmNode{},
+		map[string]*corev1.Node{k8sNode.Name: k8sNode}, map[string]*slonkv1.PhysicalNode{"fed": physicalNode}, false)
+	assert.NoError(t, err)
+	action := r.RemediationPlan().Actions[0]
+	assert.Equal(t, ACTION_K8S_NODE_DELETE, action.Type)
+	assert.Equal(t, OUTCOME_FAILED, action.Outcome)
+	assert.Contains(t, action.Message, "delete k8s node")
+}
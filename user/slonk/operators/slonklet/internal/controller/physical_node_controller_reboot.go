@@ -0,0 +1,328 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/tools"
+)
+
+const (
+	REBOOT_METHOD_AUTO     = "auto"
+	REBOOT_METHOD_SCONTROL = "scontrol"
+	REBOOT_METHOD_AGENT    = "agent"
+
+	REBOOT_PHASE_REQUESTED = "Requested"
+	REBOOT_PHASE_REBOOTED  = "Rebooted"
+	REBOOT_PHASE_COMPLETED = "Completed"
+	REBOOT_PHASE_FAILED    = "Failed"
+
+	DEFAULT_REBOOT_TIMEOUT       = 30 * time.Minute
+	DEFAULT_AGENT_REBOOT_COMMAND = "systemctl reboot"
+	MAX_REBOOT_ATTEMPTS          = 2
+	AGENT_REQUEST_TIMEOUT        = 10 * time.Second
+)
+
+// rebootSlurmNode reboots the host of a k8s node with a reboot taint. The slurm node is
+// drained first and its jobs are waited for, then the reboot is requested from slurm, or
+// from the node-local slonklet agent if slurm can't reach the node. The reboot is complete
+// once the slurm node reports a new boot time and is healthy again, at which point the
+// taint is removed. Progress is recorded in the physical node status. Returns whether the
+// reboot completed.
+func (r *PhysicalNodeReconciler) rebootSlurmNode(
+	ctx context.Context,
+	socketPath string,
+	action *RemediationAction,
+	k8sNode *corev1.Node,
+	physicalNode *slonkv1.PhysicalNode,
+	slurmNode *slurm.SlurmNode,
+	slurmJobs []slurm.SlurmJob,
+	now time.Time,
+) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	reboot := physicalNode.Status.Reboot.DeepCopy()
+	if reboot == nil || reboot.Phase == REBOOT_PHASE_COMPLETED ||
+		(reboot.Phase == REBOOT_PHASE_FAILED && reboot.Attempts < MAX_REBOOT_ATTEMPTS) {
+		if slurmNode != nil {
+			done, err := r.drainSlurmNode(ctx, socketPath, action, physicalNode, slurmNode, slurmJobs, now)
+			if err != nil || !done {
+				return false, err
+			}
+		}
+
+		attempts := 0
+		if reboot != nil && reboot.Phase == REBOOT_PHASE_FAILED {
+			attempts = reboot.Attempts
+		}
+		reason := slonkletDrainReason(action)
+		method, taskID, err := r.requestReboot(ctx, action, k8sNode, slurmNode, reason)
+		if err != nil {
+			return false, fmt.Errorf("request reboot: %w", err)
+		}
+		reboot = &slonkv1.RebootStatus{
+			Phase:            REBOOT_PHASE_REQUESTED,
+			Method:           method,
+			SlurmNodeName:    action.SlurmPodName,
+			AgentTaskID:      taskID,
+			Attempts:         attempts + 1,
+			Message:          fmt.Sprintf("reboot requested through %s", method),
+			RequestTimestamp: metav1.NewTime(now),
+		}
+		if slurmNode != nil {
+			reboot.PreviousBootTime = int64(slurmNode.BootTime.Number)
+		}
+		logger.Info("Requested host reboot",
+			"method", method,
+			"attempt", reboot.Attempts,
+			"agent task", taskID,
+			"slurm node", action.SlurmPodName,
+			"k8s node", action.K8sNodeName,
+			"physical node", physicalNode.Name,
+		)
+
+		if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+			physicalNode.Status.Reboot = reboot
+		}); err != nil {
+			return false, fmt.Errorf("update physical node reboot status: %w", err)
+		}
+		message := fmt.Sprintf(
+			"Auto requested reboot of slurm node %s through %s for lifecycle taint %s. K8s node: %s. Physical node: %s.",
+			action.SlurmPodName,
+			method,
+			action.taintString(),
+			action.K8sNodeName,
+			physicalNode.Name)
+		r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_AUTO_REBOOT, message)
+		return false, nil
+	}
+
+	if reboot.Phase == REBOOT_PHASE_FAILED {
+		return false, fmt.Errorf("host didn't come back healthy after %d reboots: %s", reboot.Attempts, reboot.Message)
+	}
+
+	if slurmNode != nil && int64(slurmNode.BootTime.Number) > reboot.PreviousBootTime {
+		reboot.Phase = REBOOT_PHASE_REBOOTED
+		reboot.BootTime = int64(slurmNode.BootTime.Number)
+		reboot.Message = fmt.Sprintf("host booted, slurm node is %s", strings.Join(slurmNode.State, ","))
+
+		if isSlurmNodeHealthy(slurmNode) {
+			if _, err := tools.MaybeRemoveTaintFromNode(ctx, r.Client, k8sNode.DeepCopy(), action.Taint); err != nil {
+				return false, fmt.Errorf("remove reboot taint: %w", err)
+			}
+			completion := metav1.NewTime(now)
+			reboot.Phase = REBOOT_PHASE_COMPLETED
+			reboot.Message = "host rebooted and healthy"
+			reboot.CompletionTimestamp = &completion
+			if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+				physicalNode.Status.Reboot = reboot
+			}); err != nil {
+				return false, fmt.Errorf("update physical node reboot status: %w", err)
+			}
+			message := fmt.Sprintf(
+				"Auto rebooted slurm node %s and untainted k8s node %s. Lifecycle taint %s. Physical node: %s.",
+				reboot.SlurmNodeName,
+				action.K8sNodeName,
+				action.taintString(),
+				physicalNode.Name)
+			r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_AUTO_REBOOT, message)
+			return true, nil
+		}
+
+		// Slurm only resumes nodes rebooted through scontrol. Nodes rebooted by the agent
+		// come back drained, or down as unexpectedly rebooted.
+		if !isSlurmNodeNotResponding(slurmNode) && isSlurmNodeDrainedOrDown(slurmNode) &&
+			physicalNode.Spec.SlurmNodeSpec.GoalState == GoalStateUp && !physicalNode.Spec.Manual {
+			if err := slurm.UpdateSlurmNodeState(socketPath, reboot.SlurmNodeName, "RESUME", ""); err != nil {
+				logger.Info("Failed to resume slurm node after reboot", "slurm node", reboot.SlurmNodeName, "physical node", physicalNode.Name, "error", err)
+			} else {
+				reboot.Message = "host booted, resumed slurm node"
+			}
+		}
+	}
+
+	if now.Sub(reboot.RequestTimestamp.Time) > r.rebootTimeout() {
+		completion := metav1.NewTime(now)
+		reboot.Phase = REBOOT_PHASE_FAILED
+		reboot.Message = fmt.Sprintf("timed out after %s, %s", r.rebootTimeout(), reboot.Message)
+		reboot.CompletionTimestamp = &completion
+		message := fmt.Sprintf(
+			"Reboot %d of slurm node %s didn't complete: %s. K8s node: %s. Physical node: %s.",
+			reboot.Attempts,
+			reboot.SlurmNodeName,
+			reboot.Message,
+			action.K8sNodeName,
+			physicalNode.Name)
+		r.emitEvent(ctx, physicalNode, corev1.EventTypeWarning, REASON_SLONKLET_AUTO_REBOOT_FAILED, message)
+	}
+
+	logger.Info("Host reboot progress",
+		"phase", reboot.Phase,
+		"message", reboot.Message,
+		"boot time", reboot.BootTime,
+		"slurm node", reboot.SlurmNodeName,
+		"physical node", physicalNode.Name,
+	)
+
+	if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Status.Reboot = reboot
+	}); err != nil {
+		return false, fmt.Errorf("update physical node reboot status: %w", err)
+	}
+	return false, nil
+}
+
+// requestReboot asks slurm or the node-local agent to reboot the host. Returns the method
+// used and the agent task ID, if any.
+func (r *PhysicalNodeReconciler) requestReboot(
+	ctx context.Context,
+	action *RemediationAction,
+	k8sNode *corev1.Node,
+	slurmNode *slurm.SlurmNode,
+	reason string,
+) (string, string, error) {
+	method := r.RebootMethod
+	if method == "" || method == REBOOT_METHOD_AUTO {
+		method = REBOOT_METHOD_SCONTROL
+		if slurmNode == nil || isSlurmNodeNotResponding(slurmNode) {
+			method = REBOOT_METHOD_AGENT
+		}
+	}
+
+	switch method {
+	case REBOOT_METHOD_SCONTROL:
+		if slurmNode == nil {
+			return method, "", fmt.Errorf("slurm node %q not found", action.SlurmPodName)
+		}
+		if err := slurm.RebootSlurmNode(slurmNode.Name, reason); err != nil {
+			return method, "", err
+		}
+		return method, "", nil
+	case REBOOT_METHOD_AGENT:
+		if r.AgentPort == 0 {
+			return method, "", fmt.Errorf("no agent port configured")
+		}
+		address := getK8sNodeInternalIP(k8sNode)
+		if address == "" {
+			return method, "", fmt.Errorf("k8s node %s has no internal IP", k8sNode.Name)
+		}
+		command := r.AgentRebootCommand
+		if command == "" {
+			command = DEFAULT_AGENT_REBOOT_COMMAND
+		}
+		taskID, err := enqueueAgentCommand(ctx, net.JoinHostPort(address, strconv.Itoa(r.AgentPort)), command)
+		if err != nil {
+			return method, "", err
+		}
+		return method, taskID, nil
+	default:
+		return method, "", fmt.Errorf("unknown reboot method %s", method)
+	}
+}
+
+func (r *PhysicalNodeReconciler) rebootTimeout() time.Duration {
+	if r.RebootTimeout > 0 {
+		return r.RebootTimeout
+	}
+	return DEFAULT_REBOOT_TIMEOUT
+}
+
+// enqueueAgentCommand enqueues a shell command on the slonklet agent at the address and
+// returns its task ID.
+func enqueueAgentCommand(ctx context.Context, address string, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, AGENT_REQUEST_TIMEOUT)
+	defer cancel()
+
+	requestURL := fmt.Sprintf("http://%s/job/enqueue/command?command=%s", address, url.QueryEscape(command))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create agent request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send agent request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read agent response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("agent responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// getAgentTaskState returns the state of a task on the slonklet agent at the address, e.g.
+// "running" or "succeeded". Tasks unknown to the agent return os.ErrNotExist.
+func getAgentTaskState(ctx context.Context, address string, taskID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, AGENT_REQUEST_TIMEOUT)
+	defer cancel()
+
+	requestURL := fmt.Sprintf("http://%s/job/state?id=%s", address, url.QueryEscape(taskID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create agent request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send agent request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read agent response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("agent responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func getK8sNodeInternalIP(k8sNode *corev1.Node) string {
+	for _, address := range k8sNode.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			return address.Address
+		}
+	}
+	return ""
+}
+
+func isSlurmNodeNotResponding(slurmNode *slurm.SlurmNode) bool {
+	for _, state := range slurmNode.State {
+		if strings.EqualFold(state, "NOT_RESPONDING") {
+			return true
+		}
+	}
+	return false
+}
+
+// isSlurmNodeHealthy returns whether the slurm node accepts jobs again.
+func isSlurmNodeHealthy(slurmNode *slurm.SlurmNode) bool {
+	for _, state := range slurmNode.State {
+		switch strings.ToUpper(state) {
+		case "DOWN", "DRAIN", "FAIL", "NOT_RESPONDING", "REBOOT_REQUESTED", "REBOOT_ISSUED":
+			return false
+		}
+	}
+	return true
+}
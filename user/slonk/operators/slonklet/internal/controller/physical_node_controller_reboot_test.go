@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestAutoRemediateRebootsThroughAgent(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	commands := []string{}
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/job/enqueue/command", r.URL.Path)
+		commands = append(commands, r.URL.Query().Get("command"))
+		w.Write([]byte("task-1"))
+	}))
+	defer agent.Close()
+	agentURL, err := url.Parse(agent.URL)
+	assert.NoError(t, err)
+	agentPort, err := strconv.Atoi(agentURL.Port())
+	assert.NoError(t, err)
+
+	rebootTaint := corev1.Taint{Key: SLURM_TAINT_ACTION_REBOOT, Value: "xid", Effect: corev1.TaintEffectNoSchedule}
+	k8sNode := testNodes[0].(*corev1.Node).DeepCopy()
+	k8sNode.Spec.Taints = []corev1.Taint{rebootTaint}
+	k8sNode.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: agentURL.Hostname()}}
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "cba", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: GoalStateUp},
+		},
+	}
+
+	testData := slurm.SlurmResponse{
+		Nodes: []slurm.SlurmNode{
+			{Name: "slurm-node-1", State: []string{"IDLE"}, BootTime: slurm.FlagType{Number: 100, Set: true}},
+		},
+		Jobs: []slurm.SlurmJob{
+			{JobID: 2, JobState: "RUNNING", Partition: "dev", Nodes: "slurm-node-2"},
+		},
+	}
+
+	// Start the test slurmrestd server.
+	socketPath := "/tmp/test.sock"
+	cleanup, err := slurm.StartTestSlurmRestD(socketPath, testData)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, testPods[0], physicalNode).
+		WithStatusSubresource(physicalNode).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client:       fakeClient,
+		Recorder:     &events.FakeRecorder{},
+		Scheme:       scheme.Scheme,
+		RebootMethod: REBOOT_METHOD_AGENT,
+		AgentPort:    agentPort,
+	}
+	k8sNodeMap := map[string]*corev1.Node{k8sNode.Name: k8sNode}
+	getPhysicalNodeMap := func() map[string]*slonkv1.PhysicalNode {
+		updatedPhysicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+		return map[string]*slonkv1.PhysicalNode{"cba": updatedPhysicalNode}
+	}
+
+	// The idle slurm node is drained and the agent is asked to reboot the host.
+	slurmNodeMap := map[string]*slurm.SlurmNode{"slurm-node-1": &testData.Nodes[0]}
+	_, err = r.AutoRemediate(context.Background(), socketPath, slurmNodeMap, k8sNodeMap, getPhysicalNodeMap(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, ACTION_SLURM_NODE_REBOOT, r.RemediationPlan().Actions[0].Type)
+	assert.Equal(t, OUTCOME_IN_PROGRESS, r.RemediationPlan().Actions[0].Outcome)
+	assert.Equal(t, []string{DEFAULT_AGENT_REBOOT_COMMAND}, commands)
+
+	slurmNodes, err := slurm.ListSlurmNodes(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DRAIN"}, slurmNodes[0].State)
+	assert.Equal(t, "slonklet: "+SLURM_TAINT_ACTION_REBOOT+":xid", slurmNodes[0].Reason)
+	assert.True(t, IsAutomaticSlurmDrainReason(slurmNodes[0].Reason))
+
+	reboot := getPhysicalNodeMap()["cba"].Status.Reboot
+	assert.NotNil(t, reboot)
+	assert.Equal(t, REBOOT_PHASE_REQUESTED, reboot.Phase)
+	assert.Equal(t, REBOOT_METHOD_AGENT, reboot.Method)
+	assert.Equal(t, "task-1", reboot.AgentTaskID)
+	assert.Equal(t, int64(100), reboot.PreviousBootTime)
+	assert.Equal(t, 1, reboot.Attempts)
+
+	// The host is still rebooting, nothing else is requested.
+	_, err = r.AutoRemediate(context.Background(), socketPath, slurmNodeMap, k8sNodeMap, getPhysicalNodeMap(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_IN_PROGRESS, r.RemediationPlan().Actions[0].Outcome)
+	assert.Equal(t, 1, len(commands))
+
+	// The host came back with a new boot time, the drained slurm node is resumed.
+	slurmNodeMap["slurm-node-1"] = &slurm.SlurmNode{
+		Name:     "slurm-node-1",
+		State:    []string{"IDLE", "DRAIN"},
+		Reason:   slurmNodes[0].Reason,
+		BootTime: slurm.FlagType{Number: 200, Set: true},
+	}
+	_, err = r.AutoRemediate(context.Background(), socketPath, slurmNodeMap, k8sNodeMap, getPhysicalNodeMap(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_IN_PROGRESS, r.RemediationPlan().Actions[0].Outcome)
+	assert.Equal(t, REBOOT_PHASE_REBOOTED, getPhysicalNodeMap()["cba"].Status.Reboot.Phase)
+
+	slurmNodes, err = slurm.ListSlurmNodes(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"IDLE"}, slurmNodes[0].State)
+
+	// Once the slurm node is healthy the taint is removed.
+	slurmNodeMap["slurm-node-1"].State = []string{"IDLE"}
+	_, err = r.AutoRemediate(context.Background(), socketPath, slurmNodeMap, k8sNodeMap, getPhysicalNodeMap(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, OUTCOME_EXECUTED, r.RemediationPlan().Actions[0].Outcome)
+
+	reboot = getPhysicalNodeMap()["cba"].Status.Reboot
+	assert.Equal(t, REBOOT_PHASE_COMPLETED, reboot.Phase)
+	assert.Equal(t, int64(200), reboot.BootTime)
+	assert.NotNil(t, reboot.CompletionTimestamp)
+
+	updatedK8sNode := &corev1.Node{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: k8sNode.Name}, updatedK8sNode))
+	assert.Empty(t, updatedK8sNode.Spec.Taints)
+}
+
+func TestIsRemediationStarted(t *testing.T) {
+	reboot := &RemediationAction{Type: ACTION_SLURM_NODE_REBOOT, SlurmPodName: "slurm-node-1"}
+	podDelete := &RemediationAction{Type: ACTION_SLURM_POD_DELETE, SlurmPodName: "slurm-node-1"}
+	newPhysicalNode := func(drainPhase string, rebootPhase string) *slonkv1.PhysicalNode {
+		physicalNode := &slonkv1.PhysicalNode{}
+		if drainPhase != "" {
+			physicalNode.Status.SlurmDrain = &slonkv1.SlurmDrainStatus{SlurmNodeName: "slurm-node-1", Phase: drainPhase}
+		}
+		if rebootPhase != "" {
+			physicalNode.Status.Reboot = &slonkv1.RebootStatus{SlurmNodeName: "slurm-node-1", Phase: rebootPhase}
+		}
+		return physicalNode
+	}
+
+	assert.False(t, isRemediationStarted(reboot, nil))
+	assert.False(t, isRemediationStarted(reboot, newPhysicalNode("", "")))
+	assert.True(t, isRemediationStarted(reboot, newPhysicalNode(DRAIN_PHASE_DRAINING, "")))
+	assert.True(t, isRemediationStarted(reboot, newPhysicalNode(DRAIN_PHASE_DRAINED, REBOOT_PHASE_REQUESTED)))
+	assert.True(t, isRemediationStarted(reboot, newPhysicalNode(DRAIN_PHASE_DRAINED, REBOOT_PHASE_REBOOTED)))
+	assert.False(t, isRemediationStarted(reboot, newPhysicalNode(DRAIN_PHASE_DRAINED, REBOOT_PHASE_COMPLETED)))
+	assert.True(t, isRemediationStarted(podDelete, newPhysicalNode(DRAIN_PHASE_DRAINING, "")))
+	assert.False(t, isRemediationStarted(podDelete, newPhysicalNode(DRAIN_PHASE_DEADLINE_EXCEEDED, "")))
+	assert.False(t, isRemediationStarted(&RemediationAction{Type: ACTION_SLURM_POD_DELETE, SlurmPodName: "slurm-node-2"},
+		newPhysicalNode(DRAIN_PHASE_DRAINING, "")))
+}
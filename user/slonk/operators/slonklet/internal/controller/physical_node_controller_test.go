@@ -12,7 +12,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/events"
 	clientFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -192,14 +192,14 @@ func TestSyncSlurmAndK8sNodeSpecAndStatus(t *testing.T) {
 
 	// Create a fake reconciler.
 	testPhysicalNode := &slonkv1.PhysicalNode{}
-	fakeClient := clientFake.NewClientBuilder().
+	fakeClient := newFakeClientBuilder().
 		WithScheme(newScheme).
 		WithRuntimeObjects(runtimeObjects...).
 		WithStatusSubresource(testPhysicalNode).
 		Build()
 	testPhysicalNodeReconciler := &PhysicalNodeReconciler{
 		Client:   fakeClient,
-		Recorder: &record.FakeRecorder{},
+		Recorder: &events.FakeRecorder{},
 		Scheme:   scheme.Scheme,
 	}
 
@@ -370,14 +370,14 @@ func TestPropogateSlurmGoalStateToK8sNodeAnnotations(t *testing.T) {
 
 	// Create a fake reconciler.
 	testPhysicalNode := &slonkv1.PhysicalNode{}
-	fakeClient := clientFake.NewClientBuilder().
+	fakeClient := newFakeClientBuilder().
 		WithScheme(newScheme).
 		WithRuntimeObjects(runtimeObjects...).
 		WithStatusSubresource(testPhysicalNode).
 		Build()
 	testPhysicalNodeReconciler := &PhysicalNodeReconciler{
 		Client:   fakeClient,
-		Recorder: &record.FakeRecorder{},
+		Recorder: &events.FakeRecorder{},
 		Scheme:   scheme.Scheme,
 	}
 
@@ -452,14 +452,14 @@ func TestPropogateSlurmGoalStateToK8sNodeTaints(t *testing.T) {
 	}
 
 	// Create a fake reconciler.
-	fakeClient := clientFake.NewClientBuilder().
+	fakeClient := newFakeClientBuilder().
 		WithScheme(newScheme).
 		WithRuntimeObjects(runtimeObjects...).
 		WithStatusSubresource(testPhysicalNode).
 		Build()
 	testPhysicalNodeReconciler := &PhysicalNodeReconciler{
 		Client:   fakeClient,
-		Recorder: &record.FakeRecorder{},
+		Recorder: &events.FakeRecorder{},
 		Scheme:   scheme.Scheme,
 	}
 
@@ -535,3 +535,10 @@ func TestPropogateSlurmGoalStateToK8sNodeTaints(t *testing.T) {
 	assert.Equal(t, 1, len(kn2.Spec.Taints))
 	assert.Equal(t, "up", kn2.Annotations[SLURM_GOAL_STATE_ANNOTATION])
 }
+
+// newFakeClientBuilder returns a fake client builder with the field indexes of the manager.
+func newFakeClientBuilder() *clientFake.ClientBuilder {
+	return clientFake.NewClientBuilder().
+		WithIndex(&corev1.Pod{}, POD_NODE_NAME_INDEX, indexPodByNodeName).
+		WithIndex(&corev1.Node{}, K8S_NODE_GPU_UUID_HASH_INDEX, indexK8sNodeByGPUUUIDHash)
+}
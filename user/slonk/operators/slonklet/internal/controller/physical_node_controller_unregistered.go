@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+	"your-org.com/slonklet/internal/tools"
+)
+
+const (
+	DEFAULT_UNREGISTERED_POD_GRACE_PERIOD = 10 * time.Minute
+	DEFAULT_UNREGISTERED_POD_MAX_RESTARTS = 3
+
+	// Value of the manual action taint added when restarting an unregistered slurm pod
+	// didn't help.
+	UNREGISTERED_SLURMD_TAINT_VALUE = "unregistered-slurmd"
+)
+
+// UnregisteredSlurmPod is a running slurm pod without a slurm node.
+type UnregisteredSlurmPod struct {
+	PodName          string    `json:"podName"`
+	K8sNodeName      string    `json:"k8sNodeName"`
+	PhysicalNodeName string    `json:"physicalNodeName,omitempty"`
+	Since            time.Time `json:"since"`
+	Restarts         int       `json:"restarts"`
+	Escalated        bool      `json:"escalated"`
+}
+
+type unregisteredSlurmPodCache struct {
+	sync.RWMutex
+	pods []UnregisteredSlurmPod
+}
+
+// HandleUnregisteredSlurmPods finds running slurm compute pods whose slurmd never
+// registered with slurmctld and records them in the physical node status. With remediate
+// set, pods still unregistered after the grace period are restarted, and once restarts
+// don't help the k8s node is tainted to be drained.
+func (r *PhysicalNodeReconciler) HandleUnregisteredSlurmPods(
+	ctx context.Context,
+	slurmNodeMap map[string]*slurm.SlurmNode,
+	slurmPodMap map[string]*corev1.Pod,
+	k8sNodeMap map[string]*corev1.Node,
+	existingPhysicalNodeMap map[string]*slonkv1.PhysicalNode,
+	remediate bool,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Started handling unregistered slurm pods")
+
+	now := time.Now()
+	gracePeriod := r.UnregisteredPodGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DEFAULT_UNREGISTERED_POD_GRACE_PERIOD
+	}
+	maxRestarts := r.UnregisteredPodMaxRestarts
+	if maxRestarts <= 0 {
+		maxRestarts = DEFAULT_UNREGISTERED_POD_MAX_RESTARTS
+	}
+
+	unregisteredPods := []UnregisteredSlurmPod{}
+	// Running compute pods per k8s node.
+	runningPodMap := map[string]*corev1.Pod{}
+	for _, slurmPod := range slurmPodMap {
+		if !isSlurmComputePod(slurmPod) || slurmPod.Status.Phase != corev1.PodRunning || slurmPod.DeletionTimestamp != nil {
+			continue
+		}
+		runningPodMap[slurmPod.Spec.NodeName] = slurmPod
+	}
+
+	restartCount := 0
+	escalationCount := 0
+	for _, physicalNode := range existingPhysicalNodeMap {
+		k8sNodeName := physicalNode.Status.K8sNodeStatus.Name
+		k8sNode, ok := k8sNodeMap[k8sNodeName]
+		slurmPod := runningPodMap[k8sNodeName]
+		status := physicalNode.Status.UnregisteredSlurmPod.DeepCopy()
+
+		if !ok || k8sNodeName == "" || (slurmPod != nil && slurmNodeMap[slurmPod.Name] != nil) {
+			// The host is gone, or slurmd registered.
+			if status != nil {
+				logger.Info("Slurm pod is no longer unregistered", "pod", status.PodName, "k8s node", k8sNodeName, "physical node", physicalNode.Name, "restarts", status.Restarts)
+				if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+					physicalNode.Status.UnregisteredSlurmPod = nil
+				}); err != nil {
+					logger.Info("Failed to clear unregistered slurm pod status", "physical node", physicalNode.Name, "error", err)
+				}
+			}
+			continue
+		}
+		if slurmPod == nil {
+			// The pod is pending or being restarted, keep the status as is.
+			continue
+		}
+		delete(runningPodMap, k8sNodeName)
+
+		if status == nil || status.PodUID != string(slurmPod.UID) {
+			if status == nil {
+				status = &slonkv1.UnregisteredSlurmPodStatus{}
+				logger.Info("Found running slurm pod without slurm node", "pod", slurmPod.Name, "k8s node", k8sNodeName, "physical node", physicalNode.Name)
+			}
+			// The grace period restarts with every new pod, the restart count is kept.
+			status.PodName = slurmPod.Name
+			status.PodUID = string(slurmPod.UID)
+			status.K8sNodeName = k8sNodeName
+			status.SinceTimestamp = metav1.NewTime(now)
+		}
+
+		if remediate && now.Sub(status.SinceTimestamp.Time) >= gracePeriod {
+			if status.Restarts < maxRestarts {
+				slurmPodLists := map[string]corev1.PodList{
+					SLURM_NAMESPACE: {Items: []corev1.Pod{*slurmPod}},
+				}
+				if _, err := tools.DeletePodsOnNode(ctx, r.Client, slurmPodLists, k8sNodeName); err != nil {
+					logger.Info("Failed to restart unregistered slurm pod", "pod", slurmPod.Name, "k8s node", k8sNodeName, "physical node", physicalNode.Name, "error", err)
+				} else {
+					restartTimestamp := metav1.NewTime(now)
+					status.Restarts++
+					status.LastRestartTimestamp = &restartTimestamp
+					restartCount++
+
+					message := fmt.Sprintf(
+						"Auto restarted slurm pod %s, slurmd didn't register for %s (restart %d of %d). K8s node: %s. Physical node: %s.",
+						slurmPod.Name,
+						now.Sub(status.SinceTimestamp.Time).Round(time.Second),
+						status.Restarts,
+						maxRestarts,
+						k8sNodeName,
+						physicalNode.Name)
+					r.emitEvent(ctx, physicalNode, corev1.EventTypeNormal, REASON_SLONKLET_UNREGISTERED_SLURM_POD_RESTART, message)
+				}
+			} else if !status.Escalated {
+				taint := corev1.Taint{
+					Key:    SLURM_TAINT_ACTION_MANUAL,
+					Value:  UNREGISTERED_SLURMD_TAINT_VALUE,
+					Effect: corev1.TaintEffectNoSchedule,
+				}
+				if allowed, reason := r.Budgets.Allow(k8sNode, physicalNode.Name); !allowed {
+					logger.Info("Disruption budget exhausted, pausing taint", "name", k8sNodeName, "physical node", physicalNode.Name, "reason", reason)
+				} else if _, err := tools.MaybeAddTaintToNode(ctx, r.Client, k8sNode.DeepCopy(), taint); err != nil {
+					logger.Info("Failed to taint k8s node with unregistered slurm pod", "name", k8sNodeName, "physical node", physicalNode.Name, "error", err)
+				} else {
+					r.Budgets.Record(k8sNode, physicalNode.Name, now)
+					status.Escalated = true
+					escalationCount++
+
+					message := fmt.Sprintf(
+						"Auto tainted k8s node %s to be drained, slurm pod %s didn't register after %d restarts. Physical node: %s.",
+						k8sNodeName,
+						slurmPod.Name,
+						status.Restarts,
+						physicalNode.Name)
+					r.emitEvent(ctx, physicalNode, corev1.EventTypeWarning, REASON_SLONKLET_UNREGISTERED_SLURM_POD_ESCALATION, message)
+				}
+			}
+		}
+
+		unregisteredPods = append(unregisteredPods, UnregisteredSlurmPod{
+			PodName:          status.PodName,
+			K8sNodeName:      k8sNodeName,
+			PhysicalNodeName: physicalNode.Name,
+			Since:            status.SinceTimestamp.Time,
+			Restarts:         status.Restarts,
+			Escalated:        status.Escalated,
+		})
+
+		if !equality.Semantic.DeepEqual(physicalNode.Status.UnregisteredSlurmPod, status) {
+			if err := r.patchPhysicalNodeStatus(ctx, physicalNode, func(physicalNode *slonkv1.PhysicalNode) {
+				physicalNode.Status.UnregisteredSlurmPod = status
+			}); err != nil {
+				logger.Info("Failed to record unregistered slurm pod status", "physical node", physicalNode.Name, "error", err)
+			}
+		}
+	}
+
+	// Pods on k8s nodes without a physical node are only reported.
+	for k8sNodeName, slurmPod := range runningPodMap {
+		if slurmNodeMap[slurmPod.Name] != nil {
+			continue
+		}
+		since := now
+		if slurmPod.Status.StartTime != nil {
+			since = slurmPod.Status.StartTime.Time
+		}
+		unregisteredPods = append(unregisteredPods, UnregisteredSlurmPod{
+			PodName:     slurmPod.Name,
+			K8sNodeName: k8sNodeName,
+			Since:       since,
+		})
+	}
+
+	sort.Slice(unregisteredPods, func(i, j int) bool {
+		return unregisteredPods[i].PodName < unregisteredPods[j].PodName
+	})
+	r.unregisteredPodCache.Lock()
+	r.unregisteredPodCache.pods = unregisteredPods
+	r.unregisteredPodCache.Unlock()
+
+	logger.Info("Finished handling unregistered slurm pods",
+		"unregisteredCount", len(unregisteredPods),
+		"restartCount", restartCount,
+		"escalationCount", escalationCount,
+	)
+
+	return ctrl.Result{}, nil
+}
+
+// UnregisteredSlurmPods returns the running slurm pods without a slurm node found in the
+// latest iteration.
+func (r *PhysicalNodeReconciler) UnregisteredSlurmPods() []UnregisteredSlurmPod {
+	r.unregisteredPodCache.RLock()
+	defer r.unregisteredPodCache.RUnlock()
+	return r.unregisteredPodCache.pods
+}
+
+func isSlurmComputePod(pod *corev1.Pod) bool {
+	return pod.Labels["slurm-compute"] == "yes" && !strings.Contains(pod.Name, "cpu")
+}
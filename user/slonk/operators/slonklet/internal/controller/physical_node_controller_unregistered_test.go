@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestHandleUnregisteredSlurmPods(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	k8sNode := testNodes[0].(*corev1.Node).DeepCopy()
+	slurmPod := testPods[0].(*corev1.Pod).DeepCopy()
+	slurmPod.Labels = map[string]string{"slurm-compute": "yes"}
+	slurmPod.UID = "uid-1"
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "cba", Namespace: SLURM_NAMESPACE},
+		Status: slonkv1.PhysicalNodeStatus{
+			K8sNodeStatus: slonkv1.K8sNodeStatus{Name: k8sNode.Name},
+		},
+	}
+
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(k8sNode, slurmPod, physicalNode).
+		WithStatusSubresource(physicalNode).
+		Build()
+	recorder := events.NewFakeRecorder(10)
+	r := &PhysicalNodeReconciler{
+		Client:                     fakeClient,
+		Recorder:                   recorder,
+		Scheme:                     scheme.Scheme,
+		UnregisteredPodGracePeriod: time.Minute,
+		UnregisteredPodMaxRestarts: 1,
+	}
+	k8sNodeMap := map[string]*corev1.Node{k8sNode.Name: k8sNode}
+	slurmNodeMap := map[string]*slurm.SlurmNode{}
+	getPhysicalNode := func() *slonkv1.PhysicalNode {
+		updatedPhysicalNode := &slonkv1.PhysicalNode{}
+		assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}, updatedPhysicalNode))
+		return updatedPhysicalNode
+	}
+	handle := func(pod *corev1.Pod) {
+		_, err := r.HandleUnregisteredSlurmPods(context.Background(), slurmNodeMap,
+			map[string]*corev1.Pod{pod.Name: pod}, k8sNodeMap,
+			map[string]*slonkv1.PhysicalNode{"cba": getPhysicalNode()}, true)
+		assert.NoError(t, err)
+	}
+	expireGracePeriod := func() {
+		updatedPhysicalNode := getPhysicalNode()
+		updatedPhysicalNode.Status.UnregisteredSlurmPod.SinceTimestamp = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+		assert.NoError(t, fakeClient.Status().Update(context.Background(), updatedPhysicalNode))
+	}
+
+	// The pod is recorded, but kept within the grace period.
+	handle(slurmPod)
+	status := getPhysicalNode().Status.UnregisteredSlurmPod
+	assert.NotNil(t, status)
+	assert.Equal(t, "slurm-node-1", status.PodName)
+	assert.Equal(t, 0, status.Restarts)
+	assert.Equal(t, 1, len(r.UnregisteredSlurmPods()))
+	assert.Equal(t, "cba", r.UnregisteredSlurmPods()[0].PhysicalNodeName)
+
+	// After the grace period the pod is restarted.
+	expireGracePeriod()
+	handle(slurmPod)
+	assert.Equal(t, 1, getPhysicalNode().Status.UnregisteredSlurmPod.Restarts)
+	pod := &corev1.Pod{}
+	err := fakeClient.Get(context.Background(), types.NamespacedName{Name: "slurm-node-1", Namespace: SLURM_NAMESPACE}, pod)
+	assert.Error(t, err)
+	assert.Contains(t, <-recorder.Events, corev1.EventTypeNormal+" "+REASON_SLONKLET_UNREGISTERED_SLURM_POD_RESTART)
+	assert.True(t, r.hasRecentEvent("cba", []string{REASON_SLONKLET_UNREGISTERED_SLURM_POD_RESTART}, "slurm-node-1", RECENT_EVENT_WINDOW))
+
+	// The new pod gets a fresh grace period, then the k8s node is tainted.
+	newSlurmPod := slurmPod.DeepCopy()
+	newSlurmPod.UID = "uid-2"
+	newSlurmPod.ResourceVersion = ""
+	assert.NoError(t, fakeClient.Create(context.Background(), newSlurmPod))
+	handle(newSlurmPod)
+	status = getPhysicalNode().Status.UnregisteredSlurmPod
+	assert.Equal(t, "uid-2", status.PodUID)
+	assert.Equal(t, 1, status.Restarts)
+	assert.False(t, status.Escalated)
+
+	expireGracePeriod()
+	handle(newSlurmPod)
+	assert.True(t, getPhysicalNode().Status.UnregisteredSlurmPod.Escalated)
+	updatedK8sNode := &corev1.Node{}
+	assert.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: k8sNode.Name}, updatedK8sNode))
+	assert.Equal(t, []corev1.Taint{{Key: SLURM_TAINT_ACTION_MANUAL, Value: UNREGISTERED_SLURMD_TAINT_VALUE, Effect: corev1.TaintEffectNoSchedule}}, updatedK8sNode.Spec.Taints)
+	assert.Contains(t, <-recorder.Events, corev1.EventTypeWarning+" "+REASON_SLONKLET_UNREGISTERED_SLURM_POD_ESCALATION)
+
+	// Once slurmd registers the status is cleared.
+	slurmNodeMap["slurm-node-1"] = &slurm.SlurmNode{Name: "slurm-node-1", State: []string{"IDLE"}}
+	handle(newSlurmPod)
+	assert.Nil(t, getPhysicalNode().Status.UnregisteredSlurmPod)
+	assert.Empty(t, r.UnregisteredSlurmPods())
+}
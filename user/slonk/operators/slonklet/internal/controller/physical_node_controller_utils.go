@@ -2,59 +2,204 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"strings"
+	"sync"
+	"time"
 
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	ref "k8s.io/client-go/tools/reference"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/history"
 	"your-org.com/slonklet/internal/tools"
 )
 
 const (
-	REASON_SLONKLET_AUTO_SLURM_NODE_DELETION       = "SlonkletAutoSlurmNodeDeletion"
-	REASON_SLONKLET_AUTO_K8S_NODE_DRAIN            = "SlonkletAutoK8sNodeDrain"
-	REASON_SLONKLET_AUTO_K8S_NODE_DELETION         = "SlonkletAutoK8sNodeDeletion"
-	REASON_SLONKLET_UNEXPECTED_SLURM_NODE_DELETION = "SlonkletUnexpectedSlurmNodeDeletion"
-	REASON_SLONKLET_UNEXPECTED_K8S_NODE_DELETION   = "SlonkletUnexpectedK8sNodeDeletion"
+	REASON_SLONKLET_AUTO_SLURM_NODE_DELETION          = "SlonkletAutoSlurmNodeDeletion"
+	REASON_SLONKLET_AUTO_K8S_NODE_DRAIN               = "SlonkletAutoK8sNodeDrain"
+	REASON_SLONKLET_AUTO_K8S_NODE_DELETION            = "SlonkletAutoK8sNodeDeletion"
+	REASON_SLONKLET_UNEXPECTED_SLURM_NODE_DELETION    = "SlonkletUnexpectedSlurmNodeDeletion"
+	REASON_SLONKLET_UNEXPECTED_K8S_NODE_DELETION      = "SlonkletUnexpectedK8sNodeDeletion"
+	REASON_SLONKLET_MAINTENANCE_DRAIN                 = "SlonkletMaintenanceDrain"
+	REASON_SLONKLET_MAINTENANCE_RESUME                = "SlonkletMaintenanceResume"
+	REASON_SLONKLET_AUTO_REBOOT                       = "SlonkletAutoReboot"
+	REASON_SLONKLET_AUTO_REBOOT_FAILED                = "SlonkletAutoRebootFailed"
+	REASON_SLONKLET_UNREGISTERED_SLURM_POD_RESTART    = "SlonkletUnregisteredSlurmPodRestart"
+	REASON_SLONKLET_UNREGISTERED_SLURM_POD_ESCALATION = "SlonkletUnregisteredSlurmPodEscalation"
+	REASON_SLONKLET_MANUAL_OVERRIDE_EXPIRED           = "SlonkletManualOverrideExpired"
+	REASON_SLONKLET_MANUAL_OVERRIDE_REVERT            = "SlonkletManualOverrideRevert"
+
+	// Actions of the events, what slonklet did or failed to do about the physical node.
+	EVENT_ACTION_DELETE   = "Delete"
+	EVENT_ACTION_DRAIN    = "Drain"
+	EVENT_ACTION_RESUME   = "Resume"
+	EVENT_ACTION_REBOOT   = "Reboot"
+	EVENT_ACTION_RESTART  = "Restart"
+	EVENT_ACTION_ESCALATE = "Escalate"
+	EVENT_ACTION_REVERT   = "Revert"
+	EVENT_ACTION_OBSERVE  = "Observe"
+	EVENT_ACTION_BLAME    = "Blame"
+	EVENT_ACTION_DIAGNOSE = "Diagnose"
+
+	// Number of events per physical node kept in memory to skip duplicates.
+	RECENT_EVENT_LIMIT = 5
+	// How long an emitted event suppresses events for the same node removal.
+	RECENT_EVENT_WINDOW = 1 * time.Hour
 )
 
-func (r *PhysicalNodeReconciler) emitAndRecordEvent(
+// Action of the events of each reason, events.k8s.io/v1 requires one.
+var EVENT_ACTIONS = map[string]string{
+	REASON_SLONKLET_AUTO_SLURM_NODE_DELETION:          EVENT_ACTION_DELETE,
+	REASON_SLONKLET_AUTO_K8S_NODE_DRAIN:               EVENT_ACTION_DRAIN,
+	REASON_SLONKLET_AUTO_K8S_NODE_DELETION:            EVENT_ACTION_DELETE,
+	REASON_SLONKLET_UNEXPECTED_SLURM_NODE_DELETION:    EVENT_ACTION_OBSERVE,
+	REASON_SLONKLET_UNEXPECTED_K8S_NODE_DELETION:      EVENT_ACTION_OBSERVE,
+	REASON_SLONKLET_MAINTENANCE_DRAIN:                 EVENT_ACTION_DRAIN,
+	REASON_SLONKLET_MAINTENANCE_RESUME:                EVENT_ACTION_RESUME,
+	REASON_SLONKLET_AUTO_REBOOT:                       EVENT_ACTION_REBOOT,
+	REASON_SLONKLET_AUTO_REBOOT_FAILED:                EVENT_ACTION_REBOOT,
+	REASON_SLONKLET_UNREGISTERED_SLURM_POD_RESTART:    EVENT_ACTION_RESTART,
+	REASON_SLONKLET_UNREGISTERED_SLURM_POD_ESCALATION: EVENT_ACTION_ESCALATE,
+	REASON_SLONKLET_MANUAL_OVERRIDE_EXPIRED:           EVENT_ACTION_OBSERVE,
+	REASON_SLONKLET_MANUAL_OVERRIDE_REVERT:            EVENT_ACTION_REVERT,
+	REASON_SLONKLET_SUSPECT:                           EVENT_ACTION_BLAME,
+	REASON_SLONKLET_SUSPECT_CLEARED:                   EVENT_ACTION_BLAME,
+	REASON_SLONKLET_NODE_HUNT_FAILED:                  EVENT_ACTION_DIAGNOSE,
+	REASON_SLONKLET_NODE_HUNT_COMPLETED:               EVENT_ACTION_DIAGNOSE,
+	REASON_SLONKLET_NODE_HUNT_ABORTED:                 EVENT_ACTION_DIAGNOSE,
+}
+
+// eventAction returns the action of events of the reason.
+func eventAction(reason string) string {
+	if action, ok := EVENT_ACTIONS[reason]; ok {
+		return action
+	}
+	return EVENT_ACTION_OBSERVE
+}
+
+// patchPhysicalNode applies mutate to the spec and metadata of the physical node and writes
+// the changes as a merge patch, conditional on the resource version the changes were made
+// on. On a conflict the latest physical node is fetched and mutated again, so that changes
+// made concurrently by operators are not overwritten with stale values, like
+// tools.PatchNode.
+func (r *PhysicalNodeReconciler) patchPhysicalNode(
+	ctx context.Context,
+	physicalNode *slonkv1.PhysicalNode,
+	mutate func(physicalNode *slonkv1.PhysicalNode),
+) error {
+	return r.patchPhysicalNodeWithRetry(ctx, physicalNode, mutate, func(patch client.Patch) error {
+		return r.Client.Patch(ctx, physicalNode, patch, client.FieldOwner(tools.FIELD_OWNER))
+	})
+}
+
+// patchPhysicalNodeStatus applies mutate to the status of the physical node and writes the
+// changes like patchPhysicalNode.
+func (r *PhysicalNodeReconciler) patchPhysicalNodeStatus(
+	ctx context.Context,
 	physicalNode *slonkv1.PhysicalNode,
+	mutate func(physicalNode *slonkv1.PhysicalNode),
+) error {
+	return r.patchPhysicalNodeWithRetry(ctx, physicalNode, mutate, func(patch client.Patch) error {
+		return r.Client.Status().Patch(ctx, physicalNode, patch, client.FieldOwner(tools.FIELD_OWNER))
+	})
+}
+
+func (r *PhysicalNodeReconciler) patchPhysicalNodeWithRetry(
+	ctx context.Context,
+	physicalNode *slonkv1.PhysicalNode,
+	mutate func(physicalNode *slonkv1.PhysicalNode),
+	patch func(patch client.Patch) error,
+) error {
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := r.Client.Get(ctx, client.ObjectKeyFromObject(physicalNode), physicalNode); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		original := physicalNode.DeepCopy()
+		mutate(physicalNode)
+		return patch(client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	})
+}
+
+// emitEvent reports an event on the physical node through the recorder, which correlates
+// repeated events into a series, and archives it in the history. The physical node itself isn't written,
+// recently emitted events are kept in memory to skip duplicates instead.
+func (r *PhysicalNodeReconciler) emitEvent(
+	ctx context.Context,
+	physicalNode *slonkv1.PhysicalNode,
+	eventtype string,
 	reason string,
 	message string,
-) error {
-	reference, err := ref.GetReference(r.Scheme, physicalNode)
-	if err != nil {
-		return fmt.Errorf("get physical node reference: %w", err)
+) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(physicalNode, nil, eventtype, reason, eventAction(reason), "%s", message)
 	}
-	event := tools.MakeEvent(
-		reference,
-		map[string]string{},
-		corev1.EventTypeNormal,
-		reason,
-		message,
-		"slonklet-controller",
-	)
-	if err := r.Client.Create(context.Background(), event); err != nil {
-		return fmt.Errorf("create event: %w", err)
+	r.recentEvents.add(physicalNode.Name, reason, message, time.Now())
+	r.recordHistory(ctx, physicalNode.Name, history.KIND_EVENT, map[string]string{
+		"type":    eventtype,
+		"reason":  reason,
+		"message": message,
+	})
+}
+
+// hasRecentEvent returns whether an event with one of the reasons and a message containing
+// substring was emitted for the physical node within the window.
+func (r *PhysicalNodeReconciler) hasRecentEvent(physicalNodeName string, reasons []string, substring string, window time.Duration) bool {
+	return r.recentEvents.contains(physicalNodeName, reasons, substring, time.Now().Add(-window))
+}
+
+type recentEvent struct {
+	Reason    string
+	Message   string
+	Timestamp time.Time
+}
+
+// recentEventCache keeps the latest events emitted per physical node.
+type recentEventCache struct {
+	sync.Mutex
+	events map[string][]recentEvent
+}
+
+func (c *recentEventCache) add(physicalNodeName string, reason string, message string, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.events == nil {
+		c.events = map[string][]recentEvent{}
 	}
-	physicalNode.EventRecords = append(
-		[]slonkv1.EventRecord{
-			{
-				Event:        *event,
-				AckTimestamp: metav1.Now(),
-			},
-		},
-		physicalNode.EventRecords...,
-	)
-	if len(physicalNode.EventRecords) > 5 {
-		physicalNode.EventRecords = physicalNode.EventRecords[:5]
+	events := append([]recentEvent{{Reason: reason, Message: message, Timestamp: now}}, c.events[physicalNodeName]...)
+	if len(events) > RECENT_EVENT_LIMIT {
+		events = events[:RECENT_EVENT_LIMIT]
 	}
-	if err := r.Client.Update(context.Background(), physicalNode); err != nil {
-		return fmt.Errorf("update physical node for event records: %w", err)
+	c.events[physicalNodeName] = events
+}
+
+func (c *recentEventCache) contains(physicalNodeName string, reasons []string, substring string, since time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, event := range c.events[physicalNodeName] {
+		if event.Timestamp.Before(since) || !strings.Contains(event.Message, substring) {
+			continue
+		}
+		for _, reason := range reasons {
+			if event.Reason == reason {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	return nil
+// recordHistory archives a change of the physical node. Failures are logged, the history
+// is best effort.
+func (r *PhysicalNodeReconciler) recordHistory(ctx context.Context, physicalNodeName string, kind string, data interface{}) {
+	if err := r.History.Record(physicalNodeName, kind, data); err != nil {
+		log.FromContext(ctx).Info("Failed to record physical node history", "physical node", physicalNodeName, "kind", kind, "error", err)
+	}
 }
@@ -8,7 +8,7 @@ import (
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -26,8 +26,10 @@ type SlurmJobReconciler struct {
 	sync.RWMutex
 
 	client.Client
-	Recorder record.EventRecorder
+	Recorder events.EventRecorder
 	Scheme   *runtime.Scheme
+
+	syncRetries syncRetryQueue
 }
 
 //+kubebuilder:rbac:groups=slonk.your-org.com,resources=slurmjobs,verbs=get;list;watch;create;update;patch;delete
@@ -70,6 +72,7 @@ func (r *SlurmJobReconciler) Sync(
 		rawSlurmJobMap[rawSlurmJob.JobID] = &rawSlurmJobCopy
 	}
 	logger.Info("Fetched raw slurm jobs", "list count", len(rawSlurmJobList), "map count", len(rawSlurmJobMap))
+	updateSlurmJobMetrics(rawSlurmJobList)
 
 	existingSlurmJobList := &slonkv1.SlurmJobList{}
 	if err := r.Client.List(ctx, existingSlurmJobList); err != nil {
@@ -91,21 +94,6 @@ func (r *SlurmJobReconciler) Sync(
 		return nil, fmt.Errorf("sync slurm jobs: %w", err)
 	}
 
-	existingSlurmJobList = &slonkv1.SlurmJobList{}
-	if err := r.Client.List(ctx, existingSlurmJobList); err != nil {
-		return nil, fmt.Errorf("list slurm jobs: %w", err)
-	}
-	existingSlurmJobMap = map[int]*slonkv1.SlurmJob{}
-	for _, existingSlurmJob := range existingSlurmJobList.Items {
-		existingSlurmJobCopy := existingSlurmJob // Copy to avoid pointer reuse.
-		id, err := strconv.Atoi(existingSlurmJob.ObjectMeta.Name)
-		if err != nil {
-			logger.Error(err, "Failed to convert slurm job id to int", "job name", existingSlurmJob.ObjectMeta.Name)
-			continue
-		}
-		existingSlurmJobMap[id] = &existingSlurmJobCopy
-	}
-
 	logger.Info("Cleaning up old slurm jobs")
 	if len(existingSlurmJobMap) > JOB_TOTAL_LIMIT {
 		for len(existingSlurmJobMap) > JOB_TOTAL_LIMIT {
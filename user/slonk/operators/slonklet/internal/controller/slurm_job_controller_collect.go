@@ -3,20 +3,27 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	slonkv1 "your-org.com/slonklet/api/v1"
 	"your-org.com/slonklet/internal/slurm"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"your-org.com/slonklet/internal/tools"
 )
 
 const (
 	JOB_HISTORY_LENGTH = 10
 )
 
+// SyncSlurmJobs creates and updates slurm jobs from the ones in slurm. The slurm jobs it
+// writes replace the ones in existingSlurmJobMap.
 func (r *SlurmJobReconciler) SyncSlurmJobs(
 	ctx context.Context,
 	rawSlurmJobMap map[int]*slurm.SlurmJob,
@@ -34,6 +41,9 @@ func (r *SlurmJobReconciler) SyncSlurmJobs(
 		}
 	}
 
+	// A job that fails is retried later with a backoff, without holding back the others.
+	now := time.Now()
+	summary := SyncSummary{}
 	statusUpdateCount := 0
 	freshSlurmJobMap := map[int]*slonkv1.SlurmJob{}
 	for rawSlurmJobID, rawSlurmJob := range rawSlurmJobMap {
@@ -94,43 +104,78 @@ func (r *SlurmJobReconciler) SyncSlurmJobs(
 		}
 		freshSlurmJobMap[rawSlurmJobID] = newSlurmJob
 
+		key := strconv.Itoa(rawSlurmJobID)
+		if !r.syncRetries.Ready(key, now) {
+			summary.Skipped++
+			continue
+		}
 		existingSlurmJob, ok := existingSlurmJobMap[rawSlurmJobID]
 		if ok {
-			if updatedStatus := r.maybeUpdateSlurmJobStatus(&existingSlurmJob.Status, &newSlurmJob.Status); updatedStatus != nil {
+			if updatedStatus := r.maybeUpdateSlurmJobStatus(&existingSlurmJob.Status, &newSlurmJob.Status, existingSlurmJob.Generation); updatedStatus != nil {
 				updatedSlurmJob := existingSlurmJob.DeepCopy()
 				updatedSlurmJob.Status = *updatedStatus
-				if err := r.Client.Status().Update(ctx, updatedSlurmJob); err != nil {
-					return ctrl.Result{}, fmt.Errorf("update slurm job: %w", err)
+				if err := r.Client.Status().Patch(ctx, updatedSlurmJob, client.MergeFrom(existingSlurmJob), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+					r.recordSlurmJobSyncFailure(ctx, key, existingSlurmJob, fmt.Errorf("update slurm job: %w", err), now)
+					summary.Failed++
+					continue
 				}
+				existingSlurmJobMap[rawSlurmJobID] = updatedSlurmJob
 				statusUpdateCount++
 			}
 		} else {
-			if err := r.Client.Create(ctx, newSlurmJob); err != nil {
-				return ctrl.Result{}, fmt.Errorf("create slurm job: %w", err)
+			// The status isn't written on create, and the created object comes back without it.
+			status := newSlurmJob.Status
+			if err := r.Client.Create(ctx, newSlurmJob, client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+				r.recordSlurmJobSyncFailure(ctx, key, nil, fmt.Errorf("create slurm job: %w", err), now)
+				summary.Failed++
+				continue
 			}
-			if err := r.Client.Status().Update(ctx, newSlurmJob); err != nil {
-				return ctrl.Result{}, fmt.Errorf("update slurm job: %w", err)
+			original := newSlurmJob.DeepCopy()
+			newSlurmJob.Status = status
+			setSlurmJobConditions(&newSlurmJob.Status, newSlurmJob.Generation)
+			if err := r.Client.Status().Patch(ctx, newSlurmJob, client.MergeFrom(original), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+				// The job exists now, the next attempt updates its status.
+				r.recordSlurmJobSyncFailure(ctx, key, nil, fmt.Errorf("update slurm job: %w", err), now)
+				summary.Failed++
+				continue
 			}
+			existingSlurmJobMap[rawSlurmJobID] = newSlurmJob
 			logger.Info("Created new slurm job", "job id", rawSlurmJobID)
 		}
-
+		r.recordSlurmJobSyncSuccess(ctx, key, existingSlurmJobMap[rawSlurmJobID])
+		summary.Succeeded++
 	}
 
 	for id, existingSlurmJob := range existingSlurmJobMap {
 		if _, ok := freshSlurmJobMap[id]; !ok {
-			if updatedStatus := r.maybeUpdateSlurmJobStatus(&existingSlurmJob.Status, nil); updatedStatus != nil {
+			key := strconv.Itoa(id)
+			if !r.syncRetries.Ready(key, now) {
+				summary.Skipped++
+				continue
+			}
+			if updatedStatus := r.maybeUpdateSlurmJobStatus(&existingSlurmJob.Status, nil, existingSlurmJob.Generation); updatedStatus != nil {
 				updatedSlurmJob := existingSlurmJob.DeepCopy()
 				updatedSlurmJob.Status = *updatedStatus
-				if err := r.Client.Status().Update(ctx, updatedSlurmJob); err != nil {
-					return ctrl.Result{}, fmt.Errorf("mark slurm job as removed: %w", err)
+				if err := r.Client.Status().Patch(ctx, updatedSlurmJob, client.MergeFrom(existingSlurmJob), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+					r.recordSlurmJobSyncFailure(ctx, key, existingSlurmJob, fmt.Errorf("mark slurm job as removed: %w", err), now)
+					summary.Failed++
+					continue
 				}
+				existingSlurmJobMap[id] = updatedSlurmJob
 				logger.Info("Mark slurm job as removed", "job id", id)
 				statusUpdateCount++
 			}
+			r.recordSlurmJobSyncSuccess(ctx, key, existingSlurmJobMap[id])
+			summary.Succeeded++
 		}
 	}
 
-	logger.Info("Finished syncing slurm job crds", "status update count", statusUpdateCount)
+	logger.Info("Finished syncing slurm job crds",
+		"status update count", statusUpdateCount,
+		"succeeded", summary.Succeeded,
+		"failed", summary.Failed,
+		"skipped", summary.Skipped,
+	)
 
 	return ctrl.Result{}, nil
 }
@@ -138,6 +183,7 @@ func (r *SlurmJobReconciler) SyncSlurmJobs(
 func (r *SlurmJobReconciler) maybeUpdateSlurmJobStatus(
 	existingSlurmJobStatus *slonkv1.SlurmJobStatus,
 	freshSlurmJobStatus *slonkv1.SlurmJobStatus,
+	generation int64,
 ) *slonkv1.SlurmJobStatus {
 	if existingSlurmJobStatus == nil {
 		return freshSlurmJobStatus
@@ -191,8 +237,60 @@ func (r *SlurmJobReconciler) maybeUpdateSlurmJobStatus(
 		}
 	}
 
+	// Also backfills the conditions of jobs created before they were maintained.
+	setSlurmJobConditions(resultSlurmJobStatus, generation)
+	if !equality.Semantic.DeepEqual(existingSlurmJobStatus.Conditions, resultSlurmJobStatus.Conditions) {
+		updateStatus = true
+	}
+
 	if updateStatus {
 		return resultSlurmJobStatus
 	}
 	return nil
 }
+
+// recordSlurmJobSyncFailure holds the job back until its retry, and counts the failure in its
+// status when it exists.
+func (r *SlurmJobReconciler) recordSlurmJobSyncFailure(
+	ctx context.Context,
+	key string,
+	slurmJob *slonkv1.SlurmJob,
+	syncErr error,
+	now time.Time,
+) {
+	logger := log.FromContext(ctx)
+
+	retryAt := r.syncRetries.Failed(key, now)
+	logger.Info("Failed to sync slurm job",
+		"job id", key,
+		"failures", r.syncRetries.Failures(key),
+		"retry at", retryAt,
+		"error", syncErr,
+	)
+	if slurmJob == nil {
+		return
+	}
+	original := slurmJob.DeepCopy()
+	slurmJob.Status.SyncFailure = nextSyncFailure(slurmJob.Status.SyncFailure, syncErr, metav1.NewTime(now))
+	if err := r.Client.Status().Patch(ctx, slurmJob, client.MergeFrom(original), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+		logger.Info("Failed to record sync failure", "job id", key, "error", err)
+	}
+}
+
+// recordSlurmJobSyncSuccess resets the backoff of the job, and clears the failures in its
+// status.
+func (r *SlurmJobReconciler) recordSlurmJobSyncSuccess(
+	ctx context.Context,
+	key string,
+	slurmJob *slonkv1.SlurmJob,
+) {
+	r.syncRetries.Succeeded(key)
+	if slurmJob == nil || slurmJob.Status.SyncFailure == nil {
+		return
+	}
+	original := slurmJob.DeepCopy()
+	slurmJob.Status.SyncFailure = nil
+	if err := r.Client.Status().Patch(ctx, slurmJob, client.MergeFrom(original), client.FieldOwner(tools.FIELD_OWNER)); err != nil {
+		log.FromContext(ctx).Info("Failed to clear sync failure", "job id", key, "error", err)
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	// The job is running or completing on its allocated nodes.
+	CONDITION_JOB_RUNNING = "Running"
+	// The job finished successfully.
+	CONDITION_JOB_COMPLETED = "Completed"
+	// The job finished unsuccessfully, including timeouts, node failures and cancellations.
+	CONDITION_JOB_FAILED = "Failed"
+
+	CONDITION_REASON_JOB_REMOVED = "Removed"
+)
+
+// setSlurmJobConditions sets the job conditions from the current run status. Once the job is
+// removed from slurm, Running turns false and the last known Completed and Failed are kept.
+func setSlurmJobConditions(status *slonkv1.SlurmJobStatus, generation int64) {
+	currentStatus := status.SlurmJobRunCurrentStatus
+	newCondition := func(conditionType string, matched bool, reason string, message string) metav1.Condition {
+		conditionStatus := metav1.ConditionFalse
+		if matched {
+			conditionStatus = metav1.ConditionTrue
+		}
+		return metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			ObservedGeneration: generation,
+			Reason:             reason,
+			Message:            message,
+		}
+	}
+
+	if currentStatus.Removed {
+		meta.SetStatusCondition(&status.Conditions, newCondition(CONDITION_JOB_RUNNING, false, CONDITION_REASON_JOB_REMOVED,
+			"The job is no longer known to slurmctld."))
+		for _, conditionType := range []string{CONDITION_JOB_COMPLETED, CONDITION_JOB_FAILED} {
+			if meta.FindStatusCondition(status.Conditions, conditionType) != nil {
+				continue
+			}
+			condition := newCondition(conditionType, false, CONDITION_REASON_JOB_REMOVED,
+				"The job is no longer known to slurmctld, its final state was not observed.")
+			condition.Status = metav1.ConditionUnknown
+			meta.SetStatusCondition(&status.Conditions, condition)
+		}
+		return
+	}
+
+	state := currentStatus.State
+	reason := slurmJobStateReason(state)
+	message := fmt.Sprintf("Slurm job state is %s.", state)
+	meta.SetStatusCondition(&status.Conditions, newCondition(CONDITION_JOB_RUNNING, slurm.SLURM_JOB_RUNNING_STATES[state], reason, message))
+	meta.SetStatusCondition(&status.Conditions, newCondition(CONDITION_JOB_COMPLETED, slurm.SLURM_JOB_COMPLETED_STATES[state], reason, message))
+	meta.SetStatusCondition(&status.Conditions, newCondition(CONDITION_JOB_FAILED, slurm.SLURM_JOB_FAILED_STATES[state], reason, message))
+}
+
+// slurmJobStateReason converts a slurm job state such as NODE_FAIL into a condition reason
+// such as NodeFail.
+func slurmJobStateReason(state string) string {
+	reason := ""
+	for _, word := range strings.Split(strings.ToLower(state), "_") {
+		if word == "" {
+			continue
+		}
+		reason += strings.ToUpper(word[:1]) + word[1:]
+	}
+	if reason == "" {
+		return "Unknown"
+	}
+	return reason
+}
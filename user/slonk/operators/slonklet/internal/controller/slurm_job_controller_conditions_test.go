@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestSetSlurmJobConditions(t *testing.T) {
+	status := &slonkv1.SlurmJobStatus{
+		SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{State: "RUNNING"},
+	}
+	setSlurmJobConditions(status, 1)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, CONDITION_JOB_RUNNING))
+	assert.True(t, meta.IsStatusConditionFalse(status.Conditions, CONDITION_JOB_COMPLETED))
+	assert.True(t, meta.IsStatusConditionFalse(status.Conditions, CONDITION_JOB_FAILED))
+	assert.Equal(t, "Running", meta.FindStatusCondition(status.Conditions, CONDITION_JOB_RUNNING).Reason)
+
+	status.SlurmJobRunCurrentStatus.State = "NODE_FAIL"
+	setSlurmJobConditions(status, 1)
+	assert.True(t, meta.IsStatusConditionFalse(status.Conditions, CONDITION_JOB_RUNNING))
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, CONDITION_JOB_FAILED))
+	assert.Equal(t, "NodeFail", meta.FindStatusCondition(status.Conditions, CONDITION_JOB_FAILED).Reason)
+
+	// Once removed, the last observed outcome is kept.
+	status.SlurmJobRunCurrentStatus = slonkv1.SlurmJobRunStatus{Removed: true}
+	setSlurmJobConditions(status, 1)
+	assert.Equal(t, CONDITION_REASON_JOB_REMOVED, meta.FindStatusCondition(status.Conditions, CONDITION_JOB_RUNNING).Reason)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, CONDITION_JOB_FAILED))
+
+	// A job removed before any outcome was observed is unknown.
+	status = &slonkv1.SlurmJobStatus{SlurmJobRunCurrentStatus: slonkv1.SlurmJobRunStatus{Removed: true}}
+	setSlurmJobConditions(status, 1)
+	assert.Equal(t, metav1.ConditionUnknown, meta.FindStatusCondition(status.Conditions, CONDITION_JOB_COMPLETED).Status)
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+const (
+	// Delay before retrying an object that failed to sync, doubled on every consecutive
+	// failure. Shorter than the sync period, so the first retry happens in the next iteration.
+	SYNC_RETRY_BASE_DELAY = 15 * time.Second
+	SYNC_RETRY_MAX_DELAY  = 30 * time.Minute
+)
+
+// SyncSummary counts the objects handled by a sync iteration.
+type SyncSummary struct {
+	Succeeded int
+	Failed    int
+	// Objects waiting for their retry, or without enough data to be synced.
+	Skipped int
+}
+
+// syncRetryQueue holds back objects that failed to sync, with a per-object exponential
+// backoff, so that one bad object neither blocks the others nor gets retried in a tight
+// loop. The zero value is ready to use.
+type syncRetryQueue struct {
+	sync.Mutex
+	rateLimiter workqueue.RateLimiter
+	retryAt     map[string]time.Time
+}
+
+func (q *syncRetryQueue) init() {
+	if q.rateLimiter == nil {
+		q.rateLimiter = workqueue.NewItemExponentialFailureRateLimiter(SYNC_RETRY_BASE_DELAY, SYNC_RETRY_MAX_DELAY)
+		q.retryAt = map[string]time.Time{}
+	}
+}
+
+// Ready returns whether the object may be synced, i.e. it didn't fail or its retry is due.
+func (q *syncRetryQueue) Ready(key string, now time.Time) bool {
+	q.Lock()
+	defer q.Unlock()
+	q.init()
+	retryAt, ok := q.retryAt[key]
+	return !ok || !now.Before(retryAt)
+}
+
+// Failed records a failure to sync the object, and returns when it is retried.
+func (q *syncRetryQueue) Failed(key string, now time.Time) time.Time {
+	q.Lock()
+	defer q.Unlock()
+	q.init()
+	retryAt := now.Add(q.rateLimiter.When(key))
+	q.retryAt[key] = retryAt
+	return retryAt
+}
+
+// Succeeded resets the backoff of the object.
+func (q *syncRetryQueue) Succeeded(key string) {
+	q.Lock()
+	defer q.Unlock()
+	q.init()
+	q.rateLimiter.Forget(key)
+	delete(q.retryAt, key)
+}
+
+// Failures returns the number of consecutive failures to sync the object.
+func (q *syncRetryQueue) Failures(key string) int {
+	q.Lock()
+	defer q.Unlock()
+	q.init()
+	return q.rateLimiter.NumRequeues(key)
+}
+
+// nextSyncFailure counts another failure to sync an object on top of the previous ones.
+func nextSyncFailure(failure *slonkv1.SyncFailureStatus, err error, now metav1.Time) *slonkv1.SyncFailureStatus {
+	next := &slonkv1.SyncFailureStatus{
+		Count:          1,
+		Message:        err.Error(),
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+	}
+	if failure != nil {
+		next.Count = failure.Count + 1
+		next.FirstTimestamp = failure.FirstTimestamp
+	}
+	return next
+}
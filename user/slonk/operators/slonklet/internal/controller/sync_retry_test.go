@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+func TestSyncIsolatesFailedPhysicalNodes(t *testing.T) {
+	// Setup test data.
+	setupTest(t)
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+	_ = corev1.AddToScheme(newScheme)
+
+	failCreate, failStatus := true, false
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(append(testPods, testNodes...)...).
+		WithStatusSubresource(&slonkv1.PhysicalNode{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, cli client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if failCreate && obj.GetName() == "fed" {
+					return fmt.Errorf("admission webhook denied the request")
+				}
+				return cli.Create(ctx, obj, opts...)
+			},
+			SubResourcePatch: func(ctx context.Context, cli client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				// Fail the status updates of the sync, but not the recording of the failure.
+				if physicalNode, ok := obj.(*slonkv1.PhysicalNode); ok && failStatus && physicalNode.Name == "cba" && physicalNode.Status.SyncFailure == nil {
+					return fmt.Errorf("etcdserver: request timed out")
+				}
+				return cli.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	r := &PhysicalNodeReconciler{
+		Client:   fakeClient,
+		Recorder: events.NewFakeRecorder(100),
+		Scheme:   scheme.Scheme,
+	}
+
+	slurmPodMap := map[string]*corev1.Pod{}
+	for _, obj := range testPods {
+		pod := obj.(*corev1.Pod)
+		slurmPodMap[pod.Name] = pod
+	}
+	k8sNodeMap := map[string]*corev1.Node{}
+	for _, obj := range testNodes {
+		node := obj.(*corev1.Node)
+		k8sNodeMap[node.Name] = node
+	}
+	slurmNodeMap := map[string]*slurm.SlurmNode{
+		"slurm-node-1": {Name: "slurm-node-1", State: []string{"IDLE"}},
+		"slurm-node-2": {Name: "slurm-node-2", State: []string{"IDLE"}},
+	}
+	getPhysicalNode := func(name string) (*slonkv1.PhysicalNode, error) {
+		physicalNode := &slonkv1.PhysicalNode{}
+		err := fakeClient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: SLURM_NAMESPACE}, physicalNode)
+		return physicalNode, err
+	}
+	sync := func() {
+		existingPhysicalNodeMap := map[string]*slonkv1.PhysicalNode{}
+		for _, name := range []string{"cba", "fed"} {
+			if physicalNode, err := getPhysicalNode(name); err == nil {
+				existingPhysicalNodeMap[name] = physicalNode
+			}
+		}
+		_, err := r.SyncSlurmAndK8sNodeSpecAndStatus(context.Background(), slurmNodeMap, slurmPodMap, k8sNodeMap, existingPhysicalNodeMap)
+		assert.NoError(t, err)
+	}
+
+	// The physical node that fails to be created doesn't block the other one.
+	sync()
+	_, err := getPhysicalNode("cba")
+	assert.NoError(t, err)
+	_, err = getPhysicalNode("fed")
+	assert.Error(t, err)
+	assert.Equal(t, 1, r.syncRetries.Failures("fed"))
+
+	// It's held back until its retry is due.
+	failCreate = false
+	sync()
+	_, err = getPhysicalNode("fed")
+	assert.Error(t, err)
+
+	// Failures of existing physical nodes are counted in their status.
+	delete(r.syncRetries.retryAt, "fed")
+	failStatus = true
+	slurmNodeMap["slurm-node-1"].State = []string{"ALLOCATED"}
+	sync()
+	_, err = getPhysicalNode("fed")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.syncRetries.Failures("fed"))
+	physicalNode, err := getPhysicalNode("cba")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"IDLE"}, physicalNode.Status.SlurmNodeStatus.State)
+	assert.NotNil(t, physicalNode.Status.SyncFailure)
+	assert.Equal(t, 1, physicalNode.Status.SyncFailure.Count)
+	assert.Contains(t, physicalNode.Status.SyncFailure.Message, "request timed out")
+
+	// The next successful sync clears them.
+	delete(r.syncRetries.retryAt, "cba")
+	failStatus = false
+	sync()
+	physicalNode, err = getPhysicalNode("cba")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ALLOCATED"}, physicalNode.Status.SlurmNodeStatus.State)
+	assert.Nil(t, physicalNode.Status.SyncFailure)
+}
+
+func TestPatchPhysicalNodeRetriesOnConflict(t *testing.T) {
+	newScheme := runtime.NewScheme()
+	_ = slonkv1.AddToScheme(newScheme)
+
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "cba", Namespace: SLURM_NAMESPACE},
+		Spec: slonkv1.PhysicalNodeSpec{
+			SlurmNodeSpec: slonkv1.SlurmNodeSpec{GoalState: GoalStateUp},
+		},
+	}
+	fakeClient := newFakeClientBuilder().
+		WithScheme(newScheme).
+		WithRuntimeObjects(physicalNode).
+		WithStatusSubresource(physicalNode).
+		Build()
+	r := &PhysicalNodeReconciler{Client: fakeClient}
+	key := types.NamespacedName{Name: "cba", Namespace: SLURM_NAMESPACE}
+
+	listed := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), key, listed))
+
+	// An operator changes the physical node after it was listed.
+	concurrent := listed.DeepCopy()
+	concurrent.Spec.Manual = true
+	assert.NoError(t, fakeClient.Update(context.Background(), concurrent))
+	concurrent.Status.MaintenanceCount = 1
+	assert.NoError(t, fakeClient.Status().Update(context.Background(), concurrent))
+
+	// The stale changes conflict, and are made again on the latest physical node.
+	assert.NoError(t, r.patchPhysicalNode(context.Background(), listed, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Spec.SlurmNodeSpec.GoalState = GoalStateDrain
+	}))
+	assert.NoError(t, r.patchPhysicalNodeStatus(context.Background(), listed, func(physicalNode *slonkv1.PhysicalNode) {
+		physicalNode.Status.MaintenanceCount++
+	}))
+
+	updated := &slonkv1.PhysicalNode{}
+	assert.NoError(t, fakeClient.Get(context.Background(), key, updated))
+	assert.Equal(t, GoalStateDrain, updated.Spec.SlurmNodeSpec.GoalState)
+	assert.True(t, updated.Spec.Manual)
+	assert.Equal(t, 2, updated.Status.MaintenanceCount)
+	assert.Equal(t, updated.ResourceVersion, listed.ResourceVersion)
+}
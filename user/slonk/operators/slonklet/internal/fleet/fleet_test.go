@@ -0,0 +1,120 @@
+package fleet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestResolver(t *testing.T) {
+	now := time.Now()
+	physicalNodes := []slonkv1.PhysicalNode{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "abc"},
+			Status: slonkv1.PhysicalNodeStatus{
+				SlurmNodeStatus: slonkv1.SlurmNodeStatus{Name: "slurm-h100-1"},
+				K8sNodeStatus:   slonkv1.K8sNodeStatus{Name: "gke-h100-1"},
+				SlurmNodeStatusHistory: []slonkv1.SlurmNodeStatus{
+					{Name: "slurm-h100-7", Timestamp: metav1.NewTime(now.Add(-2 * time.Hour))},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "def"},
+			Status: slonkv1.PhysicalNodeStatus{
+				SlurmNodeStatus: slonkv1.SlurmNodeStatus{Removed: true},
+				K8sNodeStatus:   slonkv1.K8sNodeStatus{Name: "gke-h100-2"},
+				SlurmNodeStatusHistory: []slonkv1.SlurmNodeStatus{
+					{Name: "slurm-h100-7", Timestamp: metav1.NewTime(now.Add(-time.Hour))},
+					{Name: "slurm-h100-1", Timestamp: metav1.NewTime(now.Add(-3 * time.Hour))},
+				},
+			},
+		},
+	}
+	snapshot := []slonkv1.PhysicalNode{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "def"},
+			Status: slonkv1.PhysicalNodeStatus{
+				K8sNodeStatus: slonkv1.K8sNodeStatus{Name: "gke-h100-old", Timestamp: metav1.NewTime(now.Add(-48 * time.Hour))},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "gone"},
+			Status: slonkv1.PhysicalNodeStatus{
+				K8sNodeStatus: slonkv1.K8sNodeStatus{Name: "gke-h100-gone"},
+			},
+		},
+	}
+	resolver := NewResolver(physicalNodes, snapshot)
+
+	match, _, ok := resolver.ResolveOne("def")
+	assert.True(t, ok)
+	assert.Equal(t, Match{PhysicalNode: "def", MatchedBy: MATCH_PHYSICAL}, match)
+
+	// The current owner of a name wins over previous ones.
+	match, _, ok = resolver.ResolveOne("slurm-h100-1")
+	assert.True(t, ok)
+	assert.Equal(t, Match{PhysicalNode: "abc", MatchedBy: MATCH_SLURM}, match)
+
+	// Names only in a snapshot resolve too.
+	match, _, ok = resolver.ResolveOne("gke-h100-old")
+	assert.True(t, ok)
+	assert.Equal(t, "def", match.PhysicalNode)
+	assert.Equal(t, MATCH_K8S_HISTORY, match.MatchedBy)
+
+	// A historical name of several hosts is ambiguous, the most recent first.
+	_, candidates, ok := resolver.ResolveOne("slurm-h100-7")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"def", "abc"}, []string{candidates[0].PhysicalNode, candidates[1].PhysicalNode})
+
+	_, candidates, ok = resolver.ResolveOne("gke-h100-gone")
+	assert.False(t, ok)
+	assert.Empty(t, candidates)
+}
+
+func TestApplyMetadataChanges(t *testing.T) {
+	_, err := ParseMetadataChange("sdc-hunt", false)
+	assert.Error(t, err)
+	_, err = ParseMetadataChange("sdc-hunt=not valid", false)
+	assert.Error(t, err)
+
+	add, err := ParseMetadataChange("sdc-hunt-20240507=true", false)
+	assert.NoError(t, err)
+	remove, err := ParseMetadataChange("example.com/ticket-", true)
+	assert.NoError(t, err)
+	update, err := ParseMetadataChange("example.com/note=GPU 3 swapped", true)
+	assert.NoError(t, err)
+
+	physicalNode := &slonkv1.PhysicalNode{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"example.com/ticket": "123", "example.com/note": "none"},
+		},
+	}
+	diff := ApplyMetadataChanges(physicalNode, []MetadataChange{add, remove, update})
+	assert.Equal(t, []string{
+		"+ labels.sdc-hunt-20240507=true",
+		"- annotations.example.com/ticket=123",
+		"- annotations.example.com/note=none",
+		"+ annotations.example.com/note=GPU 3 swapped",
+	}, diff)
+	assert.Equal(t, map[string]string{"sdc-hunt-20240507": "true"}, physicalNode.Labels)
+	assert.Equal(t, map[string]string{"example.com/note": "GPU 3 swapped"}, physicalNode.Annotations)
+
+	assert.Empty(t, ApplyMetadataChanges(physicalNode, []MetadataChange{add, remove, update}))
+}
+
+func TestReadNames(t *testing.T) {
+	names, err := ReadNames(strings.NewReader(`# SDC hunt
+gke-h100-1 gke-h100-2
+slurm-h100-7  # from the job logs
+
+gke-h100-1
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gke-h100-1", "gke-h100-2", "slurm-h100-7"}, names)
+}
@@ -0,0 +1,111 @@
+package fleet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// MetadataChange adds or removes a label or an annotation.
+type MetadataChange struct {
+	Annotation bool
+	Key        string
+	Value      string
+	Remove     bool
+}
+
+// ParseMetadataChange parses a change in kubectl syntax: key=value sets it, key- removes it.
+func ParseMetadataChange(spec string, annotation bool) (MetadataChange, error) {
+	change := MetadataChange{Annotation: annotation}
+	if key, value, ok := strings.Cut(spec, "="); ok {
+		change.Key = key
+		change.Value = value
+	} else if strings.HasSuffix(spec, "-") {
+		change.Key = strings.TrimSuffix(spec, "-")
+		change.Remove = true
+	} else {
+		return change, fmt.Errorf("invalid change %q, expected key=value or key-", spec)
+	}
+
+	if errs := validation.IsQualifiedName(change.Key); len(errs) > 0 {
+		return change, fmt.Errorf("invalid key %q: %s", change.Key, strings.Join(errs, ", "))
+	}
+	if !annotation && !change.Remove {
+		if errs := validation.IsValidLabelValue(change.Value); len(errs) > 0 {
+			return change, fmt.Errorf("invalid label value %q: %s", change.Value, strings.Join(errs, ", "))
+		}
+	}
+	return change, nil
+}
+
+func (c MetadataChange) field() string {
+	if c.Annotation {
+		return "annotations"
+	}
+	return "labels"
+}
+
+// ApplyMetadataChanges applies the changes to the object, and returns the diff of its
+// labels and annotations, empty if nothing changed.
+func ApplyMetadataChanges(obj metav1.Object, changes []MetadataChange) []string {
+	diff := []string{}
+	for _, change := range changes {
+		values := obj.GetLabels()
+		if change.Annotation {
+			values = obj.GetAnnotations()
+		}
+		oldValue, exists := values[change.Key]
+
+		if change.Remove {
+			if !exists {
+				continue
+			}
+			delete(values, change.Key)
+			diff = append(diff, fmt.Sprintf("- %s.%s=%s", change.field(), change.Key, oldValue))
+		} else {
+			if exists && oldValue == change.Value {
+				continue
+			}
+			if values == nil {
+				values = map[string]string{}
+			}
+			values[change.Key] = change.Value
+			if exists {
+				diff = append(diff, fmt.Sprintf("- %s.%s=%s", change.field(), change.Key, oldValue))
+			}
+			diff = append(diff, fmt.Sprintf("+ %s.%s=%s", change.field(), change.Key, change.Value))
+		}
+
+		if change.Annotation {
+			obj.SetAnnotations(values)
+		} else {
+			obj.SetLabels(values)
+		}
+	}
+	return diff
+}
+
+// ReadNames reads whitespace separated names, skipping comments from # to the end of line.
+// Duplicates are dropped, the first occurrence keeps its place.
+func ReadNames(r io.Reader) ([]string, error) {
+	names := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, name := range strings.Fields(line) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read names: %w", err)
+	}
+	return names, nil
+}
@@ -0,0 +1,137 @@
+package fleet
+
+import (
+	"sort"
+	"time"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+// How a name matched a physical node.
+const (
+	MATCH_PHYSICAL      = "physical"
+	MATCH_K8S           = "k8s"
+	MATCH_SLURM         = "slurm"
+	MATCH_K8S_HISTORY   = "k8s-history"
+	MATCH_SLURM_HISTORY = "slurm-history"
+)
+
+// Match is a physical node a name resolved to.
+type Match struct {
+	PhysicalNode string `json:"physicalNode"`
+	MatchedBy    string `json:"matchedBy"`
+	// When the name was last seen on the physical node, zero for current names.
+	LastSeen time.Time `json:"lastSeen,omitempty"`
+}
+
+// IsCurrent returns whether the name currently belongs to the physical node.
+func (m Match) IsCurrent() bool {
+	return m.MatchedBy == MATCH_PHYSICAL || m.MatchedBy == MATCH_K8S || m.MatchedBy == MATCH_SLURM
+}
+
+// Resolver finds the physical nodes behind k8s, slurm or physical node names, current or
+// historical. Slurm pod names move between hosts, so a historical name may resolve to
+// several physical nodes.
+type Resolver struct {
+	physicalNodes map[string]bool
+	matches       map[string][]Match
+}
+
+// NewResolver indexes the names of the physical nodes. Snapshots are older copies of
+// physical nodes, e.g. from a `kubectl get -o yaml` dump, that extend their status history.
+func NewResolver(physicalNodes []slonkv1.PhysicalNode, snapshots ...[]slonkv1.PhysicalNode) *Resolver {
+	r := &Resolver{
+		physicalNodes: map[string]bool{},
+		matches:       map[string][]Match{},
+	}
+	for i := range physicalNodes {
+		physicalNode := &physicalNodes[i]
+		r.physicalNodes[physicalNode.Name] = true
+		r.add(physicalNode.Name, physicalNode.Name, MATCH_PHYSICAL, time.Time{})
+		r.addStatus(physicalNode, true)
+	}
+	for _, snapshot := range snapshots {
+		for i := range snapshot {
+			// Names of physical nodes that no longer exist can't be acted on.
+			if r.physicalNodes[snapshot[i].Name] {
+				r.addStatus(&snapshot[i], false)
+			}
+		}
+	}
+	for name := range r.matches {
+		sortMatches(r.matches[name])
+	}
+	return r
+}
+
+func (r *Resolver) addStatus(physicalNode *slonkv1.PhysicalNode, current bool) {
+	status := &physicalNode.Status
+	if current {
+		if status.K8sNodeStatus.Name != "" && !status.K8sNodeStatus.Removed {
+			r.add(status.K8sNodeStatus.Name, physicalNode.Name, MATCH_K8S, time.Time{})
+		}
+		if status.SlurmNodeStatus.Name != "" && !status.SlurmNodeStatus.Removed {
+			r.add(status.SlurmNodeStatus.Name, physicalNode.Name, MATCH_SLURM, time.Time{})
+		}
+	} else {
+		r.add(status.K8sNodeStatus.Name, physicalNode.Name, MATCH_K8S_HISTORY, status.K8sNodeStatus.Timestamp.Time)
+		r.add(status.SlurmNodeStatus.Name, physicalNode.Name, MATCH_SLURM_HISTORY, status.SlurmNodeStatus.Timestamp.Time)
+	}
+	for _, k8sNodeStatus := range status.K8sNodeStatusHistory {
+		r.add(k8sNodeStatus.Name, physicalNode.Name, MATCH_K8S_HISTORY, k8sNodeStatus.Timestamp.Time)
+	}
+	for _, slurmNodeStatus := range status.SlurmNodeStatusHistory {
+		r.add(slurmNodeStatus.Name, physicalNode.Name, MATCH_SLURM_HISTORY, slurmNodeStatus.Timestamp.Time)
+	}
+}
+
+// add records that the name belonged to the physical node, keeping the best match per
+// physical node.
+func (r *Resolver) add(name string, physicalNodeName string, matchedBy string, lastSeen time.Time) {
+	if name == "" {
+		return
+	}
+	match := Match{PhysicalNode: physicalNodeName, MatchedBy: matchedBy, LastSeen: lastSeen}
+	for i, existing := range r.matches[name] {
+		if existing.PhysicalNode != physicalNodeName {
+			continue
+		}
+		if existing.IsCurrent() || (!match.IsCurrent() && !existing.LastSeen.Before(lastSeen)) {
+			return
+		}
+		r.matches[name][i] = match
+		return
+	}
+	r.matches[name] = append(r.matches[name], match)
+}
+
+// Resolve returns the physical nodes the name belongs or belonged to, current names first,
+// then the most recently seen.
+func (r *Resolver) Resolve(name string) []Match {
+	return append([]Match{}, r.matches[name]...)
+}
+
+// ResolveOne returns the single physical node the name stands for: the one it currently
+// belongs to, or the only one it belonged to. It returns the matches when that's ambiguous.
+func (r *Resolver) ResolveOne(name string) (Match, []Match, bool) {
+	matches := r.matches[name]
+	if len(matches) == 0 {
+		return Match{}, nil, false
+	}
+	if matches[0].IsCurrent() || len(matches) == 1 {
+		return matches[0], nil, true
+	}
+	return Match{}, r.Resolve(name), false
+}
+
+func sortMatches(matches []Match) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].IsCurrent() != matches[j].IsCurrent() {
+			return matches[i].IsCurrent()
+		}
+		if !matches[i].LastSeen.Equal(matches[j].LastSeen) {
+			return matches[i].LastSeen.After(matches[j].LastSeen)
+		}
+		return matches[i].PhysicalNode < matches[j].PhysicalNode
+	})
+}
@@ -0,0 +1,264 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	KIND_SLURM_STATUS     = "SlurmStatus"
+	KIND_K8S_STATUS       = "K8sStatus"
+	KIND_SLURM_GOAL_STATE = "SlurmGoalState"
+	KIND_K8S_GOAL_STATE   = "K8sGoalState"
+	KIND_EVENT            = "Event"
+	KIND_INVENTORY        = "Inventory"
+
+	DEFAULT_RETENTION = 180 * 24 * time.Hour
+	DEFAULT_LIMIT     = 1000
+
+	DB_FILE      = "history.db"
+	DB_TIMEOUT   = 10 * time.Second
+	PRUNE_PERIOD = time.Hour
+)
+
+var (
+	// Records keyed by timestamp and sequence number.
+	recordsBucket = []byte("records")
+	// One bucket per physical node, with the keys of its records.
+	physicalNodesBucket = []byte("physicalNodes")
+)
+
+// Record is a single entry in the history of a physical node.
+type Record struct {
+	Timestamp    time.Time       `json:"timestamp"`
+	PhysicalNode string          `json:"physicalNode"`
+	Kind         string          `json:"kind"`
+	Data         json.RawMessage `json:"data,omitempty"`
+}
+
+// NewRecord creates a record with the JSON encoding of data.
+func NewRecord(timestamp time.Time, physicalNode string, kind string, data interface{}) (Record, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Record{}, fmt.Errorf("marshal %s record: %w", kind, err)
+	}
+	return Record{
+		Timestamp:    timestamp.UTC(),
+		PhysicalNode: physicalNode,
+		Kind:         kind,
+		Data:         encoded,
+	}, nil
+}
+
+// Store is an archive of physical node history, kept outside etcd so it can cover months.
+// Records are kept in a bbolt database indexed by time and physical node, so queries only
+// read the records they return, and records older than the retention are deleted
+// periodically. A nil store discards all records.
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+	// When records were last pruned, guarded by the write transactions.
+	lastPrune time.Time
+}
+
+// Open opens the store in dir, creating the directory if needed. Zero retention keeps
+// records forever.
+func Open(dir string, retention time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create history directory: %w", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, DB_FILE), 0o644, &bolt.Options{Timeout: DB_TIMEOUT})
+	if err != nil {
+		return nil, fmt.Errorf("open history database: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(recordsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(physicalNodesBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create history buckets: %w", err)
+	}
+	s := &Store{
+		db:        db,
+		retention: retention,
+	}
+	if err := s.Prune(time.Now()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append writes the records.
+func (s *Store) Append(records ...Record) error {
+	if s == nil || len(records) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, record := range records {
+			if err := putRecord(tx, record); err != nil {
+				return err
+			}
+		}
+		// Old records are deleted along with the writes.
+		now := time.Now()
+		if now.Sub(s.lastPrune) < PRUNE_PERIOD {
+			return nil
+		}
+		s.lastPrune = now
+		return s.pruneTx(tx, now)
+	})
+}
+
+// Record appends a single record with the current time.
+func (s *Store) Record(physicalNode string, kind string, data interface{}) error {
+	if s == nil {
+		return nil
+	}
+	record, err := NewRecord(time.Now(), physicalNode, kind, data)
+	if err != nil {
+		return err
+	}
+	return s.Append(record)
+}
+
+// Query returns the records of the physical node within [from, to), oldest first. An
+// empty physical node matches all of them. At most limit records are returned, the most
+// recent ones are kept.
+func (s *Store) Query(physicalNode string, from time.Time, to time.Time, limit int) ([]Record, error) {
+	if s == nil {
+		return []Record{}, nil
+	}
+	if limit <= 0 {
+		limit = DEFAULT_LIMIT
+	}
+
+	records := []Record{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		all := tx.Bucket(recordsBucket)
+		index := all
+		if physicalNode != "" {
+			index = tx.Bucket(physicalNodesBucket).Bucket([]byte(physicalNode))
+			if index == nil {
+				return nil
+			}
+		}
+
+		// Walk back from the end of the range, so the limit keeps the most recent records.
+		fromKey := timestampPrefix(from)
+		cursor := index.Cursor()
+		key, _ := cursor.Seek(timestampPrefix(to))
+		if key == nil {
+			key, _ = cursor.Last()
+		} else {
+			key, _ = cursor.Prev()
+		}
+		for ; key != nil && bytes.Compare(key, fromKey) >= 0 && len(records) < limit; key, _ = cursor.Prev() {
+			var record Record
+			if err := json.Unmarshal(all.Get(key), &record); err != nil {
+				return fmt.Errorf("decode history record: %w", err)
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+// Prune deletes the records older than the retention.
+func (s *Store) Prune(now time.Time) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		s.lastPrune = now
+		return s.pruneTx(tx, now)
+	})
+}
+
+func (s *Store) pruneTx(tx *bolt.Tx, now time.Time) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	oldestKey := timestampPrefix(now.Add(-s.retention))
+	all := tx.Bucket(recordsBucket)
+	physicalNodes := tx.Bucket(physicalNodesBucket)
+	cursor := all.Cursor()
+	for key, value := cursor.First(); key != nil && bytes.Compare(key, oldestKey) < 0; key, value = cursor.First() {
+		var record Record
+		if err := json.Unmarshal(value, &record); err == nil {
+			if index := physicalNodes.Bucket([]byte(record.PhysicalNode)); index != nil {
+				if err := index.Delete(key); err != nil {
+					return fmt.Errorf("delete history index entry: %w", err)
+				}
+			}
+		}
+		if err := cursor.Delete(); err != nil {
+			return fmt.Errorf("delete history record: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// putRecord writes the record and indexes it by its physical node. Keys are the timestamp
+// followed by a sequence number, so records with the same timestamp don't collide.
+func putRecord(tx *bolt.Tx, record Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal history record: %w", err)
+	}
+	all := tx.Bucket(recordsBucket)
+	sequence, err := all.NextSequence()
+	if err != nil {
+		return fmt.Errorf("next history sequence: %w", err)
+	}
+	key := binary.BigEndian.AppendUint64(timestampPrefix(record.Timestamp), sequence)
+	if err := all.Put(key, value); err != nil {
+		return fmt.Errorf("write history record: %w", err)
+	}
+	index, err := tx.Bucket(physicalNodesBucket).CreateBucketIfNotExists([]byte(record.PhysicalNode))
+	if err != nil {
+		return fmt.Errorf("create history index of %s: %w", record.PhysicalNode, err)
+	}
+	if err := index.Put(key, nil); err != nil {
+		return fmt.Errorf("write history index entry: %w", err)
+	}
+	return nil
+}
+
+// timestampPrefix returns the key prefix of records at the timestamp, which sorts in time
+// order for timestamps since 1970.
+func timestampPrefix(timestamp time.Time) []byte {
+	nanos := timestamp.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(nanos))
+}
@@ -0,0 +1,78 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreAppendAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, 0)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	start := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	records := []Record{}
+	for i, physicalNode := range []string{"abc", "def", "abc", "abc"} {
+		record, err := NewRecord(start.Add(time.Duration(i)*time.Hour), physicalNode, KIND_SLURM_STATUS,
+			map[string]interface{}{"state": []string{"IDLE"}, "index": i})
+		assert.NoError(t, err)
+		records = append(records, record)
+	}
+	assert.NoError(t, store.Append(records...))
+
+	result, err := store.Query("abc", start, start.Add(24*time.Hour), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(result))
+	assert.Equal(t, start, result[0].Timestamp)
+	var data map[string]interface{}
+	assert.NoError(t, json.Unmarshal(result[2].Data, &data))
+	assert.Equal(t, float64(3), data["index"])
+
+	// The range end is exclusive, and the limit keeps the most recent records.
+	result, err = store.Query("", start, start.Add(3*time.Hour), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "def", result[0].PhysicalNode)
+	assert.Equal(t, "abc", result[1].PhysicalNode)
+
+	// Records survive reopening the store.
+	assert.NoError(t, store.Close())
+	store, err = Open(dir, 0)
+	assert.NoError(t, err)
+	result, err = store.Query("def", start, start.Add(24*time.Hour), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result))
+}
+
+func TestStorePrune(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, 48*time.Hour)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	old, err := NewRecord(now.Add(-5*24*time.Hour), "abc", KIND_EVENT, map[string]string{"reason": "old"})
+	assert.NoError(t, err)
+	recent, err := NewRecord(now.Add(-24*time.Hour), "abc", KIND_EVENT, map[string]string{"reason": "recent"})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Append(old, recent))
+
+	assert.NoError(t, store.Prune(now))
+	result, err := store.Query("abc", now.Add(-30*24*time.Hour), now, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, recent.Timestamp, result[0].Timestamp)
+}
+
+func TestNilStore(t *testing.T) {
+	var store *Store
+	assert.NoError(t, store.Record("abc", KIND_EVENT, map[string]string{}))
+	result, err := store.Query("abc", time.Time{}, time.Now(), 0)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+	assert.NoError(t, store.Close())
+}
@@ -0,0 +1,242 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+const (
+	PROC_CPUINFO          = "/proc/cpuinfo"
+	PROC_MEMINFO          = "/proc/meminfo"
+	PROC_KERNEL_OSRELEASE = "/proc/sys/kernel/osrelease"
+
+	NVIDIA_SMI_TIMEOUT = time.Minute
+)
+
+// nvidiaSMILog is the part of `nvidia-smi -q -x` we care about.
+type nvidiaSMILog struct {
+	DriverVersion string         `xml:"driver_version"`
+	CUDAVersion   string         `xml:"cuda_version"`
+	GPUs          []nvidiaSMIGPU `xml:"gpu"`
+}
+
+type nvidiaSMIGPU struct {
+	ID           string `xml:"id,attr"`
+	ProductName  string `xml:"product_name"`
+	Serial       string `xml:"serial"`
+	UUID         string `xml:"uuid"`
+	MinorNumber  string `xml:"minor_number"`
+	VBIOSVersion string `xml:"vbios_version"`
+	FBMemory     struct {
+		Total string `xml:"total"`
+	} `xml:"fb_memory_usage"`
+}
+
+// Collect gathers the inventory of the local host. A host without nvidia-smi reports no GPUs.
+func Collect(ctx context.Context) (*slonkv1.HardwareInventory, error) {
+	inventory := &slonkv1.HardwareInventory{}
+
+	if _, err := exec.LookPath("nvidia-smi"); err == nil {
+		ctx, cancel := context.WithTimeout(ctx, NVIDIA_SMI_TIMEOUT)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "nvidia-smi", "-q", "-x").Output()
+		if err != nil {
+			return nil, fmt.Errorf("run nvidia-smi: %w", err)
+		}
+		if err := ParseNvidiaSMI(bytes.NewReader(out), inventory); err != nil {
+			return nil, err
+		}
+	}
+
+	cpuInfo, err := os.Open(PROC_CPUINFO)
+	if err != nil {
+		return nil, fmt.Errorf("open cpuinfo: %w", err)
+	}
+	defer cpuInfo.Close()
+	if err := ParseCPUInfo(cpuInfo, inventory); err != nil {
+		return nil, err
+	}
+
+	memInfo, err := os.Open(PROC_MEMINFO)
+	if err != nil {
+		return nil, fmt.Errorf("open meminfo: %w", err)
+	}
+	defer memInfo.Close()
+	if err := ParseMemInfo(memInfo, inventory); err != nil {
+		return nil, err
+	}
+
+	kernelVersion, err := os.ReadFile(PROC_KERNEL_OSRELEASE)
+	if err != nil {
+		return nil, fmt.Errorf("read kernel version: %w", err)
+	}
+	inventory.KernelVersion = strings.TrimSpace(string(kernelVersion))
+
+	inventory.Timestamp = metav1.Now()
+	return inventory, nil
+}
+
+// ParseNvidiaSMI reads the driver and GPUs from the XML output of `nvidia-smi -q -x`. GPUs
+// are sorted by minor number.
+func ParseNvidiaSMI(r io.Reader, inventory *slonkv1.HardwareInventory) error {
+	smiLog := nvidiaSMILog{}
+	if err := xml.NewDecoder(r).Decode(&smiLog); err != nil {
+		return fmt.Errorf("decode nvidia-smi output: %w", err)
+	}
+
+	inventory.DriverVersion = strings.TrimSpace(smiLog.DriverVersion)
+	inventory.CUDAVersion = strings.TrimSpace(smiLog.CUDAVersion)
+	inventory.GPUs = []slonkv1.GPUInventory{}
+	for _, gpu := range smiLog.GPUs {
+		index, err := strconv.Atoi(strings.TrimSpace(gpu.MinorNumber))
+		if err != nil {
+			return fmt.Errorf("parse minor number of GPU %s: %w", gpu.ID, err)
+		}
+		memoryMiB := 0
+		if total := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(gpu.FBMemory.Total), "MiB")); total != "" {
+			memoryMiB, err = strconv.Atoi(total)
+			if err != nil {
+				return fmt.Errorf("parse memory of GPU %s: %w", gpu.ID, err)
+			}
+		}
+		inventory.GPUs = append(inventory.GPUs, slonkv1.GPUInventory{
+			Index:        index,
+			PCIBusID:     gpu.ID,
+			ProductName:  strings.TrimSpace(gpu.ProductName),
+			Serial:       strings.TrimSpace(gpu.Serial),
+			UUID:         strings.TrimSpace(gpu.UUID),
+			VBIOSVersion: strings.TrimSpace(gpu.VBIOSVersion),
+			MemoryMiB:    memoryMiB,
+		})
+	}
+	sort.Slice(inventory.GPUs, func(i, j int) bool {
+		return inventory.GPUs[i].Index < inventory.GPUs[j].Index
+	})
+	return nil
+}
+
+// ParseCPUInfo reads the CPU model and the number of logical CPUs from /proc/cpuinfo.
+func ParseCPUInfo(r io.Reader, inventory *slonkv1.HardwareInventory) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			inventory.CPUCount++
+		case "model name":
+			if inventory.CPUModel == "" {
+				inventory.CPUModel = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read cpuinfo: %w", err)
+	}
+	return nil
+}
+
+// ParseMemInfo reads the total memory from /proc/meminfo.
+func ParseMemInfo(r io.Reader, inventory *slonkv1.HardwareInventory) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kiB, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse MemTotal: %w", err)
+		}
+		inventory.MemoryBytes = kiB * 1024
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read meminfo: %w", err)
+	}
+	return fmt.Errorf("no MemTotal in meminfo")
+}
+
+// Change is a single difference between two inventories of a host.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Diff lists what changed from old to new, ignoring when they were collected. GPUs are
+// matched by minor number.
+func Diff(old *slonkv1.HardwareInventory, new *slonkv1.HardwareInventory) []Change {
+	if old == nil {
+		old = &slonkv1.HardwareInventory{}
+	}
+	if new == nil {
+		new = &slonkv1.HardwareInventory{}
+	}
+
+	changes := []Change{}
+	compare := func(field string, oldValue string, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, Change{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	compare("driverVersion", old.DriverVersion, new.DriverVersion)
+	compare("cudaVersion", old.CUDAVersion, new.CUDAVersion)
+	compare("cpuModel", old.CPUModel, new.CPUModel)
+	compare("cpuCount", formatInt(int64(old.CPUCount)), formatInt(int64(new.CPUCount)))
+	compare("memoryBytes", formatInt(old.MemoryBytes), formatInt(new.MemoryBytes))
+	compare("kernelVersion", old.KernelVersion, new.KernelVersion)
+
+	oldGPUs := map[int]slonkv1.GPUInventory{}
+	for _, gpu := range old.GPUs {
+		oldGPUs[gpu.Index] = gpu
+	}
+	newGPUs := map[int]slonkv1.GPUInventory{}
+	for _, gpu := range new.GPUs {
+		newGPUs[gpu.Index] = gpu
+	}
+	indexes := []int{}
+	for index := range oldGPUs {
+		indexes = append(indexes, index)
+	}
+	for index := range newGPUs {
+		if _, ok := oldGPUs[index]; !ok {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		oldGPU, newGPU := oldGPUs[index], newGPUs[index]
+		prefix := fmt.Sprintf("gpus[%d].", index)
+		compare(prefix+"pciBusID", oldGPU.PCIBusID, newGPU.PCIBusID)
+		compare(prefix+"productName", oldGPU.ProductName, newGPU.ProductName)
+		compare(prefix+"serial", oldGPU.Serial, newGPU.Serial)
+		compare(prefix+"uuid", oldGPU.UUID, newGPU.UUID)
+		compare(prefix+"vbiosVersion", oldGPU.VBIOSVersion, newGPU.VBIOSVersion)
+		compare(prefix+"memoryMiB", formatInt(int64(oldGPU.MemoryMiB)), formatInt(int64(newGPU.MemoryMiB)))
+	}
+	return changes
+}
+
+func formatInt(value int64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
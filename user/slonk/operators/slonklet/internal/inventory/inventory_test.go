@@ -0,0 +1,90 @@
+package inventory
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestParseNvidiaSMI(t *testing.T) {
+	f, err := os.Open("testdata/nvidia-smi.xml")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	inventory := &slonkv1.HardwareInventory{}
+	assert.NoError(t, ParseNvidiaSMI(f, inventory))
+	assert.Equal(t, "535.104.05", inventory.DriverVersion)
+	assert.Equal(t, "12.2", inventory.CUDAVersion)
+	assert.Equal(t, []slonkv1.GPUInventory{
+		{
+			Index:        0,
+			PCIBusID:     "00000000:04:00.0",
+			ProductName:  "NVIDIA H100 80GB HBM3",
+			Serial:       "1652923030874",
+			UUID:         "GPU-9a0c3d51-62f7-1e8b-b0d2-3c4e5f6a7b8c",
+			VBIOSVersion: "96.00.74.00.01",
+			MemoryMiB:    81559,
+		},
+		{
+			Index:        1,
+			PCIBusID:     "00000000:8F:00.0",
+			ProductName:  "NVIDIA H100 80GB HBM3",
+			Serial:       "1652923031221",
+			UUID:         "GPU-1f4b6a2e-08c5-9c3d-44a1-7be2f1a5c901",
+			VBIOSVersion: "96.00.74.00.01",
+			MemoryMiB:    81559,
+		},
+	}, inventory.GPUs)
+
+	assert.Error(t, ParseNvidiaSMI(strings.NewReader("<nvidia_smi_log>"), inventory))
+}
+
+func TestParseProc(t *testing.T) {
+	cpuInfo := `processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) Platinum 8481C CPU @ 2.70GHz
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) Platinum 8481C CPU @ 2.70GHz
+`
+	memInfo := `MemTotal:       1923462568 kB
+MemFree:        1851234560 kB
+`
+	inventory := &slonkv1.HardwareInventory{}
+	assert.NoError(t, ParseCPUInfo(strings.NewReader(cpuInfo), inventory))
+	assert.NoError(t, ParseMemInfo(strings.NewReader(memInfo), inventory))
+	assert.Equal(t, "Intel(R) Xeon(R) Platinum 8481C CPU @ 2.70GHz", inventory.CPUModel)
+	assert.Equal(t, 2, inventory.CPUCount)
+	assert.Equal(t, int64(1923462568*1024), inventory.MemoryBytes)
+
+	assert.Error(t, ParseMemInfo(strings.NewReader("MemFree: 1 kB\n"), inventory))
+}
+
+func TestDiff(t *testing.T) {
+	old := &slonkv1.HardwareInventory{
+		DriverVersion: "535.104.05",
+		GPUs: []slonkv1.GPUInventory{
+			{Index: 0, Serial: "1652923030874"},
+			{Index: 1, Serial: "1652923031221"},
+		},
+	}
+	new := old.DeepCopy()
+	new.DriverVersion = "550.54.15"
+	new.GPUs[1].Serial = "1652923039999"
+
+	assert.Equal(t, []Change{
+		{Field: "driverVersion", Old: "535.104.05", New: "550.54.15"},
+		{Field: "gpus[1].serial", Old: "1652923031221", New: "1652923039999"},
+	}, Diff(old, new))
+	assert.Empty(t, Diff(old, old))
+	assert.Equal(t, []Change{
+		{Field: "driverVersion", New: "535.104.05"},
+		{Field: "gpus[0].serial", New: "1652923030874"},
+		{Field: "gpus[1].serial", New: "1652923031221"},
+	}, Diff(nil, old))
+}
@@ -0,0 +1,48 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+const REPORT_TIMEOUT = 10 * time.Second
+
+// Report sends the inventory of the k8s node to the info server of the controller at
+// controllerURL, e.g. http://slonklet-api:18080. The token authenticates the agent, it's the
+// service account token of its pod.
+func Report(ctx context.Context, controllerURL string, k8sNodeName string, token string, inventory *slonkv1.HardwareInventory) error {
+	ctx, cancel := context.WithTimeout(ctx, REPORT_TIMEOUT)
+	defer cancel()
+
+	body, err := json.Marshal(inventory)
+	if err != nil {
+		return fmt.Errorf("marshal inventory: %w", err)
+	}
+	requestURL := fmt.Sprintf("%s/inventory/%s", strings.TrimSuffix(controllerURL, "/"), url.PathEscape(k8sNodeName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create inventory request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send inventory: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("controller responded %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
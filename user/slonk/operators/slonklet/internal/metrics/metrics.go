@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"your-org.com/slonklet/internal/budget"
+)
+
+const (
+	NAMESPACE = "slonklet"
+
+	// Phases of a sync iteration.
+	PHASE_SLURM_FETCH         = "slurm_fetch"
+	PHASE_K8S_LIST            = "k8s_list"
+	PHASE_STATUS_SYNC         = "status_sync"
+	PHASE_MANUAL_OVERRIDES    = "manual_overrides"
+	PHASE_UNREGISTERED_PODS   = "unregistered_pods"
+	PHASE_TAINT_PROPAGATION   = "taint_propagation"
+	PHASE_MAINTENANCE         = "maintenance"
+	PHASE_REMEDIATION         = "remediation"
+	PHASE_CONDITIONS          = "conditions"
+	PHASE_SLURM_JOB_SYNC      = "slurm_job_sync"
+	PHASE_NODE_HUNT_SYNC      = "node_hunt_sync"
+	PHASE_PHYSICAL_NODE_TOTAL = "physical_node_total"
+)
+
+var (
+	PhysicalNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "physical_nodes",
+		Help:      "Physical nodes by slurm and k8s goal state, slurm node state and k8s node status.",
+	}, []string{"slurm_goal_state", "k8s_goal_state", "slurm_state", "k8s_status"})
+
+	SyncPhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "sync_phase_duration_seconds",
+		Help:      "Duration of each phase of the sync loop.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"phase"})
+
+	SyncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "sync_errors_total",
+		Help:      "Sync loop phases that returned an error.",
+	}, []string{"phase"})
+
+	SlurmAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "slurm_api_duration_seconds",
+		Help:      "Latency of slurmrestd requests and slurm commands.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"operation"})
+
+	SlurmAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "slurm_api_errors_total",
+		Help:      "Failed slurmrestd requests and slurm commands.",
+	}, []string{"operation"})
+
+	RemediationActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "remediation_actions_total",
+		Help:      "Remediation actions executed or failed, by type and outcome.",
+	}, []string{"action", "outcome"})
+
+	RemediationPlannedActions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "remediation_planned_actions",
+		Help:      "Remediation actions of the current plan not acted on, e.g. blocked by a budget or pending approval, by type and outcome.",
+	}, []string{"action", "outcome"})
+
+	TaintedK8sNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "tainted_k8s_nodes",
+		Help:      "K8s nodes carrying a slonk or maintenance lifecycle taint, by taint key.",
+	}, []string{"taint"})
+
+	TaintLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "taint_limit",
+		Help:      "Maximum number of k8s nodes tainted for goal states.",
+	})
+
+	DisruptionBudgetUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "disruption_budget_used",
+		Help:      "Physical nodes disrupted within the window of a disruption budget group.",
+	}, []string{"budget", "group"})
+
+	DisruptionBudgetLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "disruption_budget_limit",
+		Help:      "Disruptions allowed within the window of a disruption budget group.",
+	}, []string{"budget", "group"})
+
+	DisruptionBudgetInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "disruption_budget_in_flight",
+		Help:      "Remediations in flight in a disruption budget group.",
+	}, []string{"budget", "group"})
+
+	DisruptionBudgetExhausted = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "disruption_budget_exhausted",
+		Help:      "1 if a disruption budget group allows no more disruptions.",
+	}, []string{"budget", "group"})
+
+	SlurmJobs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "slurm_jobs",
+		Help:      "Slurm jobs in the queue by state and partition.",
+	}, []string{"state", "partition"})
+
+	CapacityGPUs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "capacity_gpus",
+		Help:      "GPUs by partition, nodepool, GPU type and state, one of healthy, allocated, idle or drained.",
+	}, []string{"partition", "nodepool", "gpu_type", "state"})
+
+	CapacityPendingGPUs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "capacity_pending_gpus",
+		Help:      "GPUs requested by pending slurm jobs per partition.",
+	}, []string{"partition"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		PhysicalNodes,
+		SyncPhaseDuration,
+		SyncErrors,
+		SlurmAPIDuration,
+		SlurmAPIErrors,
+		RemediationActions,
+		RemediationPlannedActions,
+		TaintedK8sNodes,
+		TaintLimit,
+		DisruptionBudgetUsed,
+		DisruptionBudgetLimit,
+		DisruptionBudgetInFlight,
+		DisruptionBudgetExhausted,
+		SlurmJobs,
+		CapacityGPUs,
+		CapacityPendingGPUs,
+	)
+}
+
+// ObservePhase records the duration of a sync phase started at start, and counts the
+// error if the phase failed.
+func ObservePhase(phase string, start time.Time, err error) {
+	SyncPhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+	if err != nil {
+		SyncErrors.WithLabelValues(phase).Inc()
+	}
+}
+
+// ObserveSlurmAPI records the latency of a slurm operation started at start, and counts
+// the error if it failed.
+func ObserveSlurmAPI(operation string, start time.Time, err error) {
+	SlurmAPIDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		SlurmAPIErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// UpdateDisruptionBudgets replaces the disruption budget series with the given statuses.
+func UpdateDisruptionBudgets(statuses []budget.DisruptionBudgetStatus) {
+	DisruptionBudgetUsed.Reset()
+	DisruptionBudgetLimit.Reset()
+	DisruptionBudgetInFlight.Reset()
+	DisruptionBudgetExhausted.Reset()
+	for _, status := range statuses {
+		DisruptionBudgetUsed.WithLabelValues(status.Name, status.Group).Set(float64(status.Used))
+		DisruptionBudgetLimit.WithLabelValues(status.Name, status.Group).Set(float64(status.Limit))
+		DisruptionBudgetInFlight.WithLabelValues(status.Name, status.Group).Set(float64(status.InFlight))
+		exhausted := 0.0
+		if status.Exhausted {
+			exhausted = 1
+		}
+		DisruptionBudgetExhausted.WithLabelValues(status.Name, status.Group).Set(exhausted)
+	}
+}
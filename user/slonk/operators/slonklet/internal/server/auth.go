@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Extra of a TokenReview naming the pod a bound service account token was issued for.
+	POD_NAME_EXTRA = "authentication.kubernetes.io/pod-name"
+)
+
+// NodeAuthenticator checks that a request was made from a pod running on the k8s node.
+type NodeAuthenticator interface {
+	AuthenticateNode(ctx context.Context, r *http.Request, k8sNodeName string) error
+}
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// TokenReviewAuthenticator authenticates the bearer token of a request, which has to be a
+// service account token bound to a pod on the k8s node, e.g. of the node-local agent.
+type TokenReviewAuthenticator struct {
+	Client client.Client
+}
+
+func (a *TokenReviewAuthenticator) AuthenticateNode(ctx context.Context, r *http.Request, k8sNodeName string) error {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return fmt.Errorf("no bearer token")
+	}
+
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return fmt.Errorf("review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return fmt.Errorf("invalid token: %s", review.Status.Error)
+	}
+	namespace, ok := strings.CutPrefix(review.Status.User.Username, "system:serviceaccount:")
+	if !ok {
+		return fmt.Errorf("%s is not a service account", review.Status.User.Username)
+	}
+	namespace, _, _ = strings.Cut(namespace, ":")
+	podNames := review.Status.User.Extra[POD_NAME_EXTRA]
+	if len(podNames) != 1 {
+		return fmt.Errorf("the token of %s is not bound to a pod", review.Status.User.Username)
+	}
+
+	pod := &corev1.Pod{}
+	if err := a.Client.Get(ctx, types.NamespacedName{Name: podNames[0], Namespace: namespace}, pod); err != nil {
+		return fmt.Errorf("get pod %s/%s: %w", namespace, podNames[0], err)
+	}
+	if pod.Spec.NodeName != k8sNodeName {
+		return fmt.Errorf("pod %s/%s runs on k8s node %q, not %s", namespace, podNames[0], pod.Spec.NodeName, k8sNodeName)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	agentPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "slonklet-agent-abcde", Namespace: "slurm"},
+		Spec:       corev1.PodSpec{NodeName: "gke-h100-0"},
+	}
+	// Tokens are reviewed as the agent pod, any other token is invalid.
+	reviews := map[string]authenticationv1.TokenReviewStatus{
+		"agent": {
+			Authenticated: true,
+			User: authenticationv1.UserInfo{
+				Username: "system:serviceaccount:slurm:slonklet-agent",
+				Extra:    map[string]authenticationv1.ExtraValue{POD_NAME_EXTRA: {"slonklet-agent-abcde"}},
+			},
+		},
+		"unbound": {
+			Authenticated: true,
+			User:          authenticationv1.UserInfo{Username: "system:serviceaccount:slurm:slonklet-agent"},
+		},
+		"user": {
+			Authenticated: true,
+			User:          authenticationv1.UserInfo{Username: "alice"},
+		},
+	}
+	fakeClient := clientFake.NewClientBuilder().
+		WithObjects(agentPod).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if review, ok := obj.(*authenticationv1.TokenReview); ok {
+					if status, ok := reviews[review.Spec.Token]; ok {
+						review.Status = status
+					} else {
+						review.Status = authenticationv1.TokenReviewStatus{Error: "invalid token"}
+					}
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	authenticator := &TokenReviewAuthenticator{Client: fakeClient}
+
+	authenticate := func(token string, k8sNodeName string) error {
+		r := httptest.NewRequest(http.MethodPost, "/inventory/"+k8sNodeName, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return authenticator.AuthenticateNode(context.Background(), r, k8sNodeName)
+	}
+	assert.NoError(t, authenticate("agent", "gke-h100-0"))
+	// The agent can't report for another node.
+	assert.ErrorContains(t, authenticate("agent", "gke-h100-1"), `runs on k8s node "gke-h100-0"`)
+	assert.ErrorContains(t, authenticate("", "gke-h100-0"), "no bearer token")
+	assert.ErrorContains(t, authenticate("forged", "gke-h100-0"), "invalid token")
+	assert.ErrorContains(t, authenticate("unbound", "gke-h100-0"), "not bound to a pod")
+	assert.ErrorContains(t, authenticate("user", "gke-h100-0"), "not a service account")
+}
@@ -1,16 +1,34 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/blame"
+	"your-org.com/slonklet/internal/budget"
+	"your-org.com/slonklet/internal/controller"
+	"your-org.com/slonklet/internal/history"
+	"your-org.com/slonklet/internal/topology"
+)
+
+const (
+	DEFAULT_HISTORY_RANGE = 30 * 24 * time.Hour
+	SHUTDOWN_TIMEOUT      = 10 * time.Second
+
+	// Set on requests a follower forwarded to the leader, which never forwards them again.
+	PROXIED_HEADER = "X-Slonklet-Proxied"
 )
 
 type InfoServer struct {
@@ -20,10 +38,35 @@ type InfoServer struct {
 	slurmJobMap     map[int]*slonkv1.SlurmJob
 	physicalNodeMap map[string]*slonkv1.PhysicalNode
 
+	// Whether this replica is the leader running the sync loop. Followers serve the data
+	// read from their cache and reject writes, which only the leader acts on.
+	leader atomic.Bool
+	// Info server address of the leader, followers forward reads of the state only the
+	// leader has to it. Empty if unknown.
+	leaderAddress string
+
+	disruptionBudgetsJson []byte
+	remediationPlanJson   []byte
+
+	unregisteredSlurmPodsJson []byte
+	manualOverridesJson       []byte
+
+	// Long-term physical node history, nil if disabled.
+	history *history.Store
+
+	// Hardware inventories reported by the node-local agents, keyed by k8s node. The sync
+	// loop persists them to the status of the physical nodes, these are only the reports
+	// not synced yet.
+	inventories map[string]*slonkv1.HardwareInventory
+	// Authenticates the agents reporting inventories, nil rejects every report.
+	authenticator NodeAuthenticator
+
 	slurmJobsJson        []byte
 	slurmJobsActiveJson  []byte
 	slurmJobsRunningJson []byte
 	physicalNodesJson    []byte
+	topologyJson         []byte
+	blameJson            []byte
 }
 
 func NewInfoServer(
@@ -33,20 +76,94 @@ func NewInfoServer(
 		addr:            addr,
 		slurmJobMap:     map[int]*slonkv1.SlurmJob{},
 		physicalNodeMap: map[string]*slonkv1.PhysicalNode{},
+
+		inventories: map[string]*slonkv1.HardwareInventory{},
 	}
 }
 
-func (s *InfoServer) Serve() error {
-	http.HandleFunc("/job/", s.handleJob)
-	http.HandleFunc("/jobs", s.handleJobs)
-	http.HandleFunc("/jobs/active", s.handleActiveJobs)
-	http.HandleFunc("/jobs/running", s.handleRunningJobs)
-	http.HandleFunc("/node/", s.handleNode)
-	http.HandleFunc("/nodes", s.handleNodes)
-	http.HandleFunc("/proxy/", s.handleProxy)
+// Start serves the info server until the context is cancelled. It implements
+// manager.Runnable.
+func (s *InfoServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/", s.handleJob)
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/active", s.handleActiveJobs)
+	mux.HandleFunc("/jobs/running", s.handleRunningJobs)
+	mux.HandleFunc("/node/", s.handleNode)
+	mux.HandleFunc("/nodes", s.handleNodes)
+	mux.HandleFunc("/topology", s.handleTopology)
+	mux.HandleFunc("/blame", s.handleBlame)
+	mux.HandleFunc("/proxy/", s.handleProxy)
+	mux.HandleFunc("/budgets", s.handleDisruptionBudgets)
+	mux.HandleFunc("/remediation/plan", s.handleRemediationPlan)
+	mux.HandleFunc("/pods/unregistered", s.handleUnregisteredSlurmPods)
+	mux.HandleFunc("/overrides", s.handleManualOverrides)
+	mux.HandleFunc("/history", s.handleHistory)
+	mux.HandleFunc("/history/", s.handleHistory)
+	mux.HandleFunc("/inventory/", s.handleInventory)
+	mux.HandleFunc("/leader", s.handleLeader)
+
+	httpServer := &http.Server{Addr: s.addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
 
 	log.Printf("Starting info server on %s\n", s.addr)
-	return http.ListenAndServe(s.addr, nil)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica serves the
+// info server.
+func (s *InfoServer) NeedLeaderElection() bool {
+	return false
+}
+
+// SetLeader marks this replica as the leader, which accepts inventories.
+func (s *InfoServer) SetLeader(leader bool) {
+	s.leader.Store(leader)
+}
+
+// SetLeaderAddress sets the info server address of the leader, empty if unknown.
+func (s *InfoServer) SetLeaderAddress(address string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.leaderAddress = address
+}
+
+// proxyToLeader forwards the request from a follower to the leader, for state that is only
+// kept in the memory of the leader, e.g. the remediation plan. It returns whether the
+// request was forwarded, otherwise the follower serves what it has.
+func (s *InfoServer) proxyToLeader(w http.ResponseWriter, r *http.Request) bool {
+	if s.leader.Load() || r.Header.Get(PROXIED_HEADER) != "" {
+		return false
+	}
+	s.RLock()
+	leaderAddress := s.leaderAddress
+	s.RUnlock()
+	if leaderAddress == "" {
+		return false
+	}
+
+	r.Header.Set(PROXIED_HEADER, "true")
+	httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: leaderAddress}).ServeHTTP(w, r)
+	return true
+}
+
+// rejectFollowerWrite fails the request if this replica is not the leader, so that the
+// client retries until it reaches the leader. It returns whether the request was rejected.
+func (s *InfoServer) rejectFollowerWrite(w http.ResponseWriter) bool {
+	if s.leader.Load() {
+		return false
+	}
+	http.Error(w, "Not the leader, retry later", http.StatusServiceUnavailable)
+	return true
 }
 
 func (s *InfoServer) UpdateNodes(physicalNodeMap map[string]*slonkv1.PhysicalNode) error {
@@ -61,6 +178,17 @@ func (s *InfoServer) UpdateNodes(physicalNodeMap map[string]*slonkv1.PhysicalNod
 	}
 	s.physicalNodesJson = physicalNodesJson
 
+	// Healthy and unhealthy physical nodes per topology level and value.
+	topologySummary := topology.Summary{}
+	for _, physicalNode := range physicalNodeMap {
+		topologySummary.Add(physicalNode.Status.Topology, controller.IsPhysicalNodeHealthy(physicalNode))
+	}
+	topologyJson, err := json.Marshal(topologySummary)
+	if err != nil {
+		return fmt.Errorf("marshal topology summary: %v", err)
+	}
+	s.topologyJson = topologyJson
+
 	return nil
 }
 
@@ -97,6 +225,110 @@ func (s *InfoServer) UpdateJobs(slurmJobMap map[int]*slonkv1.SlurmJob) error {
 	return nil
 }
 
+// UpdateBlame sets the latest job failure attribution to physical nodes.
+func (s *InfoServer) UpdateBlame(report *blame.Report) error {
+	s.Lock()
+	defer s.Unlock()
+
+	blameJson, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal blame report: %v", err)
+	}
+	s.blameJson = blameJson
+
+	return nil
+}
+
+func (s *InfoServer) UpdateDisruptionBudgets(statuses []budget.DisruptionBudgetStatus) error {
+	s.Lock()
+	defer s.Unlock()
+
+	disruptionBudgetsJson, err := json.Marshal(statuses)
+	if err != nil {
+		return fmt.Errorf("marshal disruption budgets: %v", err)
+	}
+	s.disruptionBudgetsJson = disruptionBudgetsJson
+
+	return nil
+}
+
+func (s *InfoServer) UpdateRemediationPlan(plan *controller.RemediationPlan) error {
+	s.Lock()
+	defer s.Unlock()
+
+	remediationPlanJson, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("marshal remediation plan: %v", err)
+	}
+	s.remediationPlanJson = remediationPlanJson
+
+	return nil
+}
+
+// SetHistory sets the store queried by the history endpoint.
+func (s *InfoServer) SetHistory(store *history.Store) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.history = store
+}
+
+func (s *InfoServer) UpdateUnregisteredSlurmPods(pods []controller.UnregisteredSlurmPod) error {
+	s.Lock()
+	defer s.Unlock()
+
+	unregisteredSlurmPodsJson, err := json.Marshal(pods)
+	if err != nil {
+		return fmt.Errorf("marshal unregistered slurm pods: %v", err)
+	}
+	s.unregisteredSlurmPodsJson = unregisteredSlurmPodsJson
+
+	return nil
+}
+
+// UpdateManualOverrides sets the manually managed physical nodes, oldest first.
+func (s *InfoServer) UpdateManualOverrides(overrides []controller.ManualOverride) error {
+	s.Lock()
+	defer s.Unlock()
+
+	manualOverridesJson, err := json.Marshal(overrides)
+	if err != nil {
+		return fmt.Errorf("marshal manual overrides: %v", err)
+	}
+	s.manualOverridesJson = manualOverridesJson
+
+	return nil
+}
+
+// SetNodeAuthenticator sets how the agents reporting inventories are authenticated.
+func (s *InfoServer) SetNodeAuthenticator(authenticator NodeAuthenticator) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.authenticator = authenticator
+}
+
+// Inventory returns the latest inventory reported by the agent on the k8s node.
+func (s *InfoServer) Inventory(k8sNodeName string) *slonkv1.HardwareInventory {
+	s.RLock()
+	defer s.RUnlock()
+	return s.inventories[k8sNodeName].DeepCopy()
+}
+
+// persistedInventory returns the inventory in the status of the physical node on the k8s
+// node, which followers and restarted leaders have too.
+func (s *InfoServer) persistedInventory(k8sNodeName string) *slonkv1.HardwareInventory {
+	s.RLock()
+	defer s.RUnlock()
+	for _, physicalNode := range s.physicalNodeMap {
+		k8sNodeStatus := physicalNode.Status.K8sNodeStatus
+		if k8sNodeStatus.Name == k8sNodeName && !k8sNodeStatus.Removed {
+			return physicalNode.Status.Inventory.DeepCopy()
+		}
+	}
+	return nil
+}
+
 func (s *InfoServer) handleJob(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -193,6 +425,217 @@ func (s *InfoServer) handleNodes(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonResponse)
 }
 
+func (s *InfoServer) handleTopology(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s.RLock()
+	defer s.RUnlock()
+	w.Write(s.topologyJson)
+}
+
+// handleBlame serves the job failures per physical node, suspects first. ?suspects=true
+// only returns the suspects.
+func (s *InfoServer) handleBlame(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s.RLock()
+	blameJson := s.blameJson
+	s.RUnlock()
+	if r.URL.Query().Get("suspects") != "true" || blameJson == nil {
+		w.Write(blameJson)
+		return
+	}
+
+	report := &blame.Report{}
+	if err := json.Unmarshal(blameJson, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	suspects := []*blame.NodeStats{}
+	for _, stats := range report.Nodes {
+		if stats.Suspect {
+			suspects = append(suspects, stats)
+		}
+	}
+	report.Nodes = suspects
+	jsonResponse, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
+func (s *InfoServer) handleDisruptionBudgets(w http.ResponseWriter, r *http.Request) {
+	if s.proxyToLeader(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	s.RLock()
+	defer s.RUnlock()
+	w.Write(s.disruptionBudgetsJson)
+}
+
+func (s *InfoServer) handleRemediationPlan(w http.ResponseWriter, r *http.Request) {
+	if s.proxyToLeader(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	s.RLock()
+	defer s.RUnlock()
+	w.Write(s.remediationPlanJson)
+}
+
+func (s *InfoServer) handleUnregisteredSlurmPods(w http.ResponseWriter, r *http.Request) {
+	if s.proxyToLeader(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	s.RLock()
+	defer s.RUnlock()
+	w.Write(s.unregisteredSlurmPodsJson)
+}
+
+func (s *InfoServer) handleManualOverrides(w http.ResponseWriter, r *http.Request) {
+	if s.proxyToLeader(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	s.RLock()
+	defer s.RUnlock()
+	w.Write(s.manualOverridesJson)
+}
+
+func (s *InfoServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	// Only the leader records history.
+	if s.proxyToLeader(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	// URL format is /history/<physicalnode>?from=<RFC3339>&to=<RFC3339>&limit=<n>, all
+	// physical nodes without a name.
+	physicalNodeName := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/history"), "/")
+
+	to := time.Now()
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		parsed, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			http.Error(w, "Invalid to format, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-DEFAULT_HISTORY_RANGE)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			http.Error(w, "Invalid from format, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			http.Error(w, "Invalid limit format", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	s.RLock()
+	store := s.history
+	s.RUnlock()
+	if store == nil {
+		http.Error(w, "History is disabled", http.StatusNotFound)
+		return
+	}
+
+	records, err := store.Query(physicalNodeName, from, to, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse, err := json.Marshal(records)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(jsonResponse)
+}
+
+func (s *InfoServer) handleInventory(w http.ResponseWriter, r *http.Request) {
+	// URL format is /inventory/<k8s node>
+	k8sNodeName := strings.TrimPrefix(r.URL.Path, "/inventory/")
+	if k8sNodeName == "" || strings.Contains(k8sNodeName, "/") {
+		http.Error(w, "Invalid request, k8s node is missing", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		inventory := s.Inventory(k8sNodeName)
+		if inventory == nil {
+			inventory = s.persistedInventory(k8sNodeName)
+		}
+		if inventory == nil {
+			http.Error(w, "No inventory reported", http.StatusNotFound)
+			return
+		}
+		jsonResponse, err := json.Marshal(inventory)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonResponse)
+	case http.MethodPost:
+		if s.rejectFollowerWrite(w) {
+			return
+		}
+		s.RLock()
+		authenticator := s.authenticator
+		s.RUnlock()
+		if authenticator == nil {
+			http.Error(w, "Inventory reports are disabled", http.StatusForbidden)
+			return
+		}
+		if err := authenticator.AuthenticateNode(r.Context(), r, k8sNodeName); err != nil {
+			log.Printf("Rejected inventory of k8s node %s: %v\n", k8sNodeName, err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		inventory := &slonkv1.HardwareInventory{}
+		if err := json.NewDecoder(r.Body).Decode(inventory); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid inventory: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.Lock()
+		s.inventories[k8sNodeName] = inventory
+		s.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Only GET and POST are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *InfoServer) handleLeader(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jsonResponse, err := json.Marshal(map[string]bool{"leader": s.leader.Load()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
 func (s *InfoServer) handleProxy(w http.ResponseWriter, r *http.Request) {
 	s.RLock()
 	defer s.RUnlock()
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/blame"
+	"your-org.com/slonklet/internal/controller"
+)
+
+// stubAuthenticator accepts reports for the k8s nodes it lists.
+type stubAuthenticator map[string]bool
+
+func (a stubAuthenticator) AuthenticateNode(ctx context.Context, r *http.Request, k8sNodeName string) error {
+	if !a[k8sNodeName] {
+		return fmt.Errorf("not on k8s node %s", k8sNodeName)
+	}
+	return nil
+}
+
+func serve(handler http.HandlerFunc, method string, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestHandleInventory(t *testing.T) {
+	s := NewInfoServer(":0")
+	s.SetLeader(true)
+	report := `{"driverVersion":"535.104.05","gpus":[{"index":0,"serial":"1652923030874"}]}`
+
+	// Reports are rejected until an authenticator is set.
+	assert.Equal(t, http.StatusForbidden, serve(s.handleInventory, http.MethodPost, "/inventory/gke-h100-0", report).Code)
+
+	s.SetNodeAuthenticator(stubAuthenticator{"gke-h100-0": true})
+	assert.Equal(t, http.StatusUnauthorized, serve(s.handleInventory, http.MethodPost, "/inventory/gke-h100-1", report).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(s.handleInventory, http.MethodPost, "/inventory/gke-h100-0", "{").Code)
+	assert.Equal(t, http.StatusNoContent, serve(s.handleInventory, http.MethodPost, "/inventory/gke-h100-0", report).Code)
+	assert.Equal(t, "535.104.05", s.Inventory("gke-h100-0").DriverVersion)
+
+	w := serve(s.handleInventory, http.MethodGet, "/inventory/gke-h100-0", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	inventory := &slonkv1.HardwareInventory{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), inventory))
+	assert.Equal(t, "1652923030874", inventory.GPUs[0].Serial)
+
+	assert.Equal(t, http.StatusNotFound, serve(s.handleInventory, http.MethodGet, "/inventory/gke-h100-1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(s.handleInventory, http.MethodGet, "/inventory/", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(s.handleInventory, http.MethodDelete, "/inventory/gke-h100-0", "").Code)
+}
+
+func TestHandleInventoryFollower(t *testing.T) {
+	s := NewInfoServer(":0")
+	s.SetNodeAuthenticator(stubAuthenticator{"gke-h100-0": true})
+	assert.NoError(t, s.UpdateNodes(map[string]*slonkv1.PhysicalNode{
+		"abc": {Status: slonkv1.PhysicalNodeStatus{
+			K8sNodeStatus: slonkv1.K8sNodeStatus{Name: "gke-h100-0"},
+			Inventory:     &slonkv1.HardwareInventory{DriverVersion: "535.104.05"},
+		}},
+		"def": {Status: slonkv1.PhysicalNodeStatus{
+			K8sNodeStatus: slonkv1.K8sNodeStatus{Name: "gke-h100-1", Removed: true},
+			Inventory:     &slonkv1.HardwareInventory{DriverVersion: "535.104.05"},
+		}},
+	}))
+
+	// Followers only take reports once elected.
+	assert.Equal(t, http.StatusServiceUnavailable, serve(s.handleInventory, http.MethodPost, "/inventory/gke-h100-0", "{}").Code)
+
+	// They serve the inventories persisted in the physical nodes, of nodes that still exist.
+	w := serve(s.handleInventory, http.MethodGet, "/inventory/gke-h100-0", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"driverVersion":"535.104.05"`)
+	assert.Equal(t, http.StatusNotFound, serve(s.handleInventory, http.MethodGet, "/inventory/gke-h100-1", "").Code)
+}
+
+func TestProxyToLeader(t *testing.T) {
+	leader := NewInfoServer(":0")
+	leader.SetLeader(true)
+	assert.NoError(t, leader.UpdateManualOverrides([]controller.ManualOverride{{PhysicalNodeName: "abc", GoalState: "drain"}}))
+	leaderServer := httptest.NewServer(http.HandlerFunc(leader.handleManualOverrides))
+	defer leaderServer.Close()
+
+	follower := NewInfoServer(":0")
+	assert.NoError(t, follower.UpdateManualOverrides([]controller.ManualOverride{}))
+
+	// Followers serve what they have until they know the leader.
+	w := serve(follower.handleManualOverrides, http.MethodGet, "/overrides", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+
+	follower.SetLeaderAddress(strings.TrimPrefix(leaderServer.URL, "http://"))
+	w = serve(follower.handleManualOverrides, http.MethodGet, "/overrides", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"physicalNodeName":"abc"`)
+
+	// Proxied requests are never forwarded again, e.g. to a former leader.
+	r := httptest.NewRequest(http.MethodGet, "/overrides", nil)
+	r.Header.Set(PROXIED_HEADER, "true")
+	w = httptest.NewRecorder()
+	follower.handleManualOverrides(w, r)
+	assert.Equal(t, "[]", w.Body.String())
+
+	// An unreachable leader fails the request instead of serving stale state.
+	leaderServer.Close()
+	assert.Equal(t, http.StatusBadGateway, serve(follower.handleManualOverrides, http.MethodGet, "/overrides", "").Code)
+}
+
+func TestHandleLeader(t *testing.T) {
+	s := NewInfoServer(":0")
+	assert.JSONEq(t, `{"leader":false}`, serve(s.handleLeader, http.MethodGet, "/leader", "").Body.String())
+	s.SetLeader(true)
+	assert.JSONEq(t, `{"leader":true}`, serve(s.handleLeader, http.MethodGet, "/leader", "").Body.String())
+}
+
+func TestHandleManualOverrides(t *testing.T) {
+	s := NewInfoServer(":0")
+	since := time.Date(2024, 5, 7, 10, 0, 0, 0, time.UTC)
+	assert.NoError(t, s.UpdateManualOverrides([]controller.ManualOverride{
+		{PhysicalNodeName: "abc", SlurmNodeName: "slurm-h100-1", GoalState: "drain", Owner: "alice", Since: since},
+	}))
+
+	w := serve(s.handleManualOverrides, http.MethodGet, "/overrides", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	overrides := []controller.ManualOverride{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &overrides))
+	assert.Equal(t, []controller.ManualOverride{
+		{PhysicalNodeName: "abc", SlurmNodeName: "slurm-h100-1", GoalState: "drain", Owner: "alice", Since: since},
+	}, overrides)
+}
+
+func TestHandleRemediationPlan(t *testing.T) {
+	s := NewInfoServer(":0")
+	s.SetLeader(true)
+	assert.NoError(t, s.UpdateRemediationPlan(&controller.RemediationPlan{
+		Timestamp: time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC),
+		Dryrun:    true,
+		Actions: []controller.RemediationAction{
+			{
+				Type:             controller.ACTION_K8S_NODE_DELETE,
+				PhysicalNodeName: "abc",
+				K8sNodeName:      "gke-h100-0",
+				HighRisk:         true,
+				Outcome:          controller.OUTCOME_PENDING_APPROVAL,
+			},
+		},
+	}))
+
+	w := serve(s.handleRemediationPlan, http.MethodGet, "/remediation/plan", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	plan := &controller.RemediationPlan{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), plan))
+	assert.True(t, plan.Dryrun)
+	assert.Len(t, plan.Actions, 1)
+	assert.Equal(t, controller.ACTION_K8S_NODE_DELETE, plan.Actions[0].Type)
+	assert.Equal(t, controller.OUTCOME_PENDING_APPROVAL, plan.Actions[0].Outcome)
+}
+
+func TestHandleBlame(t *testing.T) {
+	s := NewInfoServer(":0")
+
+	// Nothing analyzed yet.
+	w := serve(s.handleBlame, http.MethodGet, "/blame?suspects=true", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	assert.NoError(t, s.UpdateBlame(&blame.Report{
+		Runs:   20,
+		Failed: 6,
+		Nodes: []*blame.NodeStats{
+			{PhysicalNode: "abc", Group: "NVIDIA-H100-80GB-HBM3", Runs: 10, Failed: 5, Suspect: true},
+			{PhysicalNode: "def", Group: "NVIDIA-H100-80GB-HBM3", Runs: 10, Failed: 1},
+		},
+	}))
+
+	report := &blame.Report{}
+	w = serve(s.handleBlame, http.MethodGet, "/blame", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), report))
+	assert.Len(t, report.Nodes, 2)
+
+	report = &blame.Report{}
+	w = serve(s.handleBlame, http.MethodGet, "/blame?suspects=true", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), report))
+	assert.Equal(t, 20, report.Runs)
+	assert.Len(t, report.Nodes, 1)
+	assert.Equal(t, "abc", report.Nodes[0].PhysicalNode)
+}
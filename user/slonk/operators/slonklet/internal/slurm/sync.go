@@ -1,6 +1,7 @@
 package slurm
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,7 +14,8 @@ import (
 	"time"
 )
 
-func ListSlurmNodes(socketPath string) ([]SlurmNode, error) {
+func ListSlurmNodes(socketPath string) (nodes []SlurmNode, err error) {
+	defer observe("list_nodes", time.Now(), &err)
 	if socketPath == "" {
 		return listSlurmNodesFromCommand()
 	}
@@ -98,7 +100,8 @@ func parsePhysicalHostNameFromComment(comment string) (string, error) {
 	return result, nil
 }
 
-func SyncSlurmJobs(socketPath string) ([]SlurmJob, error) {
+func SyncSlurmJobs(socketPath string) (jobs []SlurmJob, err error) {
+	defer observe("list_jobs", time.Now(), &err)
 	if socketPath == "" {
 		return syncSlurmJobsFromCommand()
 	}
@@ -316,3 +319,265 @@ func cancelHeldJobsLongerThanAWeek(socketPath string, dryRun bool) error {
 
 	return nil
 }
+
+// UpdateSlurmNodeState sets the state of a slurm node, e.g. "DRAIN" or "RESUME", with an
+// optional reason.
+func UpdateSlurmNodeState(socketPath string, nodeName string, state string, reason string) (err error) {
+	defer observe("update_node", time.Now(), &err)
+	if socketPath == "" {
+		return updateSlurmNodeStateFromCommand(nodeName, state, reason)
+	}
+	return updateSlurmNodeStateFromSocket(socketPath, nodeName, state, reason)
+}
+
+func updateSlurmNodeStateFromCommand(nodeName string, state string, reason string) error {
+	args := []string{"update", "node=" + nodeName, "state=" + state, "reason=" + reason}
+	if out, err := exec.Command("scontrol", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("running scontrol command: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func updateSlurmNodeStateFromSocket(socketPath string, nodeName string, state string, reason string) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(proto, addr string) (conn net.Conn, err error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"state":  []string{state},
+		"reason": reason,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding node update: %s", err)
+	}
+	url := fmt.Sprintf("http://localhost:8080/slurm/v0.0.40/node/%s", nodeName)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("sending request to update node: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to update node %s, status code: %d", nodeName, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SignalSlurmJob sends a signal, e.g. "USR1", to all steps and the batch shell of a job
+// without cancelling it.
+func SignalSlurmJob(socketPath string, jobID int, signal string) (err error) {
+	defer observe("signal_job", time.Now(), &err)
+	if socketPath == "" {
+		args := []string{"--signal=" + signal, "--full", strconv.Itoa(jobID)}
+		if out, err := exec.Command("scancel", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("running scancel command: %s: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(proto, addr string) (conn net.Conn, err error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	url := fmt.Sprintf("http://localhost:8080/slurm/v0.0.40/job/%d?signal=%s&flags=FULL_JOB", jobID, signal)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request to signal job: %s", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request to signal job: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to signal job %d, status code: %d", jobID, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// RequeueSlurmJob requeues a running job so it's restarted on other nodes, through a job
+// update of slurmrestd, or scontrol without a socket.
+func RequeueSlurmJob(socketPath string, jobID int) (err error) {
+	defer observe("requeue_job", time.Now(), &err)
+	if socketPath == "" {
+		if out, err := exec.Command("scontrol", "requeue", strconv.Itoa(jobID)).CombinedOutput(); err != nil {
+			return fmt.Errorf("running scontrol command: %s: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(proto, addr string) (conn net.Conn, err error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"requeue": true,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding job update: %s", err)
+	}
+	url := fmt.Sprintf("http://localhost:8080/slurm/v0.0.40/job/%d", jobID)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("sending request to requeue job: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to requeue job %d, status code: %d", jobID, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// RebootSlurmNode asks slurm to reboot the node once it's idle and resume it after boot.
+// slurmrestd v0.0.40 has no reboot operation, so this always runs scontrol.
+func RebootSlurmNode(nodeName string, reason string) (err error) {
+	defer observe("reboot_node", time.Now(), &err)
+	args := []string{"reboot", "ASAP", "nextstate=RESUME"}
+	if reason != "" {
+		args = append(args, fmt.Sprintf("reason=%s", reason))
+	}
+	args = append(args, nodeName)
+	if out, err := exec.Command("scontrol", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("running scontrol command: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// CancelSlurmJob cancels a pending or running job.
+func CancelSlurmJob(socketPath string, jobID int) (err error) {
+	defer observe("cancel_job", time.Now(), &err)
+	if socketPath == "" {
+		if out, err := exec.Command("scancel", strconv.Itoa(jobID)).CombinedOutput(); err != nil {
+			return fmt.Errorf("running scancel command: %s: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return cancelSlurmJob(socketPath, jobID)
+}
+
+// SlurmJobSubmission is a batch job pinned to a single node.
+type SlurmJobSubmission struct {
+	Name      string
+	Script    string
+	NodeName  string
+	Partition string
+	Comment   string
+	// Time limit in minutes, 0 for the partition default.
+	TimeLimit int
+}
+
+// SubmitSlurmJob submits the batch job and returns its ID.
+func SubmitSlurmJob(socketPath string, submission SlurmJobSubmission) (jobID int, err error) {
+	defer observe("submit_job", time.Now(), &err)
+	if socketPath == "" {
+		return submitSlurmJobFromCommand(submission)
+	}
+	return submitSlurmJobFromSocket(socketPath, submission)
+}
+
+func submitSlurmJobFromCommand(submission SlurmJobSubmission) (int, error) {
+	args := []string{"--parsable", "--job-name=" + submission.Name, "--nodelist=" + submission.NodeName, "--nodes=1"}
+	if submission.Partition != "" {
+		args = append(args, "--partition="+submission.Partition)
+	}
+	if submission.Comment != "" {
+		args = append(args, "--comment="+submission.Comment)
+	}
+	if submission.TimeLimit > 0 {
+		args = append(args, fmt.Sprintf("--time=%d", submission.TimeLimit))
+	}
+	cmd := exec.Command("sbatch", args...)
+	cmd.Stdin = strings.NewReader(submission.Script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("running sbatch command: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	// --parsable prints "<job id>" or "<job id>;<cluster>".
+	jobID, _, _ := strings.Cut(strings.TrimSpace(string(out)), ";")
+	id, err := strconv.Atoi(jobID)
+	if err != nil {
+		return 0, fmt.Errorf("parse sbatch output %q: %s", strings.TrimSpace(string(out)), err)
+	}
+	return id, nil
+}
+
+func submitSlurmJobFromSocket(socketPath string, submission SlurmJobSubmission) (int, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(proto, addr string) (conn net.Conn, err error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	job := map[string]interface{}{
+		"name":                      submission.Name,
+		"required_nodes":            []string{submission.NodeName},
+		"minimum_nodes":             1,
+		"current_working_directory": "/tmp",
+		"environment":               []string{"PATH=/bin:/usr/bin:/usr/local/bin"},
+	}
+	if submission.Partition != "" {
+		job["partition"] = submission.Partition
+	}
+	if submission.Comment != "" {
+		job["comment"] = submission.Comment
+	}
+	if submission.TimeLimit > 0 {
+		job["time_limit"] = map[string]interface{}{"set": true, "number": submission.TimeLimit}
+	}
+	body, err := json.Marshal(map[string]interface{}{"script": submission.Script, "job": job})
+	if err != nil {
+		return 0, fmt.Errorf("encoding job submission: %s", err)
+	}
+	resp, err := client.Post("http://localhost:8080/slurm/v0.0.40/job/submit", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("sending request to submit job: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("failed to submit job %s, status code: %d", submission.Name, resp.StatusCode)
+	}
+	result := struct {
+		JobID int `json:"job_id"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode job submission response: %s", err)
+	}
+	return result.JobID, nil
+}
+
+// Observer is called with the latency and error of every slurm operation, e.g. to export
+// them as metrics. Set it once at startup, nil observes nothing.
+var Observer func(operation string, start time.Time, err error)
+
+// observe passes the latency and error of a slurm operation to the Observer. It's deferred
+// with the named error result of the operation.
+func observe(operation string, start time.Time, err *error) {
+	if Observer != nil {
+		Observer(operation, start, *err)
+	}
+}
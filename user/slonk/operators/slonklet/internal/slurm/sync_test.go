@@ -226,3 +226,58 @@ func TestParseJobNodeList(t *testing.T) {
 	)
 
 }
+
+func TestUpdateSlurmNodeStateAndSignalJob(t *testing.T) {
+	// Setup test data.
+	testData := SlurmResponse{
+		Nodes: []SlurmNode{
+			{Name: "slurm-node-1", State: []string{"ALLOCATED"}},
+		},
+		Jobs: []SlurmJob{
+			{JobID: 1, JobState: "RUNNING"},
+		},
+	}
+
+	// Start the test server.
+	socketPath := "/tmp/test.sock"
+	cleanup, err := StartTestSlurmRestD(socketPath, testData)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	assert.NoError(t, UpdateSlurmNodeState(socketPath, "slurm-node-1", "DRAIN", "maintenance"))
+	nodes, err := ListSlurmNodes(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DRAIN"}, nodes[0].State)
+	assert.Equal(t, "maintenance", nodes[0].Reason)
+
+	// Signaled jobs keep running.
+	assert.NoError(t, SignalSlurmJob(socketPath, 1, "USR1"))
+	jobs, err := SyncSlurmJobs(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+}
+
+func TestRequeueSlurmJob(t *testing.T) {
+	testData := SlurmResponse{
+		Jobs: []SlurmJob{
+			{JobID: 1, JobState: "RUNNING", Nodes: "slurm-node-1"},
+		},
+	}
+	socketPath := "/tmp/test-requeue.sock"
+	cleanup, err := StartTestSlurmRestD(socketPath, testData)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer cleanup()
+
+	assert.NoError(t, RequeueSlurmJob(socketPath, 1))
+	jobs, err := SyncSlurmJobs(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "PENDING", jobs[0].JobState)
+	assert.Equal(t, 1, jobs[0].RestartCount)
+
+	assert.Error(t, RequeueSlurmJob(socketPath, 2))
+}
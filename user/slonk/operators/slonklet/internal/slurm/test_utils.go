@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // StartTestServer starts a Unix socket server for testing
@@ -22,9 +23,105 @@ func StartTestSlurmRestD(socketPath string, response SlurmResponse) (func(), err
 		return nil, err
 	}
 
+	// Requests are served concurrently, and update the nodes and jobs of the response.
+	var mu sync.Mutex
+	lastJobID := 0
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
 		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodDelete && r.URL.Query().Get("signal") != "" {
+			// Signalled jobs keep running.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/slurm/v0.0.40/node/") {
+			nodeName := strings.TrimPrefix(r.URL.Path, "/slurm/v0.0.40/node/")
+			update := struct {
+				State  []string `json:"state"`
+				Reason string   `json:"reason"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for i := range response.Nodes {
+				if response.Nodes[i].Name != nodeName {
+					continue
+				}
+				if len(update.State) > 0 && update.State[0] == "RESUME" {
+					response.Nodes[i].State = []string{"IDLE"}
+				} else {
+					response.Nodes[i].State = update.State
+				}
+				response.Nodes[i].Reason = update.Reason
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path != "/slurm/v0.0.40/job/submit" && strings.HasPrefix(r.URL.Path, "/slurm/v0.0.40/job/") {
+			jobID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/slurm/v0.0.40/job/"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			update := struct {
+				Requeue bool `json:"requeue"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			found := false
+			for i := range response.Jobs {
+				if response.Jobs[i].JobID != jobID {
+					continue
+				}
+				found = true
+				if update.Requeue {
+					// Requeued jobs wait for new nodes.
+					response.Jobs[i].JobState = "PENDING"
+					response.Jobs[i].Nodes = ""
+					response.Jobs[i].RestartCount++
+				}
+			}
+			if !found {
+				http.Error(w, "job not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/slurm/v0.0.40/job/submit" {
+			submission := struct {
+				Job struct {
+					Name          string   `json:"name"`
+					RequiredNodes []string `json:"required_nodes"`
+				} `json:"job"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// Submitted jobs are pending with the next job ID, never reused.
+			for _, job := range response.Jobs {
+				if job.JobID > lastJobID {
+					lastJobID = job.JobID
+				}
+			}
+			lastJobID++
+			jobID := lastJobID
+			response.Jobs = append(response.Jobs, SlurmJob{
+				JobID:    jobID,
+				Name:     submission.Job.Name,
+				JobState: "PENDING",
+				Nodes:    strings.Join(submission.Job.RequiredNodes, ","),
+			})
+			json.NewEncoder(w).Encode(map[string]int{"job_id": jobID})
+			return
+		}
 		if r.Method == http.MethodDelete {
 			// Extract jobID from the request URL.
 			jobID := strings.TrimPrefix(r.URL.Path, "/slurm/v0.0.40/job/")
@@ -0,0 +1,64 @@
+package slurm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LoadTopologyConf reads the leaf switch of every slurm node from a slurm topology.conf.
+func LoadTopologyConf(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open topology.conf: %w", err)
+	}
+	defer f.Close()
+	return ParseTopologyConf(f)
+}
+
+// ParseTopologyConf maps every slurm node to the switch, or block for the block topology
+// plugin, listing it in its Nodes. Switches of switches are ignored.
+func ParseTopologyConf(r io.Reader) (map[string]string, error) {
+	switchMap := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		switchName := ""
+		nodes := ""
+		for _, field := range strings.Fields(line) {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(key) {
+			case "switchname", "blockname":
+				switchName = value
+			case "nodes":
+				nodes = value
+			}
+		}
+		if switchName == "" || nodes == "" {
+			continue
+		}
+
+		nodeList, err := ParseJobNodeList(nodes)
+		if err != nil {
+			return nil, fmt.Errorf("parse nodes of %s on line %d: %w", switchName, lineNumber, err)
+		}
+		for _, node := range nodeList {
+			switchMap[node] = switchName
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read topology.conf: %w", err)
+	}
+	return switchMap, nil
+}
@@ -0,0 +1,33 @@
+package slurm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTopologyConf(t *testing.T) {
+	conf := `# Leaf switches.
+SwitchName=s0 Nodes=slurm-h100-[0-1] LinkSpeed=900
+SwitchName=s1 Nodes=slurm-h100-2,slurm-h100-3 # Second rack.
+SwitchName=spine Switches=s[0-1]
+
+BlockName=b0 Nodes=slurm-gb200-[0-3]
+`
+	switchMap, err := ParseTopologyConf(strings.NewReader(conf))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"slurm-h100-0":  "s0",
+		"slurm-h100-1":  "s0",
+		"slurm-h100-2":  "s1",
+		"slurm-h100-3":  "s1",
+		"slurm-gb200-0": "b0",
+		"slurm-gb200-1": "b0",
+		"slurm-gb200-2": "b0",
+		"slurm-gb200-3": "b0",
+	}, switchMap)
+
+	_, err = ParseTopologyConf(strings.NewReader("SwitchName=s0 Nodes=slurm-h100-[a-b]"))
+	assert.Error(t, err)
+}
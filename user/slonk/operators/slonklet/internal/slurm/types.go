@@ -4,6 +4,26 @@ const (
 	SLURMRESTD_SOCKET = "/etc/slurm/slurmrestd/slurmrestd.sock"
 )
 
+// Slurm job states by outcome, shared by the job conditions, node hunts and blame.
+var (
+	SLURM_JOB_RUNNING_STATES = map[string]bool{
+		"RUNNING":    true,
+		"COMPLETING": true,
+	}
+	SLURM_JOB_COMPLETED_STATES = map[string]bool{
+		"COMPLETED": true,
+	}
+	SLURM_JOB_FAILED_STATES = map[string]bool{
+		"FAILED":        true,
+		"TIMEOUT":       true,
+		"NODE_FAIL":     true,
+		"OUT_OF_MEMORY": true,
+		"BOOT_FAIL":     true,
+		"DEADLINE":      true,
+		"CANCELLED":     true,
+	}
+)
+
 type SlurmResponse struct {
 	Nodes        []SlurmNode   `json:"nodes,omitempty"`
 	LastBackfill *BackfillType `json:"last_backfill,omitempty"`
@@ -23,6 +43,7 @@ type SlurmNode struct {
 	Reason       string   `json:"reason"`
 	Comment      string   `json:"comment"`
 	Reservation  string   `json:"reservation"`
+	Partitions   []string `json:"partitions"`
 
 	Gres        string `json:"gres"`
 	GresDrained string `json:"gres_drained"`
@@ -71,6 +92,8 @@ type SlurmJob struct {
 	MemoryPerTRES string       `json:"memory_per_tres,omitempty"`
 	NodeCount     FlagType     `json:"node_count,omitempty"`
 	Partition     string       `json:"partition,omitempty"`
+	TresPerNode   string       `json:"tres_per_node,omitempty"`
+	TresReqStr    string       `json:"tres_req_str,omitempty"`
 	ResvName      string       `json:"resv_name,omitempty"`
 	Nodes         string       `json:"nodes,omitempty"`
 	JobResources  JobResources `json:"job_resources,omitempty"`
@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	EVICTION_RETRIES          = 3
+	EVICTION_RETRY_INTERVAL   = time.Second
+	EVICTION_ATTEMPT_EXPIRY   = 24 * time.Hour
+	DEFAULT_EVICTION_FALLBACK = 30 * time.Minute
+
+	EVICTION_RESULT_EVICTED     = "Evicted"
+	EVICTION_RESULT_DELETED     = "Deleted"
+	EVICTION_RESULT_BLOCKED     = "Blocked"
+	EVICTION_RESULT_SKIPPED     = "Skipped"
+	EVICTION_RESULT_TERMINATING = "Terminating"
+)
+
+// Evictor removes pods from a node through the eviction API, so PodDisruptionBudgets are
+// respected. Pods that stay blocked are retried on every call, and deleted once they have
+// been blocked for longer than the fallback timeout.
+type Evictor struct {
+	Client client.Client
+
+	// Pods blocked by a PodDisruptionBudget for longer than this are deleted. Zero never
+	// deletes them.
+	FallbackTimeout time.Duration
+	// Pods in these namespaces are never deleted, they wait for the eviction to succeed.
+	NoFallbackNamespaces map[string]bool
+	// Wait between retries of evictions rejected with 429 Too Many Requests.
+	RetryInterval time.Duration
+
+	mu sync.Mutex
+	// Pod UID -> time of the first eviction attempt.
+	firstAttempts map[types.UID]time.Time
+}
+
+func NewEvictor(cli client.Client, fallbackTimeout time.Duration, noFallbackNamespaces ...string) *Evictor {
+	evictor := &Evictor{
+		Client:               cli,
+		FallbackTimeout:      fallbackTimeout,
+		NoFallbackNamespaces: map[string]bool{},
+		RetryInterval:        EVICTION_RETRY_INTERVAL,
+		firstAttempts:        map[types.UID]time.Time{},
+	}
+	for _, namespace := range noFallbackNamespaces {
+		evictor.NoFallbackNamespaces[namespace] = true
+	}
+	return evictor
+}
+
+// EvictionResult maps "namespace/name" of each pod on the node to what happened to it.
+type EvictionResult map[string]string
+
+// Done returns whether no pod on the node is left to be removed.
+func (r EvictionResult) Done() bool {
+	for _, result := range r {
+		if result == EVICTION_RESULT_BLOCKED {
+			return false
+		}
+	}
+	return true
+}
+
+// EvictPodsOnNode evicts all pods on the k8s node, except DaemonSet and mirror pods.
+// Evictions blocked by a PodDisruptionBudget are not an error, the pod is reported as
+// blocked and should be retried later.
+func (e *Evictor) EvictPodsOnNode(
+	ctx context.Context,
+	podLists map[string]corev1.PodList,
+	k8sNodeName string,
+) (EvictionResult, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.firstAttempts == nil {
+		e.firstAttempts = map[types.UID]time.Time{}
+	}
+
+	now := time.Now()
+	for uid, firstAttempt := range e.firstAttempts {
+		if now.Sub(firstAttempt) > EVICTION_ATTEMPT_EXPIRY {
+			delete(e.firstAttempts, uid)
+		}
+	}
+
+	result := EvictionResult{}
+	for _, podList := range podLists {
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			if pod.Spec.NodeName != k8sNodeName {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+			if IsDaemonSetOrMirrorPod(pod) {
+				result[key] = EVICTION_RESULT_SKIPPED
+				continue
+			}
+			if pod.DeletionTimestamp != nil {
+				result[key] = EVICTION_RESULT_TERMINATING
+				continue
+			}
+
+			if _, ok := e.firstAttempts[pod.UID]; !ok {
+				e.firstAttempts[pod.UID] = now
+			}
+
+			err := e.evictPod(ctx, pod)
+			if err == nil || apierrors.IsNotFound(err) {
+				delete(e.firstAttempts, pod.UID)
+				result[key] = EVICTION_RESULT_EVICTED
+				continue
+			}
+			if !apierrors.IsTooManyRequests(err) {
+				return result, fmt.Errorf("evict pod %s: %w", key, err)
+			}
+
+			// Still blocked by a PodDisruptionBudget.
+			if e.FallbackTimeout <= 0 ||
+				e.NoFallbackNamespaces[pod.Namespace] ||
+				now.Sub(e.firstAttempts[pod.UID]) < e.FallbackTimeout {
+				result[key] = EVICTION_RESULT_BLOCKED
+				continue
+			}
+			if err := e.Client.Delete(ctx, pod, client.Preconditions{
+				UID: &pod.UID,
+			}); err != nil && !apierrors.IsNotFound(err) {
+				return result, fmt.Errorf("delete pod %s after eviction timeout: %w", key, err)
+			}
+			delete(e.firstAttempts, pod.UID)
+			result[key] = EVICTION_RESULT_DELETED
+		}
+	}
+
+	return result, nil
+}
+
+// evictPod creates an eviction for the pod, retrying while the API server responds with
+// 429 Too Many Requests.
+func (e *Evictor) evictPod(ctx context.Context, pod *corev1.Pod) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &pod.UID},
+		},
+	}
+
+	var err error
+	for attempt := 0; attempt < EVICTION_RETRIES; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(e.RetryInterval):
+			}
+		}
+		err = e.Client.SubResource("eviction").Create(ctx, pod.DeepCopy(), eviction)
+		if !apierrors.IsTooManyRequests(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// IsDaemonSetOrMirrorPod returns whether the pod is managed by a DaemonSet or the kubelet,
+// in which case it can't be drained from its node.
+func IsDaemonSetOrMirrorPod(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return true
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" && owner.Controller != nil && *owner.Controller {
+			return true
+		}
+	}
+	return false
+}
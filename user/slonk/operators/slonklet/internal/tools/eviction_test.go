@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func makePod(namespace string, name string, nodeName string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       types.UID(namespace + "-" + name),
+		},
+		Spec: corev1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func TestEvictPodsOnNode(t *testing.T) {
+	appPod := makePod("kube-system", "app", "node-1")
+	ingressPod := makePod("ingress-nginx", "controller", "node-1")
+	blockedPod := makePod("kube-system", "blocked", "node-1")
+	isController := true
+	daemonSetPod := makePod("kube-system", "ds", "node-1")
+	daemonSetPod.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "DaemonSet", Name: "ds", Controller: &isController},
+	}
+	mirrorPod := makePod("kube-system", "mirror", "node-1")
+	mirrorPod.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+	otherNodePod := makePod("kube-system", "other", "node-2")
+	pods := []corev1.Pod{appPod, ingressPod, blockedPod, daemonSetPod, mirrorPod, otherNodePod}
+
+	// Evictions of the ingress pod and the blocked pod violate their disruption budgets.
+	evictionCalls := map[string]int{}
+	fakeClient := clientFake.NewClientBuilder().
+		WithObjects(&appPod, &ingressPod, &blockedPod, &daemonSetPod, &mirrorPod, &otherNodePod).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+				evictionCalls[obj.GetName()]++
+				if obj.GetName() == "controller" || obj.GetName() == "blocked" {
+					return apierrors.NewTooManyRequests("disruption budget", 1)
+				}
+				return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+			},
+		}).
+		Build()
+
+	evictor := NewEvictor(fakeClient, time.Hour, "ingress-nginx")
+	evictor.RetryInterval = time.Millisecond
+	podLists := map[string]corev1.PodList{"all": {Items: pods}}
+
+	result, err := evictor.EvictPodsOnNode(context.Background(), podLists, "node-1")
+	assert.NoError(t, err)
+	assert.False(t, result.Done())
+	assert.Equal(t, EVICTION_RESULT_EVICTED, result["kube-system/app"])
+	assert.Equal(t, EVICTION_RESULT_BLOCKED, result["ingress-nginx/controller"])
+	assert.Equal(t, EVICTION_RESULT_BLOCKED, result["kube-system/blocked"])
+	assert.Equal(t, EVICTION_RESULT_SKIPPED, result["kube-system/ds"])
+	assert.Equal(t, EVICTION_RESULT_SKIPPED, result["kube-system/mirror"])
+	assert.Equal(t, 5, len(result))
+	// 429s are retried.
+	assert.Equal(t, EVICTION_RETRIES, evictionCalls["blocked"])
+
+	// After the fallback timeout blocked pods are deleted, except ingress pods.
+	evictor.firstAttempts[blockedPod.UID] = time.Now().Add(-2 * time.Hour)
+	evictor.firstAttempts[ingressPod.UID] = time.Now().Add(-2 * time.Hour)
+	result, err = evictor.EvictPodsOnNode(context.Background(), podLists, "node-1")
+	assert.NoError(t, err)
+	assert.Equal(t, EVICTION_RESULT_DELETED, result["kube-system/blocked"])
+	assert.Equal(t, EVICTION_RESULT_BLOCKED, result["ingress-nginx/controller"])
+
+	remaining := &corev1.PodList{}
+	assert.NoError(t, fakeClient.List(context.Background(), remaining))
+	names := []string{}
+	for _, pod := range remaining.Items {
+		names = append(names, pod.Name)
+	}
+	assert.ElementsMatch(t, []string{"controller", "ds", "mirror", "other"}, names)
+}
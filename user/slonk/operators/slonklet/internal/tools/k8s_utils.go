@@ -5,11 +5,51 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
-	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// Field manager of all writes by slonklet.
+	FIELD_OWNER = "slonklet"
+)
+
+// PatchNode changes the node with mutate, which returns whether it changed anything, and
+// writes the changes as a merge patch. Lists such as taints are replaced as a whole by merge
+// patches, so the patch only applies to the version of the node it was computed from. On a
+// conflict the latest node is fetched and mutate runs again, so changes made concurrently by
+// others are never overwritten. The node is updated in place.
+func PatchNode(
+	ctx context.Context,
+	cli client.Client,
+	node *corev1.Node,
+	mutate func(node *corev1.Node) bool,
+) (bool, error) {
+	changed := false
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := cli.Get(ctx, client.ObjectKeyFromObject(node), node); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		original := node.DeepCopy()
+		changed = mutate(node)
+		if !changed {
+			return nil
+		}
+		return cli.Patch(ctx, node, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}),
+			client.FieldOwner(FIELD_OWNER))
+	})
+	if err != nil {
+		return false, fmt.Errorf("patch node %s: %w", node.Name, err)
+	}
+	return changed, nil
+}
+
 // AddTaintToNode adds a new taint to a specific node.
 func MaybeAddTaintToNode(
 	ctx context.Context,
@@ -17,22 +57,20 @@ func MaybeAddTaintToNode(
 	node *corev1.Node,
 	taint corev1.Taint,
 ) (bool, error) {
-	exists := false
-	for _, nodeTaint := range node.Spec.Taints {
-		if nodeTaint.Key == taint.Key && nodeTaint.Value == taint.Value && nodeTaint.Effect == taint.Effect {
-			exists = true
-			break
+	added, err := PatchNode(ctx, cli, node, func(node *corev1.Node) bool {
+		for _, nodeTaint := range node.Spec.Taints {
+			if nodeTaint.Key == taint.Key && nodeTaint.Value == taint.Value && nodeTaint.Effect == taint.Effect {
+				return false
+			}
 		}
-	}
-
-	if !exists {
 		node.Spec.Taints = append(node.Spec.Taints, taint)
-		if err := cli.Update(ctx, node); err != nil {
-			return false, fmt.Errorf("update node taint: %w", err)
-		}
+		return true
+	})
+	if err != nil {
+		return false, fmt.Errorf("add node taint: %w", err)
 	}
 
-	return !exists, nil
+	return added, nil
 }
 
 func MaybeRemoveTaintFromNode(
@@ -41,22 +79,20 @@ func MaybeRemoveTaintFromNode(
 	node *corev1.Node,
 	taint corev1.Taint,
 ) (bool, error) {
-	exists := false
-	for i, nodeTaint := range node.Spec.Taints {
-		if nodeTaint.Key == taint.Key && nodeTaint.Value == taint.Value && nodeTaint.Effect == taint.Effect {
-			node.Spec.Taints = append(node.Spec.Taints[:i], node.Spec.Taints[i+1:]...)
-			exists = true
-			break
-		}
-	}
-
-	if exists {
-		if err := cli.Update(ctx, node); err != nil {
-			return false, fmt.Errorf("update node taint: %w", err)
+	removed, err := PatchNode(ctx, cli, node, func(node *corev1.Node) bool {
+		for i, nodeTaint := range node.Spec.Taints {
+			if nodeTaint.Key == taint.Key && nodeTaint.Value == taint.Value && nodeTaint.Effect == taint.Effect {
+				node.Spec.Taints = append(node.Spec.Taints[:i:i], node.Spec.Taints[i+1:]...)
+				return true
+			}
 		}
+		return false
+	})
+	if err != nil {
+		return false, fmt.Errorf("remove node taint: %w", err)
 	}
 
-	return exists, nil
+	return removed, nil
 }
 
 func DeletePodsOnNode(
@@ -83,29 +119,3 @@ func DeletePodsOnNode(
 
 	return deleted, nil
 }
-
-func MakeEvent(ref *v1.ObjectReference, annotations map[string]string, eventtype, reason, message string, sourceComponent string) *v1.Event {
-	t := metav1.Now()
-	namespace := ref.Namespace
-	if namespace == "" {
-		namespace = metav1.NamespaceDefault
-	}
-	return &v1.Event{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        fmt.Sprintf("%v.%x", ref.Name, t.UnixNano()),
-			Namespace:   namespace,
-			Annotations: annotations,
-		},
-		InvolvedObject:      *ref,
-		Reason:              reason,
-		Message:             message,
-		FirstTimestamp:      t,
-		LastTimestamp:       t,
-		Count:               1,
-		Type:                eventtype,
-		ReportingController: sourceComponent,
-		Source: v1.EventSource{
-			Component: sourceComponent,
-		},
-	}
-}
@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMaybeAddTaintToNodeKeepsConcurrentTaints(t *testing.T) {
+	gkeTaint := corev1.Taint{Key: "cloud.google.com/impending-node-termination", Effect: corev1.TaintEffectNoSchedule}
+	slonkTaint := corev1.Taint{Key: "slonk.your-org.com/drain", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+	fakeClient := clientFake.NewClientBuilder().
+		WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}).
+		Build()
+	ctx := context.Background()
+
+	// Listed earlier in the iteration, then tainted by someone else.
+	staleNode := &corev1.Node{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "node-1"}, staleNode))
+	latestNode := staleNode.DeepCopy()
+	latestNode.Spec.Taints = []corev1.Taint{gkeTaint}
+	assert.NoError(t, fakeClient.Update(ctx, latestNode))
+
+	added, err := MaybeAddTaintToNode(ctx, fakeClient, staleNode, slonkTaint)
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	node := &corev1.Node{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "node-1"}, node))
+	assert.Equal(t, []corev1.Taint{gkeTaint, slonkTaint}, node.Spec.Taints)
+
+	// Already there.
+	added, err = MaybeAddTaintToNode(ctx, fakeClient, node, slonkTaint)
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	removed, err := MaybeRemoveTaintFromNode(ctx, fakeClient, staleNode, slonkTaint)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "node-1"}, node))
+	assert.Equal(t, []corev1.Taint{gkeTaint}, node.Spec.Taints)
+}
@@ -0,0 +1,221 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+	"your-org.com/slonklet/internal/slurm"
+)
+
+const (
+	LABEL_ZONE              = "topology.kubernetes.io/zone"
+	LABEL_GKE_NODEPOOL      = "cloud.google.com/gke-nodepool"
+	LABEL_GCE_BLOCK         = "cloud.google.com/gce-topology-block"
+	LABEL_GKE_PLACEMENT     = "cloud.google.com/gke-placement-group"
+	LABEL_NVIDIA_GPU_CLIQUE = "nvidia.com/gpu.clique"
+)
+
+// Topology levels, in the JSON names of slonkv1.Topology.
+const (
+	LEVEL_ZONE             = "zone"
+	LEVEL_NODEPOOL         = "nodepool"
+	LEVEL_RACK             = "rack"
+	LEVEL_PLACEMENT_POLICY = "placementPolicy"
+	LEVEL_NVLINK_DOMAIN    = "nvlinkDomain"
+	LEVEL_SWITCH           = "switch"
+)
+
+// LEVELS lists the topology levels from the widest to the narrowest.
+var LEVELS = []string{
+	LEVEL_ZONE,
+	LEVEL_NODEPOOL,
+	LEVEL_PLACEMENT_POLICY,
+	LEVEL_RACK,
+	LEVEL_SWITCH,
+	LEVEL_NVLINK_DOMAIN,
+}
+
+// Source lists the k8s node labels and annotations a topology level is read from. The
+// first non-empty value wins, labels before annotations.
+type Source struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// Config tells the extractor where to find each topology level.
+type Config struct {
+	Zone            Source `json:"zone,omitempty"`
+	Nodepool        Source `json:"nodepool,omitempty"`
+	Rack            Source `json:"rack,omitempty"`
+	PlacementPolicy Source `json:"placementPolicy,omitempty"`
+	NVLinkDomain    Source `json:"nvlinkDomain,omitempty"`
+
+	// Path to a slurm topology.conf. The switch of a node is its leaf switch there.
+	SlurmTopologyConf string `json:"slurmTopologyConf,omitempty"`
+}
+
+// DefaultConfig returns the config used when none is given, reading the well-known GKE
+// and NVIDIA labels.
+func DefaultConfig() Config {
+	return Config{
+		Zone:            Source{Labels: []string{LABEL_ZONE}},
+		Nodepool:        Source{Labels: []string{LABEL_GKE_NODEPOOL}},
+		Rack:            Source{Labels: []string{LABEL_GCE_BLOCK}},
+		PlacementPolicy: Source{Labels: []string{LABEL_GKE_PLACEMENT}},
+		NVLinkDomain:    Source{Labels: []string{LABEL_NVIDIA_GPU_CLIQUE}},
+	}
+}
+
+// LoadConfig reads a config from a YAML or JSON file.
+func LoadConfig(path string) (Config, error) {
+	config := Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("read topology config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("decode topology config: %w", err)
+	}
+	return config, nil
+}
+
+// Extractor reads the topology of hosts. All methods are safe to call on a nil extractor,
+// in which case the default config is used.
+type Extractor struct {
+	config Config
+	// Slurm node name -> leaf switch, from topology.conf.
+	slurmSwitches map[string]string
+}
+
+func NewExtractor(config Config) (*Extractor, error) {
+	e := &Extractor{config: config, slurmSwitches: map[string]string{}}
+	if config.SlurmTopologyConf != "" {
+		slurmSwitches, err := slurm.LoadTopologyConf(config.SlurmTopologyConf)
+		if err != nil {
+			return nil, err
+		}
+		e.slurmSwitches = slurmSwitches
+	}
+	return e, nil
+}
+
+// Extract returns the topology of a host from its k8s node, either of which may be nil,
+// and its slurm node name. It returns nil if nothing is known about the host.
+func (e *Extractor) Extract(k8sNode *corev1.Node, slurmNodeName string) *slonkv1.Topology {
+	config := DefaultConfig()
+	slurmSwitches := map[string]string{}
+	if e != nil {
+		config = e.config
+		slurmSwitches = e.slurmSwitches
+	}
+
+	topology := &slonkv1.Topology{
+		Switch: slurmSwitches[slurmNodeName],
+	}
+	if k8sNode != nil {
+		topology.Zone = config.Zone.value(k8sNode)
+		topology.Nodepool = config.Nodepool.value(k8sNode)
+		topology.Rack = config.Rack.value(k8sNode)
+		topology.PlacementPolicy = config.PlacementPolicy.value(k8sNode)
+		topology.NVLinkDomain = config.NVLinkDomain.value(k8sNode)
+	}
+	if *topology == (slonkv1.Topology{}) {
+		return nil
+	}
+	return topology
+}
+
+// Merge returns the known topology updated with the non-empty levels of the fresh one, so
+// levels read from a node that is gone, e.g. the labels of a deleted k8s node, are kept.
+// It returns nil if both are nil.
+func Merge(known *slonkv1.Topology, fresh *slonkv1.Topology) *slonkv1.Topology {
+	if fresh == nil {
+		return known.DeepCopy()
+	}
+	merged := &slonkv1.Topology{}
+	if known != nil {
+		*merged = *known
+	}
+	merge := func(level *string, value string) {
+		if value != "" {
+			*level = value
+		}
+	}
+	merge(&merged.Zone, fresh.Zone)
+	merge(&merged.Nodepool, fresh.Nodepool)
+	merge(&merged.Rack, fresh.Rack)
+	merge(&merged.PlacementPolicy, fresh.PlacementPolicy)
+	merge(&merged.NVLinkDomain, fresh.NVLinkDomain)
+	merge(&merged.Switch, fresh.Switch)
+	return merged
+}
+
+func (s Source) value(k8sNode *corev1.Node) string {
+	for _, key := range s.Labels {
+		if value := k8sNode.Labels[key]; value != "" {
+			return value
+		}
+	}
+	for _, key := range s.Annotations {
+		if value := k8sNode.Annotations[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Value returns the value of a topology level, or an empty string for an unknown level.
+func Value(topology *slonkv1.Topology, level string) string {
+	if topology == nil {
+		return ""
+	}
+	switch level {
+	case LEVEL_ZONE:
+		return topology.Zone
+	case LEVEL_NODEPOOL:
+		return topology.Nodepool
+	case LEVEL_RACK:
+		return topology.Rack
+	case LEVEL_PLACEMENT_POLICY:
+		return topology.PlacementPolicy
+	case LEVEL_NVLINK_DOMAIN:
+		return topology.NVLinkDomain
+	case LEVEL_SWITCH:
+		return topology.Switch
+	}
+	return ""
+}
+
+// HealthCount counts the healthy and unhealthy hosts sharing a topology value.
+type HealthCount struct {
+	Healthy   int `json:"healthy"`
+	Unhealthy int `json:"unhealthy"`
+}
+
+// Summary maps a topology level to the health counts of each of its values.
+type Summary map[string]map[string]*HealthCount
+
+// Add counts a host in every topology level it is known at.
+func (s Summary) Add(topology *slonkv1.Topology, healthy bool) {
+	for _, level := range LEVELS {
+		value := Value(topology, level)
+		if value == "" {
+			continue
+		}
+		if s[level] == nil {
+			s[level] = map[string]*HealthCount{}
+		}
+		if s[level][value] == nil {
+			s[level][value] = &HealthCount{}
+		}
+		if healthy {
+			s[level][value].Healthy++
+		} else {
+			s[level][value].Unhealthy++
+		}
+	}
+}
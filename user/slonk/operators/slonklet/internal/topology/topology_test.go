@@ -0,0 +1,88 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	slonkv1 "your-org.com/slonklet/api/v1"
+)
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	topologyConf := filepath.Join(dir, "topology.conf")
+	assert.NoError(t, os.WriteFile(topologyConf, []byte("SwitchName=s0 Nodes=slurm-h100-[0-1]\n"), 0644))
+
+	config := DefaultConfig()
+	config.Rack = Source{Labels: []string{"example.com/rack"}, Annotations: []string{"example.com/rack"}}
+	config.SlurmTopologyConf = topologyConf
+	extractor, err := NewExtractor(config)
+	assert.NoError(t, err)
+
+	k8sNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "gke-h100-0",
+			Labels: map[string]string{
+				LABEL_ZONE:              "us-central1-a",
+				LABEL_GKE_NODEPOOL:      "h100",
+				LABEL_NVIDIA_GPU_CLIQUE: "clique-0",
+			},
+			Annotations: map[string]string{"example.com/rack": "rack-7"},
+		},
+	}
+	assert.Equal(t, &slonkv1.Topology{
+		Zone:         "us-central1-a",
+		Nodepool:     "h100",
+		Rack:         "rack-7",
+		NVLinkDomain: "clique-0",
+		Switch:       "s0",
+	}, extractor.Extract(k8sNode, "slurm-h100-1"))
+
+	// Without a k8s node only the switch is known.
+	assert.Equal(t, &slonkv1.Topology{Switch: "s0"}, extractor.Extract(nil, "slurm-h100-0"))
+	assert.Nil(t, extractor.Extract(nil, "slurm-h100-9"))
+
+	// A nil extractor reads the default labels.
+	var nilExtractor *Extractor
+	assert.Equal(t, &slonkv1.Topology{
+		Zone:         "us-central1-a",
+		Nodepool:     "h100",
+		NVLinkDomain: "clique-0",
+	}, nilExtractor.Extract(k8sNode, "slurm-h100-1"))
+}
+
+func TestMerge(t *testing.T) {
+	known := &slonkv1.Topology{Zone: "us-central1-a", Rack: "rack-7", Switch: "s0"}
+
+	// Only the switch is known without the k8s node, the rest is kept.
+	assert.Equal(t, known, Merge(known, &slonkv1.Topology{Switch: "s0"}))
+	assert.Equal(t, &slonkv1.Topology{Zone: "us-central1-a", Rack: "rack-8", Switch: "s1"},
+		Merge(known, &slonkv1.Topology{Rack: "rack-8", Switch: "s1"}))
+	assert.Equal(t, known, Merge(known, nil))
+	assert.Equal(t, &slonkv1.Topology{Switch: "s0"}, Merge(nil, &slonkv1.Topology{Switch: "s0"}))
+	assert.Nil(t, Merge(nil, nil))
+	assert.Equal(t, &slonkv1.Topology{Zone: "us-central1-a", Rack: "rack-7", Switch: "s0"}, known)
+}
+
+func TestSummary(t *testing.T) {
+	summary := Summary{}
+	summary.Add(&slonkv1.Topology{Zone: "a", Rack: "r0"}, true)
+	summary.Add(&slonkv1.Topology{Zone: "a", Rack: "r1"}, false)
+	summary.Add(&slonkv1.Topology{Zone: "b", Rack: "r0"}, true)
+	summary.Add(nil, false)
+
+	assert.Equal(t, Summary{
+		LEVEL_ZONE: {
+			"a": {Healthy: 1, Unhealthy: 1},
+			"b": {Healthy: 1},
+		},
+		LEVEL_RACK: {
+			"r0": {Healthy: 2},
+			"r1": {Unhealthy: 1},
+		},
+	}, summary)
+}